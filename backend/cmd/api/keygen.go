@@ -0,0 +1,30 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// runKeygenCommand implements "api keygen": it prints a new Ed25519 private
+// key in PEM form, ready to be listed in JWT_KEY_FILES.
+//
+// To rotate, put the new key first in JWT_KEY_FILES and keep the old one
+// after it until the last access token it signed has expired.
+func runKeygenCommand() int {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	pem.Encode(os.Stdout, &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return 0
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"backend/internal/database"
+	"backend/internal/jobs"
+	"backend/internal/progression"
+	"backend/internal/store/postgres"
+	"context"
+	"fmt"
+	"os"
+)
+
+const recomputeLevelsUsage = `Usage: api recompute-levels
+
+Recomputes every user's XP and level from their test results and
+achievements under the rules in data/progression.json and pays the level
+rewards they reached. Run it once after changing the rules; running it
+again changes nothing.`
+
+// runRecomputeLevelsCommand implements "api recompute-levels" and returns the process exit code.
+func runRecomputeLevelsCommand(args []string) int {
+	if len(args) != 0 {
+		fmt.Println(recomputeLevelsUsage)
+		return 2
+	}
+
+	cfg, err := progression.Load(progression.Path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if err := database.Connect(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer database.DB.Close()
+
+	n, err := jobs.RecomputeLevels(context.Background(), postgres.New(database.DB), cfg)
+	fmt.Printf("Updated %d users\n", n)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
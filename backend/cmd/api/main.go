@@ -1,22 +1,109 @@
 package main
 
 import (
+	"backend/internal/achievements"
+	"backend/internal/admob"
+	"backend/internal/appenv"
+	"backend/internal/authtoken"
 	"backend/internal/database"
+	"backend/internal/handlers"
+	"backend/internal/iap"
+	"backend/internal/identity"
+	"backend/internal/jobs"
+	"backend/internal/leaderboard"
+	"backend/internal/progression"
+	"backend/internal/ratelimit"
 	"backend/internal/routes"
+	"backend/internal/store/postgres"
+	"context"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
+	_ "time/tzdata" // user timezones must resolve in minimal containers
 )
 
 // Build Version: 1.0.2
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrateCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "merge-users" {
+		os.Exit(runMergeCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "recompute-levels" {
+		os.Exit(runRecomputeLevelsCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "keygen" {
+		os.Exit(runKeygenCommand())
+	}
+
 	fmt.Println("DEBUG: Backend starting... v1.0.3")
-	// Initialize Database
-	database.InitDB()
+	env, err := appenv.Parse(os.Getenv("APP_ENV"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	tokens, err := authtoken.FromEnv()
+	if err != nil {
+		log.Fatalf("Loading JWT keys failed: %v", err)
+	}
+
+	// Initialize Database (refuses to serve if migrations fail)
+	if err := database.InitDB(); err != nil {
+		log.Fatalf("Database initialization failed: %v", err)
+	}
 	defer database.DB.Close()
 
+	srv := handlers.NewServer(postgres.New(database.DB), tokens)
+	srv.Env = env
+	srv.SyncContent = database.SyncQuestions
+	srv.Identity = identity.FromEnv()
+	if url := os.Getenv("VERIFY_EMAIL_URL"); url != "" {
+		srv.VerifyEmailURL = url
+	}
+	if v := os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD"); v != "" {
+		grace, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid ACCOUNT_DELETION_GRACE_PERIOD %q: %v", v, err)
+		}
+		srv.DeletionGracePeriod = grace
+	}
+
+	if srv.IAP, err = iap.FromEnv(); err != nil {
+		log.Fatalf("In-app purchase configuration failed: %v", err)
+	}
+	srv.AdMob = admob.FromEnv()
+	if srv.Achievements, err = achievements.Load(achievements.Path); err != nil {
+		log.Fatalf("Loading achievements failed: %v", err)
+	}
+	if srv.Progression, err = progression.Load(progression.Path); err != nil {
+		log.Fatalf("Loading progression rules failed: %v", err)
+	}
+	if v := os.Getenv("AD_REWARD_DAILY_CAP"); v != "" {
+		if srv.AdRewardDailyCap, err = strconv.Atoi(v); err != nil {
+			log.Fatalf("Invalid AD_REWARD_DAILY_CAP %q: %v", v, err)
+		}
+	}
+
+	if srv.Limiter, err = ratelimit.FromEnv(); err != nil {
+		log.Fatalf("Rate limiter configuration failed: %v", err)
+	}
+	if srv.Store.Leaderboards, err = leaderboard.RanksFromEnv(srv.Store.Leaderboards); err != nil {
+		log.Fatalf("Leaderboard configuration failed: %v", err)
+	}
+
+	jobs.Start(context.Background(),
+		jobs.PurgeDeletedAccounts(srv.Store),
+		jobs.ExpireSubscriptions(srv.Store, srv.IAP.Check),
+		jobs.CloseLeagueWeeks(srv.Store),
+		jobs.PruneLeaderboards(srv.Store),
+		jobs.PruneNonces(srv.Store),
+	)
+
 	// Register Routes
-	mux := routes.RegisterRoutes()
+	mux := routes.RegisterRoutes(srv)
 
 	// Start Server
 	port := os.Getenv("PORT")
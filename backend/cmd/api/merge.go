@@ -0,0 +1,54 @@
+package main
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"backend/internal/progression"
+	"backend/internal/store/postgres"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const mergeUsage = `Usage: api merge-users <keep-id> <absorb-id>
+
+Moves the second account's results, identities, XP and tokens into the first
+and deletes the second. Use it for support requests where the user can't
+prove ownership of both accounts in the app.`
+
+// runMergeCommand implements "api merge-users ..." and returns the process exit code.
+func runMergeCommand(args []string) int {
+	if len(args) != 2 {
+		fmt.Println(mergeUsage)
+		return 2
+	}
+
+	cfg, err := progression.Load(progression.Path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if err := database.Connect(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer database.DB.Close()
+
+	ctx := context.Background()
+	st := postgres.New(database.DB)
+	report, err := st.Users.Merge(ctx, args[0], args[1], cfg.Curve)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	out, _ := json.MarshalIndent(report, "", "  ")
+	// Recorded without an actor: the command runs outside any admin session
+	entry := models.AuditEntry{Action: "user.merge", TargetType: "user", TargetID: args[0],
+		Before: json.RawMessage(fmt.Sprintf(`{"absorbed_id":%q}`, args[1])), After: out}
+	if err := st.Audit.Append(ctx, &entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: recording audit entry: %v\n", err)
+	}
+	fmt.Println(string(out))
+	return 0
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"backend/internal/database"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const migrateUsage = `Usage: api migrate <command>
+
+Commands:
+  up          apply all pending migrations
+  down [n]    roll back the last n migrations (default 1)
+  status      list migrations and when they were applied`
+
+// runMigrateCommand implements "api migrate ..." and returns the process exit code.
+func runMigrateCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Println(migrateUsage)
+		return 2
+	}
+
+	if err := database.Connect(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer database.DB.Close()
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		ran, err := database.Migrate(ctx)
+		for _, m := range ran {
+			fmt.Printf("applied  %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if len(ran) == 0 {
+			fmt.Println("Schema is up to date.")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, "Error: n must be a positive integer")
+				return 2
+			}
+			steps = n
+		}
+		reverted, err := database.Rollback(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+
+	case "status":
+		states, err := database.MigrationStatus(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		for _, s := range states {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, applied)
+		}
+
+	default:
+		fmt.Println(migrateUsage)
+		return 2
+	}
+	return 0
+}
@@ -7,4 +7,17 @@ require (
 	github.com/lib/pq v1.10.9
 )
 
-require github.com/golang-jwt/jwt/v5 v5.3.0
+require (
+	github.com/golang-jwt/jwt/v5 v5.3.0
+	github.com/redis/go-redis/v9 v9.7.3
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+)
+
+require (
+	golang.org/x/crypto v0.40.0
+	golang.org/x/sys v0.34.0 // indirect
+)
@@ -0,0 +1,134 @@
+// Package achievements holds the badge rules defined in data/achievements.json.
+// Every achievement watches one metric of the user's activity and is earned
+// once the metric reaches its target; earning it pays XP and tokens.
+package achievements
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// Path is where the definitions live, relative to the working directory.
+const Path = "data/achievements.json"
+
+// Metric is a number that grows with the user's activity.
+type Metric string
+
+const (
+	TestsCompleted      Metric = "tests_completed"      // distinct tests with a result
+	Streak              Metric = "streak"               // current practice streak in days
+	CategoriesCompleted Metric = "categories_completed" // categories with every test completed
+	PerfectScores       Metric = "perfect_scores"       // distinct tests finished without a mistake
+	QuestionsAnswered   Metric = "questions_answered"   // questions in the distinct tests finished
+
+	// Level is the user's level. Only the badges of level rewards watch it,
+	// so no event moves it and the catalog can't use it.
+	Level Metric = "level"
+)
+
+// Event is something the user did that can move metrics.
+type Event string
+
+const (
+	TestCompleted Event = "test_completed"
+)
+
+// eventMetrics lists the metrics each event can move. Only achievements on
+// these metrics are evaluated when the event happens.
+var eventMetrics = map[Event][]Metric{
+	TestCompleted: {TestsCompleted, Streak, CategoriesCompleted, PerfectScores, QuestionsAnswered},
+}
+
+// Stats is the current value of each metric for one user.
+type Stats map[Metric]int
+
+// Definition is one achievement.
+type Definition struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+	Metric      Metric `json:"metric"`
+	Target      int    `json:"target"`
+	XP          int    `json:"xp"`
+	Tokens      int    `json:"tokens"`
+}
+
+// Catalog is the validated list of achievements, in display order.
+type Catalog struct {
+	Version      int          `json:"version"`
+	Achievements []Definition `json:"achievements"`
+}
+
+var idPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Load reads and validates the catalog at path.
+func Load(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// New returns a catalog of defs, validated as Load does.
+func New(defs []Definition) (*Catalog, error) {
+	c := &Catalog{Version: 1, Achievements: defs}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Catalog) validate() error {
+	known := map[Metric]bool{}
+	for _, metrics := range eventMetrics {
+		for _, m := range metrics {
+			known[m] = true
+		}
+	}
+	seen := map[string]bool{}
+	for _, d := range c.Achievements {
+		switch {
+		case !idPattern.MatchString(d.ID):
+			return fmt.Errorf("achievement %q: id must be a lowercase slug", d.ID)
+		case seen[d.ID]:
+			return fmt.Errorf("achievement %q: duplicate id", d.ID)
+		case d.Name == "":
+			return fmt.Errorf("achievement %q: name is required", d.ID)
+		case !known[d.Metric]:
+			return fmt.Errorf("achievement %q: unknown metric %q", d.ID, d.Metric)
+		case d.Target <= 0:
+			return fmt.Errorf("achievement %q: target must be positive", d.ID)
+		case d.XP < 0 || d.Tokens < 0:
+			return fmt.Errorf("achievement %q: rewards can't be negative", d.ID)
+		}
+		seen[d.ID] = true
+	}
+	return nil
+}
+
+// Unlocked returns the achievements that event can award and stats reach,
+// skipping those in earned.
+func (c *Catalog) Unlocked(event Event, stats Stats, earned map[string]bool) []Definition {
+	moved := map[Metric]bool{}
+	for _, m := range eventMetrics[event] {
+		moved[m] = true
+	}
+	var list []Definition
+	for _, d := range c.Achievements {
+		if moved[d.Metric] && !earned[d.ID] && stats[d.Metric] >= d.Target {
+			list = append(list, d)
+		}
+	}
+	return list
+}
@@ -0,0 +1,52 @@
+package achievements_test
+
+import (
+	"backend/internal/achievements"
+	"testing"
+)
+
+// The bundled definitions are loaded at startup, so a broken file must fail here first.
+func TestBundledDefinitions(t *testing.T) {
+	c, err := achievements.Load("../../" + achievements.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Achievements) == 0 {
+		t.Fatal("no achievements defined")
+	}
+}
+
+func TestValidation(t *testing.T) {
+	cases := map[string]achievements.Definition{
+		"bad id":         {ID: "First Test", Name: "x", Metric: achievements.TestsCompleted, Target: 1},
+		"unknown metric": {ID: "x", Name: "x", Metric: "logins", Target: 1},
+		"no target":      {ID: "x", Name: "x", Metric: achievements.Streak},
+		"negative xp":    {ID: "x", Name: "x", Metric: achievements.Streak, Target: 1, XP: -1},
+	}
+	for name, d := range cases {
+		if _, err := achievements.New([]achievements.Definition{d}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	dup := achievements.Definition{ID: "x", Name: "x", Metric: achievements.Streak, Target: 1}
+	if _, err := achievements.New([]achievements.Definition{dup, dup}); err == nil {
+		t.Error("duplicate ids: expected an error")
+	}
+}
+
+func TestUnlocked(t *testing.T) {
+	c, err := achievements.New([]achievements.Definition{
+		{ID: "first-test", Name: "a", Metric: achievements.TestsCompleted, Target: 1},
+		{ID: "ten-tests", Name: "b", Metric: achievements.TestsCompleted, Target: 10},
+		{ID: "streak-7", Name: "c", Metric: achievements.Streak, Target: 7},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := achievements.Stats{achievements.TestsCompleted: 3, achievements.Streak: 7}
+
+	got := c.Unlocked(achievements.TestCompleted, stats, map[string]bool{"streak-7": true})
+	if len(got) != 1 || got[0].ID != "first-test" {
+		t.Fatalf("unexpected unlocks: %+v", got)
+	}
+}
@@ -0,0 +1,134 @@
+// Package admob verifies AdMob server-side verification (SSV) callbacks, so
+// rewarded ad views are credited on Google's word rather than the client's.
+package admob
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VerifierKeysURL publishes the keys AdMob signs callbacks with.
+const VerifierKeysURL = "https://www.gstatic.com/admob/reward/verifier-keys.json"
+
+var (
+	ErrInvalidSignature = errors.New("invalid SSV signature")
+	// ErrUnknownAdUnit means a genuine callback is for an ad unit that isn't
+	// ours, e.g. another app's ad unit pointed at our callback URL.
+	ErrUnknownAdUnit = errors.New("unknown ad unit")
+)
+
+// Reward is a verified callback for one completed rewarded ad view.
+type Reward struct {
+	TransactionID string
+	AdNetwork     string
+	AdUnit        string
+	// CustomData is set by the app when it loads the ad; ours carries the user ID.
+	CustomData   string
+	UserID       string // the ad SDK's user identifier, not ours
+	RewardItem   string
+	RewardAmount int
+	Timestamp    time.Time
+}
+
+type Verifier struct {
+	Keys *KeySet
+	// AdUnits are the rewarded ad units callbacks are accepted for. An ad
+	// unit belongs to one app, so this also pins the app. Without any,
+	// every callback is refused.
+	AdUnits []string
+}
+
+func NewVerifier(keysURL string, adUnits ...string) *Verifier {
+	return &Verifier{Keys: NewKeySet(keysURL), AdUnits: adUnits}
+}
+
+// FromEnv builds a verifier from ADMOB_VERIFIER_KEYS_URL, falling back to
+// Google's key server, and ADMOB_AD_UNITS, a comma separated list of our
+// rewarded ad unit IDs (full "ca-app-pub-…/…" IDs or the part after the slash).
+func FromEnv() *Verifier {
+	keysURL := os.Getenv("ADMOB_VERIFIER_KEYS_URL")
+	if keysURL == "" {
+		keysURL = VerifierKeysURL
+	}
+	var adUnits []string
+	for _, unit := range strings.Split(os.Getenv("ADMOB_AD_UNITS"), ",") {
+		if unit = strings.TrimSpace(unit); unit != "" {
+			adUnits = append(adUnits, unit)
+		}
+	}
+	return NewVerifier(keysURL, adUnits...)
+}
+
+// knownAdUnit reports whether the ad_unit of a callback, which is the part
+// of the ad unit ID after the slash, is one of v.AdUnits.
+func (v *Verifier) knownAdUnit(adUnit string) bool {
+	if adUnit == "" {
+		return false
+	}
+	for _, unit := range v.AdUnits {
+		if _, id, ok := strings.Cut(unit, "/"); ok {
+			unit = id
+		}
+		if unit == adUnit {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify checks the signature of a callback's raw query string and that it is
+// for one of v.AdUnits. AdMob signs everything before the signature
+// parameter, which is followed only by key_id.
+func (v *Verifier) Verify(ctx context.Context, rawQuery string) (*Reward, error) {
+	i := strings.Index(rawQuery, "&signature=")
+	if i < 0 {
+		return nil, fmt.Errorf("%w: missing signature", ErrInvalidSignature)
+	}
+	message := rawQuery[:i]
+
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(params.Get("signature"), "="))
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidSignature)
+	}
+	key, err := v.Keys.Key(ctx, params.Get("key_id"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	digest := sha256.Sum256([]byte(message))
+	if !ecdsa.VerifyASN1(key, digest[:], sig) {
+		return nil, ErrInvalidSignature
+	}
+
+	r := &Reward{
+		TransactionID: params.Get("transaction_id"),
+		AdNetwork:     params.Get("ad_network"),
+		AdUnit:        params.Get("ad_unit"),
+		CustomData:    params.Get("custom_data"),
+		UserID:        params.Get("user_id"),
+		RewardItem:    params.Get("reward_item"),
+	}
+	if r.TransactionID == "" {
+		return nil, fmt.Errorf("%w: missing transaction_id", ErrInvalidSignature)
+	}
+	if !v.knownAdUnit(r.AdUnit) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownAdUnit, r.AdUnit)
+	}
+	r.RewardAmount, _ = strconv.Atoi(params.Get("reward_amount"))
+	if ms, err := strconv.ParseInt(params.Get("timestamp"), 10, 64); err == nil {
+		r.Timestamp = time.UnixMilli(ms)
+	}
+	return r, nil
+}
@@ -0,0 +1,87 @@
+package admob_test
+
+import (
+	"backend/internal/admob"
+	"backend/internal/admob/admobtest"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newVerifier(ks *admobtest.KeyServer) *admob.Verifier {
+	v := admob.NewVerifier(ks.URL, "ca-app-pub-3940256099942544/"+admobtest.AdUnit)
+	v.Keys.MinRefreshInterval = 0
+	return v
+}
+
+func TestVerifyAcceptsSignedCallback(t *testing.T) {
+	ks := admobtest.NewKeyServer(t)
+	r, err := newVerifier(ks).Verify(context.Background(), ks.Callback(t, "tx-1", "user 1"))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if r.TransactionID != "tx-1" || r.CustomData != "user 1" || r.RewardAmount != 5 || r.Timestamp.IsZero() {
+		t.Fatalf("unexpected reward: %+v", r)
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	ks := admobtest.NewKeyServer(t)
+	v := newVerifier(ks)
+	raw := ks.Callback(t, "tx-1", "user-1")
+
+	cases := map[string]string{
+		"other user":        strings.Replace(raw, "custom_data=user-1", "custom_data=user-2", 1),
+		"no signature":      raw[:strings.Index(raw, "&signature=")],
+		"garbled signature": strings.Replace(raw, "&signature=", "&signature=AA", 1),
+		"unknown key":       raw[:strings.Index(raw, "&key_id=")] + "&key_id=1",
+	}
+	for name, query := range cases {
+		if _, err := v.Verify(context.Background(), query); !errors.Is(err, admob.ErrInvalidSignature) {
+			t.Errorf("%s: err = %v, want ErrInvalidSignature", name, err)
+		}
+	}
+}
+
+func TestVerifyChecksAdUnit(t *testing.T) {
+	ks := admobtest.NewKeyServer(t)
+	v := newVerifier(ks)
+
+	// Bare ad unit IDs are accepted in the allowlist too
+	if _, err := admob.NewVerifier(ks.URL, admobtest.AdUnit).Verify(context.Background(), ks.Callback(t, "tx-1", "u")); err != nil {
+		t.Fatalf("bare ad unit: %v", err)
+	}
+	// Genuinely signed, but for someone else's ad unit
+	ks.AdUnit = "9999999999"
+	if _, err := v.Verify(context.Background(), ks.Callback(t, "tx-2", "u")); !errors.Is(err, admob.ErrUnknownAdUnit) {
+		t.Fatalf("other ad unit: err = %v, want ErrUnknownAdUnit", err)
+	}
+	// Nothing is accepted until ad units are configured
+	ks.AdUnit = admobtest.AdUnit
+	if _, err := admob.NewVerifier(ks.URL).Verify(context.Background(), ks.Callback(t, "tx-3", "u")); !errors.Is(err, admob.ErrUnknownAdUnit) {
+		t.Fatalf("no ad units: err = %v, want ErrUnknownAdUnit", err)
+	}
+}
+
+func TestKeysAreCachedUntilRotation(t *testing.T) {
+	ks := admobtest.NewKeyServer(t)
+	v := newVerifier(ks)
+
+	for i := 0; i < 3; i++ {
+		if _, err := v.Verify(context.Background(), ks.Callback(t, "tx", "u")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := ks.Fetches.Load(); n != 1 {
+		t.Fatalf("fetched keys %d times, want 1", n)
+	}
+
+	ks.Rotate(t)
+	if _, err := v.Verify(context.Background(), ks.Callback(t, "tx", "u")); err != nil {
+		t.Fatalf("rotated key: %v", err)
+	}
+	if n := ks.Fetches.Load(); n != 2 {
+		t.Fatalf("fetched keys %d times, want 2", n)
+	}
+}
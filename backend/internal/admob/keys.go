@@ -0,0 +1,130 @@
+package admob
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// keyTTL follows Google's advice to cache the verifier keys for a day.
+	keyTTL = 24 * time.Hour
+	// defaultMinRefresh limits refetches triggered by unknown key IDs, so
+	// forged callbacks can't turn into a stream of requests to Google.
+	defaultMinRefresh = time.Minute
+)
+
+var errUnknownKey = errors.New("unknown signing key")
+
+// KeySet fetches and caches the ECDSA keys published at the verifier keys
+// URL. Keys are refreshed daily and when a callback names a key ID that isn't
+// cached yet.
+type KeySet struct {
+	URL                string
+	Client             *http.Client
+	MinRefreshInterval time.Duration
+
+	mu          sync.Mutex
+	keys        map[string]*ecdsa.PublicKey
+	expires     time.Time
+	lastFetched time.Time
+}
+
+func NewKeySet(url string) *KeySet {
+	return &KeySet{
+		URL:                url,
+		Client:             &http.Client{Timeout: 10 * time.Second},
+		MinRefreshInterval: defaultMinRefresh,
+	}
+}
+
+// Key returns the public key with the given key ID.
+func (ks *KeySet) Key(ctx context.Context, id string) (*ecdsa.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := time.Now()
+	key, ok := ks.keys[id]
+	if ok && now.Before(ks.expires) {
+		return key, nil
+	}
+	if !ks.lastFetched.IsZero() && now.Sub(ks.lastFetched) < ks.MinRefreshInterval {
+		if ok {
+			return key, nil
+		}
+		return nil, errUnknownKey
+	}
+
+	if err := ks.refresh(ctx); err != nil {
+		// Keep serving cached keys if Google is briefly unreachable
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+	if key, ok = ks.keys[id]; !ok {
+		return nil, errUnknownKey
+	}
+	return key, nil
+}
+
+// refresh replaces the cached keys. Callers hold ks.mu.
+func (ks *KeySet) refresh(ctx context.Context) error {
+	ks.lastFetched = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := ks.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching verifier keys: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching verifier keys: %s returned %s", ks.URL, resp.Status)
+	}
+
+	var doc struct {
+		Keys []struct {
+			KeyID  json.Number `json:"keyId"`
+			Base64 string      `json:"base64"` // DER-encoded SubjectPublicKeyInfo
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("decoding verifier keys: %w", err)
+	}
+
+	keys := map[string]*ecdsa.PublicKey{}
+	for _, k := range doc.Keys {
+		if _, err := strconv.ParseInt(k.KeyID.String(), 10, 64); err != nil {
+			continue
+		}
+		der, err := base64.StdEncoding.DecodeString(k.Base64)
+		if err != nil {
+			continue
+		}
+		pub, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			continue
+		}
+		if ec, ok := pub.(*ecdsa.PublicKey); ok {
+			keys[k.KeyID.String()] = ec
+		}
+	}
+	if len(keys) == 0 {
+		return errors.New("verifier keys contain no usable ECDSA keys")
+	}
+
+	ks.keys = keys
+	ks.expires = time.Now().Add(keyTTL)
+	return nil
+}
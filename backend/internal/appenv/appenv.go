@@ -0,0 +1,39 @@
+// Package appenv tells which environment the API runs in. It is read from
+// APP_ENV: "development", "staging" or "production" (the default). Debug
+// routes and shortcuts only open when development is asked for by name, so
+// a deploy that doesn't set APP_ENV runs as production.
+package appenv
+
+import (
+	"fmt"
+	"os"
+)
+
+type Env string
+
+const (
+	Development Env = "development"
+	Staging     Env = "staging"
+	Production  Env = "production"
+)
+
+// Current returns the environment named by APP_ENV. Unknown values count as
+// production so that a typo never opens up development-only routes.
+func Current() Env {
+	env, err := Parse(os.Getenv("APP_ENV"))
+	if err != nil {
+		return Production
+	}
+	return env
+}
+
+// Parse validates an environment name; empty means Production.
+func Parse(name string) (Env, error) {
+	switch Env(name) {
+	case "", Production:
+		return Production, nil
+	case Development, Staging:
+		return Env(name), nil
+	}
+	return "", fmt.Errorf("unknown APP_ENV %q", name)
+}
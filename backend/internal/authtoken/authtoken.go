@@ -0,0 +1,204 @@
+// Package authtoken issues and parses the access tokens the API hands out.
+// Tokens are signed with an asymmetric key (Ed25519 or RSA) named by the kid
+// header; older keys can stay configured for verification so that rotating
+// the signing key doesn't sign anyone out. Every piece of code that reads a
+// bearer token goes through an Issuer.
+package authtoken
+
+import (
+	"backend/internal/appenv"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// AccessTTL is the lifetime of an access token. Long-lived sign-in is
+// carried by the session's refresh token instead.
+const AccessTTL = 15 * time.Minute
+
+// TypeAccess is the typ claim of access tokens; tokens without it are rejected.
+const TypeAccess = "access"
+
+// TypeConfirm is the typ claim of confirmation tokens, which authorize one
+// destructive action and can't be used as access tokens.
+const TypeConfirm = "confirm"
+
+var (
+	// ErrNoToken means the request carried no bearer token.
+	ErrNoToken      = errors.New("no bearer token")
+	ErrInvalidToken = errors.New("invalid access token")
+	// ErrNoKeys is returned by FromEnv in production when no keys are configured.
+	ErrNoKeys = errors.New("JWT_KEY_FILES must be set in production")
+)
+
+type Claims struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"sid,omitempty"`
+	Type      string `json:"typ"`
+	// Action names what a confirmation token allows.
+	Action string `json:"act,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Issuer signs access tokens with one key and verifies them against every
+// configured key.
+type Issuer struct {
+	signing *Key
+	keys    map[string]*Key
+	ordered []*Key // signing key first, for the JWKS document
+}
+
+// NewIssuer signs with signing and additionally accepts tokens signed by
+// any of verifyOnly, typically keys that were recently rotated out.
+func NewIssuer(signing *Key, verifyOnly ...*Key) (*Issuer, error) {
+	if signing == nil || !signing.CanSign() {
+		return nil, errors.New("signing key must include its private key")
+	}
+	i := &Issuer{signing: signing, keys: map[string]*Key{}}
+	for _, k := range append([]*Key{signing}, verifyOnly...) {
+		if _, dup := i.keys[k.ID]; dup {
+			continue
+		}
+		i.keys[k.ID] = k
+		i.ordered = append(i.ordered, k)
+	}
+	return i, nil
+}
+
+// FromEnv loads keys from JWT_KEY_FILES, a comma separated list of PEM files.
+// The first file must hold a private key and is used for signing; the rest
+// may be public keys kept for verification during a rotation.
+//
+// Without JWT_KEY_FILES an ephemeral key is generated, so tokens don't
+// survive a restart. That is refused in production, which is also what an
+// unset APP_ENV means.
+func FromEnv() (*Issuer, error) {
+	var keys []*Key
+	for _, path := range strings.Split(os.Getenv("JWT_KEY_FILES"), ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParseKeyPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		if appenv.Current() == appenv.Production {
+			return nil, ErrNoKeys
+		}
+		log.Printf("JWT_KEY_FILES is not set; using an ephemeral signing key (tokens won't survive a restart)")
+		key, err := GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return NewIssuer(keys[0], keys[1:]...)
+}
+
+// Issue returns an access token for the user's session.
+func (i *Issuer) Issue(userID, sessionID string) (string, error) {
+	return i.sign(&Claims{UserID: userID, SessionID: sessionID, Type: TypeAccess}, AccessTTL)
+}
+
+// IssueConfirmation returns a token that lets userID perform action within
+// ttl, and its claims. Handlers hand it out with a preview of a destructive
+// operation and require it back to carry the operation out. The token's ID
+// (jti) is unique, so callers can record it and accept the token only once.
+func (i *Issuer) IssueConfirmation(userID, action string, ttl time.Duration) (string, *Claims, error) {
+	claims := &Claims{UserID: userID, Type: TypeConfirm, Action: action}
+	claims.ID = uuid.NewString()
+	raw, err := i.sign(claims, ttl)
+	return raw, claims, err
+}
+
+func (i *Issuer) sign(claims *Claims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	token := jwt.NewWithClaims(i.signing.method(), claims)
+	token.Header["kid"] = i.signing.ID
+	return token.SignedString(i.signing.private)
+}
+
+// Parse verifies an access token and returns its claims.
+func (i *Issuer) Parse(raw string) (*Claims, error) {
+	claims, err := i.verify(raw)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != TypeAccess || claims.UserID == "" {
+		return nil, fmt.Errorf("%w: not an access token", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// CheckConfirmation verifies that raw is a confirmation token for userID and
+// action and returns its claims. It doesn't know whether the token was used
+// before; that is up to the caller, by its ID.
+func (i *Issuer) CheckConfirmation(raw, userID, action string) (*Claims, error) {
+	claims, err := i.verify(raw)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != TypeConfirm || claims.UserID != userID || claims.Action != action || claims.ID == "" {
+		return nil, fmt.Errorf("%w: not a confirmation of %s", ErrInvalidToken, action)
+	}
+	return claims, nil
+}
+
+// verify checks the signature and expiry of raw.
+func (i *Issuer) verify(raw string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := i.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		// The algorithm is fixed by the key, never chosen by the token
+		if t.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("key %q does not sign %s", kid, t.Method.Alg())
+		}
+		return key.public, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+// FromRequest parses the bearer token in the Authorization header.
+func (i *Issuer) FromRequest(r *http.Request) (*Claims, error) {
+	scheme, raw, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || raw == "" {
+		return nil, ErrNoToken
+	}
+	return i.Parse(raw)
+}
+
+// JWKS returns the public verification keys, signing key first.
+func (i *Issuer) JWKS() []JWK {
+	keys := make([]JWK, 0, len(i.ordered))
+	for _, k := range i.ordered {
+		keys = append(keys, k.JWK())
+	}
+	return keys
+}
@@ -0,0 +1,201 @@
+package authtoken
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func mustIssuer(t *testing.T, signing *Key, verifyOnly ...*Key) *Issuer {
+	t.Helper()
+	i, err := NewIssuer(signing, verifyOnly...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return i
+}
+
+func rsaKey(t *testing.T) *Key {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestIssueAndParse(t *testing.T) {
+	ed, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []*Key{ed, rsaKey(t)} {
+		t.Run(key.Algorithm, func(t *testing.T) {
+			i := mustIssuer(t, key)
+			raw, err := i.Issue("user-1", "session-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := i.Parse(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.UserID != "user-1" || claims.SessionID != "session-1" || claims.Type != TypeAccess {
+				t.Fatalf("unexpected claims: %+v", claims)
+			}
+			if ttl := time.Until(claims.ExpiresAt.Time); ttl > AccessTTL || ttl < AccessTTL-time.Minute {
+				t.Fatalf("expiry %v, want about %v", ttl, AccessTTL)
+			}
+		})
+	}
+}
+
+func TestRotationKeepsOldTokensValid(t *testing.T) {
+	oldKey, _ := GenerateKey()
+	newKey, _ := GenerateKey()
+
+	before, _ := mustIssuer(t, oldKey).Issue("user-1", "")
+
+	// After rotation only the public half of the old key is kept
+	oldPublic, err := newKeyFromPublic(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := mustIssuer(t, newKey, oldPublic)
+	if _, err := rotated.Parse(before); err != nil {
+		t.Fatalf("token from the previous key should still verify: %v", err)
+	}
+	if jwks := rotated.JWKS(); len(jwks) != 2 || jwks[0].Kid != newKey.ID {
+		t.Fatalf("JWKS should list the signing key first: %+v", jwks)
+	}
+
+	// Once the old key is dropped its tokens stop working
+	if _, err := mustIssuer(t, newKey).Parse(before); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("err = %v, want ErrInvalidToken", err)
+	}
+	if _, err := NewIssuer(oldPublic); err == nil {
+		t.Fatal("a public key must not be accepted as the signing key")
+	}
+}
+
+func newKeyFromPublic(k *Key) (*Key, error) {
+	der, err := x509.MarshalPKIXPublicKey(k.public)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func TestParseRejectsForgedTokens(t *testing.T) {
+	key := rsaKey(t)
+	i := mustIssuer(t, key)
+	claims := jwt.MapClaims{"user_id": "user-1", "typ": TypeAccess, "exp": time.Now().Add(time.Hour).Unix()}
+
+	// HS256 signed with the public key bytes (algorithm confusion)
+	der, _ := x509.MarshalPKIXPublicKey(key.public)
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	hs.Header["kid"] = key.ID
+	forged, _ := hs.SignedString(der)
+
+	other, _ := GenerateKey()
+	stranger, _ := mustIssuer(t, other).Issue("user-1", "")
+
+	noType := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"user_id": "user-1", "exp": claims["exp"]})
+	noType.Header["kid"] = key.ID
+	untyped, _ := noType.SignedString(key.private)
+
+	expired := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"user_id": "user-1", "typ": TypeAccess, "exp": time.Now().Add(-time.Hour).Unix()})
+	expired.Header["kid"] = key.ID
+	stale, _ := expired.SignedString(key.private)
+
+	for name, raw := range map[string]string{"alg confusion": forged, "unknown key": stranger, "no type": untyped, "expired": stale, "garbage": "a.b.c"} {
+		if _, err := i.Parse(raw); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: err = %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
+
+func TestConfirmationTokens(t *testing.T) {
+	key, _ := GenerateKey()
+	i := mustIssuer(t, key)
+
+	confirm, issued, err := i.IssueConfirmation("u1", "content.sync.clean", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := i.CheckConfirmation(confirm, "u1", "content.sync.clean")
+	if err != nil {
+		t.Fatalf("valid confirmation rejected: %v", err)
+	}
+	// Each token has its own ID, for callers to accept it once
+	_, other, _ := i.IssueConfirmation("u1", "content.sync.clean", time.Minute)
+	if claims.ID == "" || claims.ID != issued.ID || other.ID == issued.ID {
+		t.Fatalf("unexpected token IDs: %q, %q, %q", claims.ID, issued.ID, other.ID)
+	}
+	if _, err := i.CheckConfirmation(confirm, "u2", "content.sync.clean"); err == nil {
+		t.Fatal("confirmation accepted for another user")
+	}
+	if _, err := i.CheckConfirmation(confirm, "u1", "users.purge"); err == nil {
+		t.Fatal("confirmation accepted for another action")
+	}
+	if _, err := i.Parse(confirm); err == nil {
+		t.Fatal("confirmation token accepted as an access token")
+	}
+
+	access, _ := i.Issue("u1", "")
+	if _, err := i.CheckConfirmation(access, "u1", ""); err == nil {
+		t.Fatal("access token accepted as a confirmation")
+	}
+	expired, _, _ := i.IssueConfirmation("u1", "content.sync.clean", -time.Minute)
+	if _, err := i.CheckConfirmation(expired, "u1", "content.sync.clean"); err == nil {
+		t.Fatal("expired confirmation accepted")
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := GenerateKey()
+	der, _ := x509.MarshalPKCS8PrivateKey(key.private)
+	path := filepath.Join(dir, "signing.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("APP_ENV", "production")
+	t.Setenv("JWT_KEY_FILES", "")
+	if _, err := FromEnv(); !errors.Is(err, ErrNoKeys) {
+		t.Fatalf("err = %v, want ErrNoKeys", err)
+	}
+
+	t.Setenv("APP_ENV", "")
+	if _, err := FromEnv(); !errors.Is(err, ErrNoKeys) {
+		t.Fatalf("an unset APP_ENV should refuse an ephemeral key: %v", err)
+	}
+
+	t.Setenv("JWT_KEY_FILES", path)
+	i, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jwks := i.JWKS(); len(jwks) != 1 || jwks[0].Kid != key.ID {
+		t.Fatalf("unexpected keys: %+v", jwks)
+	}
+
+	t.Setenv("APP_ENV", "development")
+	t.Setenv("JWT_KEY_FILES", "")
+	if _, err := FromEnv(); err != nil {
+		t.Fatalf("development should fall back to an ephemeral key: %v", err)
+	}
+}
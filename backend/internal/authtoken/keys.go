@@ -0,0 +1,154 @@
+package authtoken
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSABits is the smallest RSA modulus accepted for signing or verification.
+const minRSABits = 2048
+
+// Key is a signing key pair, or just the public half of a retired key that
+// is kept around so tokens it signed stay valid until they expire.
+type Key struct {
+	// ID is the RFC 7638 thumbprint of the public key, sent as the kid header.
+	ID        string
+	Algorithm string // "EdDSA" or "RS256"
+
+	private crypto.Signer // nil for verification-only keys
+	public  crypto.PublicKey
+}
+
+// GenerateKey creates a new Ed25519 signing key.
+func GenerateKey() (*Key, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newKey(priv)
+}
+
+// ParseKeyPEM reads a PKCS#8 or PKCS#1 private key, or a PKIX public key for
+// verification only. Ed25519 and RSA (2048 bits or more) are supported.
+func ParseKeyPEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newKey(parsed)
+}
+
+func newKey(k any) (*Key, error) {
+	key := &Key{}
+	switch k := k.(type) {
+	case ed25519.PrivateKey:
+		key.private, key.public = k, k.Public()
+	case *rsa.PrivateKey:
+		key.private, key.public = k, k.Public()
+	case ed25519.PublicKey, *rsa.PublicKey:
+		key.public = k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", k)
+	}
+
+	switch pub := key.public.(type) {
+	case ed25519.PublicKey:
+		key.Algorithm = jwt.SigningMethodEdDSA.Alg()
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA key is %d bits, need at least %d", pub.N.BitLen(), minRSABits)
+		}
+		key.Algorithm = jwt.SigningMethodRS256.Alg()
+	}
+	key.ID = thumbprint(key.JWK())
+	return key, nil
+}
+
+// CanSign reports whether the key has its private half.
+func (k *Key) CanSign() bool {
+	return k.private != nil
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	if k.Algorithm == jwt.SigningMethodEdDSA.Alg() {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWK returns the public half of the key.
+func (k *Key) JWK() JWK {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Algorithm}
+	switch pub := k.public.(type) {
+	case ed25519.PublicKey:
+		jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	}
+	return jwk
+}
+
+// thumbprint computes the RFC 7638 thumbprint: the SHA-256 of the required
+// members in lexicographic order.
+func thumbprint(jwk JWK) string {
+	var members any
+	if jwk.Kty == "OKP" {
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	} else {
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	}
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,184 @@
+package content
+
+import (
+	"backend/internal/models"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// ManifestPath is where the content manifest lives, relative to the working directory.
+const ManifestPath = "data/manifest.json"
+
+// QuestionsDir holds the question files referenced by the manifest.
+const QuestionsDir = "data/questions"
+
+// Manifest declares every exam and category served by the app, the question
+// files that feed each category and the tests built from those questions.
+type Manifest struct {
+	Version    int        `json:"version"`
+	Exams      []Exam     `json:"exams"`
+	Categories []Category `json:"categories"`
+}
+
+// Exam is a top-level product line, e.g. an ÖABT branch or a KPSS section.
+type Exam struct {
+	Slug  string `json:"slug"`
+	Name  string `json:"name"`
+	Order int    `json:"order"`
+}
+
+// Category is a single entry in the manifest. Slug is the stable identifier used
+// by the database and API; Name is the display name with proper Turkish casing.
+// Exam is the slug of the exam the category belongs to.
+type Category struct {
+	Slug  string   `json:"slug"`
+	Name  string   `json:"name"`
+	Icon  string   `json:"icon"`
+	Order int      `json:"order"`
+	Exam  string   `json:"exam"`
+	Files []string `json:"files"`
+	// LegacyNames are category names previously derived from file names, used to
+	// adopt rows that were seeded before the manifest existed.
+	LegacyNames []string `json:"legacy_names,omitempty"`
+	Tests       []Test   `json:"tests"`
+}
+
+// Test defines a test either by an explicit list of question IDs or by a
+// selection rule applied to the category's questions in file order.
+type Test struct {
+	Slug             string   `json:"slug"`
+	Title            string   `json:"title"`
+	Description      string   `json:"description,omitempty"`
+	LegacyTitle      string   `json:"legacy_title,omitempty"`
+	TimeLimitMinutes int      `json:"time_limit_minutes"`
+	QuestionIDs      []string `json:"question_ids,omitempty"`
+	Select           *Rule    `json:"select,omitempty"`
+}
+
+// Rule selects questions matching every non-empty filter, then applies Offset and Limit.
+type Rule struct {
+	Subject    string `json:"subject,omitempty"`
+	Topic      string `json:"topic,omitempty"`
+	Difficulty string `json:"difficulty,omitempty"`
+	Offset     int    `json:"offset,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// LoadManifest reads and validates the manifest at path.
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// Validate checks that slugs are well formed and unique, that every category
+// belongs to a declared exam and that every file and test belongs to exactly
+// one category.
+func (m *Manifest) Validate() error {
+	examSlugs := map[string]bool{}
+	categorySlugs := map[string]bool{}
+	testSlugs := map[string]bool{}
+	files := map[string]string{}
+
+	for _, e := range m.Exams {
+		if !slugPattern.MatchString(e.Slug) {
+			return fmt.Errorf("exam %q: invalid slug", e.Slug)
+		}
+		if examSlugs[e.Slug] {
+			return fmt.Errorf("exam %q: duplicate slug", e.Slug)
+		}
+		if e.Name == "" {
+			return fmt.Errorf("exam %q: name is required", e.Slug)
+		}
+		examSlugs[e.Slug] = true
+	}
+
+	for _, c := range m.Categories {
+		if !slugPattern.MatchString(c.Slug) {
+			return fmt.Errorf("category %q: invalid slug", c.Slug)
+		}
+		if categorySlugs[c.Slug] {
+			return fmt.Errorf("category %q: duplicate slug", c.Slug)
+		}
+		categorySlugs[c.Slug] = true
+
+		if c.Name == "" {
+			return fmt.Errorf("category %q: name is required", c.Slug)
+		}
+		if !examSlugs[c.Exam] {
+			return fmt.Errorf("category %q: unknown exam %q", c.Slug, c.Exam)
+		}
+		if len(c.Files) == 0 {
+			return fmt.Errorf("category %q: at least one file is required", c.Slug)
+		}
+		for _, f := range c.Files {
+			if owner, ok := files[f]; ok {
+				return fmt.Errorf("file %q is listed by both %q and %q", f, owner, c.Slug)
+			}
+			files[f] = c.Slug
+		}
+
+		for _, t := range c.Tests {
+			if !slugPattern.MatchString(t.Slug) {
+				return fmt.Errorf("test %q: invalid slug", t.Slug)
+			}
+			if testSlugs[t.Slug] {
+				return fmt.Errorf("test %q: duplicate slug", t.Slug)
+			}
+			testSlugs[t.Slug] = true
+
+			if t.Title == "" {
+				return fmt.Errorf("test %q: title is required", t.Slug)
+			}
+			if (len(t.QuestionIDs) == 0) == (t.Select == nil) {
+				return fmt.Errorf("test %q: exactly one of question_ids or select is required", t.Slug)
+			}
+		}
+	}
+	return nil
+}
+
+// Pick returns the question IDs the test selects from the category's questions,
+// which must be given in manifest file order.
+func (t Test) Pick(questions []models.Question) []string {
+	if len(t.QuestionIDs) > 0 {
+		return t.QuestionIDs
+	}
+
+	matched := []string{}
+	for _, q := range questions {
+		if t.Select.Subject != "" && q.Subject != t.Select.Subject {
+			continue
+		}
+		if t.Select.Topic != "" && q.Topic != t.Select.Topic {
+			continue
+		}
+		if t.Select.Difficulty != "" && q.Difficulty != t.Select.Difficulty {
+			continue
+		}
+		matched = append(matched, q.QuestionID)
+	}
+
+	if t.Select.Offset >= len(matched) {
+		return []string{}
+	}
+	matched = matched[t.Select.Offset:]
+	if t.Select.Limit > 0 && t.Select.Limit < len(matched) {
+		matched = matched[:t.Select.Limit]
+	}
+	return matched
+}
@@ -0,0 +1,37 @@
+package content
+
+import (
+	"strings"
+	"unicode"
+)
+
+var turkishFold = strings.NewReplacer(
+	"ç", "c", "Ç", "c",
+	"ğ", "g", "Ğ", "g",
+	"ı", "i", "I", "i", "İ", "i",
+	"ö", "o", "Ö", "o",
+	"ş", "s", "Ş", "s",
+	"ü", "u", "Ü", "u",
+	"â", "a", "Â", "a",
+	"î", "i", "Î", "i",
+	"û", "u", "Û", "u",
+)
+
+// Slugify turns a Turkish display name into a stable ASCII slug,
+// e.g. "Özel Eğitimde Değerlendirme" -> "ozel-egitimde-degerlendirme".
+func Slugify(name string) string {
+	folded := turkishFold.Replace(name)
+
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(folded) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
@@ -0,0 +1,97 @@
+// Package credentials hashes and checks the secrets local accounts sign in
+// with: argon2id for user-chosen passwords and SHA-256 for the random device
+// secrets and email tokens the server generates itself.
+package credentials
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// MinPasswordLength is the shortest password accepted for a local account.
+const MinPasswordLength = 8
+
+// Params are the argon2id cost parameters stored alongside each hash, so they
+// can be raised later without invalidating existing passwords.
+type Params struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultParams follow the OWASP recommendation for argon2id.
+var DefaultParams = Params{Memory: 64 * 1024, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+
+var ErrMalformedHash = errors.New("malformed password hash")
+
+// HashPassword returns an encoded argon2id hash in the PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func HashPassword(password string) (string, error) {
+	p := DefaultParams
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// CheckPassword reports whether password matches an encoded argon2id hash.
+func CheckPassword(password, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, ErrMalformedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrMalformedHash
+	}
+	var p Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return false, ErrMalformedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+
+	got := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+// NewSecret returns a random 256-bit secret for the client and the hash to store.
+func NewSecret() (raw, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	raw = base64.RawURLEncoding.EncodeToString(b)
+	return raw, HashSecret(raw), nil
+}
+
+// HashSecret hashes a server-generated secret. These have full entropy, so
+// a fast hash is enough and lets them be looked up by hash.
+func HashSecret(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// SecretMatches compares raw against a stored hash in constant time.
+func SecretMatches(raw, hash string) bool {
+	return hash != "" && subtle.ConstantTimeCompare([]byte(HashSecret(raw)), []byte(hash)) == 1
+}
@@ -0,0 +1,39 @@
+package credentials
+
+import "testing"
+
+func TestPasswordRoundTrip(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if ok, err := CheckPassword("correct horse", hash); err != nil || !ok {
+		t.Fatalf("CheckPassword(correct) = %v, %v", ok, err)
+	}
+	if ok, _ := CheckPassword("wrong horse", hash); ok {
+		t.Fatal("CheckPassword accepted a wrong password")
+	}
+
+	other, _ := HashPassword("correct horse")
+	if other == hash {
+		t.Fatal("hashes of the same password should use different salts")
+	}
+}
+
+func TestCheckPasswordRejectsMalformedHash(t *testing.T) {
+	for _, encoded := range []string{"", "plain", "$argon2i$v=19$m=1,t=1,p=1$c2FsdA$a2V5", "$argon2id$v=19$m=x$c2FsdA$a2V5"} {
+		if _, err := CheckPassword("pw", encoded); err != ErrMalformedHash {
+			t.Errorf("CheckPassword(%q) err = %v, want ErrMalformedHash", encoded, err)
+		}
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	raw, hash, err := NewSecret()
+	if err != nil {
+		t.Fatalf("NewSecret: %v", err)
+	}
+	if !SecretMatches(raw, hash) || SecretMatches(raw+"x", hash) || SecretMatches(raw, "") {
+		t.Fatal("SecretMatches gave the wrong answer")
+	}
+}
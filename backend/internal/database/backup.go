@@ -0,0 +1,35 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// snapshotTables are the tables a content operation can change. test_results
+// is included so a snapshot is consistent with the questions it points to.
+var snapshotTables = []string{"categories", "tests", "questions", "test_results"}
+
+// Snapshot copies snapshotTables into the backups schema inside tx, so the
+// copy sees exactly the state the operation starts from, and returns the
+// snapshot name. To restore, copy the rows of backups.<table>_<name> back
+// into <table>.
+func Snapshot(tx *sql.Tx, reason string) (string, error) {
+	name := time.Now().UTC().Format("20060102_150405") + "_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:6]
+	for _, table := range snapshotTables {
+		copyName := pq.QuoteIdentifier(table + "_" + name)
+		if _, err := tx.Exec(fmt.Sprintf("CREATE TABLE backups.%s AS TABLE %s", copyName, pq.QuoteIdentifier(table))); err != nil {
+			return "", fmt.Errorf("copying %s: %w", table, err)
+		}
+	}
+	_, err := tx.Exec("INSERT INTO backup_snapshots (name, reason, tables) VALUES ($1, $2, $3)",
+		name, reason, pq.Array(snapshotTables))
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
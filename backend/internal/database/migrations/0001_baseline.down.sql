@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS related_subjects;
+DROP TABLE IF EXISTS subjects;
+DROP TABLE IF EXISTS test_results;
+DROP TABLE IF EXISTS questions;
+DROP TABLE IF EXISTS tests;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,93 @@
+-- Baseline schema. Written with IF NOT EXISTS so databases created by the old
+-- boot-time CreateTables converge to the same state.
+
+CREATE TABLE IF NOT EXISTS users (
+	id UUID PRIMARY KEY,
+	nickname TEXT UNIQUE NOT NULL,
+	emoji TEXT NOT NULL,
+	streak INTEGER DEFAULT 0,
+	last_active_date DATE,
+	total_score INTEGER DEFAULT 0,
+	level INTEGER DEFAULT 1,
+	xp INTEGER DEFAULT 0,
+	email TEXT UNIQUE,
+	google_id TEXT UNIQUE,
+	apple_id TEXT UNIQUE,
+	provider TEXT DEFAULT 'local',
+	role TEXT DEFAULT 'free',
+	tokens INTEGER DEFAULT 0,
+	is_premium BOOLEAN DEFAULT FALSE
+);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS level INTEGER DEFAULT 1;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS xp INTEGER DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email TEXT UNIQUE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS google_id TEXT UNIQUE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS apple_id TEXT UNIQUE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS provider TEXT DEFAULT 'local';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT DEFAULT 'free';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens INTEGER DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_premium BOOLEAN DEFAULT FALSE;
+-- Case-insensitive uniqueness for emails and uniqueness for provider IDs
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users(LOWER(email)) WHERE email IS NOT NULL AND email != '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_google_id ON users(google_id) WHERE google_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_apple_id ON users(apple_id) WHERE apple_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS tests (
+	id UUID PRIMARY KEY,
+	title TEXT NOT NULL,
+	description TEXT,
+	category TEXT
+);
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS category TEXT;
+
+CREATE TABLE IF NOT EXISTS questions (
+	id UUID PRIMARY KEY,
+	test_id UUID REFERENCES tests(id),
+	question_id TEXT,
+	category TEXT,
+	subject TEXT,
+	topic TEXT,
+	sub_topic TEXT,
+	difficulty TEXT,
+	skill_level TEXT,
+	text TEXT NOT NULL,
+	options JSONB NOT NULL,
+	solution JSONB,
+	metadata JSONB,
+	image_url TEXT,
+	related_concept_id TEXT
+);
+ALTER TABLE questions DROP COLUMN IF EXISTS correct_answer;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS question_id TEXT;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS category TEXT;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS subject TEXT;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS topic TEXT;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS sub_topic TEXT;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS difficulty TEXT;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS skill_level TEXT;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS solution JSONB;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS metadata JSONB;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS image_url TEXT;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS related_concept_id TEXT;
+
+CREATE TABLE IF NOT EXISTS test_results (
+	id UUID PRIMARY KEY,
+	user_id UUID REFERENCES users(id),
+	test_id UUID REFERENCES tests(id),
+	score INTEGER,
+	completed_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS subjects (
+	id UUID PRIMARY KEY,
+	title TEXT UNIQUE NOT NULL,
+	weight TEXT NOT NULL,
+	category TEXT NOT NULL,
+	content TEXT
+);
+
+CREATE TABLE IF NOT EXISTS related_subjects (
+	subject_id UUID REFERENCES subjects(id) ON DELETE CASCADE,
+	related_subject_id UUID REFERENCES subjects(id) ON DELETE CASCADE,
+	PRIMARY KEY (subject_id, related_subject_id)
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_questions_category_question_id;
+ALTER TABLE questions DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE questions DROP COLUMN IF EXISTS retired_at;
+ALTER TABLE questions DROP COLUMN IF EXISTS content_hash;
+ALTER TABLE questions DROP COLUMN IF EXISTS source_file;
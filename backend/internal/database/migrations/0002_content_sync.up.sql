@@ -0,0 +1,6 @@
+-- Bookkeeping for the hash-based question sync
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS source_file TEXT;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS content_hash TEXT;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS retired_at TIMESTAMP;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_questions_category_question_id ON questions(category, question_id);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_questions_category_slug_question_id;
+ALTER TABLE questions DROP COLUMN IF EXISTS category_slug;
+ALTER TABLE tests DROP COLUMN IF EXISTS sort_order;
+ALTER TABLE tests DROP COLUMN IF EXISTS time_limit_minutes;
+ALTER TABLE tests DROP COLUMN IF EXISTS category_slug;
+ALTER TABLE tests DROP COLUMN IF EXISTS slug;
+DROP TABLE IF EXISTS categories;
@@ -0,0 +1,15 @@
+-- Manifest-driven categories and tests
+CREATE TABLE IF NOT EXISTS categories (
+	id UUID PRIMARY KEY,
+	slug TEXT UNIQUE NOT NULL,
+	name TEXT NOT NULL,
+	icon TEXT,
+	sort_order INTEGER DEFAULT 0,
+	exam TEXT
+);
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS slug TEXT UNIQUE;
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS category_slug TEXT;
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS time_limit_minutes INTEGER;
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS sort_order INTEGER;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS category_slug TEXT;
+CREATE INDEX IF NOT EXISTS idx_questions_category_slug_question_id ON questions(category_slug, question_id);
@@ -0,0 +1,15 @@
+DROP INDEX IF EXISTS idx_tests_exam_id;
+DROP INDEX IF EXISTS idx_questions_category_id;
+ALTER TABLE users DROP COLUMN IF EXISTS selected_exam_id;
+ALTER TABLE subjects DROP COLUMN IF EXISTS exam_id;
+ALTER TABLE tests DROP COLUMN IF EXISTS category_id;
+ALTER TABLE tests DROP COLUMN IF EXISTS exam_id;
+ALTER TABLE questions DROP COLUMN IF EXISTS topic_id;
+ALTER TABLE questions DROP COLUMN IF EXISTS subject_id;
+ALTER TABLE questions DROP COLUMN IF EXISTS category_id;
+DROP TABLE IF EXISTS taxonomy_topics;
+DROP TABLE IF EXISTS taxonomy_subjects;
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS exam TEXT;
+UPDATE categories c SET exam = e.slug FROM exams e WHERE e.id = c.exam_id;
+ALTER TABLE categories DROP COLUMN IF EXISTS exam_id;
+DROP TABLE IF EXISTS exams;
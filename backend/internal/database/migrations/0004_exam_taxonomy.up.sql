@@ -0,0 +1,35 @@
+-- Exam taxonomy: exams -> categories -> subjects -> topics. Free-text values
+-- are linked to these tables by database.BackfillTaxonomy on boot.
+CREATE TABLE IF NOT EXISTS exams (
+	id UUID PRIMARY KEY,
+	slug TEXT UNIQUE NOT NULL,
+	name TEXT NOT NULL,
+	sort_order INTEGER DEFAULT 0
+);
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS exam_id UUID REFERENCES exams(id);
+ALTER TABLE categories DROP COLUMN IF EXISTS exam;
+
+CREATE TABLE IF NOT EXISTS taxonomy_subjects (
+	id UUID PRIMARY KEY,
+	category_id UUID NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+	slug TEXT NOT NULL,
+	name TEXT NOT NULL,
+	UNIQUE (category_id, slug)
+);
+CREATE TABLE IF NOT EXISTS taxonomy_topics (
+	id UUID PRIMARY KEY,
+	subject_id UUID NOT NULL REFERENCES taxonomy_subjects(id) ON DELETE CASCADE,
+	slug TEXT NOT NULL,
+	name TEXT NOT NULL,
+	UNIQUE (subject_id, slug)
+);
+
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS category_id UUID REFERENCES categories(id);
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS subject_id UUID REFERENCES taxonomy_subjects(id);
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS topic_id UUID REFERENCES taxonomy_topics(id);
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS exam_id UUID REFERENCES exams(id);
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS category_id UUID REFERENCES categories(id);
+ALTER TABLE subjects ADD COLUMN IF NOT EXISTS exam_id UUID REFERENCES exams(id);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS selected_exam_id UUID REFERENCES exams(id);
+CREATE INDEX IF NOT EXISTS idx_questions_category_id ON questions(category_id);
+CREATE INDEX IF NOT EXISTS idx_tests_exam_id ON tests(exam_id);
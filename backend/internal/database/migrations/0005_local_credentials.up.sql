@@ -0,0 +1,19 @@
+-- Real credentials for local accounts: a device-bound secret issued at
+-- registration and an optional email + password with verification.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS device_secret_hash TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP;
+
+-- Only a hash of each emailed token is stored
+CREATE TABLE IF NOT EXISTS email_verifications (
+	token_hash TEXT PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	email TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_email_verifications_user ON email_verifications(user_id);
+
+-- Emails on social accounts came from the provider and count as verified
+UPDATE users SET email_verified_at = NOW()
+WHERE email IS NOT NULL AND email_verified_at IS NULL AND (google_id IS NOT NULL OR apple_id IS NOT NULL);
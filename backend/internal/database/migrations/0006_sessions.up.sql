@@ -0,0 +1,23 @@
+-- One row per signed-in device. Refresh tokens are opaque and only their
+-- hashes are stored; rotated tokens are kept (used_at set) so that a replay
+-- of an old token can be detected and the whole session revoked.
+CREATE TABLE IF NOT EXISTS sessions (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	device_name TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	last_used_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	token_hash TEXT PRIMARY KEY,
+	session_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	used_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session ON refresh_tokens(session_id);
@@ -0,0 +1,7 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS google_id TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS apple_id TEXT;
+UPDATE users u SET google_id = i.subject FROM user_identities i WHERE i.user_id = u.id AND i.provider = 'google';
+UPDATE users u SET apple_id = i.subject FROM user_identities i WHERE i.user_id = u.id AND i.provider = 'apple';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_google_id ON users(google_id) WHERE google_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_apple_id ON users(apple_id) WHERE apple_id IS NOT NULL;
+DROP TABLE IF EXISTS user_identities;
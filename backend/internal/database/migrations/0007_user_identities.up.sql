@@ -0,0 +1,24 @@
+-- Sign-in providers move from one column per provider on users to a table,
+-- so an account can link several of them (and new providers need no schema
+-- change). An account has at most one identity per provider.
+CREATE TABLE IF NOT EXISTS user_identities (
+	provider TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	email TEXT NOT NULL DEFAULT '',
+	linked_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (provider, subject),
+	UNIQUE (user_id, provider)
+);
+
+INSERT INTO user_identities (provider, subject, user_id, email)
+SELECT 'google', google_id, id, COALESCE(email, '') FROM users WHERE google_id IS NOT NULL AND google_id != ''
+ON CONFLICT DO NOTHING;
+INSERT INTO user_identities (provider, subject, user_id, email)
+SELECT 'apple', apple_id, id, COALESCE(email, '') FROM users WHERE apple_id IS NOT NULL AND apple_id != ''
+ON CONFLICT DO NOTHING;
+
+DROP INDEX IF EXISTS idx_users_google_id;
+DROP INDEX IF EXISTS idx_users_apple_id;
+ALTER TABLE users DROP COLUMN IF EXISTS google_id;
+ALTER TABLE users DROP COLUMN IF EXISTS apple_id;
@@ -0,0 +1,15 @@
+-- Personal data exports (KVKK/GDPR access requests). Large accounts are
+-- exported in the background; the finished archive is kept here until it
+-- expires.
+CREATE TABLE IF NOT EXISTS data_exports (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	status TEXT NOT NULL DEFAULT 'pending',
+	error TEXT NOT NULL DEFAULT '',
+	archive BYTEA,
+	size_bytes INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	completed_at TIMESTAMP,
+	expires_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_data_exports_user ON data_exports(user_id, created_at DESC);
@@ -0,0 +1,4 @@
+-- Results of purged accounts stay with the tombstone user, so it is kept.
+DROP INDEX IF EXISTS idx_users_deletion_scheduled;
+ALTER TABLE users DROP COLUMN IF EXISTS deletion_scheduled_for;
+ALTER TABLE users DROP COLUMN IF EXISTS deletion_requested_at;
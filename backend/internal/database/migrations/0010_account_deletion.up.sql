@@ -0,0 +1,11 @@
+-- Deleting an account only schedules it; a background job purges accounts
+-- whose grace period is over. Their test results move to the tombstone user
+-- below so that question statistics keep counting them.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_requested_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_for TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_users_deletion_scheduled ON users(deletion_scheduled_for)
+	WHERE deletion_scheduled_for IS NOT NULL;
+
+INSERT INTO users (id, nickname, emoji, streak, total_score, level, xp, provider, role, tokens, is_premium)
+VALUES ('00000000-0000-0000-0000-000000000000', '[silinmiş kullanıcı]', '👤', 0, 0, 1, 0, 'local', 'free', 0, FALSE)
+ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS backup_snapshots;
+DROP SCHEMA IF EXISTS backups CASCADE;
@@ -0,0 +1,10 @@
+-- Destructive content operations first copy the content tables into the
+-- backups schema. Each snapshot's tables share a name suffix, e.g.
+-- backups.questions_20261019_031500_a1b2c3.
+CREATE SCHEMA IF NOT EXISTS backups;
+CREATE TABLE IF NOT EXISTS backup_snapshots (
+	name TEXT PRIMARY KEY,
+	reason TEXT NOT NULL,
+	tables TEXT[] NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
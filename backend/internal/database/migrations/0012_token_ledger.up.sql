@@ -0,0 +1,22 @@
+-- Every change to users.tokens is recorded here. users.tokens stays as a
+-- cached balance and must equal the sum of the user's amounts; each row also
+-- carries the balance after it so the history reads like a statement.
+CREATE TABLE IF NOT EXISTS token_transactions (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	amount INTEGER NOT NULL CHECK (amount <> 0),
+	balance_after INTEGER NOT NULL,
+	reason TEXT NOT NULL,
+	reference TEXT NOT NULL DEFAULT '',
+	idempotency_key TEXT,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	UNIQUE (user_id, idempotency_key)
+);
+CREATE INDEX IF NOT EXISTS idx_token_transactions_user ON token_transactions(user_id, created_at DESC);
+
+-- Balances from before the ledger become its first entries
+INSERT INTO token_transactions (id, user_id, amount, balance_after, reason)
+SELECT gen_random_uuid(), id, tokens, tokens, 'opening_balance'
+FROM users
+WHERE COALESCE(tokens, 0) <> 0
+	AND NOT EXISTS (SELECT 1 FROM token_transactions t WHERE t.user_id = users.id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS daily_reward_claims;
+ALTER TABLE users DROP COLUMN IF EXISTS timezone;
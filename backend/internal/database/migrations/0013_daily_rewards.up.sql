@@ -0,0 +1,16 @@
+-- Days are calendar days in the user's timezone, so users need one. The
+-- default covers the existing audience.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'Europe/Istanbul';
+
+-- One row per claimed daily login reward. calendar_day is the position in the
+-- 7-day cycle; the tokens themselves are in the ledger entry.
+CREATE TABLE IF NOT EXISTS daily_reward_claims (
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	day DATE NOT NULL,
+	calendar_day INTEGER NOT NULL CHECK (calendar_day BETWEEN 1 AND 7),
+	tokens INTEGER NOT NULL,
+	bonus INTEGER NOT NULL DEFAULT 0,
+	transaction_id UUID NOT NULL REFERENCES token_transactions(id),
+	claimed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (user_id, day)
+);
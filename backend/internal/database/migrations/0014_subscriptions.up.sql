@@ -0,0 +1,22 @@
+-- Store subscriptions validated with the App Store or Google Play. A user is
+-- premium while one of them is active (or in its grace period) and unexpired;
+-- users.is_premium and the pro role are kept in sync with that.
+CREATE TABLE IF NOT EXISTS subscriptions (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	platform TEXT NOT NULL CHECK (platform IN ('apple', 'google')),
+	product_id TEXT NOT NULL,
+	-- The original transaction ID on Apple, the purchase token on Google
+	external_id TEXT NOT NULL,
+	status TEXT NOT NULL,
+	auto_renew BOOLEAN NOT NULL DEFAULT FALSE,
+	environment TEXT NOT NULL DEFAULT 'production',
+	period_start TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	grace_expires_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	UNIQUE (platform, external_id)
+);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_user ON subscriptions(user_id);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_expiry ON subscriptions(expires_at) WHERE status IN ('active', 'grace');
@@ -0,0 +1,2 @@
+-- Streak freezes the user holds; bought in the token shop.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS streak_freezes INTEGER NOT NULL DEFAULT 0 CHECK (streak_freezes >= 0);
@@ -0,0 +1,10 @@
+-- Achievements earned by users. The definitions live in data/achievements.json;
+-- xp and tokens record what the achievement paid when it was earned.
+CREATE TABLE IF NOT EXISTS user_achievements (
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	achievement_id TEXT NOT NULL,
+	xp INTEGER NOT NULL DEFAULT 0,
+	tokens INTEGER NOT NULL DEFAULT 0,
+	earned_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (user_id, achievement_id)
+);
@@ -0,0 +1,29 @@
+-- The user's league tier, an index into leagues.Tiers (0 is the lowest).
+ALTER TABLE users ADD COLUMN IF NOT EXISTS league_tier INTEGER NOT NULL DEFAULT 0;
+
+-- A week's league groups. week is the Monday the week starts on in
+-- Europe/Istanbul; band is the level band of the members. members counts
+-- joins so that filling a group can lock just its row.
+CREATE TABLE IF NOT EXISTS league_groups (
+	id UUID PRIMARY KEY,
+	week DATE NOT NULL,
+	tier INTEGER NOT NULL,
+	band INTEGER NOT NULL,
+	members INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	closed_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS league_groups_open_idx ON league_groups (week, tier, band) WHERE closed_at IS NULL;
+
+-- rank and outcome are set when the week is closed.
+CREATE TABLE IF NOT EXISTS league_members (
+	group_id UUID NOT NULL REFERENCES league_groups(id) ON DELETE CASCADE,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	week DATE NOT NULL,
+	xp INTEGER NOT NULL DEFAULT 0,
+	joined_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	rank INTEGER,
+	outcome TEXT,
+	PRIMARY KEY (group_id, user_id),
+	UNIQUE (user_id, week)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS leaderboard_scores;
+ALTER TABLE users DROP COLUMN IF EXISTS leaderboard_hidden;
@@ -0,0 +1,52 @@
+-- Opting out hides the user from every leaderboard.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS leaderboard_hidden BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- A running score per user for every leaderboard period, kept up to date as
+-- results come in. hidden mirrors the user's opt-out and pending deletion so
+-- that ranking needs no join. expires_at is when the period ends; all-time
+-- rows never expire.
+CREATE TABLE IF NOT EXISTS leaderboard_scores (
+	board TEXT NOT NULL,
+	time_window TEXT NOT NULL,
+	period TEXT NOT NULL,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	score INTEGER NOT NULL DEFAULT 0,
+	hidden BOOLEAN NOT NULL DEFAULT FALSE,
+	expires_at TIMESTAMPTZ,
+	PRIMARY KEY (board, time_window, period, user_id)
+);
+CREATE INDEX IF NOT EXISTS leaderboard_scores_rank_idx
+	ON leaderboard_scores (board, time_window, period, score DESC, user_id) WHERE NOT hidden;
+CREATE INDEX IF NOT EXISTS leaderboard_scores_user_idx ON leaderboard_scores (user_id);
+CREATE INDEX IF NOT EXISTS leaderboard_scores_expiry_idx ON leaderboard_scores (expires_at) WHERE expires_at IS NOT NULL;
+
+-- Backfill from first attempts, which are what total_score counts, leaving
+-- out the tombstone user and periods that are already over.
+-- completed_at is written by NOW() in the server's UTC session.
+WITH firsts AS (
+	SELECT DISTINCT ON (r.user_id, r.test_id) r.user_id, r.score, COALESCE(t.category_slug, '') AS category,
+		(r.completed_at AT TIME ZONE 'UTC') AT TIME ZONE 'Europe/Istanbul' AS local_at
+	FROM test_results r
+	JOIN tests t ON t.id = r.test_id
+	JOIN users u ON u.id = r.user_id
+	WHERE r.user_id <> '00000000-0000-0000-0000-000000000000'
+	ORDER BY r.user_id, r.test_id, r.completed_at
+), entries AS (
+	SELECT f.user_id, f.score, b.board, w.time_window, w.period, w.period_end AT TIME ZONE 'Europe/Istanbul' AS expires_at
+	FROM firsts f
+	CROSS JOIN LATERAL (VALUES ('all'), ('category:' || f.category)) AS b(board)
+	CROSS JOIN LATERAL (VALUES
+		('all_time', 'all', NULL::timestamp),
+		('monthly', to_char(f.local_at, 'YYYY-MM'), date_trunc('month', f.local_at) + INTERVAL '1 month'),
+		('weekly', to_char(date_trunc('week', f.local_at), 'YYYY-MM-DD'), date_trunc('week', f.local_at) + INTERVAL '7 days'),
+		('daily', to_char(f.local_at, 'YYYY-MM-DD'), date_trunc('day', f.local_at) + INTERVAL '1 day')
+	) AS w(time_window, period, period_end)
+	WHERE f.score > 0 AND b.board <> 'category:'
+)
+INSERT INTO leaderboard_scores (board, time_window, period, user_id, score, hidden, expires_at)
+SELECT e.board, e.time_window, e.period, e.user_id, SUM(e.score), u.leaderboard_hidden OR u.deletion_scheduled_for IS NOT NULL,
+	MIN(e.expires_at)
+FROM entries e JOIN users u ON u.id = e.user_id
+WHERE e.expires_at IS NULL OR e.expires_at > NOW()
+GROUP BY e.board, e.time_window, e.period, e.user_id, u.leaderboard_hidden, u.deletion_scheduled_for
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,22 @@
+-- What each user did on each day of their timezone, for streaks and the
+-- practice calendar. frozen marks a missed day covered by a streak freeze.
+CREATE TABLE IF NOT EXISTS user_activity (
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	day DATE NOT NULL,
+	tests INTEGER NOT NULL DEFAULT 0,
+	score INTEGER NOT NULL DEFAULT 0,
+	xp INTEGER NOT NULL DEFAULT 0,
+	frozen BOOLEAN NOT NULL DEFAULT FALSE,
+	PRIMARY KEY (user_id, day)
+);
+
+-- Backfill from test results in each user's current timezone. Every test
+-- earned its score as XP until now. completed_at is written by NOW() in the
+-- server's UTC session.
+INSERT INTO user_activity (user_id, day, tests, score, xp)
+SELECT r.user_id, ((r.completed_at AT TIME ZONE 'UTC') AT TIME ZONE u.timezone)::date,
+	COUNT(*), SUM(r.score), SUM(r.score)
+FROM test_results r JOIN users u ON u.id = r.user_id
+WHERE r.completed_at IS NOT NULL AND r.user_id <> '00000000-0000-0000-0000-000000000000'
+GROUP BY 1, 2
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,6 @@
+-- Lifetime XP. Levels follow from it through the curve in
+-- data/progression.json; level and xp are kept alongside for queries.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS total_xp INTEGER NOT NULL DEFAULT 0;
+
+-- Every level took 100 XP until now
+UPDATE users SET total_xp = (GREATEST(COALESCE(level, 1), 1) - 1) * 100 + COALESCE(xp, 0);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS attempt_answers;
+DROP TABLE IF EXISTS test_attempts;
@@ -0,0 +1,19 @@
+-- A sitting of a test. Answers are recorded against it as they are given
+-- and their grades only shown once submitted_at is set.
+CREATE TABLE IF NOT EXISTS test_attempts (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	test_id UUID NOT NULL REFERENCES tests(id) ON DELETE CASCADE,
+	started_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	submitted_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS test_attempts_user_idx ON test_attempts (user_id);
+
+CREATE TABLE IF NOT EXISTS attempt_answers (
+	attempt_id UUID NOT NULL REFERENCES test_attempts(id) ON DELETE CASCADE,
+	question_id UUID NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+	option_text TEXT NOT NULL,
+	correct BOOLEAN NOT NULL,
+	answered_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (attempt_id, question_id)
+);
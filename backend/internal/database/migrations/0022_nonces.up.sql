@@ -0,0 +1,9 @@
+-- Single-use values the server hands out, such as sign-in nonces. A row is
+-- deleted when it is used, so a value can't be presented twice.
+CREATE TABLE IF NOT EXISTS nonces (
+	purpose TEXT NOT NULL,
+	value TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (purpose, value)
+);
+CREATE INDEX IF NOT EXISTS nonces_expires_idx ON nonces (expires_at);
@@ -1,130 +1,12 @@
 package database
 
 import (
-	"backend/internal/models"
-	"encoding/json"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
-	"strings"
 
 	"github.com/google/uuid"
 )
 
-func SeedData() {
-	fmt.Println("Checking for Questions and Tests to seed...")
-
-	questionsDir := "data/questions"
-	files, err := os.ReadDir(questionsDir)
-	if err != nil {
-		log.Printf("Error reading questions directory: %v", err)
-		// Fallback to current directory for safety if data/questions doesn't exist
-		questionsDir = "."
-		files, _ = os.ReadDir(questionsDir)
-	}
-
-	totalInserted := 0
-	for _, file := range files {
-		if !file.IsDir() && (file.Name() == "questions.json" || (len(file.Name()) > 5 && file.Name()[len(file.Name())-5:] == ".json")) {
-			filename := questionsDir + "/" + file.Name()
-			fmt.Printf("Processing file: %s\n", filename)
-
-			var fileQuestions []models.Question
-			data, err := os.ReadFile(filename)
-			if err != nil {
-				log.Printf("Error reading file %s: %v", filename, err)
-				continue
-			}
-
-			if err := json.Unmarshal(data, &fileQuestions); err != nil {
-				log.Printf("Error unmarshalling %s: %v", filename, err)
-				continue
-			}
-
-			if len(fileQuestions) == 0 {
-				continue
-			}
-
-			fmt.Printf("File %s: Found %d questions in JSON\n", file.Name(), len(fileQuestions))
-
-			questionsPerTest := 20
-			currentTestID := ""
-			newQuestionsInFile := 0
-			for _, q := range fileQuestions {
-				// Basic Validation
-				if q.Text == "" || len(q.Options) == 0 {
-					log.Printf("Skipping invalid question %s from %s (missing text or options)", q.QuestionID, file.Name())
-					continue
-				}
-
-				// Use the cleaned filename as the category
-				categoryName := file.Name()
-				categoryName = strings.TrimSuffix(categoryName, filepath.Ext(categoryName))
-				categoryName = strings.ReplaceAll(categoryName, " öabt sorular", "")
-				categoryName = strings.ReplaceAll(categoryName, " ÖABT sorular", "")
-				categoryName = strings.ReplaceAll(categoryName, " soruları", "")
-				categoryName = strings.ReplaceAll(categoryName, " sorular", "")
-				categoryName = strings.Title(strings.TrimSpace(categoryName))
-
-				// Check if question already exists
-				var existingID string
-				err := DB.QueryRow("SELECT id FROM questions WHERE question_id = $1 AND category = $2", q.QuestionID, categoryName).Scan(&existingID)
-				if err == nil {
-					continue
-				}
-
-				// Change test every 20 questions
-				testNum := (newQuestionsInFile / questionsPerTest) + 1
-				testTitle := fmt.Sprintf("%s - Deneme %d", categoryName, testNum)
-
-				if currentTestID == "" || newQuestionsInFile%questionsPerTest == 0 {
-					var testID string
-					err := DB.QueryRow("SELECT id FROM tests WHERE title = $1", testTitle).Scan(&testID)
-					if err != nil {
-						newUUID, _ := uuid.NewV7()
-						testID = newUUID.String()
-						_, err = DB.Exec("INSERT INTO tests (id, title, description, category) VALUES ($1, $2, $3, $4)",
-							testID, testTitle, "ÖABT "+categoryName+" Alan Bilgisi", categoryName)
-						if err != nil {
-							log.Printf("Error creating test %s: %v", testTitle, err)
-							_ = DB.QueryRow("SELECT id FROM tests WHERE title = $1", testTitle).Scan(&testID)
-						} else {
-							fmt.Printf("Created NEW test title: %s\n", testTitle)
-						}
-					}
-					currentTestID = testID
-				}
-
-				if currentTestID == "" {
-					continue
-				}
-
-				qID, _ := uuid.NewV7()
-				optionsJson, _ := json.Marshal(q.Options)
-				solutionJson, _ := json.Marshal(q.Solution)
-				metadataJson, _ := json.Marshal(q.Metadata)
-
-				_, err = DB.Exec(`INSERT INTO questions 
-					(id, test_id, question_id, category, subject, topic, sub_topic, difficulty, skill_level, text, options, solution, metadata, image_url, related_concept_id) 
-					VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
-					qID.String(), currentTestID, q.QuestionID, categoryName, q.Subject, q.Topic, q.SubTopic, q.Difficulty, q.SkillLevel, q.Text, optionsJson, solutionJson, metadataJson, q.ImageURL, q.RelatedConceptID)
-
-				if err == nil {
-					newQuestionsInFile++
-					totalInserted++
-				} else {
-					log.Printf("Error inserting question %s from %s: %v", q.QuestionID, file.Name(), err)
-				}
-			}
-			if newQuestionsInFile > 0 {
-				fmt.Printf("Successfully seeded %d questions from %s divided into %d tests\n", newQuestionsInFile, file.Name(), (newQuestionsInFile+19)/20)
-			}
-		}
-	}
-	fmt.Printf("Seeding complete. Total new questions added: %d\n", totalInserted)
-}
-
 func SeedSubjects() {
 	var count int
 	DB.QueryRow("SELECT COUNT(*) FROM subjects").Scan(&count)
@@ -0,0 +1,442 @@
+package database
+
+import (
+	"backend/internal/content"
+	"backend/internal/models"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// SyncOptions controls how SyncQuestions applies the JSON content to the database.
+type SyncOptions struct {
+	// DryRun computes the full diff inside a transaction and rolls it back.
+	DryRun bool
+	// Prune also retires legacy rows (seeded before source files were tracked)
+	// whose question_id no longer appears in their category's files.
+	Prune bool
+}
+
+// FileSyncReport lists what changed for a single question file.
+type FileSyncReport struct {
+	File      string   `json:"file"`
+	Added     []string `json:"added"`
+	Updated   []string `json:"updated"`
+	Unchanged int      `json:"unchanged"`
+	Skipped   []string `json:"skipped"`
+}
+
+// TestSyncReport describes a test defined by the manifest after the sync.
+type TestSyncReport struct {
+	Slug      string   `json:"slug"`
+	Title     string   `json:"title"`
+	Created   bool     `json:"created"`
+	Questions int      `json:"questions"`
+	Moved     int      `json:"moved"`
+	Missing   []string `json:"missing"`
+}
+
+// CategorySyncReport groups the file and test reports of one manifest category.
+type CategorySyncReport struct {
+	Slug       string           `json:"slug"`
+	Name       string           `json:"name"`
+	Files      []FileSyncReport `json:"files"`
+	Tests      []TestSyncReport `json:"tests"`
+	Retired    []string         `json:"retired"`
+	Unassigned []string         `json:"unassigned"`
+}
+
+// SyncReport is the diff produced by SyncQuestions.
+type SyncReport struct {
+	DryRun        bool                 `json:"dry_run"`
+	Categories    []CategorySyncReport `json:"categories"`
+	UnlistedFiles []string             `json:"unlisted_files"`
+	Added         int                  `json:"added"`
+	Updated       int                  `json:"updated"`
+	Retired       int                  `json:"retired"`
+	Unchanged     int                  `json:"unchanged"`
+	TestsCreated  int                  `json:"tests_created"`
+	// Backup names the snapshot taken before a pruning sync.
+	Backup string `json:"backup,omitempty"`
+}
+
+type existingQuestion struct {
+	ID         string
+	Hash       string
+	Retired    bool
+	SourceFile string
+	TestID     string
+	Linked     bool
+	seen       bool
+}
+
+// SyncQuestions reconciles the categories, tests and questions tables with the
+// content manifest. Questions are matched by (category slug, question_id): new
+// ones are inserted, changed ones are updated in place and ones removed from
+// their files are retired instead of deleted so that test_results stay intact.
+// Test membership is taken from the manifest's test definitions. A pruning
+// sync takes a Snapshot first.
+func SyncQuestions(opts SyncOptions) (*SyncReport, error) {
+	manifest, err := content.LoadManifest(content.ManifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	report := &SyncReport{DryRun: opts.DryRun, Categories: []CategorySyncReport{}, UnlistedFiles: []string{}}
+	if opts.Prune && !opts.DryRun {
+		if report.Backup, err = Snapshot(tx, "content sync with prune"); err != nil {
+			return nil, fmt.Errorf("backing up before sync: %w", err)
+		}
+	}
+
+	examIDs := map[string]string{}
+	for _, e := range manifest.Exams {
+		var id string
+		err := tx.QueryRow(`INSERT INTO exams (id, slug, name, sort_order) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (slug) DO UPDATE SET name=EXCLUDED.name, sort_order=EXCLUDED.sort_order
+			RETURNING id`, newUUID(), e.Slug, e.Name, e.Order).Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("upserting exam %s: %w", e.Slug, err)
+		}
+		examIDs[e.Slug] = id
+	}
+
+	listed := map[string]bool{}
+	for _, c := range manifest.Categories {
+		cr, err := syncCategory(tx, c, examIDs[c.Exam], opts)
+		if err != nil {
+			return nil, fmt.Errorf("syncing category %s: %w", c.Slug, err)
+		}
+
+		report.Categories = append(report.Categories, *cr)
+		for _, fr := range cr.Files {
+			listed[fr.File] = true
+			report.Added += len(fr.Added)
+			report.Updated += len(fr.Updated)
+			report.Unchanged += fr.Unchanged
+		}
+		for _, tr := range cr.Tests {
+			if tr.Created {
+				report.TestsCreated++
+			}
+		}
+		report.Retired += len(cr.Retired)
+	}
+
+	files, err := os.ReadDir(content.QuestionsDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading questions directory: %w", err)
+	}
+	for _, file := range files {
+		if !file.IsDir() && filepath.Ext(file.Name()) == ".json" && !listed[file.Name()] {
+			report.UnlistedFiles = append(report.UnlistedFiles, file.Name())
+		}
+	}
+
+	if !opts.DryRun {
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Printf("Question sync complete (dry run: %t). Added: %d, updated: %d, retired: %d, unchanged: %d\n",
+		report.DryRun, report.Added, report.Updated, report.Retired, report.Unchanged)
+	return report, nil
+}
+
+func syncCategory(tx *sql.Tx, c content.Category, examID string, opts SyncOptions) (*CategorySyncReport, error) {
+	cr := &CategorySyncReport{
+		Slug:       c.Slug,
+		Name:       c.Name,
+		Files:      []FileSyncReport{},
+		Tests:      []TestSyncReport{},
+		Retired:    []string{},
+		Unassigned: []string{},
+	}
+
+	tax := Taxonomy{ExamID: examID}
+	err := tx.QueryRow(`INSERT INTO categories (id, slug, name, icon, sort_order, exam_id) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (slug) DO UPDATE SET name=EXCLUDED.name, icon=EXCLUDED.icon, sort_order=EXCLUDED.sort_order, exam_id=EXCLUDED.exam_id
+		RETURNING id`,
+		newUUID(), c.Slug, c.Name, c.Icon, c.Order, examID).Scan(&tax.CategoryID)
+	if err != nil {
+		return nil, fmt.Errorf("upserting category: %w", err)
+	}
+
+	existing, err := loadExistingQuestions(tx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	// Questions of the category in manifest file order, and their row IDs.
+	ordered := []models.Question{}
+	rowIDs := map[string]string{}
+	currentTest := map[string]string{}
+
+	for _, fileName := range c.Files {
+		fr, err := syncFile(tx, c, tax, fileName, existing, rowIDs, currentTest, &ordered)
+		if err != nil {
+			return nil, fmt.Errorf("syncing %s: %w", fileName, err)
+		}
+		cr.Files = append(cr.Files, *fr)
+	}
+
+	// Resolve test definitions into the desired test of every question.
+	desired := map[string]string{}
+	testIndex := map[string]int{}
+	for i, t := range c.Tests {
+		testID, created, err := upsertTest(tx, c, tax, t, i+1)
+		if err != nil {
+			return nil, fmt.Errorf("upserting test %s: %w", t.Slug, err)
+		}
+
+		tr := TestSyncReport{Slug: t.Slug, Title: t.Title, Created: created, Missing: []string{}}
+		for _, questionID := range t.Pick(ordered) {
+			if _, ok := rowIDs[questionID]; !ok {
+				tr.Missing = append(tr.Missing, questionID)
+				continue
+			}
+			if _, taken := desired[questionID]; taken {
+				log.Printf("Sync: question %s is selected by more than one test in %s, keeping the first", questionID, c.Slug)
+				continue
+			}
+			desired[questionID] = testID
+			tr.Questions++
+		}
+		testIndex[testID] = len(cr.Tests)
+		cr.Tests = append(cr.Tests, tr)
+	}
+
+	for _, q := range ordered {
+		testID := desired[q.QuestionID]
+		if testID == "" {
+			cr.Unassigned = append(cr.Unassigned, q.QuestionID)
+		}
+		if testID == currentTest[q.QuestionID] {
+			continue
+		}
+
+		if _, err := tx.Exec("UPDATE questions SET test_id=$1 WHERE id=$2", sql.NullString{String: testID, Valid: testID != ""}, rowIDs[q.QuestionID]); err != nil {
+			return nil, fmt.Errorf("assigning question %s: %w", q.QuestionID, err)
+		}
+		if i, ok := testIndex[testID]; ok && currentTest[q.QuestionID] != "" {
+			cr.Tests[i].Moved++
+		}
+	}
+
+	for questionID, ex := range existing {
+		if ex.seen || ex.Retired {
+			continue
+		}
+		if ex.SourceFile == "" && !opts.Prune {
+			continue
+		}
+
+		if _, err := tx.Exec("UPDATE questions SET retired_at=NOW(), updated_at=NOW() WHERE id=$1", ex.ID); err != nil {
+			return nil, fmt.Errorf("retiring question %s: %w", questionID, err)
+		}
+		cr.Retired = append(cr.Retired, questionID)
+	}
+	sort.Strings(cr.Retired)
+
+	return cr, nil
+}
+
+func syncFile(tx *sql.Tx, c content.Category, tax Taxonomy, fileName string, existing map[string]*existingQuestion,
+	rowIDs, currentTest map[string]string, ordered *[]models.Question) (*FileSyncReport, error) {
+	data, err := os.ReadFile(filepath.Join(content.QuestionsDir, fileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var fileQuestions []models.Question
+	if err := json.Unmarshal(data, &fileQuestions); err != nil {
+		return nil, err
+	}
+
+	fr := &FileSyncReport{
+		File:    fileName,
+		Added:   []string{},
+		Updated: []string{},
+		Skipped: []string{},
+	}
+
+	for _, q := range fileQuestions {
+		if q.Text == "" || len(q.Options) == 0 {
+			fr.Skipped = append(fr.Skipped, q.QuestionID+": missing text or options")
+			continue
+		}
+		if q.QuestionID == "" {
+			fr.Skipped = append(fr.Skipped, "question without question_id")
+			continue
+		}
+		if _, dup := rowIDs[q.QuestionID]; dup {
+			fr.Skipped = append(fr.Skipped, q.QuestionID+": duplicate question_id in category")
+			continue
+		}
+
+		q.Category = c.Name
+		hash := contentHash(q)
+
+		optionsJson, _ := json.Marshal(q.Options)
+		solutionJson, _ := json.Marshal(q.Solution)
+		metadataJson, _ := json.Marshal(q.Metadata)
+
+		if ex, ok := existing[q.QuestionID]; ok {
+			ex.seen = true
+			rowIDs[q.QuestionID] = ex.ID
+			currentTest[q.QuestionID] = ex.TestID
+			*ordered = append(*ordered, q)
+
+			// Rows synced before the taxonomy existed need their links filled in once.
+			if ex.Hash == hash && !ex.Retired && ex.SourceFile == fileName && ex.Linked {
+				fr.Unchanged++
+				continue
+			}
+
+			subjectID, topicID, err := resolveSubjectTopic(tx, tax.CategoryID, q)
+			if err != nil {
+				return nil, err
+			}
+			_, err = tx.Exec(`UPDATE questions SET
+				category=$1, category_slug=$2, subject=$3, topic=$4, sub_topic=$5, difficulty=$6, skill_level=$7, text=$8, options=$9, solution=$10,
+				metadata=$11, image_url=$12, related_concept_id=$13, content_hash=$14, source_file=$15, retired_at=NULL, updated_at=NOW(),
+				category_id=$16, subject_id=$17, topic_id=$18
+				WHERE id=$19`,
+				c.Name, c.Slug, q.Subject, q.Topic, q.SubTopic, q.Difficulty, q.SkillLevel, q.Text, optionsJson, solutionJson,
+				metadataJson, q.ImageURL, q.RelatedConceptID, hash, fileName, tax.CategoryID, NullIfEmpty(subjectID), NullIfEmpty(topicID), ex.ID)
+			if err != nil {
+				return nil, fmt.Errorf("updating question %s: %w", q.QuestionID, err)
+			}
+			fr.Updated = append(fr.Updated, q.QuestionID)
+			continue
+		}
+
+		subjectID, topicID, err := resolveSubjectTopic(tx, tax.CategoryID, q)
+		if err != nil {
+			return nil, err
+		}
+		qID, _ := uuid.NewV7()
+		_, err = tx.Exec(`INSERT INTO questions
+			(id, question_id, category, category_slug, subject, topic, sub_topic, difficulty, skill_level, text, options, solution, metadata, image_url, related_concept_id, content_hash, source_file, updated_at,
+			category_id, subject_id, topic_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, NOW(), $18, $19, $20)`,
+			qID.String(), q.QuestionID, c.Name, c.Slug, q.Subject, q.Topic, q.SubTopic, q.Difficulty, q.SkillLevel, q.Text, optionsJson, solutionJson, metadataJson, q.ImageURL, q.RelatedConceptID, hash, fileName,
+			tax.CategoryID, NullIfEmpty(subjectID), NullIfEmpty(topicID))
+		if err != nil {
+			return nil, fmt.Errorf("inserting question %s: %w", q.QuestionID, err)
+		}
+		rowIDs[q.QuestionID] = qID.String()
+		currentTest[q.QuestionID] = ""
+		*ordered = append(*ordered, q)
+		fr.Added = append(fr.Added, q.QuestionID)
+	}
+
+	return fr, nil
+}
+
+func resolveSubjectTopic(tx *sql.Tx, categoryID string, q models.Question) (string, string, error) {
+	subjectID, err := EnsureSubject(tx, categoryID, q.Subject)
+	if err != nil {
+		return "", "", fmt.Errorf("resolving subject of %s: %w", q.QuestionID, err)
+	}
+	topicID, err := EnsureTopic(tx, subjectID, q.Topic)
+	if err != nil {
+		return "", "", fmt.Errorf("resolving topic of %s: %w", q.QuestionID, err)
+	}
+	return subjectID, topicID, nil
+}
+
+// loadExistingQuestions returns the category's rows, including legacy rows that
+// were seeded under a filename-derived category name before the manifest existed.
+func loadExistingQuestions(tx *sql.Tx, c content.Category) (map[string]*existingQuestion, error) {
+	names := append([]string{c.Name}, c.LegacyNames...)
+	rows, err := tx.Query(`
+		SELECT id, question_id, COALESCE(content_hash, ''), retired_at IS NOT NULL, COALESCE(source_file, ''), COALESCE(test_id::text, ''),
+			category_id IS NOT NULL
+		FROM questions
+		WHERE category_slug = $1 OR (category_slug IS NULL AND category = ANY($2))
+		ORDER BY category_slug NULLS LAST, id`, c.Slug, pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := make(map[string]*existingQuestion)
+	for rows.Next() {
+		var questionID string
+		ex := &existingQuestion{}
+		if err := rows.Scan(&ex.ID, &questionID, &ex.Hash, &ex.Retired, &ex.SourceFile, &ex.TestID, &ex.Linked); err != nil {
+			return nil, err
+		}
+		// Rows already keyed by slug sort first and win over legacy duplicates.
+		if _, ok := existing[questionID]; ok {
+			continue
+		}
+		existing[questionID] = ex
+	}
+	return existing, rows.Err()
+}
+
+// upsertTest finds the test by slug, adopting an unslugged test with the same or
+// legacy title, and brings its metadata in line with the manifest.
+func upsertTest(tx *sql.Tx, c content.Category, tax Taxonomy, t content.Test, order int) (string, bool, error) {
+	description := t.Description
+	if description == "" {
+		description = "ÖABT " + c.Name + " Alan Bilgisi"
+	}
+
+	var testID string
+	err := tx.QueryRow("SELECT id FROM tests WHERE slug = $1", t.Slug).Scan(&testID)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow("SELECT id FROM tests WHERE slug IS NULL AND title = ANY($1) ORDER BY id LIMIT 1",
+			pq.Array([]string{t.Title, t.LegacyTitle})).Scan(&testID)
+	}
+
+	if err == sql.ErrNoRows {
+		newUUID, _ := uuid.NewV7()
+		_, err = tx.Exec(`INSERT INTO tests (id, slug, title, description, category, category_slug, time_limit_minutes, sort_order, exam_id, category_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			newUUID.String(), t.Slug, t.Title, description, c.Name, c.Slug, t.TimeLimitMinutes, order, tax.ExamID, tax.CategoryID)
+		if err != nil {
+			return "", false, err
+		}
+		log.Printf("Sync: created test %s", t.Title)
+		return newUUID.String(), true, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	_, err = tx.Exec(`UPDATE tests SET slug=$1, title=$2, description=$3, category=$4, category_slug=$5, time_limit_minutes=$6, sort_order=$7,
+		exam_id=$8, category_id=$9
+		WHERE id=$10`,
+		t.Slug, t.Title, description, c.Name, c.Slug, t.TimeLimitMinutes, order, tax.ExamID, tax.CategoryID, testID)
+	return testID, false, err
+}
+
+// contentHash fingerprints everything about a question that comes from the
+// manifest and its JSON file, so unchanged questions can be skipped on every boot.
+func contentHash(q models.Question) string {
+	q.ID = ""
+	q.TestID = ""
+	q.CategoryID, q.SubjectID, q.TopicID = "", "", ""
+	data, _ := json.Marshal(q)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
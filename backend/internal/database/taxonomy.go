@@ -0,0 +1,237 @@
+package database
+
+import (
+	"backend/internal/content"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// DefaultExamSlug is the exam that rows created before exams existed belong to.
+const DefaultExamSlug = "oabt-ozel-egitim"
+
+const defaultExamName = "ÖABT Özel Eğitim"
+
+// unlistedCategoryOrder sorts categories that aren't in the manifest after the ones that are.
+const unlistedCategoryOrder = 1000
+
+// execQuerier is satisfied by both *sql.DB and *sql.Tx.
+type execQuerier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Taxonomy holds the normalized IDs a question or test points at. Empty strings
+// mean the level is unknown.
+type Taxonomy struct {
+	ExamID     string
+	CategoryID string
+	SubjectID  string
+	TopicID    string
+}
+
+func newUUID() string {
+	id, _ := uuid.NewV7()
+	return id.String()
+}
+
+// NullIfEmpty maps an empty ID to SQL NULL.
+func NullIfEmpty(id string) sql.NullString {
+	return sql.NullString{String: id, Valid: id != ""}
+}
+
+// EnsureExam returns the ID of the exam with the given slug, creating it if needed.
+func EnsureExam(q execQuerier, slug, name string, order int) (string, error) {
+	var id string
+	err := q.QueryRow(`INSERT INTO exams (id, slug, name, sort_order) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (slug) DO UPDATE SET slug = exams.slug
+		RETURNING id`, newUUID(), slug, name, order).Scan(&id)
+	return id, err
+}
+
+// EnsureCategory returns the ID of the category whose slug matches name, creating
+// it under examID if it doesn't exist yet.
+func EnsureCategory(q execQuerier, examID, name string) (string, error) {
+	var id string
+	err := q.QueryRow(`INSERT INTO categories (id, slug, name, icon, sort_order, exam_id) VALUES ($1, $2, $3, '', $4, $5)
+		ON CONFLICT (slug) DO UPDATE SET slug = categories.slug
+		RETURNING id`, newUUID(), content.Slugify(name), name, unlistedCategoryOrder, NullIfEmpty(examID)).Scan(&id)
+	return id, err
+}
+
+// EnsureSubject returns the ID of the subject called name within a category.
+func EnsureSubject(q execQuerier, categoryID, name string) (string, error) {
+	if categoryID == "" || content.Slugify(name) == "" {
+		return "", nil
+	}
+
+	var id string
+	err := q.QueryRow(`INSERT INTO taxonomy_subjects (id, category_id, slug, name) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (category_id, slug) DO UPDATE SET slug = taxonomy_subjects.slug
+		RETURNING id`, newUUID(), categoryID, content.Slugify(name), name).Scan(&id)
+	return id, err
+}
+
+// EnsureTopic returns the ID of the topic called name within a subject.
+func EnsureTopic(q execQuerier, subjectID, name string) (string, error) {
+	if subjectID == "" || content.Slugify(name) == "" {
+		return "", nil
+	}
+
+	var id string
+	err := q.QueryRow(`INSERT INTO taxonomy_topics (id, subject_id, slug, name) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (subject_id, slug) DO UPDATE SET slug = taxonomy_topics.slug
+		RETURNING id`, newUUID(), subjectID, content.Slugify(name), name).Scan(&id)
+	return id, err
+}
+
+// ResolveTaxonomy maps free-text category, subject and topic names to their
+// normalized rows under examID, creating whatever is missing.
+func ResolveTaxonomy(q execQuerier, examID, category, subject, topic string) (Taxonomy, error) {
+	t := Taxonomy{ExamID: examID}
+	if content.Slugify(category) == "" {
+		return t, nil
+	}
+
+	var err error
+	if t.CategoryID, err = EnsureCategory(q, examID, category); err != nil {
+		return t, err
+	}
+	if t.SubjectID, err = EnsureSubject(q, t.CategoryID, subject); err != nil {
+		return t, err
+	}
+	t.TopicID, err = EnsureTopic(q, t.SubjectID, topic)
+	return t, err
+}
+
+// BackfillTaxonomy links rows that only carry free-text category, subject and
+// topic values to the normalized tables. Rows without an exam are assigned to
+// DefaultExamSlug. It is safe to run on every boot: only NULL links are filled.
+func BackfillTaxonomy() error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	examID, err := EnsureExam(tx, DefaultExamSlug, defaultExamName, 1)
+	if err != nil {
+		return fmt.Errorf("ensuring default exam: %w", err)
+	}
+
+	linkBySlug := []string{
+		`UPDATE questions q SET category_id = c.id FROM categories c WHERE q.category_id IS NULL AND q.category_slug = c.slug`,
+		`UPDATE tests t SET category_id = c.id FROM categories c WHERE t.category_id IS NULL AND t.category_slug = c.slug`,
+	}
+	for _, query := range linkBySlug {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	names, err := collectStrings(tx, `
+		SELECT DISTINCT category FROM (
+			SELECT category FROM questions WHERE category_id IS NULL
+			UNION SELECT category FROM tests WHERE category_id IS NULL
+		) c WHERE category IS NOT NULL AND category != ''`)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		categoryID, err := EnsureCategory(tx, examID, name)
+		if err != nil {
+			return fmt.Errorf("backfilling category %q: %w", name, err)
+		}
+		slug := content.Slugify(name)
+		if _, err := tx.Exec(`UPDATE questions SET category_id = $1, category_slug = COALESCE(category_slug, $2)
+			WHERE category_id IS NULL AND category = $3`, categoryID, slug, name); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE tests SET category_id = $1, category_slug = COALESCE(category_slug, $2)
+			WHERE category_id IS NULL AND category = $3`, categoryID, slug, name); err != nil {
+			return err
+		}
+	}
+
+	examLinks := []string{
+		`UPDATE categories SET exam_id = $1 WHERE exam_id IS NULL`,
+		`UPDATE tests t SET exam_id = COALESCE((SELECT c.exam_id FROM categories c WHERE c.id = t.category_id), $1) WHERE t.exam_id IS NULL`,
+		`UPDATE subjects SET exam_id = $1 WHERE exam_id IS NULL`,
+	}
+	for _, query := range examLinks {
+		if _, err := tx.Exec(query, examID); err != nil {
+			return err
+		}
+	}
+
+	type pair struct{ parentID, name string }
+	collectPairs := func(query string) ([]pair, error) {
+		rows, err := tx.Query(query)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var pairs []pair
+		for rows.Next() {
+			var p pair
+			if err := rows.Scan(&p.parentID, &p.name); err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, p)
+		}
+		return pairs, rows.Err()
+	}
+
+	subjects, err := collectPairs(`SELECT DISTINCT category_id, subject FROM questions
+		WHERE subject_id IS NULL AND category_id IS NOT NULL AND subject IS NOT NULL AND subject != ''`)
+	if err != nil {
+		return err
+	}
+	for _, p := range subjects {
+		subjectID, err := EnsureSubject(tx, p.parentID, p.name)
+		if err != nil {
+			return fmt.Errorf("backfilling subject %q: %w", p.name, err)
+		}
+		if _, err := tx.Exec(`UPDATE questions SET subject_id = $1 WHERE subject_id IS NULL AND category_id = $2 AND subject = $3`,
+			NullIfEmpty(subjectID), p.parentID, p.name); err != nil {
+			return err
+		}
+	}
+
+	topics, err := collectPairs(`SELECT DISTINCT subject_id, topic FROM questions
+		WHERE topic_id IS NULL AND subject_id IS NOT NULL AND topic IS NOT NULL AND topic != ''`)
+	if err != nil {
+		return err
+	}
+	for _, p := range topics {
+		topicID, err := EnsureTopic(tx, p.parentID, p.name)
+		if err != nil {
+			return fmt.Errorf("backfilling topic %q: %w", p.name, err)
+		}
+		if _, err := tx.Exec(`UPDATE questions SET topic_id = $1 WHERE topic_id IS NULL AND subject_id = $2 AND topic = $3`,
+			NullIfEmpty(topicID), p.parentID, p.name); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func collectStrings(tx *sql.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,49 @@
+// Package days works with calendar days in a user's timezone. Days are
+// YYYY-MM-DD strings, so they compare and store as plain text.
+package days
+
+import "time"
+
+// Layout is the format of a day.
+const Layout = "2006-01-02"
+
+// Today returns the current day in loc.
+func Today(now time.Time, loc *time.Location) string {
+	return now.In(loc).Format(Layout)
+}
+
+// Start returns when the day of now started in loc.
+func Start(now time.Time, loc *time.Location) time.Time {
+	y, m, d := now.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+// NextMidnight returns when the day after now starts in loc.
+func NextMidnight(now time.Time, loc *time.Location) time.Time {
+	y, m, d := now.In(loc).Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+}
+
+// Add shifts day by n days. It returns "" if day doesn't parse.
+func Add(day string, n int) string {
+	t, err := time.Parse(Layout, day)
+	if err != nil {
+		return ""
+	}
+	return t.AddDate(0, 0, n).Format(Layout)
+}
+
+// Between returns how many days lie strictly between from and to: 0 for
+// consecutive days and -1 for the same day. ok is false if either day
+// doesn't parse.
+func Between(from, to string) (int, bool) {
+	a, err := time.Parse(Layout, from)
+	if err != nil {
+		return 0, false
+	}
+	b, err := time.Parse(Layout, to)
+	if err != nil {
+		return 0, false
+	}
+	return int(b.Sub(a).Hours()/24) - 1, true
+}
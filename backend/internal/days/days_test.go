@@ -0,0 +1,50 @@
+package days_test
+
+import (
+	"backend/internal/days"
+	"testing"
+	"time"
+)
+
+func TestTodayUsesTimezone(t *testing.T) {
+	istanbul, err := time.LoadLocation("Europe/Istanbul")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 22:30 UTC is already the next day at UTC+3
+	now := time.Date(2026, 3, 10, 22, 30, 0, 0, time.UTC)
+	if got := days.Today(now, istanbul); got != "2026-03-11" {
+		t.Fatalf("Today = %s, want 2026-03-11", got)
+	}
+	if got := days.Start(now, istanbul); !got.Equal(time.Date(2026, 3, 10, 21, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Start = %s", got.UTC())
+	}
+	if got := days.NextMidnight(now, istanbul); !got.Equal(time.Date(2026, 3, 11, 21, 0, 0, 0, time.UTC)) {
+		t.Fatalf("NextMidnight = %s", got.UTC())
+	}
+}
+
+func TestAddAndBetween(t *testing.T) {
+	if got := days.Add("2026-02-28", 1); got != "2026-03-01" {
+		t.Fatalf("Add = %s, want 2026-03-01", got)
+	}
+	if got := days.Add("yesterday", 1); got != "" {
+		t.Fatalf("Add of a bad day = %q", got)
+	}
+	cases := []struct {
+		from, to string
+		want     int
+	}{
+		{"2026-03-10", "2026-03-10", -1},
+		{"2026-03-10", "2026-03-11", 0},
+		{"2026-02-27", "2026-03-02", 2},
+	}
+	for _, c := range cases {
+		if got, ok := days.Between(c.from, c.to); !ok || got != c.want {
+			t.Errorf("Between(%q, %q) = %d, %v, want %d", c.from, c.to, got, ok, c.want)
+		}
+	}
+	if _, ok := days.Between("", "2026-03-10"); ok {
+		t.Error("Between of a bad day should fail")
+	}
+}
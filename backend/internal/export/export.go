@@ -0,0 +1,225 @@
+// Package export assembles a user's personal data for KVKK/GDPR access
+// requests. The archive is a zip with the full data as one JSON document and
+// the tabular parts repeated as CSV for spreadsheet users.
+package export
+
+import (
+	"archive/zip"
+	"backend/internal/models"
+	"backend/internal/store"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// maxAdminActions caps the audit entries about the account in one export.
+const maxAdminActions = 1000
+
+// maxTokenTransactions caps the ledger entries in one export.
+const maxTokenTransactions = 100000
+
+// maxLeagueWeeks caps the finished league weeks in one export.
+const maxLeagueWeeks = 1000
+
+// Account describes how the user signs in, without the secrets themselves.
+type Account struct {
+	Email           string `json:"email"`
+	EmailVerified   bool   `json:"email_verified"`
+	HasPassword     bool   `json:"has_password"`
+	HasDeviceSecret bool   `json:"has_device_secret"`
+}
+
+// Identity is a linked sign-in provider, including the provider's subject
+// that the API never shows otherwise.
+type Identity struct {
+	Provider string    `json:"provider"`
+	Subject  string    `json:"subject"`
+	Email    string    `json:"email"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+// AdminAction is an audit entry about the account, without the admin's ID.
+type AdminAction struct {
+	Action    string          `json:"action"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Data is everything stored about one user.
+type Data struct {
+	ExportedAt    time.Time                 `json:"exported_at"`
+	Profile       *models.User              `json:"profile"`
+	Account       Account                   `json:"account"`
+	Identities    []Identity                `json:"identities"`
+	TestResults   []models.TestResult       `json:"test_results"`
+	Sessions      []models.Session          `json:"sessions"`
+	Tokens        []models.TokenTransaction `json:"token_transactions"`
+	Subscriptions []models.Subscription     `json:"subscriptions"`
+	Achievements  []models.UserAchievement  `json:"achievements"`
+	Leagues       []models.LeagueMembership `json:"league_weeks"`
+	Activity      []models.DailyActivity    `json:"activity"`
+	AdminActions  []AdminAction             `json:"admin_actions"`
+}
+
+// Collect reads the user's data from st.
+func Collect(ctx context.Context, st *store.Store, userID string, now time.Time) (*Data, error) {
+	d := &Data{ExportedAt: now.UTC(), Identities: []Identity{}, AdminActions: []AdminAction{}}
+
+	var err error
+	if d.Profile, err = st.Users.Get(ctx, userID); err != nil {
+		return nil, err
+	}
+	creds, err := st.Credentials.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	d.Account = Account{
+		Email:           creds.Email,
+		EmailVerified:   creds.EmailVerified,
+		HasPassword:     creds.PasswordHash != "",
+		HasDeviceSecret: creds.DeviceSecretHash != "",
+	}
+
+	identities, err := st.Identities.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range identities {
+		d.Identities = append(d.Identities, Identity{Provider: i.Provider, Subject: i.Subject, Email: i.Email, LinkedAt: i.LinkedAt})
+	}
+
+	if d.TestResults, err = st.Results.ListForUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	if d.Sessions, err = st.Sessions.List(ctx, userID, now); err != nil {
+		return nil, err
+	}
+	if d.Tokens, err = st.Tokens.History(ctx, userID, time.Time{}, maxTokenTransactions); err != nil {
+		return nil, err
+	}
+	if d.Subscriptions, err = st.Subs.ListForUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	if d.Achievements, err = st.Achievements.List(ctx, userID); err != nil {
+		return nil, err
+	}
+	if d.Leagues, err = st.Leagues.History(ctx, userID, maxLeagueWeeks); err != nil {
+		return nil, err
+	}
+	// Every day there is; the log has at most one row per day
+	if d.Activity, err = st.Activity.List(ctx, userID, "0001-01-01", "9999-12-31"); err != nil {
+		return nil, err
+	}
+
+	entries, err := st.Audit.List(ctx, store.AuditFilter{TargetType: "user", TargetID: userID, Limit: maxAdminActions})
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		d.AdminActions = append(d.AdminActions, AdminAction{Action: e.Action, Before: e.Before, After: e.After, CreatedAt: e.CreatedAt})
+	}
+	return d, nil
+}
+
+const readme = `Personal data export
+
+data.json holds everything we store about your account. The CSV files
+repeat the tabular parts of it:
+
+  test_results.csv  one row per completed test
+  sessions.csv      devices that are currently signed in
+  identities.csv    linked Google and Apple accounts
+  tokens.csv        every change to your token balance, newest first
+
+We keep a score per completed test, not the individual answers. Passwords
+and device secrets are stored only as one-way hashes and are not included.
+`
+
+// Archive returns the zip archive for d.
+func (d *Data) Archive() ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	files := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"README.txt", func(w io.Writer) error { _, err := io.WriteString(w, readme); return err }},
+		{"data.json", func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(d)
+		}},
+		{"test_results.csv", d.writeResults},
+		{"sessions.csv", d.writeSessions},
+		{"identities.csv", d.writeIdentities},
+		{"tokens.csv", d.writeTokens},
+	}
+	for _, f := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: d.ExportedAt})
+		if err != nil {
+			return nil, err
+		}
+		if err := f.write(w); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *Data) writeResults(w io.Writer) error {
+	rows := [][]string{{"id", "test_id", "test_title", "score", "completed_at"}}
+	for _, r := range d.TestResults {
+		rows = append(rows, []string{r.ID, r.TestID, r.TestTitle, strconv.Itoa(r.Score), timestamp(r.CompletedAt)})
+	}
+	return writeCSV(w, rows)
+}
+
+func (d *Data) writeSessions(w io.Writer) error {
+	rows := [][]string{{"id", "device_name", "user_agent", "ip", "created_at", "last_used_at", "expires_at"}}
+	for _, s := range d.Sessions {
+		rows = append(rows, []string{s.ID, s.DeviceName, s.UserAgent, s.IP,
+			timestamp(s.CreatedAt), timestamp(s.LastUsedAt), timestamp(s.ExpiresAt)})
+	}
+	return writeCSV(w, rows)
+}
+
+func (d *Data) writeIdentities(w io.Writer) error {
+	rows := [][]string{{"provider", "subject", "email", "linked_at"}}
+	for _, i := range d.Identities {
+		rows = append(rows, []string{i.Provider, i.Subject, i.Email, timestamp(i.LinkedAt)})
+	}
+	return writeCSV(w, rows)
+}
+
+func (d *Data) writeTokens(w io.Writer) error {
+	rows := [][]string{{"id", "amount", "balance_after", "reason", "reference", "created_at"}}
+	for _, t := range d.Tokens {
+		rows = append(rows, []string{t.ID, strconv.Itoa(t.Amount), strconv.Itoa(t.BalanceAfter), t.Reason, t.Reference,
+			timestamp(t.CreatedAt)})
+	}
+	return writeCSV(w, rows)
+}
+
+// writeCSV starts with a UTF-8 byte order mark so that spreadsheet apps show
+// Turkish characters correctly.
+func writeCSV(w io.Writer, rows [][]string) error {
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.WriteAll(rows)
+	return cw.Error()
+}
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"backend/internal/achievements"
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// AchievementStatus is one achievement as the user sees it: earned or
+// locked, with the progress towards its target.
+type AchievementStatus struct {
+	achievements.Definition
+	Progress int        `json:"progress"` // capped at Target
+	Earned   bool       `json:"earned"`
+	EarnedAt *time.Time `json:"earned_at,omitempty"`
+}
+
+// AchievementsHandler lists every achievement, level badges included, with
+// the user's progress.
+func (s *Server) AchievementsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if s.Achievements == nil {
+		http.Error(w, "Achievements are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := s.Store.Users.Get(ctx, userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	stats, err := s.achievementStats(ctx, user)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	earned, err := s.Store.Achievements.List(ctx, userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	earnedAt := map[string]time.Time{}
+	for _, a := range earned {
+		earnedAt[a.AchievementID] = a.EarnedAt
+	}
+
+	list := []AchievementStatus{}
+	for _, d := range s.Achievements.Achievements {
+		st := AchievementStatus{Definition: d, Progress: min(stats[d.Metric], d.Target)}
+		if at, ok := earnedAt[d.ID]; ok {
+			st.Earned, st.EarnedAt, st.Progress = true, &at, d.Target
+		}
+		list = append(list, st)
+	}
+	// Level badges follow the catalog, earned by reaching their level
+	for _, lr := range s.Progression.Rewards {
+		if lr.Badge == "" {
+			continue
+		}
+		d := achievements.Definition{ID: lr.Badge, Name: lr.Name, Metric: achievements.Level, Target: lr.Level, Tokens: lr.Tokens}
+		st := AchievementStatus{Definition: d, Progress: min(user.Level, lr.Level)}
+		if at, ok := earnedAt[lr.Achievement(userID).AchievementID]; ok {
+			st.Earned, st.EarnedAt, st.Progress = true, &at, d.Target
+		}
+		list = append(list, st)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"earned":       len(earnedAt),
+		"total":        len(list),
+		"achievements": list,
+	})
+}
+
+// checkAchievements awards what event unlocked for the user and returns the
+// new achievements. Errors are logged rather than returned: a failed award
+// is retried by the next event and must not fail the request behind it.
+func (s *Server) checkAchievements(ctx context.Context, userID string, event achievements.Event) []achievements.Definition {
+	if s.Achievements == nil {
+		return nil
+	}
+	user, err := s.Store.Users.Get(ctx, userID)
+	if err != nil {
+		log.Printf("Achievements: loading user %s: %v", userID, err)
+		return nil
+	}
+	stats, err := s.achievementStats(ctx, user)
+	if err != nil {
+		log.Printf("Achievements: counting stats of %s: %v", userID, err)
+		return nil
+	}
+	list, err := s.Store.Achievements.List(ctx, userID)
+	if err != nil {
+		log.Printf("Achievements: listing %s: %v", userID, err)
+		return nil
+	}
+	earned := map[string]bool{}
+	for _, a := range list {
+		earned[a.AchievementID] = true
+	}
+
+	var awarded []achievements.Definition
+	for _, d := range s.Achievements.Unlocked(event, stats, earned) {
+		err := s.Store.Achievements.Award(ctx, &models.UserAchievement{UserID: userID, AchievementID: d.ID, XP: d.XP, Tokens: d.Tokens}, s.Progression.Curve)
+		if errors.Is(err, store.ErrDuplicate) {
+			continue // a concurrent request got there first
+		}
+		if err != nil {
+			log.Printf("Achievements: awarding %s to %s: %v", d.ID, userID, err)
+			continue
+		}
+		awarded = append(awarded, d)
+	}
+	if len(awarded) > 0 {
+		// Achievement XP can reach levels of its own
+		if u, err := s.Store.Users.Get(ctx, userID); err == nil {
+			s.payLevelRewards(ctx, userID, user.Level, u.Level)
+		}
+	}
+	return awarded
+}
+
+func (s *Server) achievementStats(ctx context.Context, user *models.User) (achievements.Stats, error) {
+	counted, err := s.Store.Achievements.Stats(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	progress, err := s.Store.Tests.CategoryProgress(ctx, user.ID, "")
+	if err != nil {
+		return nil, err
+	}
+	categories := 0
+	for _, c := range progress {
+		if c.TotalTests > 0 && c.CompletedTests >= c.TotalTests {
+			categories++
+		}
+	}
+	return achievements.Stats{
+		achievements.TestsCompleted:      counted.TestsCompleted,
+		achievements.Streak:              user.Streak,
+		achievements.CategoriesCompleted: categories,
+		achievements.PerfectScores:       counted.PerfectScores,
+		achievements.QuestionsAnswered:   counted.QuestionsAnswered,
+	}, nil
+}
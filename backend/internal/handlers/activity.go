@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"backend/internal/days"
+	"backend/internal/models"
+	"backend/internal/shop"
+	"backend/internal/store"
+	"backend/internal/streaks"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// advanceStreak counts today towards the user's streak, using up streak
+// freezes for missed days. It returns the streak afterwards and the update
+// it applied, whose EarnFreeze is only set if a freeze was actually earned.
+// Errors are logged: the result is already saved.
+func (s *Server) advanceStreak(ctx context.Context, user *models.User, today string) (int, store.StreakUpdate) {
+	streak, frozen := streaks.Advance(user.LastActiveDate, user.Streak, user.StreakFreezes, today)
+	if streak == user.Streak && user.LastActiveDate >= today {
+		return streak, store.StreakUpdate{}
+	}
+	update := store.StreakUpdate{Day: today, Streak: streak, Frozen: frozen,
+		EarnFreeze: streaks.EarnsFreeze(streak) && streak > user.Streak, MaxFreezes: shop.MaxStreakFreezes}
+	held, err := s.Store.Users.UpdateStreak(ctx, user.ID, update)
+	if errors.Is(err, store.ErrConflict) {
+		// Another submission counted the day first
+		if u, err := s.Store.Users.Get(ctx, user.ID); err == nil {
+			return u.Streak, store.StreakUpdate{}
+		}
+		return user.Streak, store.StreakUpdate{}
+	}
+	if err != nil {
+		log.Printf("Error updating streak: %v", err)
+		return user.Streak, store.StreakUpdate{}
+	}
+	update.EarnFreeze = update.EarnFreeze && held > user.StreakFreezes-len(frozen)
+	return streak, update
+}
+
+// recordActivity adds to the user's activity log, logging errors like
+// advanceStreak does.
+func (s *Server) recordActivity(ctx context.Context, a *models.DailyActivity) {
+	if err := s.Store.Activity.Record(ctx, a); err != nil {
+		log.Printf("Error recording activity for %s: %v", a.UserID, err)
+	}
+}
+
+// ActivityResponse is the user's practice calendar for the last Days days
+// up to Today, in their timezone. Streak is the streak as it stands today,
+// which is 0 once it's broken even before the user practices again.
+type ActivityResponse struct {
+	Timezone      string                 `json:"timezone"`
+	Today         string                 `json:"today"`
+	From          string                 `json:"from"`
+	Streak        int                    `json:"streak"`
+	StreakFreezes int                    `json:"streak_freezes"`
+	MaxFreezes    int                    `json:"max_streak_freezes"`
+	EarnEvery     int                    `json:"freeze_earned_every"` // days of streak
+	Days          []models.DailyActivity `json:"days"`
+}
+
+// ActivityHandler returns the calendar heatmap of the days the user
+// practiced: ?days= (1-366, default 365) days ending today.
+func (s *Server) ActivityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	span := 365
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 366 {
+			http.Error(w, "days must be between 1 and 366", http.StatusBadRequest)
+			return
+		}
+		span = n
+	}
+
+	ctx := r.Context()
+	user, err := s.Store.Users.Get(ctx, userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	loc := userLocation(user)
+	today := days.Today(time.Now(), loc)
+	resp := ActivityResponse{
+		Timezone:      loc.String(),
+		Today:         today,
+		From:          days.Add(today, 1-span),
+		Streak:        streaks.Current(user.LastActiveDate, user.Streak, user.StreakFreezes, today),
+		StreakFreezes: user.StreakFreezes,
+		MaxFreezes:    shop.MaxStreakFreezes,
+		EarnEvery:     streaks.EarnEvery,
+	}
+	if resp.Days, err = s.Store.Activity.List(ctx, userID, resp.From, today); err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
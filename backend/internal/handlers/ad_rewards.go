@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"backend/internal/admob"
+	"backend/internal/days"
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// adWatchTokens is what one rewarded ad view is worth.
+const adWatchTokens = 5
+
+// grantAdReward credits one ad view unless the user's daily cap, counted per
+// day in their timezone like the other daily rewards, is used up.
+func (s *Server) grantAdReward(ctx context.Context, t *models.TokenTransaction) error {
+	user, err := s.Store.Users.Get(ctx, t.UserID)
+	if err != nil {
+		return err
+	}
+	t.Amount, t.Reason = adWatchTokens, "ad_watch"
+	dayStart := days.Start(time.Now(), userLocation(user))
+	return s.Store.Tokens.RecordCapped(ctx, t, dayStart, s.AdRewardDailyCap)
+}
+
+// AdMobCallbackHandler serves GET /api/v1/rewards/admob/ssv, the server-side
+// verification callback AdMob calls after a rewarded ad was watched. The app
+// puts the user ID in the ad request's custom data; the signature covers it,
+// so the callback can't be replayed for someone else. Callbacks that can never
+// be credited still get a 200, since AdMob retries anything else.
+func (s *Server) AdMobCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.AdMob == nil {
+		http.Error(w, "Ad verification is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	reward, err := s.AdMob.Verify(r.Context(), r.URL.RawQuery)
+	if errors.Is(err, admob.ErrInvalidSignature) {
+		log.Printf("Rejected AdMob callback: %v", err)
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, admob.ErrUnknownAdUnit) {
+		log.Printf("Rejected AdMob callback: %v", err)
+		http.Error(w, "Unknown ad unit", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Printf("AdMob callback verification failed: %v", err)
+		http.Error(w, "Verification failed", http.StatusServiceUnavailable)
+		return
+	}
+
+	resp := map[string]interface{}{"transaction_id": reward.TransactionID, "credited": false}
+	if reward.CustomData == "" {
+		// The AdMob console's test callback carries no custom data
+		resp["reason"] = "no user"
+	} else {
+		t := &models.TokenTransaction{UserID: reward.CustomData, Reference: reward.TransactionID,
+			IdempotencyKey: "admob:" + reward.TransactionID}
+		switch err := s.grantAdReward(r.Context(), t); {
+		case err == nil:
+			resp["credited"] = true
+			resp["added"] = t.Amount
+		case errors.Is(err, store.ErrDuplicate):
+			resp["reason"] = "duplicate"
+		case errors.Is(err, store.ErrLimitReached):
+			resp["reason"] = "daily limit reached"
+		case errors.Is(err, store.ErrNotFound):
+			resp["reason"] = "unknown user"
+		default:
+			storeError(w, err, "User not found")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
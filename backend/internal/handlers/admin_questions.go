@@ -3,17 +3,19 @@ package handlers
 import (
 	"backend/internal/database"
 	"backend/internal/models"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 // CreateQuestionHandler adds a new question
-func CreateQuestionHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) CreateQuestionHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -25,54 +27,43 @@ func CreateQuestionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if q.ID == "" {
-		id, err := uuid.NewV7()
-		if err != nil {
-			http.Error(w, "UUID generation failed", http.StatusInternalServerError)
-			return
-		}
-		q.ID = id.String()
-	}
-
 	// Validate TestID presence
 	if q.TestID == "" {
 		http.Error(w, "TestID is required", http.StatusBadRequest)
 		return
 	}
 
-	optionsJson, _ := json.Marshal(q.Options)
-	solutionJson, _ := json.Marshal(q.Solution)
-	metadataJson, _ := json.Marshal(q.Metadata)
-
-	_, err := database.DB.Exec(`INSERT INTO questions 
-		(id, test_id, question_id, category, subject, topic, sub_topic, difficulty, skill_level, text, options, solution, metadata, image_url, related_concept_id) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
-		q.ID, q.TestID, q.QuestionID, q.Category, q.Subject, q.Topic, q.SubTopic, q.Difficulty, q.SkillLevel, q.Text, optionsJson, solutionJson, metadataJson, q.ImageURL, q.RelatedConceptID)
-
-	if err != nil {
-		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+	if err := s.Store.Questions.Create(r.Context(), &q); err != nil {
+		storeError(w, err, "Test not found")
 		return
 	}
+	s.audit(r, "question.create", "question", q.ID, nil, q)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(q)
 }
 
+// questionIDFromPath extracts {id} from /api/v1/admin/questions/{id}.
+func questionIDFromPath(path string) string {
+	parts := strings.Split(path, "/")
+	if len(parts) < 6 {
+		return ""
+	}
+	return parts[len(parts)-1]
+}
+
 // UpdateQuestionHandler updates an existing question
-func UpdateQuestionHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) UpdateQuestionHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Extract ID from URL path (assuming /api/v1/admin/questions/{id})
-	// Current router uses simple prefix matching, so we need to parse carefully
-	parts := strings.Split(r.URL.Path, "/")
-	if len(parts) < 6 || parts[len(parts)-1] == "" {
+	id := questionIDFromPath(r.URL.Path)
+	if id == "" {
 		http.Error(w, "ID required in URL", http.StatusBadRequest)
 		return
 	}
-	id := parts[len(parts)-1]
 
 	var q models.Question
 	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
@@ -81,78 +72,141 @@ func UpdateQuestionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	q.ID = id
 
-	optionsJson, _ := json.Marshal(q.Options)
-	solutionJson, _ := json.Marshal(q.Solution)
-	metadataJson, _ := json.Marshal(q.Metadata)
-
-	result, err := database.DB.Exec(`UPDATE questions SET
-		test_id=$1, question_id=$2, category=$3, subject=$4, topic=$5, sub_topic=$6, difficulty=$7, skill_level=$8, text=$9, options=$10, solution=$11, metadata=$12, image_url=$13, related_concept_id=$14
-		WHERE id=$15`,
-		q.TestID, q.QuestionID, q.Category, q.Subject, q.Topic, q.SubTopic, q.Difficulty, q.SkillLevel, q.Text, optionsJson, solutionJson, metadataJson, q.ImageURL, q.RelatedConceptID, q.ID)
-
+	before, err := s.Store.Questions.Get(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		storeError(w, err, "Question not found")
 		return
 	}
-
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		http.Error(w, "Question not found", http.StatusNotFound)
+	if err := s.Store.Questions.Update(r.Context(), &q); err != nil {
+		storeError(w, err, "Question not found")
 		return
 	}
+	s.audit(r, "question.update", "question", id, before, q)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(q)
 }
 
 // DeleteQuestionHandler deletes a question
-func DeleteQuestionHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) DeleteQuestionHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	parts := strings.Split(r.URL.Path, "/")
-	if len(parts) < 6 || parts[len(parts)-1] == "" {
+	id := questionIDFromPath(r.URL.Path)
+	if id == "" {
 		http.Error(w, "ID required in URL", http.StatusBadRequest)
 		return
 	}
-	id := parts[len(parts)-1]
 
-	_, err := database.DB.Exec("DELETE FROM questions WHERE id=$1", id)
+	before, err := s.Store.Questions.Get(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		storeError(w, err, "Question not found")
+		return
+	}
+	if err := s.Store.Questions.Delete(r.Context(), id); err != nil {
+		storeError(w, err, "Question not found")
 		return
 	}
+	s.audit(r, "question.delete", "question", id, before, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// SyncQuestionsHandler triggers the seed logic manually
-func SyncQuestionsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+const (
+	// cleanSyncAction is the confirmation token action of a pruning sync.
+	cleanSyncAction = "content.sync.clean"
+	confirmationTTL = 10 * time.Minute
+	// confirmationNonce is the NonceStore purpose of confirmation token IDs.
+	confirmationNonce = "confirmation"
+)
+
+// issueConfirmation returns a confirmation token for action and records its
+// ID, so that useConfirmation accepts it once.
+func (s *Server) issueConfirmation(ctx context.Context, userID, action string) (string, error) {
+	raw, claims, err := s.Tokens.IssueConfirmation(userID, action, confirmationTTL)
+	if err != nil {
+		return "", err
+	}
+	if err := s.Store.Nonces.Issue(ctx, confirmationNonce, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// useConfirmation checks that raw confirms action for userID and uses it up.
+// ErrNotFound means it was used before.
+func (s *Server) useConfirmation(ctx context.Context, raw, userID, action string) error {
+	claims, err := s.Tokens.CheckConfirmation(raw, userID, action)
+	if err != nil {
+		return err
+	}
+	return s.Store.Nonces.Consume(ctx, confirmationNonce, claims.ID, time.Now())
+}
+
+// SyncQuestionsHandler reconciles the questions table with the JSON files and
+// returns the diff. Pass dry_run=true to preview the changes without applying them;
+// clean=true also retires legacy questions that are no longer in any file.
+// test_results are never touched.
+//
+// Only POST is served, so a link or prefetch can't start a sync. A clean
+// sync is destructive: its dry run returns a confirmation_token that the
+// real run must pass back as confirm, once, and the database is
+// snapshotted before it starts.
+func (s *Server) SyncQuestionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	clean := r.URL.Query().Get("clean") == "true"
-	if clean {
-		log.Println("ADMIN: Truncating tables for fresh sync...")
-		_, _ = database.DB.Exec("TRUNCATE questions, test_results, tests CASCADE")
+	opts := database.SyncOptions{
+		DryRun: r.URL.Query().Get("dry_run") == "true",
+		Prune:  r.URL.Query().Get("clean") == "true",
+	}
+	userID, _ := r.Context().Value("userID").(string)
+	if opts.Prune && !opts.DryRun {
+		if err := s.useConfirmation(r.Context(), r.URL.Query().Get("confirm"), userID, cleanSyncAction); err != nil {
+			http.Error(w, "A clean sync must be confirmed: run it with dry_run=true first and pass its confirmation_token as confirm",
+				http.StatusPreconditionRequired)
+			return
+		}
 	}
+	if s.SyncContent == nil {
+		http.Error(w, "Content sync is not available", http.StatusServiceUnavailable)
+		return
+	}
+	log.Printf("ADMIN: Syncing questions (dry run: %t, prune: %t)", opts.DryRun, opts.Prune)
 
-	database.SeedData()
+	report, err := s.SyncContent(opts)
+	if err != nil {
+		http.Error(w, "Sync failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !opts.DryRun {
+		s.audit(r, "content.sync", "questions", "", nil, map[string]interface{}{
+			"prune": opts.Prune, "added": report.Added, "updated": report.Updated,
+			"retired": report.Retired, "tests_created": report.TestsCreated, "backup": report.Backup,
+		})
+	}
+
+	resp := struct {
+		*database.SyncReport
+		ConfirmationToken string `json:"confirmation_token,omitempty"`
+	}{SyncReport: report}
+	if opts.Prune && opts.DryRun {
+		if resp.ConfirmationToken, err = s.issueConfirmation(r.Context(), userID, cleanSyncAction); err != nil {
+			http.Error(w, "Failed to issue confirmation token", http.StatusInternalServerError)
+			return
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"status": "Sync successful",
-		"mode":   "Clean: " + r.URL.Query().Get("clean"),
-	})
+	json.NewEncoder(w).Encode(resp)
 }
 
 // BulkCreateQuestionsHandler adds multiple questions at once from a JSON array
-func BulkCreateQuestionsHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) BulkCreateQuestionsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -169,6 +223,7 @@ func BulkCreateQuestionsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx := r.Context()
 	questionsPerTest := 100
 	insertedCount := 0
 	skippedCount := 0
@@ -176,9 +231,7 @@ func BulkCreateQuestionsHandler(w http.ResponseWriter, r *http.Request) {
 
 	for i, q := range questions {
 		// Check if question already exists
-		var existingID string
-		err := database.DB.QueryRow("SELECT id FROM questions WHERE question_id = $1", q.QuestionID).Scan(&existingID)
-		if err == nil {
+		if exists, err := s.Store.Questions.ExistsByQuestionID(ctx, q.QuestionID); err != nil || exists {
 			skippedCount++
 			continue
 		}
@@ -190,36 +243,35 @@ func BulkCreateQuestionsHandler(w http.ResponseWriter, r *http.Request) {
 			}
 			testTitle := fmt.Sprintf("%s - Deneme %d (Bulk Upload)", category, (i/questionsPerTest)+1)
 
-			var testID string
-			err := database.DB.QueryRow("SELECT id FROM tests WHERE title = $1", testTitle).Scan(&testID)
+			t, err := s.Store.Tests.GetByTitle(ctx, testTitle)
 			if err != nil {
-				newUUID, _ := uuid.NewV7()
-				testID = newUUID.String()
-				_, _ = database.DB.Exec("INSERT INTO tests (id, title, description) VALUES ($1, $2, $3)",
-					testID, testTitle, "ÖABT "+category+" Alan Bilgisi (Uploaded)")
+				t = &models.Test{
+					Title:       testTitle,
+					Description: "ÖABT " + category + " Alan Bilgisi (Uploaded)",
+					Exam:        database.DefaultExamSlug,
+				}
+				if err := s.Store.Tests.Create(ctx, t); err != nil {
+					log.Printf("Bulk upload: creating test %q: %v", testTitle, err)
+				}
 			}
-			currentTestID = testID
+			currentTestID = t.ID
 		}
 
-		qID, _ := uuid.NewV7()
-		if q.ID != "" {
-			qID, _ = uuid.Parse(q.ID)
+		if _, err := uuid.Parse(q.ID); err != nil {
+			q.ID = ""
 		}
-
-		optionsJson, _ := json.Marshal(q.Options)
-		solutionJson, _ := json.Marshal(q.Solution)
-		metadataJson, _ := json.Marshal(q.Metadata)
-
-		_, err = database.DB.Exec(`INSERT INTO questions 
-			(id, test_id, question_id, category, subject, topic, sub_topic, difficulty, skill_level, text, options, solution, metadata, image_url, related_concept_id) 
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
-			qID.String(), currentTestID, q.QuestionID, q.Category, q.Subject, q.Topic, q.SubTopic, q.Difficulty, q.SkillLevel, q.Text, optionsJson, solutionJson, metadataJson, q.ImageURL, q.RelatedConceptID)
-
-		if err == nil {
-			insertedCount++
+		q.TestID = currentTestID
+		if err := s.Store.Questions.Create(ctx, &q); err != nil {
+			log.Printf("Bulk upload: inserting %s: %v", q.QuestionID, err)
+			continue
 		}
+		insertedCount++
 	}
 
+	s.audit(r, "question.bulk_create", "questions", "", nil, map[string]int{
+		"inserted": insertedCount, "skipped": skippedCount,
+	})
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message":  "Bulk upload completed",
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"backend/internal/models"
+	"backend/internal/permissions"
+	"backend/internal/store"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+// audit appends an entry for an admin action. before and after are
+// snapshots of the target and may be nil. A failed write is logged rather
+// than failing a change that has already been applied.
+func (s *Server) audit(r *http.Request, action, targetType, targetID string, before, after any) {
+	actorID, _ := r.Context().Value("userID").(string)
+	e := models.AuditEntry{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Before:     snapshot(before),
+		After:      snapshot(after),
+	}
+	if err := s.Store.Audit.Append(r.Context(), &e); err != nil {
+		log.Printf("Audit: recording %s on %s %s by %s: %v", action, targetType, targetID, actorID, err)
+	}
+}
+
+func snapshot(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Audit: encoding snapshot: %v", err)
+		return nil
+	}
+	return raw
+}
+
+// ListRolesHandler returns every assignable role with its permissions.
+func (s *Server) ListRolesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(permissions.Roles())
+}
+
+// SetUserRoleHandler handles PUT /api/v1/admin/users/{id}/role. Changing a
+// role signs the user out everywhere so new tokens pick up the permissions.
+func (s *Server) SetUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/api/v1/admin/users/")
+	targetID, suffix, _ := strings.Cut(rest, "/")
+	if targetID == "" || suffix != "role" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	var payload struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !permissions.Valid(payload.Role) {
+		http.Error(w, "Unknown role: "+payload.Role, http.StatusBadRequest)
+		return
+	}
+
+	// Keeps an admin from locking themselves (and possibly everyone) out
+	actorID, _ := r.Context().Value("userID").(string)
+	if targetID == actorID {
+		http.Error(w, "You cannot change your own role", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := s.Store.Users.Get(ctx, targetID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	before := map[string]string{"role": user.Role}
+	if user.Role != payload.Role {
+		if err := s.Store.Users.SetRole(ctx, targetID, payload.Role); err != nil {
+			storeError(w, err, "User not found")
+			return
+		}
+		s.audit(r, "user.role_change", "user", targetID, before, map[string]string{"role": payload.Role})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"user_id": targetID,
+		"role":    payload.Role,
+		"changed": user.Role != payload.Role,
+	})
+}
+
+// AuditLogHandler returns audit entries, newest first. Filters: actor_id,
+// action, target_type, target_id, before (RFC 3339, for paging) and limit.
+func (s *Server) AuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	filter := store.AuditFilter{
+		ActorID:    q.Get("actor_id"),
+		Action:     q.Get("action"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+		Limit:      defaultAuditLimit,
+	}
+	if v := q.Get("before"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			http.Error(w, "before must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		filter.Before = t
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = min(n, maxAuditLimit)
+	}
+
+	entries, err := s.Store.Audit.List(r.Context(), filter)
+	if err != nil {
+		storeError(w, err, "Not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// TokenReconcileHandler reports users whose cached token balance differs from
+// the sum of their ledger entries. An empty list means the books balance.
+func (s *Server) TokenReconcileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	drift, err := s.Store.Tokens.Reconcile(r.Context())
+	if err != nil {
+		storeError(w, err, "Not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"checked_at": time.Now().UTC(),
+		"drift":      drift,
+	})
+}
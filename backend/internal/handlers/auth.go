@@ -1,12 +1,74 @@
 package handlers
 
 import (
+	"backend/internal/authtoken"
+	"backend/internal/credentials"
 	"backend/internal/middleware"
+	"backend/internal/models"
+	"backend/internal/store"
 	"encoding/json"
+	"errors"
+	"log"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 )
 
-func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+// refreshTokenTTL is how long a session survives without being refreshed.
+const refreshTokenTTL = 30 * 24 * time.Hour
+
+// startSession opens a session for the device making the request and returns
+// the token payload shared by every login endpoint. Clients may name the
+// device with the X-Device-Name header; it is shown in the session list.
+func (s *Server) startSession(r *http.Request, userID, message string) (map[string]interface{}, error) {
+	refreshToken, hash, err := credentials.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	sess := &models.Session{
+		UserID:     userID,
+		DeviceName: strings.TrimSpace(r.Header.Get("X-Device-Name")),
+		UserAgent:  r.UserAgent(),
+		IP:         ip,
+		ExpiresAt:  time.Now().Add(refreshTokenTTL),
+	}
+	if err := s.Store.Sessions.Create(r.Context(), sess, hash); err != nil {
+		return nil, err
+	}
+	// Signing in during the grace period keeps the account
+	cancelled, err := s.Store.Users.CancelDeletion(r.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.Tokens.Issue(userID, sess.ID)
+	if err != nil {
+		return nil, err
+	}
+	resp := map[string]interface{}{
+		"id":            userID,
+		"session_id":    sess.ID,
+		"access_token":  token,
+		"refresh_token": refreshToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(authtoken.AccessTTL.Seconds()),
+		"message":       message,
+	}
+	if cancelled {
+		resp["deletion_cancelled"] = true
+	}
+	return resp, nil
+}
+
+// RefreshTokenHandler swaps a refresh token for a new access and refresh
+// token pair. Each refresh token works once; presenting a rotated one again
+// means it was copied, so the whole session is revoked.
+func (s *Server) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCors(&w)
 	if r.Method != "POST" {
 		return
@@ -20,32 +82,138 @@ func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if requestBody.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
 
-	// Validate refresh token
-	claims, err := middleware.ValidateToken(requestBody.RefreshToken)
+	newRefreshToken, newHash, err := credentials.NewSecret()
 	if err != nil {
+		http.Error(w, "Failed to generate refresh token", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	sess, err := s.Store.Sessions.Rotate(r.Context(), credentials.HashSecret(requestBody.RefreshToken), newHash, now, now.Add(refreshTokenTTL))
+	switch {
+	case errors.Is(err, store.ErrTokenReused):
+		log.Printf("Refresh: reused refresh token, session revoked")
 		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
 		return
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	case err != nil:
+		storeError(w, err, "Session not found")
+		return
 	}
 
 	// Generate new access token
-	newToken, err := middleware.GenerateToken(claims.UserID)
+	newToken, err := s.Tokens.Issue(sess.UserID, sess.ID)
 	if err != nil {
 		http.Error(w, "Failed to generate new token", http.StatusInternalServerError)
 		return
 	}
 
-	// Generate new refresh token
-	newRefreshToken, err := middleware.GenerateRefreshToken(claims.UserID)
-	if err != nil {
-		http.Error(w, "Failed to generate refresh token", http.StatusInternalServerError)
-		return
-	}
-
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"access_token":  newToken,
 		"refresh_token": newRefreshToken,
 		"token_type":    "Bearer",
-		"expires_in":    72 * 3600, // 72 hours in seconds
+		"expires_in":    int(authtoken.AccessTTL.Seconds()),
 	})
 }
+
+// GetSessionsHandler lists the signed-in devices of the current user.
+func (s *Server) GetSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	userID, _ := r.Context().Value("userID").(string)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := s.Store.Sessions.List(r.Context(), userID, time.Now())
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	current, _ := r.Context().Value("sessionID").(string)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// LogoutHandler ends the current session, or the one named by session_id
+// (e.g. to sign out a lost device).
+func (s *Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := r.Context().Value("userID").(string)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var payload struct {
+		SessionID string `json:"session_id"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if payload.SessionID == "" {
+		payload.SessionID, _ = r.Context().Value("sessionID").(string)
+	}
+	if payload.SessionID == "" {
+		http.Error(w, "session_id is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Store.Sessions.Revoke(r.Context(), userID, payload.SessionID); err != nil {
+		storeError(w, err, "Session not found")
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// LogoutAllHandler ends every session of the current user, including this one.
+func (s *Server) LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := r.Context().Value("userID").(string)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	n, err := s.Store.Sessions.RevokeAll(r.Context(), userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "revoked": n})
+}
+
+// JWKSHandler publishes the public keys access tokens can be verified with.
+func (s *Server) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": s.Tokens.JWKS()})
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"backend/internal/days"
+	"backend/internal/models"
+	"backend/internal/rewards"
+	"backend/internal/store"
+	"backend/internal/streaks"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+type dailyRewardDay struct {
+	Day     int  `json:"day"`
+	Tokens  int  `json:"tokens"`
+	Claimed bool `json:"claimed"`
+}
+
+// DailyRewardStatus tells the app what the daily login reward looks like for
+// the user right now.
+type DailyRewardStatus struct {
+	Claimable bool   `json:"claimable"`
+	Today     string `json:"today"` // in Timezone
+	Timezone  string `json:"timezone"`
+	// Day is the calendar day of the next claim: today's if claimable,
+	// tomorrow's otherwise. Tokens and StreakBonus are what it pays.
+	Day         int `json:"day"`
+	Tokens      int `json:"tokens"`
+	StreakBonus int `json:"streak_bonus"`
+	// NextClaimAt is set while today's reward is claimed: tomorrow's midnight.
+	NextClaimAt *time.Time               `json:"next_claim_at,omitempty"`
+	Calendar    []dailyRewardDay         `json:"calendar"`
+	LastClaim   *models.DailyRewardClaim `json:"last_claim"`
+}
+
+func (s *Server) dailyRewardStatus(r *http.Request, user *models.User) (*DailyRewardStatus, error) {
+	last, err := s.Store.Daily.Last(r.Context(), user.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		last, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now, loc := time.Now(), userLocation(user)
+	st := &DailyRewardStatus{
+		Today:     days.Today(now, loc),
+		Timezone:  loc.String(),
+		LastClaim: last,
+	}
+	// A streak that lapsed since the user last practiced earns no bonus
+	st.StreakBonus = rewards.StreakBonus(streaks.Current(user.LastActiveDate, user.Streak, user.StreakFreezes, st.Today))
+	lastDay, lastCalendarDay, claimed := "", 0, 0
+	if last != nil {
+		lastDay, lastCalendarDay = last.Day, last.CalendarDay
+	}
+	if lastDay >= st.Today {
+		// Already claimed today; a timezone change can't earn a second claim
+		st.Day = rewards.NextDay(lastDay, lastCalendarDay, days.Add(lastDay, 1))
+		next := days.NextMidnight(now, loc)
+		st.NextClaimAt = &next
+		claimed = lastCalendarDay
+	} else {
+		st.Claimable = true
+		st.Day = rewards.NextDay(lastDay, lastCalendarDay, st.Today)
+		claimed = st.Day - 1
+	}
+	st.Tokens = rewards.Tokens(st.Day)
+
+	for i, tokens := range rewards.Calendar() {
+		st.Calendar = append(st.Calendar, dailyRewardDay{Day: i + 1, Tokens: tokens, Claimed: i < claimed})
+	}
+	return st, nil
+}
+
+// DailyRewardHandler serves /api/v1/user/daily-reward: GET returns the
+// status, POST claims today's reward.
+func (s *Server) DailyRewardHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		user, err := s.Store.Users.Get(r.Context(), userID)
+		if err != nil {
+			storeError(w, err, "User not found")
+			return
+		}
+		st, err := s.dailyRewardStatus(r, user)
+		if err != nil {
+			storeError(w, err, "User not found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(st)
+	case http.MethodPost:
+		s.claimDailyReward(w, r, userID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// claimDailyReward claims today's reward, answering 409 with the status if
+// it was already claimed.
+func (s *Server) claimDailyReward(w http.ResponseWriter, r *http.Request, userID string) {
+	user, err := s.Store.Users.Get(r.Context(), userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	st, err := s.dailyRewardStatus(r, user)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	claim := &models.DailyRewardClaim{UserID: userID, Day: st.Today, CalendarDay: st.Day, Tokens: st.Tokens, Bonus: st.StreakBonus}
+	if st.Claimable {
+		err = s.Store.Daily.Claim(r.Context(), claim)
+	}
+	if !st.Claimable || errors.Is(err, store.ErrDuplicate) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "Daily reward already claimed",
+			"status":  st,
+		})
+		return
+	}
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+
+	balance, err := s.Store.Tokens.Balance(r.Context(), userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"added":        claim.Tokens + claim.Bonus,
+		"new_balance":  balance,
+		"calendar_day": claim.CalendarDay,
+		"streak_bonus": claim.Bonus,
+		"claim":        claim,
+		"message":      "Reward granted",
+	})
+}
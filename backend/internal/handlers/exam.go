@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/store"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// examScope returns the exam slug a listing should be limited to: the explicit
+// ?exam= parameter, or else the exam the user selected in their profile.
+// An empty result means no exam filter.
+func (s *Server) examScope(r *http.Request, userID string) string {
+	if exam := r.URL.Query().Get("exam"); exam != "" {
+		return exam
+	}
+	if userID == "" {
+		return ""
+	}
+
+	u, err := s.Store.Users.Get(r.Context(), userID)
+	if err != nil {
+		return ""
+	}
+	return u.SelectedExam
+}
+
+func (s *Server) GetExamsHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	exams, err := s.Store.Tests.Exams(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(exams)
+}
+
+// GetExamTaxonomyHandler returns the category -> subject -> topic tree of an
+// exam. URL: /exams/{slug}/taxonomy
+func (s *Server) GetExamTaxonomyHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 3 || parts[2] != "taxonomy" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	examSlug := parts[1]
+
+	categories, err := s.Store.Tests.ExamTaxonomy(r.Context(), examSlug)
+	if err != nil {
+		storeError(w, err, "Exam not found")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"exam":       examSlug,
+		"categories": categories,
+	})
+}
+
+// SelectExamHandler stores the exam the user is preparing for.
+func (s *Server) SelectExamHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := r.Context().Value("userID").(string)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var payload struct {
+		Exam string `json:"exam"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := s.Store.Users.SelectExam(r.Context(), userID, payload.Exam)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Unknown exam", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error updating user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "selected_exam": payload.Exam})
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"backend/internal/export"
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// exportSyncLimit is the largest number of test results exported within
+	// the request; bigger accounts get a background export.
+	exportSyncLimit = 1000
+	exportRetention = 7 * 24 * time.Hour
+	// exportStaleAfter is how long a pending export may run before a new
+	// request starts another one.
+	exportStaleAfter = time.Hour
+	exportTimeout    = 10 * time.Minute
+)
+
+// ExportHandler serves GET /api/v1/user/export, the KVKK/GDPR access
+// request. Small accounts receive the zip archive directly. Large accounts,
+// or any request with async=true, get 202 and an export to poll at
+// /api/v1/user/export/{id}.
+func (s *Server) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, _ := r.Context().Value("userID").(string)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ctx := r.Context()
+
+	async := r.URL.Query().Get("async") == "true"
+	if !async {
+		n, err := s.Store.Results.CountForUser(ctx, userID)
+		if err != nil {
+			storeError(w, err, "User not found")
+			return
+		}
+		async = n > exportSyncLimit
+	}
+
+	if !async {
+		data, err := export.Collect(ctx, s.Store, userID, time.Now())
+		if err != nil {
+			storeError(w, err, "User not found")
+			return
+		}
+		archive, err := data.Archive()
+		if err != nil {
+			log.Printf("Export: building archive for %s: %v", userID, err)
+			http.Error(w, "Failed to build export", http.StatusInternalServerError)
+			return
+		}
+		writeArchive(w, archive, data.ExportedAt)
+		return
+	}
+
+	if n, err := s.Store.Exports.DeleteExpired(ctx, time.Now()); err != nil {
+		log.Printf("Export: deleting expired exports: %v", err)
+	} else if n > 0 {
+		log.Printf("Export: deleted %d expired exports", n)
+	}
+
+	job, err := s.Store.Exports.Pending(ctx, userID, time.Now().Add(-exportStaleAfter))
+	if errors.Is(err, store.ErrNotFound) {
+		job = &models.DataExport{UserID: userID}
+		if err = s.Store.Exports.Create(ctx, job); err == nil {
+			// Detached from the request so the export outlives it
+			go s.runExport(context.WithoutCancel(ctx), job.ID, userID)
+		}
+	}
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/v1/user/export/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(exportResponse(job))
+}
+
+// runExport builds an archive in the background and records the outcome.
+func (s *Server) runExport(ctx context.Context, id, userID string) {
+	ctx, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+
+	var archive []byte
+	data, err := export.Collect(ctx, s.Store, userID, time.Now())
+	if err == nil {
+		archive, err = data.Archive()
+	}
+	if err != nil {
+		log.Printf("Export: %s for %s failed: %v", id, userID, err)
+		if err := s.Store.Exports.Fail(ctx, id, "Export failed, please try again"); err != nil {
+			log.Printf("Export: marking %s failed: %v", id, err)
+		}
+		return
+	}
+	if err := s.Store.Exports.Finish(ctx, id, archive, time.Now().Add(exportRetention)); err != nil {
+		log.Printf("Export: saving %s: %v", id, err)
+	}
+}
+
+// ExportStatusHandler serves GET /api/v1/user/export/{id} with the export's
+// status and GET /api/v1/user/export/{id}/download with the archive once
+// it's ready.
+func (s *Server) ExportStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, _ := r.Context().Value("userID").(string)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/api/v1/user/export/")
+	id, suffix, _ := strings.Cut(rest, "/")
+	if id == "" || (suffix != "" && suffix != "download") {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	job, err := s.Store.Exports.Get(r.Context(), userID, id)
+	if err != nil {
+		storeError(w, err, "Export not found")
+		return
+	}
+
+	if suffix == "download" {
+		archive, err := s.Store.Exports.Archive(r.Context(), userID, id, time.Now())
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Export is not ready or has expired", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			storeError(w, err, "Export not found")
+			return
+		}
+		writeArchive(w, archive, *job.CompletedAt)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exportResponse(job))
+}
+
+func exportResponse(job *models.DataExport) map[string]interface{} {
+	resp := map[string]interface{}{
+		"export":     job,
+		"status_url": "/api/v1/user/export/" + job.ID,
+	}
+	if job.Status == "ready" {
+		resp["download_url"] = "/api/v1/user/export/" + job.ID + "/download"
+	}
+	return resp
+}
+
+func writeArchive(w http.ResponseWriter, archive []byte, at time.Time) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="kisisel-veriler-`+at.Format("2006-01-02")+`.zip"`)
+	w.Write(archive)
+}
@@ -0,0 +1,2059 @@
+package handlers_test
+
+import (
+	"archive/zip"
+	"backend/internal/achievements"
+	"backend/internal/admob"
+	"backend/internal/admob/admobtest"
+	"backend/internal/appenv"
+	"backend/internal/authtoken"
+	"backend/internal/database"
+	"backend/internal/days"
+	"backend/internal/handlers"
+	"backend/internal/iap"
+	"backend/internal/iap/iaptest"
+	"backend/internal/identity"
+	"backend/internal/identity/identitytest"
+	"backend/internal/jobs"
+	"backend/internal/leaderboard"
+	"backend/internal/leagues"
+	"backend/internal/mail"
+	"backend/internal/models"
+	"backend/internal/progression"
+	"backend/internal/ratelimit"
+	"backend/internal/routes"
+	"backend/internal/shop"
+	"backend/internal/store"
+	"backend/internal/store/memory"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testEnv is a full router backed by the in-memory store.
+type testEnv struct {
+	t     *testing.T
+	store *store.Store
+	mux   *http.ServeMux
+	srv   *handlers.Server
+	keys  *identitytest.KeyServer // signs Google and Apple ID tokens
+	mail  *mailbox
+}
+
+// mailbox records the messages the server sends.
+type mailbox struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (m *mailbox) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// lastToken returns the token query parameter of the last link mailed to addr.
+func (m *mailbox) lastToken(t *testing.T, addr string) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.sent) - 1; i >= 0; i-- {
+		if m.sent[i].To != addr {
+			continue
+		}
+		for _, field := range strings.Fields(m.sent[i].Body) {
+			if u, err := url.Parse(field); err == nil && u.Query().Get("token") != "" {
+				return u.Query().Get("token")
+			}
+		}
+	}
+	t.Fatalf("no verification link mailed to %s", addr)
+	return ""
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	st := memory.New()
+	keys := identitytest.NewKeyServer(t)
+
+	key, err := authtoken.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := authtoken.NewIssuer(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := handlers.NewServer(st, tokens)
+	// The tests use the development shortcuts; servers run as production unless told
+	srv.Env = appenv.Development
+	srv.Identity = identity.NewVerifier(
+		&identity.Provider{Name: "google", Issuers: []string{"https://accounts.google.com"}, Audiences: []string{"test-client"}, Keys: identity.NewKeySet(keys.URL)},
+		&identity.Provider{Name: "apple", Issuers: []string{"https://appleid.apple.com"}, Audiences: []string{"test-client"}, Keys: identity.NewKeySet(keys.URL), HashedNonce: true},
+	)
+	box := &mailbox{}
+	srv.Mailer = box
+	srv.VerifyEmailURL = "https://app.example.com/verify"
+	return &testEnv{t: t, store: st, mux: routes.RegisterRoutes(srv), srv: srv, keys: keys, mail: box}
+}
+
+// do sends a request through the router. body is JSON-encoded unless nil;
+// token, when set, is sent as a bearer token.
+func (e *testEnv) do(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	e.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			e.t.Fatalf("encoding body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	e.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// decode fails the test unless rec has the wanted status, then unmarshals its body into v.
+func (e *testEnv) decode(rec *httptest.ResponseRecorder, wantStatus int, v interface{}) {
+	e.t.Helper()
+	if rec.Code != wantStatus {
+		e.t.Fatalf("status = %d, want %d (body: %s)", rec.Code, wantStatus, rec.Body.String())
+	}
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			e.t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+		}
+	}
+}
+
+// user creates a user directly in the store and returns it with an access token.
+func (e *testEnv) user(nickname string, edit func(u *models.User)) (*models.User, string) {
+	e.t.Helper()
+	u := &models.User{Nickname: nickname, Emoji: "🙂"}
+	if edit != nil {
+		edit(u)
+	}
+	if err := e.store.Users.Create(context.Background(), u); err != nil {
+		e.t.Fatalf("creating user %s: %v", nickname, err)
+	}
+	token, err := e.srv.Tokens.Issue(u.ID, "")
+	if err != nil {
+		e.t.Fatalf("generating token: %v", err)
+	}
+	return u, token
+}
+
+// seedTest registers exam (if needed) and a test in it.
+func (e *testEnv) seedTest(exam, category, title string) *models.Test {
+	e.t.Helper()
+	tests := e.store.Tests.(*memory.TestStore)
+	exams, _ := tests.Exams(context.Background())
+	known := false
+	for _, ex := range exams {
+		known = known || ex.Slug == exam
+	}
+	if !known {
+		tests.AddExam(models.Exam{Slug: exam, Name: exam})
+	}
+
+	t := &models.Test{Title: title, Category: category, Exam: exam}
+	if err := tests.Create(context.Background(), t); err != nil {
+		e.t.Fatalf("creating test: %v", err)
+	}
+	return t
+}
+
+// seedQuestions gives test n questions, so submissions may score up to
+// n * store.PointsPerQuestion.
+func (e *testEnv) seedQuestions(test *models.Test, n int) {
+	e.t.Helper()
+	for i := 0; i < n; i++ {
+		q := &models.Question{TestID: test.ID, QuestionID: fmt.Sprintf("%s-q-%d", test.ID, i), Text: "Soru?",
+			Options: []models.Option{{Text: "A", IsCorrect: true}, {Text: "B"}}}
+		if err := e.store.Questions.Create(context.Background(), q); err != nil {
+			e.t.Fatalf("creating question: %v", err)
+		}
+	}
+}
+
+func TestRegisterRejectsTakenNickname(t *testing.T) {
+	e := newTestEnv(t)
+
+	var first map[string]interface{}
+	e.decode(e.do("POST", "/register", "", map[string]string{"nickname": "ayse", "emoji": "🦊"}), http.StatusOK, &first)
+	if first["message"] != "Registered successfully" || first["access_token"] == "" || first["device_secret"] == "" {
+		t.Fatalf("unexpected register response: %v", first)
+	}
+
+	// Knowing a nickname must not sign anyone into that account
+	e.decode(e.do("POST", "/register", "", map[string]string{"nickname": "ayse", "emoji": "🦊"}), http.StatusConflict, nil)
+	e.decode(e.do("POST", "/register", "", map[string]string{"nickname": "  "}), http.StatusBadRequest, nil)
+
+	var u models.User
+	e.decode(e.do("GET", "/user/"+first["id"].(string), first["access_token"].(string), nil), http.StatusOK, &u)
+	if u.Nickname != "ayse" || u.Level != 1 || u.Streak != 1 {
+		t.Fatalf("unexpected user: %+v", u)
+	}
+
+	e.decode(e.do("GET", "/user/missing", first["access_token"].(string), nil), http.StatusNotFound, nil)
+}
+
+func TestUserProfilesArePrivate(t *testing.T) {
+	e := newTestEnv(t)
+	me, token := e.user("me", nil)
+	other, _ := e.user("other", func(u *models.User) { u.Email = "other@example.com" })
+
+	e.decode(e.do("GET", "/user/"+other.ID, "", nil), http.StatusUnauthorized, nil)
+	e.decode(e.do("GET", "/user/history/"+me.ID, "", nil), http.StatusUnauthorized, nil)
+
+	var mine map[string]interface{}
+	e.decode(e.do("GET", "/user/"+me.ID, token, nil), http.StatusOK, &mine)
+	if mine["nickname"] != "me" || mine["tokens"] == nil || mine["role"] == nil {
+		t.Fatalf("the caller should get their whole account: %v", mine)
+	}
+
+	var theirs map[string]interface{}
+	e.decode(e.do("GET", "/user/"+other.ID, token, nil), http.StatusOK, &theirs)
+	if theirs["nickname"] != "other" || theirs["level"] != float64(1) {
+		t.Fatalf("unexpected public profile: %v", theirs)
+	}
+	for _, private := range []string{"email", "tokens", "role", "timezone", "is_premium", "leaderboard_hidden", "total_xp", "providers"} {
+		if _, ok := theirs[private]; ok {
+			t.Errorf("public profile leaks %s: %v", private, theirs)
+		}
+	}
+
+	e.decode(e.do("GET", "/user/history/"+me.ID, token, nil), http.StatusOK, nil)
+	e.decode(e.do("GET", "/user/history/"+other.ID, token, nil), http.StatusForbidden, nil)
+}
+
+func TestUpdateUserRejectsTakenNickname(t *testing.T) {
+	e := newTestEnv(t)
+	e.user("taken", nil)
+	u, token := e.user("mine", nil)
+
+	e.decode(e.do("POST", "/user/update", token, map[string]string{"nickname": "taken", "emoji": "x"}), http.StatusConflict, nil)
+	e.decode(e.do("POST", "/user/update", token, map[string]string{"nickname": "renamed", "emoji": "x"}), http.StatusOK, nil)
+
+	got, _ := e.store.Users.Get(context.Background(), u.ID)
+	if got.Nickname != "renamed" || got.Emoji != "x" {
+		t.Fatalf("profile not updated: %+v", got)
+	}
+
+	e.decode(e.do("POST", "/user/update", "", map[string]string{"nickname": "x"}), http.StatusUnauthorized, nil)
+}
+
+func TestSubmitTestTracksScoreXPAndHistory(t *testing.T) {
+	e := newTestEnv(t)
+	test := e.seedTest("oabt", "Otizm", "Otizm Deneme 1")
+	e.seedQuestions(test, 60)
+	u, token := e.user("solver", nil)
+
+	var res map[string]interface{}
+	e.decode(e.do("POST", "/submit-test", token, map[string]interface{}{"test_id": test.ID, "score": 120}), http.StatusOK, &res)
+	if res["score_added"] != float64(120) || res["new_level"] != float64(2) || res["new_xp"] != float64(20) || res["leveled_up"] != true {
+		t.Fatalf("unexpected first submission: %v", res)
+	}
+
+	// A retake that doesn't beat the best result pays nothing, so tests can't be farmed
+	e.decode(e.do("POST", "/submit-test", token, map[string]interface{}{"test_id": test.ID, "score": 50}), http.StatusOK, &res)
+	if res["score_added"] != float64(0) || res["xp_gained"] != float64(0) || res["new_xp"] != float64(20) {
+		t.Fatalf("unexpected retake: %v", res)
+	}
+
+	// Scores beyond what the questions are worth, or below zero, are refused
+	e.decode(e.do("POST", "/submit-test", token, map[string]interface{}{"test_id": test.ID, "score": 121}), http.StatusBadRequest, nil)
+	e.decode(e.do("POST", "/submit-test", token, map[string]interface{}{"test_id": test.ID, "score": -1}), http.StatusBadRequest, nil)
+
+	got, _ := e.store.Users.Get(context.Background(), u.ID)
+	if got.TotalScore != 120 || got.Level != 2 || got.XP != 20 {
+		t.Fatalf("unexpected user stats: %+v", got)
+	}
+
+	var history []models.HistoryEntry
+	e.decode(e.do("GET", "/user/history/"+u.ID, token, nil), http.StatusOK, &history)
+	if len(history) != 2 || history[0].Title != test.Title {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+
+	var tests []models.Test
+	e.decode(e.do("GET", "/tests?userId="+u.ID, "", nil), http.StatusOK, &tests)
+	if len(tests) != 1 || !tests[0].Completed {
+		t.Fatalf("test should be completed: %+v", tests)
+	}
+
+	var progress []models.CategoryProgress
+	e.decode(e.do("GET", "/tests/categories?userId="+u.ID, "", nil), http.StatusOK, &progress)
+	if len(progress) != 1 || progress[0].TotalTests != 1 || progress[0].CompletedTests != 1 {
+		t.Fatalf("unexpected category progress: %+v", progress)
+	}
+
+	// Unknown tests and tests without questions pay nothing either
+	empty := e.seedTest("oabt", "Otizm", "Boş Deneme")
+	e.decode(e.do("POST", "/submit-test", token, map[string]interface{}{"test_id": "missing", "score": 0}), http.StatusNotFound, nil)
+	e.decode(e.do("POST", "/submit-test", token, map[string]interface{}{"test_id": empty.ID, "score": 0}), http.StatusNotFound, nil)
+}
+
+func TestAchievements(t *testing.T) {
+	e := newTestEnv(t)
+	catalog, err := achievements.New([]achievements.Definition{
+		{ID: "first-test", Name: "İlk Adım", Metric: achievements.TestsCompleted, Target: 1, XP: 10, Tokens: 5},
+		{ID: "first-perfect", Name: "Kusursuz", Metric: achievements.PerfectScores, Target: 1, Tokens: 10},
+		{ID: "questions-3", Name: "Üç Soru", Metric: achievements.QuestionsAnswered, Target: 3},
+		{ID: "first-category", Name: "Kategori Ustası", Metric: achievements.CategoriesCompleted, Target: 1, XP: 100},
+		{ID: "streak-3", Name: "Üç Gün", Metric: achievements.Streak, Target: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.srv.Achievements = catalog
+
+	ctx := context.Background()
+	first := e.seedTest("oabt", "Otizm", "Otizm Deneme 1")
+	second := e.seedTest("oabt", "Otizm", "Otizm Deneme 2")
+	for i, testID := range []string{first.ID, first.ID, second.ID} {
+		q := &models.Question{TestID: testID, QuestionID: fmt.Sprintf("q-%d", i), Text: "Soru?",
+			Options: []models.Option{{Text: "A", IsCorrect: true}, {Text: "B"}}}
+		if err := e.store.Questions.Create(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	u, token := e.user("collector", nil)
+
+	submit := func(testID string, score int) (ids []string, res map[string]interface{}) {
+		t.Helper()
+		e.decode(e.do("POST", "/submit-test", token, map[string]interface{}{"test_id": testID, "score": score}), http.StatusOK, &res)
+		for _, a := range res["achievements_earned"].([]interface{}) {
+			ids = append(ids, a.(map[string]interface{})["id"].(string))
+		}
+		return ids, res
+	}
+	if ids, res := submit(first.ID, 2); fmt.Sprint(ids) != "[first-test]" || res["new_xp"] != float64(12) {
+		t.Fatalf("unexpected first submission: %v %v", ids, res)
+	}
+	// A perfect retake counts, but its questions were answered already
+	if ids, _ := submit(first.ID, 4); fmt.Sprint(ids) != "[first-perfect]" {
+		t.Fatalf("unexpected retake: %v", ids)
+	}
+	ids, res := submit(second.ID, 0)
+	if fmt.Sprint(ids) != "[questions-3 first-category]" || res["new_level"] != float64(2) || res["new_xp"] != float64(16) || res["leveled_up"] != true {
+		t.Fatalf("achievement XP should count towards the level: %v %v", ids, res)
+	}
+	if ids, _ := submit(second.ID, 2); ids != nil {
+		t.Fatalf("achievements are earned once: %v", ids)
+	}
+
+	var list struct {
+		Earned       int                          `json:"earned"`
+		Total        int                          `json:"total"`
+		Achievements []handlers.AchievementStatus `json:"achievements"`
+	}
+	e.decode(e.do("GET", "/api/v1/user/achievements", token, nil), http.StatusOK, &list)
+	if list.Earned != 4 || list.Total != 5 {
+		t.Fatalf("unexpected counts: %+v", list)
+	}
+	if streak := list.Achievements[4]; streak.Earned || streak.Progress != 1 || streak.Target != 3 {
+		t.Fatalf("unexpected locked achievement: %+v", streak)
+	}
+	if got := list.Achievements[0]; !got.Earned || got.EarnedAt == nil || got.Progress != 1 {
+		t.Fatalf("unexpected earned achievement: %+v", got)
+	}
+
+	if balance, _ := e.store.Tokens.Balance(ctx, u.ID); balance != 15 {
+		t.Fatalf("balance = %d, want 15", balance)
+	}
+	if drift, _ := e.store.Tokens.Reconcile(ctx); len(drift) != 0 {
+		t.Fatalf("ledger should balance: %+v", drift)
+	}
+
+	e.srv.Achievements = nil
+	e.decode(e.do("GET", "/api/v1/user/achievements", token, nil), http.StatusServiceUnavailable, nil)
+}
+
+func TestWeeklyLeagues(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := context.Background()
+	test := e.seedTest("oabt", "Otizm", "Otizm Deneme 1")
+	e.seedQuestions(test, 50)
+
+	// Seven silver players of similar level and one veteran
+	var ids, tokens []string
+	for i := 0; i < 7; i++ {
+		u, token := e.user(fmt.Sprintf("player%d", i), func(u *models.User) { u.LeagueTier = 1 })
+		ids, tokens = append(ids, u.ID), append(tokens, token)
+		e.decode(e.do("POST", "/submit-test", token, map[string]interface{}{"test_id": test.ID, "score": 70 - i*10}), http.StatusOK, nil)
+	}
+	veteran, veteranToken := e.user("veteran", func(u *models.User) { u.LeagueTier, u.Level, u.TotalXP = 1, 60, 5900 })
+	e.decode(e.do("POST", "/submit-test", veteranToken, map[string]interface{}{"test_id": test.ID, "score": 90}), http.StatusOK, nil)
+	_, idleToken := e.user("idle", nil)
+
+	var status handlers.LeagueStatus
+	e.decode(e.do("GET", "/api/v1/leagues/current", idleToken, nil), http.StatusOK, &status)
+	if status.Joined || status.TierName != "bronze" || len(status.Table) != 0 {
+		t.Fatalf("users without XP this week have no group: %+v", status)
+	}
+
+	// A retake adds to the week's XP
+	e.decode(e.do("POST", "/submit-test", tokens[6], map[string]interface{}{"test_id": test.ID, "score": 15}), http.StatusOK, nil)
+	e.decode(e.do("GET", "/api/v1/leagues/current", tokens[6], nil), http.StatusOK, &status)
+	if !status.Joined || status.TierName != "silver" || len(status.Table) != 7 || status.XP != 25 || status.Rank != 6 {
+		t.Fatalf("unexpected standings: %+v", status)
+	}
+	if status.Promote != 3 || status.Relegate != 2 || status.Table[0].Zone != "promotion" || status.Table[6].Zone != "relegation" ||
+		status.Table[3].Zone != "" || !status.Table[5].Me || status.Table[0].Nickname != "player0" {
+		t.Fatalf("unexpected zones: %+v", status)
+	}
+	e.decode(e.do("GET", "/api/v1/leagues/current", veteranToken, nil), http.StatusOK, &status)
+	if len(status.Table) != 1 {
+		t.Fatalf("the veteran should play in another group: %+v", status.Table)
+	}
+
+	// Nothing closes before the week is over in Istanbul
+	if n, _ := jobs.CloseLeagues(ctx, e.store, time.Now()); n != 0 {
+		t.Fatalf("closed %d groups of the running week", n)
+	}
+	next, _ := leagues.WeekEnd(leagues.Week(time.Now()))
+	if n, err := jobs.CloseLeagues(ctx, e.store, next); n != 2 || err != nil {
+		t.Fatalf("CloseLeagues = %d, %v", n, err)
+	}
+	if n, _ := jobs.CloseLeagues(ctx, e.store, next); n != 0 {
+		t.Fatalf("groups were closed twice: %d", n)
+	}
+	for i, want := range []int{2, 2, 2, 1, 1, 0, 0} {
+		if u, _ := e.store.Users.Get(ctx, ids[i]); u.LeagueTier != want {
+			t.Errorf("player%d tier = %d, want %d", i, u.LeagueTier, want)
+		}
+	}
+	if u, _ := e.store.Users.Get(ctx, veteran.ID); u.LeagueTier != 2 {
+		t.Errorf("a lone player should be promoted, got tier %d", u.LeagueTier)
+	}
+
+	var history struct {
+		TierName string                    `json:"tier_name"`
+		History  []models.LeagueMembership `json:"history"`
+	}
+	e.decode(e.do("GET", "/api/v1/leagues/history", tokens[0], nil), http.StatusOK, &history)
+	if history.TierName != "gold" || len(history.History) != 1 || history.History[0].Rank != 1 ||
+		history.History[0].Outcome != leagues.Promoted || history.History[0].XP != 70 {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+	e.decode(e.do("GET", "/api/v1/leagues/history?limit=0", tokens[0], nil), http.StatusBadRequest, nil)
+}
+
+func TestLeagueGroupsFillUp(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := context.Background()
+	groups := map[string]int{}
+	for i := 0; i < 5; i++ {
+		u, _ := e.user(fmt.Sprintf("player%d", i), nil)
+		m := &models.LeagueMembership{UserID: u.ID, Week: "2026-10-19", XP: 10}
+		if err := e.store.Leagues.AddXP(ctx, m, 0, 2); err != nil {
+			t.Fatal(err)
+		}
+		groups[m.GroupID]++
+	}
+	if len(groups) != 3 {
+		t.Fatalf("five players in groups of two should fill three groups: %v", groups)
+	}
+}
+
+func TestStreaksUseTimezoneAndFreezes(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := context.Background()
+	users := e.store.Users.(*memory.UserStore)
+	test := e.seedTest("oabt", "Otizm", "Otizm Deneme 1")
+	e.seedQuestions(test, 50)
+	submit := func(token string) (resp map[string]interface{}) {
+		e.decode(e.do("POST", "/submit-test", token, map[string]interface{}{"test_id": test.ID, "score": 20}), http.StatusOK, &resp)
+		return resp
+	}
+	localDay := func(tz string, offset int) string {
+		loc, _ := time.LoadLocation(tz)
+		return days.Add(days.Today(time.Now(), loc), offset)
+	}
+
+	// A week of streak in Tokyo earns a freeze, once
+	tokyo, tokyoToken := e.user("tokyo", func(u *models.User) { u.Timezone = "Asia/Tokyo" })
+	users.SetStreak(tokyo.ID, 6, localDay("Asia/Tokyo", -1))
+	if resp := submit(tokyoToken); resp["current_streak"] != float64(7) || resp["streak_freeze_earned"] != true {
+		t.Fatalf("unexpected first submission: %v", resp)
+	}
+	if resp := submit(tokyoToken); resp["current_streak"] != float64(7) || resp["streak_freeze_earned"] != false {
+		t.Fatalf("the same day counted twice: %v", resp)
+	}
+	if u, _ := e.store.Users.Get(ctx, tokyo.ID); u.StreakFreezes != 1 || u.LastActiveDate != localDay("Asia/Tokyo", 0) {
+		t.Fatalf("unexpected user: %+v", u)
+	}
+
+	// Two freezes cover two missed days; one isn't enough and is kept
+	frozen, frozenToken := e.user("frozen", nil)
+	broken, brokenToken := e.user("broken", nil)
+	for _, id := range []string{frozen.ID, frozen.ID, broken.ID} {
+		if _, err := e.store.Users.AddStreakFreeze(ctx, id, nil, shop.MaxStreakFreezes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	users.SetStreak(frozen.ID, 10, localDay(store.DefaultTimezone, -3))
+	users.SetStreak(broken.ID, 10, localDay(store.DefaultTimezone, -3))
+	if resp := submit(frozenToken); resp["current_streak"] != float64(11) || resp["streak_freezes_used"] != float64(2) {
+		t.Fatalf("freezes should keep the streak: %v", resp)
+	}
+	if resp := submit(brokenToken); resp["current_streak"] != float64(1) || resp["streak_freezes_used"] != float64(0) {
+		t.Fatalf("too few freezes should break the streak: %v", resp)
+	}
+	if u, _ := e.store.Users.Get(ctx, broken.ID); u.StreakFreezes != 1 {
+		t.Fatalf("a broken streak shouldn't use freezes: %+v", u)
+	}
+
+	var calendar handlers.ActivityResponse
+	e.decode(e.do("GET", "/api/v1/user/activity?days=7", frozenToken, nil), http.StatusOK, &calendar)
+	if calendar.Streak != 11 || calendar.StreakFreezes != 0 || calendar.From != localDay(store.DefaultTimezone, -6) || len(calendar.Days) != 3 ||
+		!calendar.Days[0].Frozen || !calendar.Days[1].Frozen || calendar.Days[2].Frozen || calendar.Days[2].Tests != 1 || calendar.Days[2].Score != 20 {
+		t.Fatalf("unexpected calendar: %+v", calendar)
+	}
+	e.decode(e.do("GET", "/api/v1/user/activity", tokyoToken, nil), http.StatusOK, &calendar)
+	if calendar.Timezone != "Asia/Tokyo" || len(calendar.Days) != 1 || calendar.Days[0].Tests != 2 || calendar.Days[0].XP != 20 {
+		t.Fatalf("unexpected calendar: %+v", calendar)
+	}
+	e.decode(e.do("GET", "/api/v1/user/activity?days=0", tokyoToken, nil), http.StatusBadRequest, nil)
+
+	// A streak shows as broken before the user is back
+	idle, idleToken := e.user("idle", nil)
+	users.SetStreak(idle.ID, 5, localDay(store.DefaultTimezone, -2))
+	e.decode(e.do("GET", "/api/v1/user/activity", idleToken, nil), http.StatusOK, &calendar)
+	if calendar.Streak != 0 {
+		t.Fatalf("a streak missing yesterday should be broken, got %d", calendar.Streak)
+	}
+}
+
+func TestProgressionCurveAndLevelRewards(t *testing.T) {
+	e := newTestEnv(t)
+	cfg, err := progression.Load("../../" + progression.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.srv.Progression = cfg
+
+	ctx := context.Background()
+	test := e.seedTest("oabt", "Otizm", "Otizm Deneme 1")
+	for i := 0; i < 4; i++ {
+		q := &models.Question{TestID: test.ID, QuestionID: fmt.Sprintf("q-%d", i), Text: "Soru?", Difficulty: "Zor Beceri",
+			Options: []models.Option{{Text: "A", IsCorrect: true}, {Text: "B"}}}
+		if err := e.store.Questions.Create(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	u, token := e.user("climber", nil)
+	type submission struct {
+		GainedXP     int                       `json:"xp_gained"`
+		Breakdown    progression.Breakdown     `json:"xp_breakdown"`
+		Level        int                       `json:"new_level"`
+		XP           int                       `json:"new_xp"`
+		ToNext       int                       `json:"xp_to_next"`
+		LeveledUp    bool                      `json:"leveled_up"`
+		LevelRewards []progression.LevelReward `json:"level_rewards"`
+	}
+	submit := func(score int) (resp submission) {
+		t.Helper()
+		e.decode(e.do("POST", "/submit-test", token, map[string]interface{}{"test_id": test.ID, "score": score}), http.StatusOK, &resp)
+		return resp
+	}
+
+	// Hard questions pay 1.5 times (10 + 6), and 6 of 8 points is no accuracy bonus
+	if resp := submit(6); resp.Breakdown != (progression.Breakdown{Test: 24, Total: 24}) || resp.Level != 1 || resp.XP != 24 {
+		t.Fatalf("unexpected first submission: %+v", resp)
+	}
+	// Retakes only earn XP when they improve on the best result
+	if resp := submit(6); resp.GainedXP != 0 || resp.XP != 24 || resp.LeveledUp {
+		t.Fatalf("unexpected retake: %+v", resp)
+	}
+	// The third test of the day meets the daily goal, all 8 points the top
+	// accuracy bonus, and reaches level 2, which takes 100 XP
+	resp := submit(8)
+	if resp.Breakdown != (progression.Breakdown{Test: 27, Accuracy: 25, DailyGoal: 30, Total: 82}) || resp.Level != 2 || resp.XP != 6 || !resp.LeveledUp ||
+		resp.ToNext != cfg.Curve.ToNext(2)-6 || len(resp.LevelRewards) != 1 || resp.LevelRewards[0].Level != 2 {
+		t.Fatalf("unexpected level up: %+v", resp)
+	}
+	if balance, _ := e.store.Tokens.Balance(ctx, u.ID); balance != 10 {
+		t.Fatalf("level 2 should pay 10 tokens, balance is %d", balance)
+	}
+
+	var progress handlers.ProgressionResponse
+	e.decode(e.do("GET", "/api/v1/user/progression", token, nil), http.StatusOK, &progress)
+	if progress.Level != 2 || progress.TotalXP != 106 || len(progress.Rewards) != 1 ||
+		progress.NextReward == nil || progress.NextReward.Level != 5 || progress.Sources.DailyGoal.Tests != 3 {
+		t.Fatalf("unexpected progression: %+v", progress)
+	}
+	var activity handlers.ActivityResponse
+	e.decode(e.do("GET", "/api/v1/user/activity?days=1", token, nil), http.StatusOK, &activity)
+	if len(activity.Days) != 1 || activity.Days[0].XP != 106 {
+		t.Fatalf("unexpected activity: %+v", activity.Days)
+	}
+
+	// A user from the flat rules: level 3 with 20 XP was 220 XP in total,
+	// more than their one result earns, so they keep it on the new curve
+	legacy, _ := e.user("legacy", func(u *models.User) { u.Level, u.XP, u.TotalXP = 3, 20, 220 })
+	if err := e.store.Results.Create(ctx, &models.TestResult{UserID: legacy.ID, TestID: test.ID, Score: 8}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := jobs.RecomputeLevels(ctx, e.store, cfg); err != nil || n != 1 {
+		t.Fatalf("recompute updated %d users: %v", n, err)
+	}
+	if got, _ := e.store.Users.Get(ctx, legacy.ID); got.TotalXP != 220 || got.Level != 3 || got.XP != 220-100-cfg.Curve.ToNext(2) {
+		t.Fatalf("unexpected recomputed user: %+v", got)
+	}
+	if balance, _ := e.store.Tokens.Balance(ctx, legacy.ID); balance != 10 {
+		t.Fatalf("recompute should pay reached level rewards, balance is %d", balance)
+	}
+	// Running it again changes and pays nothing
+	if n, err := jobs.RecomputeLevels(ctx, e.store, cfg); err != nil || n != 0 {
+		t.Fatalf("second recompute updated %d users: %v", n, err)
+	}
+	if balance, _ := e.store.Tokens.Balance(ctx, u.ID); balance != 10 {
+		t.Fatalf("level 2 was paid twice, balance is %d", balance)
+	}
+
+	// Reaching level 5 earns its badge along with its tokens
+	catalog, err := achievements.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.srv.Achievements = catalog
+	almost := cfg.Curve.Total(5, 0) - 1
+	nearly, nearlyToken := e.user("nearly", func(u *models.User) { u.TotalXP = almost; u.Level, u.XP = cfg.Curve.Level(almost) })
+	e.decode(e.do("POST", "/submit-test", nearlyToken, map[string]interface{}{"test_id": test.ID, "score": 8}), http.StatusOK, &resp)
+	if resp.Level != 5 || len(resp.LevelRewards) != 1 || resp.LevelRewards[0].Badge != "level-5" {
+		t.Fatalf("unexpected level 5 submission: %+v", resp)
+	}
+	var list struct {
+		Achievements []handlers.AchievementStatus `json:"achievements"`
+	}
+	e.decode(e.do("GET", "/api/v1/user/achievements", nearlyToken, nil), http.StatusOK, &list)
+	badges := map[string]handlers.AchievementStatus{}
+	for _, a := range list.Achievements {
+		badges[a.ID] = a
+	}
+	if b := badges["level-5"]; !b.Earned || b.EarnedAt == nil || b.Name != "Çırak" || b.Progress != 5 {
+		t.Fatalf("level 5 badge not earned: %+v", b)
+	}
+	if b := badges["level-10"]; b.Earned || b.Progress != 5 || b.Target != 10 {
+		t.Fatalf("unexpected level 10 badge: %+v", b)
+	}
+	// The recompute job records it once, like the tokens
+	if _, err := jobs.RecomputeLevels(ctx, e.store, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if earned, _ := e.store.Achievements.List(ctx, nearly.ID); len(earned) != 1 || earned[0].AchievementID != "level:5" {
+		t.Fatalf("unexpected earned badges: %+v", earned)
+	}
+	if balance, _ := e.store.Tokens.Balance(ctx, nearly.ID); balance != 10+25 {
+		t.Fatalf("levels 2 and 5 should pay 35 tokens, balance is %d", balance)
+	}
+}
+
+func TestSubmitTestAnonymousIsNotSaved(t *testing.T) {
+	e := newTestEnv(t)
+	test := e.seedTest("oabt", "Otizm", "Otizm Deneme 1")
+
+	e.decode(e.do("POST", "/submit-test", "", map[string]interface{}{"test_id": test.ID, "score": 80}), http.StatusOK, nil)
+	if n, _ := e.store.Results.Count(context.Background()); n != 0 {
+		t.Fatalf("anonymous submission stored %d results", n)
+	}
+
+	// Naming someone else in the body doesn't submit for them
+	victim, _ := e.user("victim", nil)
+	e.decode(e.do("POST", "/submit-test", "", map[string]interface{}{"test_id": test.ID, "score": 80, "user_id": victim.ID}), http.StatusOK, nil)
+	if n, _ := e.store.Results.Count(context.Background()); n != 0 {
+		t.Fatalf("submission for a user in the body stored %d results", n)
+	}
+	if u, _ := e.store.Users.Get(context.Background(), victim.ID); u.TotalXP != 0 || u.TotalScore != 0 {
+		t.Fatalf("submission for a user in the body paid them: %+v", u)
+	}
+	if _, err := e.store.Leagues.Membership(context.Background(), victim.ID, leagues.Week(time.Now())); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("submission for a user in the body joined them to a league: %v", err)
+	}
+	if _, err := e.store.Leaderboards.Rank(context.Background(), leaderboard.PeriodsFor("", time.Now())[0], victim.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("submission for a user in the body ranked them: %v", err)
+	}
+}
+
+func TestListingsFollowSelectedExam(t *testing.T) {
+	e := newTestEnv(t)
+	e.seedTest("oabt", "Otizm", "Otizm Deneme 1")
+	e.seedTest("kpss", "Tarih", "Tarih Deneme 1")
+	u, token := e.user("picker", nil)
+
+	var tests []models.Test
+	e.decode(e.do("GET", "/tests", "", nil), http.StatusOK, &tests)
+	if len(tests) != 2 {
+		t.Fatalf("expected every test without a scope, got %d", len(tests))
+	}
+
+	e.decode(e.do("POST", "/user/exam", token, map[string]string{"exam": "nope"}), http.StatusBadRequest, nil)
+	e.decode(e.do("POST", "/user/exam", token, map[string]string{"exam": "kpss"}), http.StatusOK, nil)
+
+	e.decode(e.do("GET", "/tests?userId="+u.ID, "", nil), http.StatusOK, &tests)
+	if len(tests) != 1 || tests[0].Exam != "kpss" {
+		t.Fatalf("expected only kpss tests, got %+v", tests)
+	}
+
+	// An explicit ?exam= wins over the profile
+	var names []string
+	e.decode(e.do("GET", "/tests/categories?exam=oabt", "", nil), http.StatusOK, &names)
+	if len(names) != 1 || names[0] != "Otizm" {
+		t.Fatalf("unexpected categories: %v", names)
+	}
+
+	var exams []models.Exam
+	e.decode(e.do("GET", "/exams", "", nil), http.StatusOK, &exams)
+	if len(exams) != 2 {
+		t.Fatalf("unexpected exams: %+v", exams)
+	}
+	e.decode(e.do("GET", "/exams/missing/taxonomy", "", nil), http.StatusNotFound, nil)
+}
+
+func TestRewardAndSpendTokens(t *testing.T) {
+	e := newTestEnv(t)
+	_, token := e.user("spender", func(u *models.User) { u.Tokens = 20 })
+
+	var res map[string]interface{}
+	e.decode(e.do("POST", "/api/v1/user/reward", token, map[string]string{"reward_type": "ad_watch"}), http.StatusOK, &res)
+	if res["new_balance"] != float64(25) {
+		t.Fatalf("unexpected reward: %v", res)
+	}
+	e.decode(e.do("POST", "/api/v1/user/reward", token, map[string]string{"reward_type": "bogus"}), http.StatusBadRequest, nil)
+
+	// Spending goes through the shop catalog; the client can't pick the price
+	e.decode(e.do("POST", "/api/v1/user/spend-tokens", token, map[string]interface{}{"amount": 3}), http.StatusBadRequest, nil)
+	e.decode(e.do("POST", "/api/v1/user/spend-tokens", token, map[string]interface{}{"item": "extra_time", "amount": 1}), http.StatusBadRequest, nil)
+	e.decode(e.do("POST", "/api/v1/user/spend-tokens", token, map[string]interface{}{"item": "extra_time", "amount": 20}), http.StatusOK, &res)
+	if res["new_balance"] != float64(5) || res["spent"] != float64(20) {
+		t.Fatalf("unexpected spend: %v", res)
+	}
+	e.decode(e.do("POST", "/api/v1/user/spend-tokens", token, map[string]interface{}{"item": "extra_time"}), http.StatusPaymentRequired, nil)
+
+	_, premium := e.user("premium", func(u *models.User) { u.IsPremium = true })
+	e.decode(e.do("POST", "/api/v1/user/spend-tokens", premium, map[string]interface{}{"item": "extra_time"}), http.StatusOK, &res)
+	if res["spent"] != float64(0) {
+		t.Fatalf("premium user should not spend tokens: %v", res)
+	}
+}
+
+func TestTokenShop(t *testing.T) {
+	e := newTestEnv(t)
+	test := e.seedTest("oabt", "Otizm", "Otizm Deneme 1")
+	ctx := context.Background()
+	q := &models.Question{TestID: test.ID, QuestionID: "q-1", Text: "Soru?",
+		Options:  []models.Option{{Text: "A"}, {Text: "B"}, {Text: "C", IsCorrect: true}, {Text: "D"}},
+		Solution: models.Solution{ExplanationText: "Çünkü C."}}
+	bare := &models.Question{TestID: test.ID, QuestionID: "q-2", Text: "Doğru mu?",
+		Options: []models.Option{{Text: "Evet", IsCorrect: true}, {Text: "Hayır"}}}
+	for _, question := range []*models.Question{q, bare} {
+		if err := e.store.Questions.Create(ctx, question); err != nil {
+			t.Fatal(err)
+		}
+	}
+	u, token := e.user("shopper", func(u *models.User) { u.Tokens = 120 })
+
+	var catalog struct {
+		Items []shop.Item `json:"items"`
+	}
+	e.decode(e.do("GET", "/api/v1/shop/items", "", nil), http.StatusOK, &catalog)
+	if len(catalog.Items) != 4 {
+		t.Fatalf("unexpected catalog: %+v", catalog)
+	}
+
+	buy := func(body map[string]string, wantStatus int) map[string]interface{} {
+		t.Helper()
+		var res map[string]interface{}
+		rec := e.do("POST", "/api/v1/shop/purchase", token, body)
+		if wantStatus != http.StatusOK {
+			e.decode(rec, wantStatus, nil)
+			return nil
+		}
+		e.decode(rec, wantStatus, &res)
+		return res
+	}
+	buy(map[string]string{"item": "free_tokens"}, http.StatusBadRequest)
+	buy(map[string]string{"item": "fifty_fifty"}, http.StatusBadRequest)
+	buy(map[string]string{"item": "fifty_fifty", "question_id": "missing"}, http.StatusNotFound)
+	buy(map[string]string{"item": "fifty_fifty", "question_id": bare.ID}, http.StatusConflict)
+	buy(map[string]string{"item": "reveal_explanation", "question_id": bare.ID}, http.StatusConflict)
+
+	// 50/50 hides two wrong options, and buying it again costs nothing
+	first := buy(map[string]string{"item": "fifty_fifty", "question_id": q.ID}, http.StatusOK)
+	hidden := first["effect"].(map[string]interface{})["hide_options"].([]interface{})
+	if len(hidden) != 2 || first["new_balance"] != float64(105) {
+		t.Fatalf("unexpected 50/50: %v", first)
+	}
+	for _, i := range hidden {
+		if q.Options[int(i.(float64))].IsCorrect {
+			t.Fatalf("50/50 hid the correct option: %v", hidden)
+		}
+	}
+	again := buy(map[string]string{"item": "fifty_fifty", "question_id": q.ID}, http.StatusOK)
+	if again["transaction_id"] != first["transaction_id"] || fmt.Sprint(again["effect"]) != fmt.Sprint(first["effect"]) {
+		t.Fatalf("repeat purchase should return the original: %v then %v", first, again)
+	}
+
+	res := buy(map[string]string{"item": "reveal_explanation", "question_id": q.ID}, http.StatusOK)
+	if res["effect"].(map[string]interface{})["explanation_text"] != "Çünkü C." || res["new_balance"] != float64(95) {
+		t.Fatalf("unexpected explanation: %v", res)
+	}
+	res = buy(map[string]string{"item": "extra_time"}, http.StatusOK)
+	if res["effect"].(map[string]interface{})["extra_seconds"] != float64(300) || res["new_balance"] != float64(75) {
+		t.Fatalf("unexpected extra time: %v", res)
+	}
+
+	// Streak freezes are capped and never free
+	res = buy(map[string]string{"item": "streak_freeze"}, http.StatusOK)
+	if res["effect"].(map[string]interface{})["streak_freezes"] != float64(1) || res["new_balance"] != float64(25) {
+		t.Fatalf("unexpected streak freeze: %v", res)
+	}
+	buy(map[string]string{"item": "streak_freeze"}, http.StatusPaymentRequired)
+	e.store.Tokens.Record(ctx, &models.TokenTransaction{UserID: u.ID, Amount: 200, Reason: "admin_grant"})
+	buy(map[string]string{"item": "streak_freeze"}, http.StatusOK)
+	buy(map[string]string{"item": "streak_freeze"}, http.StatusConflict)
+	if got, _ := e.store.Users.Get(ctx, u.ID); got.StreakFreezes != 2 || got.Tokens != 175 {
+		t.Fatalf("unexpected user after purchases: %+v", got)
+	}
+
+	history, _ := e.store.Tokens.History(ctx, u.ID, time.Time{}, 10)
+	if spend := history[len(history)-2]; spend.Reason != "shop" || spend.Reference != "fifty_fifty:"+q.ID || spend.Amount != -15 {
+		t.Fatalf("unexpected ledger entry: %+v", spend)
+	}
+	drift, _ := e.store.Tokens.Reconcile(ctx)
+	if len(drift) != 0 {
+		t.Fatalf("ledger should balance: %+v", drift)
+	}
+}
+
+func TestTokenLedger(t *testing.T) {
+	e := newTestEnv(t)
+	_, token := e.user("saver", func(u *models.User) { u.Tokens = 24 })
+	_, admin := e.user("admin", func(u *models.User) { u.Role = "admin" })
+
+	// A retried reward with the same key is granted once
+	reward := func() map[string]interface{} {
+		req := httptest.NewRequest("POST", "/api/v1/user/reward", strings.NewReader(`{"reward_type":"ad_watch"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Idempotency-Key", "ad-1")
+		rec := httptest.NewRecorder()
+		e.mux.ServeHTTP(rec, req)
+		var res map[string]interface{}
+		e.decode(rec, http.StatusOK, &res)
+		return res
+	}
+	first, second := reward(), reward()
+	if first["new_balance"] != float64(29) || second["transaction_id"] != first["transaction_id"] || second["new_balance"] != float64(29) {
+		t.Fatalf("retry should return the original reward: %v then %v", first, second)
+	}
+	e.decode(e.do("POST", "/api/v1/user/spend-tokens", token, map[string]interface{}{"item": "extra_time"}), http.StatusOK, nil)
+
+	var history struct {
+		Balance      int                       `json:"balance"`
+		Transactions []models.TokenTransaction `json:"transactions"`
+	}
+	e.decode(e.do("GET", "/api/v1/user/tokens/history", token, nil), http.StatusOK, &history)
+	if history.Balance != 9 || len(history.Transactions) != 3 {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+	spend, opening := history.Transactions[0], history.Transactions[2]
+	if spend.Amount != -20 || spend.Reason != "shop" || spend.Reference != "extra_time" || spend.BalanceAfter != 9 {
+		t.Fatalf("unexpected spend entry: %+v", spend)
+	}
+	if opening.Amount != 24 || opening.Reason != "opening_balance" {
+		t.Fatalf("unexpected opening entry: %+v", opening)
+	}
+	e.decode(e.do("GET", "/api/v1/user/tokens/history?limit=1", token, nil), http.StatusOK, &history)
+	if len(history.Transactions) != 1 {
+		t.Fatalf("limit ignored: %+v", history.Transactions)
+	}
+	e.decode(e.do("GET", "/api/v1/user/tokens/history?before=yesterday", token, nil), http.StatusBadRequest, nil)
+
+	var report struct {
+		Drift []models.TokenDrift `json:"drift"`
+	}
+	e.decode(e.do("GET", "/api/v1/admin/tokens/reconcile", token, nil), http.StatusForbidden, nil)
+	e.decode(e.do("GET", "/api/v1/admin/tokens/reconcile", admin, nil), http.StatusOK, &report)
+	if len(report.Drift) != 0 {
+		t.Fatalf("ledger should balance: %+v", report.Drift)
+	}
+}
+
+func TestAdMobCallback(t *testing.T) {
+	e := newTestEnv(t)
+	ks := admobtest.NewKeyServer(t)
+	e.srv.AdMob = admob.NewVerifier(ks.URL, admobtest.AdUnit)
+	e.srv.AdRewardDailyCap = 2
+	u, token := e.user("viewer", nil)
+
+	callback := func(raw string, wantStatus int) map[string]interface{} {
+		var res map[string]interface{}
+		e.decode(e.do("GET", "/api/v1/rewards/admob/ssv?"+raw, "", nil), wantStatus, &res)
+		return res
+	}
+	balance := func() int {
+		n, _ := e.store.Tokens.Balance(context.Background(), u.ID)
+		return n
+	}
+
+	first := ks.Callback(t, "tx-1", u.ID)
+	if res := callback(first, http.StatusOK); res["credited"] != true || balance() != 5 {
+		t.Fatalf("first view should be credited: %v, balance %d", res, balance())
+	}
+	if res := callback(first, http.StatusOK); res["reason"] != "duplicate" || balance() != 5 {
+		t.Fatalf("a retried callback must not pay twice: %v, balance %d", res, balance())
+	}
+	e.decode(e.do("GET", "/api/v1/rewards/admob/ssv?"+strings.Replace(first, "tx-1", "tx-9", 1), "", nil), http.StatusForbidden, nil)
+	// Another app's ad unit pointed at our callback URL pays nothing
+	ks.AdUnit = "9999999999"
+	e.decode(e.do("GET", "/api/v1/rewards/admob/ssv?"+ks.Callback(t, "tx-other", u.ID), "", nil), http.StatusForbidden, nil)
+	ks.AdUnit = admobtest.AdUnit
+
+	// The dev-only client path shares the daily cap
+	e.decode(e.do("POST", "/api/v1/user/reward", token, map[string]string{"reward_type": "ad_watch"}), http.StatusOK, nil)
+	if res := callback(ks.Callback(t, "tx-2", u.ID), http.StatusOK); res["reason"] != "daily limit reached" || balance() != 10 {
+		t.Fatalf("cap should stop the third view: %v, balance %d", res, balance())
+	}
+	if res := callback(ks.Callback(t, "tx-3", "no-such-user"), http.StatusOK); res["credited"] != false {
+		t.Fatalf("unknown users can't be credited: %v", res)
+	}
+
+	e.srv.Env = appenv.Production
+	e.decode(e.do("POST", "/api/v1/user/reward", token, map[string]string{"reward_type": "ad_watch"}), http.StatusForbidden, nil)
+}
+
+func TestDailyReward(t *testing.T) {
+	e := newTestEnv(t)
+	_, token := e.user("daily", func(u *models.User) { u.Streak = 8 })
+
+	var status handlers.DailyRewardStatus
+	e.decode(e.do("GET", "/api/v1/user/daily-reward", token, nil), http.StatusOK, &status)
+	if !status.Claimable || status.Day != 1 || status.Tokens != 10 || status.StreakBonus != 5 || status.Timezone != "Europe/Istanbul" {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	var res map[string]interface{}
+	e.decode(e.do("POST", "/api/v1/user/daily-reward", token, nil), http.StatusOK, &res)
+	if res["added"] != float64(15) || res["new_balance"] != float64(15) {
+		t.Fatalf("unexpected claim: %v", res)
+	}
+	e.decode(e.do("POST", "/api/v1/user/daily-reward", token, nil), http.StatusConflict, nil)
+	// Older apps claim through the generic reward endpoint
+	e.decode(e.do("POST", "/api/v1/user/reward", token, map[string]string{"reward_type": "daily_login"}), http.StatusConflict, nil)
+
+	e.decode(e.do("GET", "/api/v1/user/daily-reward", token, nil), http.StatusOK, &status)
+	if status.Claimable || status.Day != 2 || status.NextClaimAt == nil || !status.Calendar[0].Claimed || status.Calendar[1].Claimed {
+		t.Fatalf("unexpected status after claiming: %+v", status)
+	}
+
+	// A streak that lapsed days ago pays no bonus, however long it was
+	lapsed, lapsedToken := e.user("lapsed", nil)
+	loc, _ := time.LoadLocation(store.DefaultTimezone)
+	e.store.Users.(*memory.UserStore).SetStreak(lapsed.ID, 40, days.Add(days.Today(time.Now(), loc), -3))
+	e.decode(e.do("POST", "/api/v1/user/daily-reward", lapsedToken, nil), http.StatusOK, &res)
+	if res["streak_bonus"] != float64(0) || res["added"] != float64(10) {
+		t.Fatalf("a lapsed streak was paid a bonus: %v", res)
+	}
+
+	// A claim yesterday continues the calendar, a gap starts it over
+	u, token := e.user("regular", nil)
+	istanbul, _ := time.LoadLocation("Europe/Istanbul")
+	today := time.Now().In(istanbul)
+	yesterday := &models.DailyRewardClaim{UserID: u.ID, Day: today.AddDate(0, 0, -1).Format("2006-01-02"), CalendarDay: 3, Tokens: 20}
+	if err := e.store.Daily.Claim(context.Background(), yesterday); err != nil {
+		t.Fatal(err)
+	}
+	e.decode(e.do("GET", "/api/v1/user/daily-reward", token, nil), http.StatusOK, &status)
+	if status.Day != 4 || status.Tokens != 25 || status.StreakBonus != 0 || !status.Calendar[2].Claimed || status.Calendar[3].Claimed {
+		t.Fatalf("calendar should continue at day 4: %+v", status)
+	}
+	old := &models.DailyRewardClaim{UserID: u.ID, Day: today.AddDate(0, 0, -3).Format("2006-01-02"), CalendarDay: 1, Tokens: 10}
+	if err := e.store.Daily.Claim(context.Background(), old); !errors.Is(err, store.ErrDuplicate) {
+		t.Fatalf("claiming an earlier day: err = %v, want ErrDuplicate", err)
+	}
+
+	e.decode(e.do("PUT", "/user/timezone", token, map[string]string{"timezone": "Mars/Olympus"}), http.StatusBadRequest, nil)
+	e.decode(e.do("PUT", "/user/timezone", token, map[string]string{"timezone": "America/New_York"}), http.StatusOK, nil)
+	e.decode(e.do("GET", "/api/v1/user/daily-reward", token, nil), http.StatusOK, &status)
+	if status.Timezone != "America/New_York" {
+		t.Fatalf("timezone not applied: %+v", status)
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	e := newTestEnv(t)
+	apple := iaptest.NewAppleServer(t, "com.example.app")
+	play := iaptest.NewGooglePlay(t, "com.example.app")
+	appleClient, err := iap.NewAppleClient("issuer", "KEY123", apple.BundleID, apple.KeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appleClient.BaseURL, appleClient.SandboxURL = apple.URL, ""
+	googleClient, err := iap.NewGoogleClient(play.PackageName, play.ServiceAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	googleClient.BaseURL = play.URL
+	e.srv.IAP = &iap.Validator{Apple: appleClient, Google: googleClient, GooglePushToken: "push-secret"}
+
+	u, token := e.user("subscriber", nil)
+	_, thief := e.user("thief", nil)
+	month := time.Now().Add(30 * 24 * time.Hour)
+	apple.Set("1000", iaptest.AppleSubscription{ProductID: "premium.monthly", Status: 1, ExpiresAt: month, AutoRenew: true})
+
+	var res struct {
+		Subscription models.Subscription `json:"subscription"`
+		IsPremium    bool                `json:"is_premium"`
+	}
+	verifyApple := map[string]string{"platform": "apple", "transaction_id": "1000"}
+	e.decode(e.do("POST", "/api/v1/user/subscriptions/verify", token, verifyApple), http.StatusOK, &res)
+	if !res.IsPremium || res.Subscription.Status != models.SubscriptionActive || !res.Subscription.AutoRenew {
+		t.Fatalf("unexpected verification: %+v", res)
+	}
+	if got, _ := e.store.Users.Get(context.Background(), u.ID); !got.IsPremium || got.Role != "pro" {
+		t.Fatalf("purchase should grant premium: %+v", got)
+	}
+	e.decode(e.do("POST", "/api/v1/user/subscriptions/verify", thief, verifyApple), http.StatusConflict, nil)
+	e.decode(e.do("POST", "/api/v1/user/subscriptions/verify", token, map[string]string{"platform": "apple", "transaction_id": "404"}), http.StatusBadRequest, nil)
+
+	// A refund reaches us as a notification; the state is looked up again
+	apple.Set("1000", iaptest.AppleSubscription{ProductID: "premium.monthly", Status: 5, ExpiresAt: month})
+	e.decode(e.do("POST", "/api/v1/iap/apple/notifications", "", apple.Notification("REFUND", "1000")), http.StatusOK, nil)
+	if got, _ := e.store.Users.Get(context.Background(), u.ID); got.IsPremium || got.Role != "free" {
+		t.Fatalf("refund should end premium: %+v", got)
+	}
+
+	play.Set("tok-1", iaptest.GoogleSubscription{ProductID: "premium_monthly", State: "SUBSCRIPTION_STATE_ACTIVE", ExpiresAt: month, AutoRenew: true})
+	e.decode(e.do("POST", "/api/v1/user/subscriptions/verify", token, map[string]string{"platform": "google", "purchase_token": "tok-1"}), http.StatusOK, &res)
+	if !res.IsPremium || !play.Acknowledged("tok-1") {
+		t.Fatalf("google purchase should grant premium and be acknowledged: %+v", res)
+	}
+	push := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/iap/google/notifications"+query, bytes.NewReader(play.Push(13, "tok-1")))
+		rec := httptest.NewRecorder()
+		e.mux.ServeHTTP(rec, req)
+		return rec
+	}
+	e.decode(push("?token=wrong"), http.StatusForbidden, nil)
+	e.decode(push(""), http.StatusForbidden, nil)
+	// Without a configured token nothing is accepted, not even an empty one
+	e.srv.IAP.GooglePushToken = ""
+	e.decode(push(""), http.StatusServiceUnavailable, nil)
+	e.decode(push("?token="), http.StatusServiceUnavailable, nil)
+	e.srv.IAP.GooglePushToken = "push-secret"
+	play.Set("tok-1", iaptest.GoogleSubscription{ProductID: "premium_monthly", State: "SUBSCRIPTION_STATE_EXPIRED", ExpiresAt: time.Now().Add(-time.Hour)})
+	e.decode(push("?token=push-secret"), http.StatusOK, nil)
+
+	var list struct {
+		IsPremium     bool                  `json:"is_premium"`
+		Subscriptions []models.Subscription `json:"subscriptions"`
+	}
+	e.decode(e.do("GET", "/api/v1/user/subscriptions", token, nil), http.StatusOK, &list)
+	if list.IsPremium || len(list.Subscriptions) != 2 {
+		t.Fatalf("unexpected subscriptions: %+v", list)
+	}
+}
+
+func TestExpiredSubscriptionsAreDowngraded(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := context.Background()
+	now := time.Now()
+	pro, _ := e.user("pro", nil)
+	admin, _ := e.user("admin", func(u *models.User) { u.Role = "admin" })
+	gift, _ := e.user("gift", func(u *models.User) { u.IsPremium = true })
+
+	for i, id := range []string{pro.ID, admin.ID} {
+		sub := &models.Subscription{UserID: id, Platform: "apple", ProductID: "premium.monthly", ExternalID: fmt.Sprint(i),
+			Status: models.SubscriptionActive, ExpiresAt: now.Add(time.Hour)}
+		if err := e.store.Subs.Upsert(ctx, sub); err != nil {
+			t.Fatal(err)
+		}
+		e.store.Subs.SyncEntitlement(ctx, id, now)
+	}
+
+	if n, err := jobs.ExpireDue(ctx, e.store, nil, now); err != nil || n != 0 {
+		t.Fatalf("nothing is due yet: %d, %v", n, err)
+	}
+	if n, err := jobs.ExpireDue(ctx, e.store, nil, now.Add(2*time.Hour)); err != nil || n != 2 {
+		t.Fatalf("downgraded %d, %v; want 2", n, err)
+	}
+	for id, wantRole := range map[string]string{pro.ID: "free", admin.ID: "admin"} {
+		if u, _ := e.store.Users.Get(ctx, id); u.IsPremium || u.Role != wantRole {
+			t.Fatalf("unexpected user after expiry: %+v", u)
+		}
+	}
+	// Premium granted without a subscription is not the job's business
+	if u, _ := e.store.Users.Get(ctx, gift.ID); !u.IsPremium {
+		t.Fatal("users without subscriptions must keep their premium flag")
+	}
+}
+
+func TestAdminQuestionLifecycle(t *testing.T) {
+	e := newTestEnv(t)
+	test := e.seedTest("oabt", "Otizm", "Otizm Deneme 1")
+	_, userToken := e.user("regular", nil)
+	_, adminToken := e.user("admin", func(u *models.User) { u.Role = "admin" })
+
+	question := models.Question{TestID: test.ID, QuestionID: "q-1", Category: "Otizm", Text: "Soru?",
+		Options: []models.Option{{Text: "A", IsCorrect: true}, {Text: "B"}}}
+
+	e.decode(e.do("POST", "/api/v1/admin/questions", "", question), http.StatusUnauthorized, nil)
+	e.decode(e.do("POST", "/api/v1/admin/questions", userToken, question), http.StatusForbidden, nil)
+
+	var created models.Question
+	e.decode(e.do("POST", "/api/v1/admin/questions", adminToken, question), http.StatusOK, &created)
+	if created.ID == "" {
+		t.Fatal("created question has no ID")
+	}
+
+	created.Text = "Güncel soru?"
+	e.decode(e.do("PUT", "/api/v1/admin/questions/"+created.ID, adminToken, created), http.StatusOK, nil)
+
+	var questions []models.Question
+	e.decode(e.do("GET", "/test/"+test.ID+"/questions", "", nil), http.StatusOK, &questions)
+	if len(questions) != 1 || questions[0].Text != "Güncel soru?" {
+		t.Fatalf("unexpected questions: %+v", questions)
+	}
+
+	// Players don't get the answers up front, only once they submit
+	for _, path := range []string{"/test/" + test.ID + "/questions", "/questions"} {
+		if body := e.do("GET", path, "", nil).Body.String(); strings.Contains(body, "is_correct") || strings.Contains(body, "solution") {
+			t.Fatalf("%s gives the answers away: %s", path, body)
+		}
+	}
+
+	e.decode(e.do("DELETE", "/api/v1/admin/questions/"+created.ID, adminToken, nil), http.StatusNoContent, nil)
+	e.decode(e.do("DELETE", "/api/v1/admin/questions/"+created.ID, adminToken, nil), http.StatusNotFound, nil)
+	e.decode(e.do("PUT", "/api/v1/admin/questions/"+created.ID, adminToken, created), http.StatusNotFound, nil)
+}
+
+func TestTestAttempts(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := context.Background()
+	test := e.seedTest("oabt", "Otizm", "Otizm Deneme 1")
+	other := e.seedTest("oabt", "Otizm", "Otizm Deneme 2")
+	e.seedQuestions(test, 3)
+	e.seedQuestions(other, 1)
+	questions, _ := e.store.Questions.ListByTest(ctx, test.ID)
+	foreign, _ := e.store.Questions.ListByTest(ctx, other.ID)
+	u, token := e.user("solver", nil)
+	_, strangerToken := e.user("stranger", nil)
+
+	e.decode(e.do("POST", "/api/v1/tests/attempts", "", map[string]string{"test_id": test.ID}), http.StatusUnauthorized, nil)
+	e.decode(e.do("POST", "/api/v1/tests/attempts", token, map[string]string{"test_id": "missing"}), http.StatusNotFound, nil)
+	var started struct {
+		AttemptID string `json:"attempt_id"`
+	}
+	e.decode(e.do("POST", "/api/v1/tests/attempts", token, map[string]string{"test_id": test.ID}), http.StatusOK, &started)
+
+	answer := func(token, questionID, option string, want int) string {
+		t.Helper()
+		rec := e.do("POST", "/api/v1/questions/answer", token,
+			map[string]string{"attempt_id": started.AttemptID, "question_id": questionID, "option_text": option})
+		e.decode(rec, want, nil)
+		return rec.Body.String()
+	}
+	answer("", questions[0].ID, "A", http.StatusUnauthorized)
+	// Answers are recorded without telling whether they were right
+	if body := answer(token, questions[0].ID, "A", http.StatusOK); strings.Contains(body, "correct") {
+		t.Fatalf("answer gave its grade away: %s", body)
+	}
+	answer(token, questions[0].ID, "B", http.StatusConflict)
+	answer(token, questions[1].ID, "C", http.StatusBadRequest)
+	answer(token, questions[1].ID, "B", http.StatusOK)
+	answer(token, foreign[0].ID, "A", http.StatusNotFound)
+	answer(strangerToken, questions[2].ID, "A", http.StatusNotFound)
+
+	// The attempt's answers make the score, whatever the body says
+	var res struct {
+		Score   int                     `json:"score"`
+		Answers []handlers.AnswerReview `json:"answers"`
+	}
+	submit := map[string]interface{}{"test_id": test.ID, "attempt_id": started.AttemptID, "score": 6}
+	e.decode(e.do("POST", "/submit-test", strangerToken, submit), http.StatusNotFound, nil)
+	e.decode(e.do("POST", "/submit-test", token, submit), http.StatusOK, &res)
+	if res.Score != 2 || len(res.Answers) != 3 {
+		t.Fatalf("unexpected submission: %+v", res)
+	}
+	for _, a := range res.Answers {
+		if a.CorrectOption != "A" || a.Correct != (a.OptionText == "A") {
+			t.Fatalf("unexpected review: %+v", res.Answers)
+		}
+	}
+	if got, _ := e.store.Users.Get(ctx, u.ID); got.TotalScore != 2 {
+		t.Fatalf("unexpected score: %+v", got)
+	}
+
+	// A submitted attempt is closed
+	e.decode(e.do("POST", "/submit-test", token, submit), http.StatusConflict, nil)
+	answer(token, questions[2].ID, "A", http.StatusConflict)
+}
+
+func TestRoleAssignmentAndAuditLog(t *testing.T) {
+	e := newTestEnv(t)
+	test := e.seedTest("oabt", "Otizm", "Otizm Deneme 1")
+	admin, adminToken := e.user("admin", func(u *models.User) { u.Role = "admin" })
+	target, targetToken := e.user("target", nil)
+	_, moderatorToken := e.user("moderator", func(u *models.User) { u.Role = "moderator" })
+
+	question := models.Question{TestID: test.ID, QuestionID: "q-1", Text: "Soru?"}
+	e.decode(e.do("POST", "/api/v1/admin/questions", targetToken, question), http.StatusForbidden, nil)
+	e.decode(e.do("PUT", "/api/v1/admin/users/"+target.ID+"/role", targetToken, map[string]string{"role": "admin"}), http.StatusForbidden, nil)
+	e.decode(e.do("PUT", "/api/v1/admin/users/"+target.ID+"/role", moderatorToken, map[string]string{"role": "editor"}), http.StatusForbidden, nil)
+	e.decode(e.do("PUT", "/api/v1/admin/users/"+target.ID+"/role", adminToken, map[string]string{"role": "owner"}), http.StatusBadRequest, nil)
+	e.decode(e.do("PUT", "/api/v1/admin/users/"+admin.ID+"/role", adminToken, map[string]string{"role": "free"}), http.StatusForbidden, nil)
+
+	e.decode(e.do("PUT", "/api/v1/admin/users/"+target.ID+"/role", adminToken, map[string]string{"role": "editor"}), http.StatusOK, nil)
+	if u, _ := e.store.Users.Get(context.Background(), target.ID); u.Role != "editor" {
+		t.Fatalf("role not changed: %q", u.Role)
+	}
+
+	// The editor can now write questions but not manage users
+	var created models.Question
+	e.decode(e.do("POST", "/api/v1/admin/questions", targetToken, question), http.StatusOK, &created)
+	e.decode(e.do("GET", "/api/v1/admin/roles", targetToken, nil), http.StatusForbidden, nil)
+	e.decode(e.do("GET", "/api/v1/admin/audit", targetToken, nil), http.StatusForbidden, nil)
+
+	var entries []models.AuditEntry
+	e.decode(e.do("GET", "/api/v1/admin/audit", moderatorToken, nil), http.StatusOK, &entries)
+	if len(entries) != 2 || entries[0].Action != "question.create" || entries[1].Action != "user.role_change" {
+		t.Fatalf("unexpected audit log: %+v", entries)
+	}
+	change := entries[1]
+	if change.ActorID != admin.ID || change.TargetID != target.ID ||
+		string(change.Before) != `{"role":"free"}` || string(change.After) != `{"role":"editor"}` {
+		t.Fatalf("unexpected role change entry: %+v", change)
+	}
+	if entries[0].ActorID != target.ID || entries[0].TargetID != created.ID {
+		t.Fatalf("unexpected question entry: %+v", entries[0])
+	}
+
+	e.decode(e.do("GET", "/api/v1/admin/audit?action=user.role_change&actor_id="+admin.ID, adminToken, nil), http.StatusOK, &entries)
+	if len(entries) != 1 {
+		t.Fatalf("filter returned %d entries", len(entries))
+	}
+	e.decode(e.do("GET", "/api/v1/admin/audit?limit=1", adminToken, nil), http.StatusOK, &entries)
+	if len(entries) != 1 || entries[0].Action != "question.create" {
+		t.Fatalf("limit not applied: %+v", entries)
+	}
+	e.decode(e.do("GET", "/api/v1/admin/audit?limit=x", adminToken, nil), http.StatusBadRequest, nil)
+}
+
+func TestBulkCreateSkipsExistingQuestions(t *testing.T) {
+	e := newTestEnv(t)
+	e.store.Tests.(*memory.TestStore).AddExam(models.Exam{Slug: "oabt-ozel-egitim"})
+	_, adminToken := e.user("admin", func(u *models.User) { u.Role = "admin" })
+
+	batch := []models.Question{
+		{QuestionID: "b-1", Category: "Otizm", Text: "1"},
+		{QuestionID: "b-2", Category: "Otizm", Text: "2"},
+	}
+	var res map[string]interface{}
+	e.decode(e.do("POST", "/api/v1/admin/questions/bulk", adminToken, batch), http.StatusOK, &res)
+	if res["inserted"] != float64(2) || res["skipped"] != float64(0) {
+		t.Fatalf("unexpected first upload: %v", res)
+	}
+
+	e.decode(e.do("POST", "/api/v1/admin/questions/bulk", adminToken, batch), http.StatusOK, &res)
+	if res["inserted"] != float64(0) || res["skipped"] != float64(2) {
+		t.Fatalf("unexpected second upload: %v", res)
+	}
+	if n, _ := e.store.Tests.Count(context.Background()); n != 1 {
+		t.Fatalf("bulk upload should reuse its test, have %d tests", n)
+	}
+}
+
+func TestLeaderboardAndDeleteUser(t *testing.T) {
+	e := newTestEnv(t)
+	test := e.seedTest("oabt", "Otizm", "Otizm Deneme 1")
+	e.seedQuestions(test, 50)
+	low, lowToken := e.user("low", nil)
+	_, highToken := e.user("high", nil)
+
+	e.do("POST", "/submit-test", lowToken, map[string]interface{}{"test_id": test.ID, "score": 10})
+	e.do("POST", "/submit-test", highToken, map[string]interface{}{"test_id": test.ID, "score": 90})
+
+	var board []models.LeaderboardEntry
+	e.decode(e.do("GET", "/leaderboard", "", nil), http.StatusOK, &board)
+	if len(board) != 2 || board[0].Nickname != "high" || board[1].Score != 10 {
+		t.Fatalf("unexpected leaderboard: %+v", board)
+	}
+
+	e.decode(e.do("GET", "/api/v1/user/delete", lowToken, nil), http.StatusMethodNotAllowed, nil)
+	e.decode(e.do("DELETE", "/api/v1/user/delete", lowToken, nil), http.StatusOK, nil)
+	ctx := context.Background()
+	if u, err := e.store.Users.Get(ctx, low.ID); err != nil || u.DeletionScheduledFor == nil {
+		t.Fatalf("deletion should only be scheduled: %+v, %v", u, err)
+	}
+	e.decode(e.do("GET", "/leaderboard", "", nil), http.StatusOK, &board)
+	if len(board) != 1 || board[0].Nickname != "high" {
+		t.Fatalf("account awaiting deletion still ranked: %+v", board)
+	}
+
+	// Nothing is due before the grace period ends
+	if n, err := jobs.PurgeDue(ctx, e.store, time.Now()); err != nil || n != 0 {
+		t.Fatalf("purged %d accounts early (%v)", n, err)
+	}
+	if n, err := jobs.PurgeDue(ctx, e.store, time.Now().Add(e.srv.DeletionGracePeriod+time.Minute)); err != nil || n != 1 {
+		t.Fatalf("purged %d accounts, want 1 (%v)", n, err)
+	}
+	if _, err := e.store.Users.Get(ctx, low.ID); err != store.ErrNotFound {
+		t.Fatalf("purged user still readable: %v", err)
+	}
+	if n, _ := e.store.Results.CountForUser(ctx, low.ID); n != 0 {
+		t.Fatalf("purged user kept %d results", n)
+	}
+	if n, _ := e.store.Results.CountForUser(ctx, store.TombstoneUserID); n != 1 {
+		t.Fatalf("tombstone has %d results, want 1", n)
+	}
+	e.decode(e.do("GET", "/leaderboard", "", nil), http.StatusOK, &board)
+	if len(board) != 1 {
+		t.Fatalf("tombstone should not be ranked: %+v", board)
+	}
+}
+
+func TestRichLeaderboards(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := context.Background()
+	history := e.seedTest("kpss", "Tarih", "Tarih 1")
+	geography := e.seedTest("kpss", "Coğrafya", "Coğrafya 1")
+	e.seedQuestions(history, 50)
+	e.seedQuestions(geography, 50)
+
+	var tokens []string
+	for i := 0; i < 6; i++ {
+		_, token := e.user(fmt.Sprintf("player%d", i), nil)
+		tokens = append(tokens, token)
+		e.decode(e.do("POST", "/submit-test", token, map[string]interface{}{"test_id": history.ID, "score": 60 - i*10}), http.StatusOK, nil)
+	}
+	// player5 climbs the overall board with geography; retakes don't count
+	e.decode(e.do("POST", "/submit-test", tokens[5], map[string]interface{}{"test_id": geography.ID, "score": 45}), http.StatusOK, nil)
+	e.decode(e.do("POST", "/submit-test", tokens[5], map[string]interface{}{"test_id": geography.ID, "score": 30}), http.StatusOK, nil)
+
+	leaderboard := func(path, token string) (page handlers.LeaderboardPage) {
+		e.decode(e.do("GET", path, token, nil), http.StatusOK, &page)
+		return page
+	}
+	page := leaderboard("/api/v1/leaderboard?window=weekly&limit=2", "")
+	if page.Window != "weekly" || page.Board != "all" || page.ExpiresAt == nil || page.Total != 6 || len(page.Entries) != 2 ||
+		page.Entries[0].Nickname != "player0" || page.Entries[1].Nickname != "player5" || page.Entries[1].Score != 55 || page.Me != nil {
+		t.Fatalf("unexpected weekly board: %+v", page)
+	}
+	page = leaderboard("/api/v1/leaderboard?window=daily&offset=4&limit=10", tokens[3])
+	if len(page.Entries) != 2 || page.Entries[0].Rank != 5 || page.Entries[1].Nickname != "player4" ||
+		page.Me == nil || page.Me.Rank != 5 || !page.Me.Me || !page.Entries[0].Me || page.Entries[1].Me {
+		t.Fatalf("unexpected daily page: %+v", page)
+	}
+	page = leaderboard("/api/v1/leaderboard?category=tarih", "")
+	if page.Board != "category:tarih" || page.ExpiresAt != nil || page.Total != 6 || page.Entries[5].Nickname != "player5" || page.Entries[5].Score != 10 {
+		t.Fatalf("unexpected category board: %+v", page)
+	}
+	e.decode(e.do("GET", "/api/v1/leaderboard?window=yearly", "", nil), http.StatusBadRequest, nil)
+	e.decode(e.do("GET", "/api/v1/leaderboard?limit=0", "", nil), http.StatusBadRequest, nil)
+
+	type ownRank struct {
+		Ranked  bool                      `json:"ranked"`
+		Hidden  bool                      `json:"hidden"`
+		Me      *models.LeaderboardEntry  `json:"me"`
+		Entries []models.LeaderboardEntry `json:"entries"`
+	}
+	var mine ownRank
+	mine = ownRank{}
+	e.decode(e.do("GET", "/api/v1/leaderboard/me?window=monthly&around=1", tokens[3], nil), http.StatusOK, &mine)
+	if !mine.Ranked || mine.Me.Rank != 5 || len(mine.Entries) != 3 || mine.Entries[0].Rank != 4 || !mine.Entries[1].Me {
+		t.Fatalf("unexpected own rank: %+v", mine)
+	}
+	mine = ownRank{}
+	e.decode(e.do("GET", "/api/v1/leaderboard/me?category=cografya", tokens[0], nil), http.StatusOK, &mine)
+	if mine.Ranked || len(mine.Entries) != 0 {
+		t.Fatalf("player0 has no geography score: %+v", mine)
+	}
+	e.decode(e.do("GET", "/api/v1/leaderboard/me", "", nil), http.StatusUnauthorized, nil)
+
+	// Opting out hides the user everywhere until they opt back in
+	e.decode(e.do("PUT", "/api/v1/user/privacy", tokens[0], map[string]bool{"hide_from_leaderboards": true}), http.StatusOK, nil)
+	page = leaderboard("/api/v1/leaderboard", "")
+	if page.Total != 5 || page.Entries[0].Nickname != "player5" || page.Entries[0].Rank != 1 {
+		t.Fatalf("hidden user still ranked: %+v", page)
+	}
+	var board []models.LeaderboardEntry
+	e.decode(e.do("GET", "/leaderboard", "", nil), http.StatusOK, &board)
+	if len(board) != 5 {
+		t.Fatalf("hidden user still on the classic board: %+v", board)
+	}
+	mine = ownRank{}
+	e.decode(e.do("GET", "/api/v1/leaderboard/me", tokens[0], nil), http.StatusOK, &mine)
+	if mine.Ranked || !mine.Hidden {
+		t.Fatalf("unexpected own rank while hidden: %+v", mine)
+	}
+	e.decode(e.do("PUT", "/api/v1/user/privacy", tokens[0], map[string]string{}), http.StatusBadRequest, nil)
+	e.decode(e.do("POST", "/api/v1/user/privacy", tokens[0], map[string]bool{"hide_from_leaderboards": false}), http.StatusOK, nil)
+	mine = ownRank{}
+	e.decode(e.do("GET", "/api/v1/leaderboard/me", tokens[0], nil), http.StatusOK, &mine)
+	if !mine.Ranked || mine.Me.Rank != 1 || mine.Me.Score != 60 {
+		t.Fatalf("unexpected own rank after opting back in: %+v", mine)
+	}
+
+	// Periods that are over are pruned; all-time scores stay
+	n, err := e.store.Leaderboards.Prune(ctx, time.Now().AddDate(0, 2, 0))
+	if err != nil || n != 6*3*2+3 { // daily, weekly and monthly rows: six users on two boards, one on geography
+		t.Fatalf("Prune = %d, %v", n, err)
+	}
+	page = leaderboard("/api/v1/leaderboard?window=weekly", "")
+	if page.Total != 0 {
+		t.Fatalf("pruned weekly board still has %d users", page.Total)
+	}
+	page = leaderboard("/api/v1/leaderboard", "")
+	if page.Total != 6 {
+		t.Fatalf("all-time board lost users: %d", page.Total)
+	}
+}
+
+func TestSigningInCancelsDeletion(t *testing.T) {
+	e := newTestEnv(t)
+	reg := e.register("regretful")
+	e.decode(e.do("DELETE", "/api/v1/user/delete", reg["access_token"].(string), nil), http.StatusOK, nil)
+
+	var login map[string]interface{}
+	e.decode(e.do("POST", "/auth/device-login", "", map[string]string{
+		"user_id": reg["id"].(string), "device_secret": reg["device_secret"].(string),
+	}), http.StatusOK, &login)
+	if login["deletion_cancelled"] != true {
+		t.Fatalf("login should report the cancelled deletion: %v", login)
+	}
+	if n, _ := jobs.PurgeDue(context.Background(), e.store, time.Now().Add(365*24*time.Hour)); n != 0 {
+		t.Fatalf("cancelled deletion was purged")
+	}
+}
+
+func TestSubjectsAreFilteredByCategory(t *testing.T) {
+	e := newTestEnv(t)
+	subjects := e.store.Subjects.(*memory.SubjectStore)
+	subjects.Add("oabt", models.Subject{Title: "B", Category: "bilgi", Related: []string{"A"}})
+	subjects.Add("oabt", models.Subject{Title: "A", Category: "bilgi"})
+	subjects.Add("oabt", models.Subject{Title: "C", Category: "ogretim"})
+
+	var list []models.Subject
+	e.decode(e.do("GET", "/subjects?category=bilgi", "", nil), http.StatusOK, &list)
+	if len(list) != 2 || list[0].Title != "A" || len(list[1].Related) != 1 {
+		t.Fatalf("unexpected subjects: %+v", list)
+	}
+}
+
+func TestSyncWithoutDatabaseIsUnavailable(t *testing.T) {
+	e := newTestEnv(t)
+	e.decode(e.do("POST", "/api/v1/debug/sync-public?dry_run=true", "", nil), http.StatusServiceUnavailable, nil)
+}
+
+func TestDebugRoutesOutsideDevelopment(t *testing.T) {
+	e := newTestEnv(t)
+	// Development has to be asked for by name
+	if env, err := appenv.Parse(""); err != nil || env != appenv.Production {
+		t.Fatalf("an unset APP_ENV is %q, %v", env, err)
+	}
+	if env := handlers.NewServer(e.store, e.srv.Tokens).Env; env != appenv.Production {
+		t.Fatalf("new servers run as %q", env)
+	}
+	e.srv.Env = appenv.Production
+	e.mux = routes.RegisterRoutes(e.srv)
+	_, userToken := e.user("regular", nil)
+	_, adminToken := e.user("admin", func(u *models.User) { u.Role = "admin" })
+
+	e.decode(e.do("POST", "/api/v1/debug/sync-public?dry_run=true", adminToken, nil), http.StatusNotFound, nil)
+	e.decode(e.do("GET", "/api/v1/debug/db-stats", "", nil), http.StatusUnauthorized, nil)
+	e.decode(e.do("GET", "/api/v1/debug/db-stats", userToken, nil), http.StatusForbidden, nil)
+	e.decode(e.do("GET", "/api/v1/debug/db-stats", adminToken, nil), http.StatusOK, nil)
+	e.decode(e.do("GET", "/api/v1/debug/categories", adminToken, nil), http.StatusOK, nil)
+}
+
+func TestCleanSyncNeedsConfirmation(t *testing.T) {
+	e := newTestEnv(t)
+	var runs []database.SyncOptions
+	e.srv.SyncContent = func(opts database.SyncOptions) (*database.SyncReport, error) {
+		runs = append(runs, opts)
+		return &database.SyncReport{DryRun: opts.DryRun, Retired: 3}, nil
+	}
+	_, adminToken := e.user("admin", func(u *models.User) { u.Role = "admin" })
+	_, otherAdmin := e.user("admin2", func(u *models.User) { u.Role = "admin" })
+
+	e.decode(e.do("POST", "/api/v1/admin/sync?clean=true", adminToken, nil), http.StatusPreconditionRequired, nil)
+	e.decode(e.do("POST", "/api/v1/admin/sync?clean=true&confirm=nonsense", adminToken, nil), http.StatusPreconditionRequired, nil)
+	if len(runs) != 0 {
+		t.Fatalf("unconfirmed clean sync ran: %+v", runs)
+	}
+
+	var preview map[string]interface{}
+	e.decode(e.do("POST", "/api/v1/admin/sync?clean=true&dry_run=true", adminToken, nil), http.StatusOK, &preview)
+	confirm, _ := preview["confirmation_token"].(string)
+	if confirm == "" || preview["retired"] != float64(3) {
+		t.Fatalf("unexpected preview: %v", preview)
+	}
+
+	e.decode(e.do("POST", "/api/v1/admin/sync?clean=true&confirm="+confirm, otherAdmin, nil), http.StatusPreconditionRequired, nil)
+	e.decode(e.do("POST", "/api/v1/admin/sync?clean=true&confirm="+confirm, adminToken, nil), http.StatusOK, nil)
+	// A confirmation is good for one sync
+	e.decode(e.do("POST", "/api/v1/admin/sync?clean=true&confirm="+confirm, adminToken, nil), http.StatusPreconditionRequired, nil)
+	if len(runs) != 2 || !runs[1].Prune || runs[1].DryRun {
+		t.Fatalf("unexpected runs: %+v", runs)
+	}
+
+	// A plain sync never asks for confirmation, but only runs on POST
+	e.decode(e.do("POST", "/api/v1/admin/sync", adminToken, nil), http.StatusOK, nil)
+	e.decode(e.do("GET", "/api/v1/admin/sync", adminToken, nil), http.StatusMethodNotAllowed, nil)
+}
+
+// nonce has the server issue a sign-in nonce.
+func (e *testEnv) nonce() string {
+	var res struct {
+		Nonce string `json:"nonce"`
+	}
+	e.decode(e.do("POST", "/auth/nonce", "", nil), http.StatusOK, &res)
+	return res.Nonce
+}
+
+func (e *testEnv) googleToken(nonce, sub, email string, verified bool) string {
+	return e.keys.Token(e.t, jwt.MapClaims{
+		"iss": "https://accounts.google.com", "aud": "test-client", "sub": sub,
+		"email": email, "email_verified": verified, "nonce": nonce,
+	})
+}
+
+// googleSignIn returns a sign-in body whose token was minted for a freshly
+// issued nonce.
+func (e *testEnv) googleSignIn(sub, email string, verified bool) map[string]string {
+	nonce := e.nonce()
+	return map[string]string{"provider": "google", "nonce": nonce, "id_token": e.googleToken(nonce, sub, email, verified)}
+}
+
+// appleSignIn is googleSignIn for Apple, whose tokens carry the nonce's hash.
+func (e *testEnv) appleSignIn(sub, email string) map[string]string {
+	nonce := e.nonce()
+	hashed := sha256.Sum256([]byte(nonce))
+	return map[string]string{"provider": "apple", "nonce": nonce, "id_token": e.keys.Token(e.t, jwt.MapClaims{
+		"iss": "https://appleid.apple.com", "aud": "test-client", "sub": sub,
+		"email": email, "email_verified": "true", "nonce": hex.EncodeToString(hashed[:]),
+	})}
+}
+
+func TestSocialLoginUsesVerifiedClaims(t *testing.T) {
+	e := newTestEnv(t)
+
+	var first map[string]interface{}
+	e.decode(e.do("POST", "/auth/social-login", "", e.googleSignIn("g-1", "a@example.com", true)), http.StatusOK, &first)
+	if first["is_new_user"] != true {
+		t.Fatalf("expected a new user: %v", first)
+	}
+
+	var again map[string]interface{}
+	e.decode(e.do("POST", "/auth/social-login", "", e.googleSignIn("g-1", "a@example.com", true)), http.StatusOK, &again)
+	if again["id"] != first["id"] {
+		t.Fatalf("same subject should log into %v, got %v", first["id"], again["id"])
+	}
+
+	u, _ := e.store.Users.Get(context.Background(), first["id"].(string))
+	if u == nil || u.Email != "a@example.com" || len(u.Providers) != 1 || u.Providers[0] != "google" {
+		t.Fatalf("user not stored by verified subject: %+v", u)
+	}
+}
+
+func TestSocialLoginRejectsForgedOrMisdirectedTokens(t *testing.T) {
+	e := newTestEnv(t)
+	forger := identitytest.NewKeyServer(t)
+
+	nonce := e.nonce()
+	forged := forger.Token(t, jwt.MapClaims{"iss": "https://accounts.google.com", "aud": "test-client", "sub": "g-1", "nonce": nonce})
+	e.decode(e.do("POST", "/auth/social-login", "", map[string]string{"provider": "google", "nonce": nonce, "id_token": forged}), http.StatusUnauthorized, nil)
+
+	nonce = e.nonce()
+	otherApp := e.keys.Token(t, jwt.MapClaims{"iss": "https://accounts.google.com", "aud": "other-client", "sub": "g-1", "nonce": nonce})
+	e.decode(e.do("POST", "/auth/social-login", "", map[string]string{"provider": "google", "nonce": nonce, "id_token": otherApp}), http.StatusUnauthorized, nil)
+
+	// Tokens minted without a nonce, or sent without one, could be replayed
+	nonce = e.nonce()
+	noNonce := e.keys.Token(t, jwt.MapClaims{"iss": "https://accounts.google.com", "aud": "test-client", "sub": "g-1"})
+	e.decode(e.do("POST", "/auth/social-login", "", map[string]string{"provider": "google", "nonce": nonce, "id_token": noNonce}), http.StatusUnauthorized, nil)
+	e.decode(e.do("POST", "/auth/social-login", "", map[string]string{"provider": "google", "id_token": e.googleToken(e.nonce(), "g-1", "", false)}), http.StatusBadRequest, nil)
+	nonce = e.nonce()
+	e.decode(e.do("POST", "/auth/social-login", "", map[string]string{"provider": "google", "nonce": e.nonce(), "id_token": e.googleToken(nonce, "g-1", "", false)}), http.StatusUnauthorized, nil)
+
+	// The old body-only payload no longer works
+	e.decode(e.do("POST", "/auth/social-login", "", map[string]string{"provider": "google", "oauth_id": "g-1"}), http.StatusBadRequest, nil)
+	e.decode(e.do("POST", "/auth/social-login", "", map[string]string{"provider": "facebook", "nonce": e.nonce(), "id_token": forged}), http.StatusBadRequest, nil)
+}
+
+func TestSocialLoginNoncesAreSingleUse(t *testing.T) {
+	e := newTestEnv(t)
+
+	// Only nonces the server issued count, and each one only once
+	e.decode(e.do("POST", "/auth/social-login", "", map[string]string{"provider": "google", "nonce": "made-up", "id_token": e.googleToken("made-up", "g-1", "", false)}), http.StatusUnauthorized, nil)
+	login := e.googleSignIn("g-1", "", false)
+	e.decode(e.do("POST", "/auth/social-login", "", login), http.StatusOK, nil)
+	e.decode(e.do("POST", "/auth/social-login", "", login), http.StatusUnauthorized, nil)
+
+	// Google tokens carry the nonce itself; only Apple's carry its hash
+	nonce := e.nonce()
+	hashed := sha256.Sum256([]byte(nonce))
+	hashedGoogle := e.googleToken(hex.EncodeToString(hashed[:]), "g-1", "", false)
+	e.decode(e.do("POST", "/auth/social-login", "", map[string]string{"provider": "google", "nonce": nonce, "id_token": hashedGoogle}), http.StatusUnauthorized, nil)
+}
+
+func TestSocialLoginLinksOnlyVerifiedEmails(t *testing.T) {
+	e := newTestEnv(t)
+	existing, _ := e.user("existing", func(u *models.User) { u.Email, u.EmailVerified = "shared@example.com", true })
+
+	var res map[string]interface{}
+	e.decode(e.do("POST", "/auth/social-login", "", e.googleSignIn("g-unverified", "shared@example.com", false)), http.StatusOK, &res)
+	if res["id"] == existing.ID {
+		t.Fatal("unverified email must not sign into an existing account")
+	}
+
+	e.decode(e.do("POST", "/auth/social-login", "", e.googleSignIn("g-verified", "shared@example.com", true)), http.StatusOK, &res)
+	if res["id"] != existing.ID {
+		t.Fatalf("verified email should link to %s, got %v", existing.ID, res["id"])
+	}
+}
+
+func TestDeviceSecretLogin(t *testing.T) {
+	e := newTestEnv(t)
+
+	var reg map[string]interface{}
+	e.decode(e.do("POST", "/register", "", map[string]string{"nickname": "guest"}), http.StatusOK, &reg)
+	id, secret := reg["id"].(string), reg["device_secret"].(string)
+
+	var login map[string]interface{}
+	e.decode(e.do("POST", "/auth/device-login", "", map[string]string{"user_id": id, "device_secret": secret}), http.StatusOK, &login)
+	if login["id"] != id || login["access_token"] == "" {
+		t.Fatalf("unexpected device login response: %v", login)
+	}
+	e.decode(e.do("POST", "/auth/device-login", "", map[string]string{"user_id": id, "device_secret": "guess"}), http.StatusUnauthorized, nil)
+	e.decode(e.do("POST", "/auth/device-login", "", map[string]string{"user_id": "missing", "device_secret": secret}), http.StatusUnauthorized, nil)
+
+	// Rotating replaces the old secret
+	var rotated map[string]interface{}
+	e.decode(e.do("POST", "/api/v1/user/device-secret", reg["access_token"].(string), nil), http.StatusOK, &rotated)
+	e.decode(e.do("POST", "/auth/device-login", "", map[string]string{"user_id": id, "device_secret": secret}), http.StatusUnauthorized, nil)
+	e.decode(e.do("POST", "/auth/device-login", "", map[string]string{"user_id": id, "device_secret": rotated["device_secret"].(string)}), http.StatusOK, nil)
+}
+
+func TestUpgradeToEmailPasswordKeepsAccount(t *testing.T) {
+	e := newTestEnv(t)
+	guest, token := e.user("guest", nil)
+	test := e.seedTest("kpss", "Tarih", "Tarih 1")
+	e.seedQuestions(test, 50)
+	e.decode(e.do("POST", "/submit-test", token, map[string]interface{}{"test_id": test.ID, "score": 80}), http.StatusOK, nil)
+
+	e.decode(e.do("POST", "/api/v1/user/upgrade", token, map[string]string{"email": "not-an-email", "password": "long enough"}), http.StatusBadRequest, nil)
+	e.decode(e.do("POST", "/api/v1/user/upgrade", token, map[string]string{"email": "guest@example.com", "password": "short"}), http.StatusBadRequest, nil)
+	e.decode(e.do("POST", "/api/v1/user/upgrade", token, map[string]string{"email": "guest@example.com", "password": "correct horse"}), http.StatusOK, nil)
+
+	creds := map[string]string{"email": "guest@example.com", "password": "correct horse"}
+	e.decode(e.do("POST", "/auth/login", "", creds), http.StatusForbidden, nil)
+
+	e.decode(e.do("GET", "/auth/verify-email?token="+url.QueryEscape(e.mail.lastToken(t, "guest@example.com")), "", nil), http.StatusOK, nil)
+	e.decode(e.do("GET", "/auth/verify-email?token=bogus", "", nil), http.StatusBadRequest, nil)
+
+	e.decode(e.do("POST", "/auth/login", "", map[string]string{"email": "guest@example.com", "password": "wrong password"}), http.StatusUnauthorized, nil)
+	e.decode(e.do("POST", "/auth/login", "", map[string]string{"email": "nobody@example.com", "password": "correct horse"}), http.StatusUnauthorized, nil)
+
+	var login map[string]interface{}
+	e.decode(e.do("POST", "/auth/login", "", map[string]string{"email": "GUEST@example.com", "password": "correct horse"}), http.StatusOK, &login)
+	if login["id"] != guest.ID {
+		t.Fatalf("login should return the upgraded account %s, got %v", guest.ID, login["id"])
+	}
+	if n, _ := e.store.Results.CountForUser(context.Background(), guest.ID); n != 1 {
+		t.Fatalf("results after upgrade = %d, want 1", n)
+	}
+
+	// The address can't be claimed by a second account
+	_, other := e.user("other", nil)
+	e.decode(e.do("POST", "/api/v1/user/upgrade", other, creds), http.StatusConflict, nil)
+}
+
+func TestVerificationLinkGoesStaleWhenEmailChanges(t *testing.T) {
+	e := newTestEnv(t)
+	_, token := e.user("guest", nil)
+
+	e.decode(e.do("POST", "/api/v1/user/upgrade", token, map[string]string{"email": "first@example.com", "password": "correct horse"}), http.StatusOK, nil)
+	stale := e.mail.lastToken(t, "first@example.com")
+	e.decode(e.do("POST", "/api/v1/user/upgrade", token, map[string]string{"email": "second@example.com", "password": "correct horse"}), http.StatusOK, nil)
+
+	e.decode(e.do("POST", "/auth/verify-email", "", map[string]string{"token": stale}), http.StatusBadRequest, nil)
+
+	e.decode(e.do("POST", "/api/v1/user/resend-verification", token, nil), http.StatusOK, nil)
+	e.decode(e.do("POST", "/auth/verify-email", "", map[string]string{"token": e.mail.lastToken(t, "second@example.com")}), http.StatusOK, nil)
+}
+
+func TestSocialLoginDoesNotLinkUnverifiedLocalEmail(t *testing.T) {
+	e := newTestEnv(t)
+	_, token := e.user("squatter", nil)
+	e.decode(e.do("POST", "/api/v1/user/upgrade", token, map[string]string{"email": "victim@example.com", "password": "correct horse"}), http.StatusOK, nil)
+
+	var res map[string]interface{}
+	e.decode(e.do("POST", "/auth/social-login", "", e.googleSignIn("g-victim", "victim@example.com", true)), http.StatusOK, &res)
+	if res["is_new_user"] != true {
+		t.Fatalf("a verified provider email must not sign into an unverified local account: %v", res)
+	}
+}
+
+// register creates a local account and returns the login response.
+func (e *testEnv) register(nickname string) map[string]interface{} {
+	e.t.Helper()
+	var res map[string]interface{}
+	e.decode(e.do("POST", "/register", "", map[string]string{"nickname": nickname}), http.StatusOK, &res)
+	return res
+}
+
+func (e *testEnv) refresh(refreshToken string, wantStatus int) map[string]interface{} {
+	e.t.Helper()
+	var res map[string]interface{}
+	rec := e.do("POST", "/auth/refresh", "", map[string]string{"refresh_token": refreshToken})
+	if wantStatus != http.StatusOK {
+		e.decode(rec, wantStatus, nil)
+		return nil
+	}
+	e.decode(rec, wantStatus, &res)
+	return res
+}
+
+func TestRefreshTokenRotationDetectsReuse(t *testing.T) {
+	e := newTestEnv(t)
+	reg := e.register("ayse")
+	first := reg["refresh_token"].(string)
+
+	rotated := e.refresh(first, http.StatusOK)
+	second := rotated["refresh_token"].(string)
+	if second == first || rotated["access_token"] == "" {
+		t.Fatalf("refresh should issue a new pair: %v", rotated)
+	}
+	e.decode(e.do("GET", "/api/v1/user/sessions", rotated["access_token"].(string), nil), http.StatusOK, nil)
+
+	// Replaying the old token revokes the session, so the new one dies too
+	e.refresh(first, http.StatusUnauthorized)
+	e.refresh(second, http.StatusUnauthorized)
+}
+
+func TestAccessAndRefreshTokensAreNotInterchangeable(t *testing.T) {
+	e := newTestEnv(t)
+	reg := e.register("ayse")
+
+	e.refresh(reg["access_token"].(string), http.StatusUnauthorized)
+	e.decode(e.do("GET", "/api/v1/user/sessions", reg["refresh_token"].(string), nil), http.StatusUnauthorized, nil)
+
+	// HS256 tokens signed with the old development secret are rejected
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": reg["id"], "exp": 4102444800})
+	signed, _ := legacy.SignedString([]byte("default_oabt_secret_key_for_dev"))
+	e.decode(e.do("GET", "/api/v1/user/sessions", signed, nil), http.StatusUnauthorized, nil)
+}
+
+func TestSessionListAndLogout(t *testing.T) {
+	e := newTestEnv(t)
+	reg := e.register("ayse")
+	login := map[string]string{"user_id": reg["id"].(string), "device_secret": reg["device_secret"].(string)}
+
+	var tablet map[string]interface{}
+	e.decode(e.do("POST", "/auth/device-login", "", login), http.StatusOK, &tablet)
+	token := reg["access_token"].(string)
+
+	var sessions []models.Session
+	e.decode(e.do("GET", "/api/v1/user/sessions", token, nil), http.StatusOK, &sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("sessions = %d, want 2", len(sessions))
+	}
+	for _, s := range sessions {
+		if s.Current != (s.ID == reg["session_id"]) {
+			t.Fatalf("wrong current flag: %+v", s)
+		}
+	}
+
+	// Sign the tablet out from the phone
+	e.decode(e.do("POST", "/api/v1/user/logout", token, map[string]string{"session_id": tablet["session_id"].(string)}), http.StatusOK, nil)
+	e.refresh(tablet["refresh_token"].(string), http.StatusUnauthorized)
+	e.decode(e.do("POST", "/api/v1/user/logout", token, map[string]string{"session_id": tablet["session_id"].(string)}), http.StatusNotFound, nil)
+
+	// Another user's session can't be revoked
+	other := e.register("mehmet")
+	e.decode(e.do("POST", "/api/v1/user/logout", token, map[string]string{"session_id": other["session_id"].(string)}), http.StatusNotFound, nil)
+
+	e.decode(e.do("POST", "/auth/device-login", "", login), http.StatusOK, nil)
+	var all map[string]interface{}
+	e.decode(e.do("POST", "/api/v1/user/logout-all", token, nil), http.StatusOK, &all)
+	if all["revoked"] != float64(2) {
+		t.Fatalf("revoked = %v, want 2", all["revoked"])
+	}
+	e.refresh(reg["refresh_token"].(string), http.StatusUnauthorized)
+	e.refresh(other["refresh_token"].(string), http.StatusOK)
+}
+
+func TestSessionsEndOnDeletionAndRoleChange(t *testing.T) {
+	e := newTestEnv(t)
+
+	deleted := e.register("leaving")
+	e.decode(e.do("DELETE", "/api/v1/user/delete", deleted["access_token"].(string), nil), http.StatusOK, nil)
+	e.refresh(deleted["refresh_token"].(string), http.StatusUnauthorized)
+
+	promoted := e.register("promoted")
+	if err := e.store.Users.SetRole(context.Background(), promoted["id"].(string), "admin"); err != nil {
+		t.Fatal(err)
+	}
+	e.refresh(promoted["refresh_token"].(string), http.StatusUnauthorized)
+}
+
+func TestJWKSPublishesSigningKey(t *testing.T) {
+	e := newTestEnv(t)
+	_, token := e.user("ayse", nil)
+
+	var doc struct {
+		Keys []authtoken.JWK `json:"keys"`
+	}
+	e.decode(e.do("GET", "/.well-known/jwks.json", "", nil), http.StatusOK, &doc)
+	if len(doc.Keys) != 1 || doc.Keys[0].Kty != "OKP" || doc.Keys[0].X == "" {
+		t.Fatalf("unexpected JWKS: %+v", doc.Keys)
+	}
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Header["kid"] != doc.Keys[0].Kid || parsed.Method.Alg() != "EdDSA" {
+		t.Fatalf("token header %v doesn't match published key %s", parsed.Header, doc.Keys[0].Kid)
+	}
+}
+
+func TestLinkAndUnlinkProviders(t *testing.T) {
+	e := newTestEnv(t)
+
+	var apple map[string]interface{}
+	e.decode(e.do("POST", "/auth/social-login", "", e.appleSignIn("a-1", "")), http.StatusOK, &apple)
+	token := apple["access_token"].(string)
+
+	// Can't remove the only way in
+	e.decode(e.do("DELETE", "/api/v1/user/identities/apple", token, nil), http.StatusConflict, nil)
+
+	e.decode(e.do("POST", "/api/v1/user/identities", token, e.googleSignIn("g-1", "me@example.com", true)), http.StatusCreated, nil)
+	e.decode(e.do("POST", "/api/v1/user/identities", token, e.googleSignIn("g-1", "me@example.com", true)), http.StatusOK, nil)
+
+	// A second Google account can't be linked next to the first
+	e.decode(e.do("POST", "/api/v1/user/identities", token, e.googleSignIn("g-2", "other@example.com", true)), http.StatusConflict, nil)
+
+	var identities []models.Identity
+	e.decode(e.do("GET", "/api/v1/user/identities", token, nil), http.StatusOK, &identities)
+	if len(identities) != 2 {
+		t.Fatalf("identities = %+v, want apple and google", identities)
+	}
+
+	// Signing in with Google now lands on the same account
+	var google map[string]interface{}
+	e.decode(e.do("POST", "/auth/social-login", "", e.googleSignIn("g-1", "me@example.com", true)), http.StatusOK, &google)
+	if google["id"] != apple["id"] {
+		t.Fatalf("google sign-in should reach %v, got %v", apple["id"], google["id"])
+	}
+
+	e.decode(e.do("DELETE", "/api/v1/user/identities/apple", token, nil), http.StatusOK, nil)
+	e.decode(e.do("DELETE", "/api/v1/user/identities/apple", token, nil), http.StatusNotFound, nil)
+	e.decode(e.do("POST", "/auth/social-login", "", e.appleSignIn("a-1", "")), http.StatusOK, &apple)
+	if apple["id"] == google["id"] {
+		t.Fatal("an unlinked identity must not sign into the account anymore")
+	}
+}
+
+func TestMergeAccounts(t *testing.T) {
+	e := newTestEnv(t)
+	test := e.seedTest("kpss", "Tarih", "Tarih 1")
+	other := e.seedTest("kpss", "Tarih", "Tarih 2")
+	e.seedQuestions(test, 50)
+	e.seedQuestions(other, 50)
+
+	// The Apple account on the phone
+	var phone map[string]interface{}
+	e.decode(e.do("POST", "/auth/social-login", "", e.appleSignIn("a-1", "")), http.StatusOK, &phone)
+	phoneToken := phone["access_token"].(string)
+	e.decode(e.do("POST", "/submit-test", phoneToken, map[string]interface{}{"test_id": test.ID, "score": 80}), http.StatusOK, nil)
+	e.store.Tokens.Record(context.Background(), &models.TokenTransaction{UserID: phone["id"].(string), Amount: 5, Reason: "test"})
+
+	// The Google account on the tablet
+	var tablet map[string]interface{}
+	e.decode(e.do("POST", "/auth/social-login", "", e.googleSignIn("g-1", "me@example.com", true)), http.StatusOK, &tablet)
+	tabletToken := tablet["access_token"].(string)
+	e.decode(e.do("POST", "/submit-test", tabletToken, map[string]interface{}{"test_id": other.ID, "score": 70}), http.StatusOK, nil)
+	e.store.Tokens.Record(context.Background(), &models.TokenTransaction{UserID: tablet["id"].(string), Amount: 3, Reason: "test"})
+
+	// Linking reports the conflict instead of merging silently
+	e.decode(e.do("POST", "/api/v1/user/identities", phoneToken, e.googleSignIn("g-1", "me@example.com", true)), http.StatusConflict, nil)
+
+	var report store.MergeReport
+	e.decode(e.do("POST", "/api/v1/user/merge", phoneToken, e.googleSignIn("g-1", "me@example.com", true)), http.StatusOK, &report)
+	if report.ResultsMoved != 1 || report.IdentitiesMoved != 1 || !report.EmailMoved {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	u, err := e.store.Users.Get(context.Background(), phone["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 80 + 70 XP = level 2 with 50 XP; tokens and score are added up
+	if u.Level != 2 || u.XP != 50 || u.TotalScore != 150 || u.Tokens != 8 || u.Email != "me@example.com" {
+		t.Fatalf("unexpected merged user: %+v", u)
+	}
+	if n, _ := e.store.Results.CountForUser(context.Background(), u.ID); n != 2 {
+		t.Fatalf("results = %d, want 2", n)
+	}
+	var page handlers.LeaderboardPage
+	e.decode(e.do("GET", "/api/v1/leaderboard?window=weekly", "", nil), http.StatusOK, &page)
+	if page.Total != 1 || page.Entries[0].Score != 150 {
+		t.Fatalf("leaderboard scores should be merged: %+v", page)
+	}
+	if drift, _ := e.store.Tokens.Reconcile(context.Background()); len(drift) != 0 {
+		t.Fatalf("merge left the ledger out of balance: %+v", drift)
+	}
+	if _, err := e.store.Users.Get(context.Background(), tablet["id"].(string)); err == nil {
+		t.Fatal("absorbed account should be gone")
+	}
+	e.refresh(tablet["refresh_token"].(string), http.StatusUnauthorized)
+
+	var again map[string]interface{}
+	e.decode(e.do("POST", "/auth/social-login", "", e.googleSignIn("g-1", "me@example.com", true)), http.StatusOK, &again)
+	if again["id"] != u.ID {
+		t.Fatalf("google sign-in should reach the merged account %s, got %v", u.ID, again["id"])
+	}
+}
+
+func TestMergeRefusesSameProviderOnBothAccounts(t *testing.T) {
+	e := newTestEnv(t)
+
+	var first, second map[string]interface{}
+	e.decode(e.do("POST", "/auth/social-login", "", e.googleSignIn("g-1", "", false)), http.StatusOK, &first)
+	e.decode(e.do("POST", "/auth/social-login", "", e.googleSignIn("g-2", "", false)), http.StatusOK, &second)
+
+	e.decode(e.do("POST", "/api/v1/user/merge", first["access_token"].(string), e.googleSignIn("g-2", "", false)), http.StatusConflict, nil)
+	e.decode(e.do("POST", "/api/v1/user/merge", first["access_token"].(string), e.googleSignIn("g-1", "", false)), http.StatusBadRequest, nil)
+}
+
+// exportedData unzips an export archive and decodes its data.json.
+func exportedData(t *testing.T, archive []byte) map[string]interface{} {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("reading archive: %v", err)
+	}
+	var data map[string]interface{}
+	for _, f := range zr.File {
+		if f.Name != "data.json" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		if err := json.NewDecoder(rc).Decode(&data); err != nil {
+			t.Fatalf("decoding data.json: %v", err)
+		}
+	}
+	if data == nil {
+		t.Fatal("archive has no data.json")
+	}
+	return data
+}
+
+func TestExportReturnsArchive(t *testing.T) {
+	e := newTestEnv(t)
+	test := e.seedTest("oabt", "Otizm", "Otizm Deneme 1")
+	u, token := e.user("exporter", nil)
+	e.store.Results.Create(context.Background(), &models.TestResult{UserID: u.ID, TestID: test.ID, Score: 42})
+
+	e.decode(e.do("GET", "/api/v1/user/export", "", nil), http.StatusUnauthorized, nil)
+	rec := e.do("GET", "/api/v1/user/export", token, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("status = %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	data := exportedData(t, rec.Body.Bytes())
+	results := data["test_results"].([]interface{})
+	if len(results) != 1 || results[0].(map[string]interface{})["test_title"] != "Otizm Deneme 1" {
+		t.Fatalf("unexpected results: %v", results)
+	}
+	if data["profile"].(map[string]interface{})["nickname"] != "exporter" {
+		t.Fatalf("unexpected profile: %v", data["profile"])
+	}
+}
+
+func TestAsyncExport(t *testing.T) {
+	e := newTestEnv(t)
+	_, token := e.user("exporter", nil)
+	_, otherToken := e.user("other", nil)
+
+	var started struct {
+		Export    models.DataExport `json:"export"`
+		StatusURL string            `json:"status_url"`
+	}
+	e.decode(e.do("GET", "/api/v1/user/export?async=true", token, nil), http.StatusAccepted, &started)
+	if started.StatusURL != "/api/v1/user/export/"+started.Export.ID {
+		t.Fatalf("unexpected response: %+v", started)
+	}
+	e.decode(e.do("GET", started.StatusURL, otherToken, nil), http.StatusNotFound, nil)
+
+	var status map[string]interface{}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		e.decode(e.do("GET", started.StatusURL, token, nil), http.StatusOK, &status)
+		if status["export"].(map[string]interface{})["status"] == "ready" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("export not ready: %v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	e.decode(e.do("GET", started.StatusURL+"/download", otherToken, nil), http.StatusNotFound, nil)
+	rec := e.do("GET", status["download_url"].(string), token, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("download status = %d", rec.Code)
+	}
+	if data := exportedData(t, rec.Body.Bytes()); data["profile"].(map[string]interface{})["nickname"] != "exporter" {
+		t.Fatalf("unexpected profile: %v", data["profile"])
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	e := newTestEnv(t)
+	e.srv.Limiter = ratelimit.New(ratelimit.NewMemory(), map[string]ratelimit.Policy{
+		"register": {Name: "register", Rate: 2, Per: time.Hour, Burst: 2, By: ratelimit.ByIP},
+		"reward":   {Name: "reward", Rate: 1, Per: time.Hour, Burst: 1, By: ratelimit.ByUser},
+	})
+	e.mux = routes.RegisterRoutes(e.srv)
+
+	e.register("first")
+	e.register("second")
+	rec := e.do("POST", "/register", "", map[string]string{"nickname": "third"})
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1800" {
+		t.Fatalf("status = %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	// Per-user policies count each user separately
+	_, ayse := e.user("ayse", nil)
+	_, mehmet := e.user("mehmet", nil)
+	reward := map[string]string{"reward_type": "ad_watch"}
+	e.decode(e.do("POST", "/api/v1/user/reward", ayse, reward), http.StatusOK, nil)
+	e.decode(e.do("POST", "/api/v1/user/reward", ayse, reward), http.StatusTooManyRequests, nil)
+	e.decode(e.do("POST", "/api/v1/user/reward", mehmet, reward), http.StatusOK, nil)
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"backend/internal/credentials"
+	"backend/internal/identity"
+	"backend/internal/middleware"
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func identityRecord(userID string, ident *identity.Identity) *models.Identity {
+	email := ""
+	if ident.EmailVerified {
+		email = ident.Email
+	}
+	return &models.Identity{Provider: ident.Provider, Subject: ident.Subject, UserID: userID, Email: email}
+}
+
+// createSocialUser creates an account for a provider identity seen for the
+// first time. email is empty unless the provider verified it.
+func (s *Server) createSocialUser(ctx context.Context, ident *identity.Identity, email, emoji string) (*models.User, error) {
+	// Use the subject as temporary nickname to satisfy UNIQUE constraint
+	safeSubject := ident.Subject
+	if len(safeSubject) > 8 {
+		safeSubject = safeSubject[:8]
+	}
+	user := &models.User{
+		Nickname:      "user_" + safeSubject + "_" + uuid.NewString()[:4],
+		Emoji:         emoji,
+		Email:         email,
+		EmailVerified: email != "",
+		Provider:      ident.Provider,
+	}
+	if err := s.Store.Users.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	if err := s.Store.Identities.Link(ctx, identityRecord(user.ID, ident)); err != nil {
+		// Lost a race with a concurrent first sign-in; don't leave an orphan behind
+		if delErr := s.Store.Users.Delete(ctx, user.ID); delErr != nil {
+			log.Printf("SocialLogin: removing orphaned user %s: %v", user.ID, delErr)
+		}
+		return nil, err
+	}
+	user.Providers = []string{ident.Provider}
+	return user, nil
+}
+
+// nonceTTL is how long a sign-in nonce can wait for its ID token.
+const nonceTTL = 10 * time.Minute
+
+// identityNonce is the NonceStore purpose of sign-in nonces.
+const identityNonce = "identity"
+
+// NonceHandler issues a single-use nonce for the client to pass to the
+// identity provider and send back with the ID token it gets.
+func (s *Server) NonceHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Only the hash is kept, like the other secrets the server hands out
+	nonce, hash, err := credentials.NewSecret()
+	if err != nil {
+		http.Error(w, "Failed to issue nonce", http.StatusInternalServerError)
+		return
+	}
+	expiresAt := time.Now().Add(nonceTTL)
+	if err := s.Store.Nonces.Issue(r.Context(), identityNonce, hash, expiresAt); err != nil {
+		log.Printf("Nonce: issuing: %v", err)
+		http.Error(w, "Failed to issue nonce", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"nonce": nonce, "expires_at": expiresAt})
+}
+
+// identityPayload is the body of the requests that present an ID token.
+type identityPayload struct {
+	Provider string `json:"provider"` // "google" or "apple"
+	IDToken  string `json:"id_token"`
+	Nonce    string `json:"nonce"` // from NonceHandler
+	Emoji    string `json:"emoji"` // avatar for accounts created by social login
+}
+
+// verifyIdentityPayload reads an identityPayload, uses up its nonce and
+// verifies the token, writing the error response itself when it fails.
+func (s *Server) verifyIdentityPayload(w http.ResponseWriter, r *http.Request) (*identity.Identity, *identityPayload, bool) {
+	var payload identityPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	if payload.IDToken == "" {
+		http.Error(w, "id_token is required", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	if payload.Nonce == "" {
+		http.Error(w, "nonce is required", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	if s.Identity == nil {
+		http.Error(w, "Social login is not available", http.StatusServiceUnavailable)
+		return nil, nil, false
+	}
+
+	// A nonce counts once, whether or not its token turns out valid
+	err := s.Store.Nonces.Consume(r.Context(), identityNonce, credentials.HashSecret(payload.Nonce), time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Nonce is unknown, expired or already used", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+	if err != nil {
+		log.Printf("Identity: consuming nonce: %v", err)
+		http.Error(w, "Failed to check nonce", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	ident, err := s.Identity.Verify(r.Context(), payload.Provider, payload.IDToken, payload.Nonce)
+	switch {
+	case errors.Is(err, identity.ErrUnknownProvider), errors.Is(err, identity.ErrNotConfigured), errors.Is(err, identity.ErrMissingNonce):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	case err != nil:
+		log.Printf("Identity: rejected %s token: %v", payload.Provider, err)
+		http.Error(w, "Invalid identity token", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+	return ident, &payload, true
+}
+
+// IdentitiesHandler lists the sign-in providers linked to the current
+// account (GET) or links another one with a fresh ID token (POST).
+func (s *Server) IdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	userID, _ := r.Context().Value("userID").(string)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		identities, err := s.Store.Identities.List(r.Context(), userID)
+		if err != nil {
+			storeError(w, err, "User not found")
+			return
+		}
+		json.NewEncoder(w).Encode(identities)
+	case "POST":
+		ident, _, ok := s.verifyIdentityPayload(w, r)
+		if !ok {
+			return
+		}
+
+		existing, err := s.Store.Identities.Get(r.Context(), ident.Provider, ident.Subject)
+		if err == nil {
+			if existing.UserID != userID {
+				http.Error(w, "This sign-in is used by another account; merge the accounts to combine them", http.StatusConflict)
+				return
+			}
+			json.NewEncoder(w).Encode(existing)
+			return
+		}
+
+		record := identityRecord(userID, ident)
+		err = s.Store.Identities.Link(r.Context(), record)
+		if errors.Is(err, store.ErrConflict) {
+			http.Error(w, "Account already has a "+ident.Provider+" sign-in; unlink it first", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			storeError(w, err, "User not found")
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(record)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// UnlinkIdentityHandler removes a provider from the current account, as long
+// as another way to sign in remains.
+func (s *Server) UnlinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := r.Context().Value("userID").(string)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	provider := strings.TrimPrefix(r.URL.Path, "/api/v1/user/identities/")
+
+	ctx := r.Context()
+	identities, err := s.Store.Identities.List(ctx, userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	creds, err := s.Store.Credentials.Get(ctx, userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	linked := false
+	for _, id := range identities {
+		linked = linked || id.Provider == provider
+	}
+	if !linked {
+		http.Error(w, "Provider is not linked", http.StatusNotFound)
+		return
+	}
+	hasPassword := creds.PasswordHash != "" && creds.EmailVerified
+	if len(identities) == 1 && !hasPassword && creds.DeviceSecretHash == "" {
+		http.Error(w, "Can't unlink the only way to sign in to this account", http.StatusConflict)
+		return
+	}
+
+	if err := s.Store.Identities.Unlink(ctx, userID, provider); err != nil {
+		storeError(w, err, "Provider is not linked")
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// MergeAccountHandler folds another account into the current one. The caller
+// proves they own the other account with an ID token of one of its linked
+// identities; see store.MergeUsers for how conflicting data is combined.
+func (s *Server) MergeAccountHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := r.Context().Value("userID").(string)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ident, _, ok := s.verifyIdentityPayload(w, r)
+	if !ok {
+		return
+	}
+
+	other, err := s.Store.Identities.Get(r.Context(), ident.Provider, ident.Subject)
+	if err != nil {
+		storeError(w, err, "No account uses this sign-in")
+		return
+	}
+	if other.UserID == userID {
+		http.Error(w, "This sign-in already belongs to your account", http.StatusBadRequest)
+		return
+	}
+
+	report, err := s.Store.Users.Merge(r.Context(), userID, other.UserID, s.Progression.Curve)
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "Both accounts have a sign-in from the same provider; unlink one first", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	log.Printf("Merge: user %s absorbed user %s (%d results)", userID, other.UserID, report.ResultsMoved)
+	json.NewEncoder(w).Encode(report)
+}
@@ -1,32 +1,254 @@
 package handlers
 
 import (
-	"backend/internal/database"
+	"backend/internal/leaderboard"
 	"backend/internal/middleware"
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"slices"
+	"strconv"
+	"time"
 )
 
-func GetLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCors(&w)
-	rows, err := database.DB.Query("SELECT nickname, emoji, total_score, streak FROM users ORDER BY total_score DESC LIMIT 10")
+	list, err := s.Store.Users.TopByScore(r.Context(), 10)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
+	json.NewEncoder(w).Encode(list)
+}
+
+// LeaderboardPage is a page of one board period's ranking. Me is the
+// caller's own entry when they are signed in and ranked, whether or not it
+// is on the page.
+type LeaderboardPage struct {
+	models.BoardPeriod
+	Total   int                       `json:"total"`
+	Entries []models.LeaderboardEntry `json:"entries"`
+	Me      *models.LeaderboardEntry  `json:"me,omitempty"`
+}
 
-	type LeaderboardEntry struct {
-		Nickname string `json:"nickname"`
-		Emoji    string `json:"emoji"`
-		Score    int    `json:"score"`
-		Streak   int    `json:"streak"`
+// boardPeriod reads the window and category query parameters into the
+// current period of that board.
+func boardPeriod(r *http.Request) (models.BoardPeriod, error) {
+	q := r.URL.Query()
+	window, ok := leaderboard.ParseWindow(q.Get("window"))
+	if !ok {
+		return models.BoardPeriod{}, errors.New("window must be one of daily, weekly, monthly or all_time")
 	}
-	var list []LeaderboardEntry = []LeaderboardEntry{}
-	for rows.Next() {
-		var e LeaderboardEntry
-		rows.Scan(&e.Nickname, &e.Emoji, &e.Score, &e.Streak)
-		list = append(list, e)
+	board := leaderboard.Overall
+	if c := q.Get("category"); c != "" {
+		board = leaderboard.CategoryBoard(c)
+	}
+	return leaderboard.Period(board, window, time.Now()), nil
+}
+
+// intParam reads a non-negative integer query parameter no larger than max.
+func intParam(r *http.Request, name string, def, max int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || n > max {
+		return 0, errors.New(name + " must be between 0 and " + strconv.Itoa(max))
+	}
+	return n, nil
+}
+
+// LeaderboardHandler returns a page of the overall or a category's ranking
+// for a time window: ?window=daily|weekly|monthly|all_time&category=&offset=&limit=.
+func (s *Server) LeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p, err := boardPeriod(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset, err := intParam(r, "offset", 0, 100000)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := intParam(r, "limit", 50, 100)
+	if err != nil || limit == 0 {
+		http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	page := LeaderboardPage{BoardPeriod: p}
+	if page.Total, err = s.Store.Leaderboards.Count(ctx, p); err != nil {
+		storeError(w, err, "Leaderboard not found")
+		return
+	}
+	if page.Entries, err = s.Store.Leaderboards.Top(ctx, p, offset, limit); err != nil {
+		storeError(w, err, "Leaderboard not found")
+		return
+	}
+	if userID, _ := ctx.Value("userID").(string); userID != "" {
+		page.Me, err = s.Store.Leaderboards.Rank(ctx, p, userID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			storeError(w, err, "User not found")
+			return
+		}
+		for i := range page.Entries {
+			page.Entries[i].Me = page.Entries[i].UserID == userID
+		}
+		if page.Me != nil {
+			page.Me.Me = true
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// MyRankHandler returns the caller's rank with up to ?around= users on
+// either side of them. Users who are hidden or have no score in the period
+// get Ranked false and no entries.
+func (s *Server) MyRankHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	p, err := boardPeriod(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	around, err := intParam(r, "around", 5, 25)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := s.Store.Users.Get(ctx, userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	total, err := s.Store.Leaderboards.Count(ctx, p)
+	if err != nil {
+		storeError(w, err, "Leaderboard not found")
+		return
+	}
+	resp := map[string]interface{}{
+		"board":   p.Board,
+		"window":  p.Window,
+		"period":  p.Period,
+		"ends_at": p.ExpiresAt,
+		"total":   total,
+		"hidden":  user.LeaderboardHidden,
+		"ranked":  false,
+		"entries": []models.LeaderboardEntry{},
+	}
+
+	me, err := s.Store.Leaderboards.Rank(ctx, p, userID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		storeError(w, err, "User not found")
+		return
+	}
+	if me != nil {
+		entries, err := s.Store.Leaderboards.Around(ctx, p, userID, around)
+		if errors.Is(err, store.ErrNotFound) {
+			entries = nil // hidden since the rank was read
+		} else if err != nil {
+			storeError(w, err, "Leaderboard not found")
+			return
+		}
+		// Ranks count on from the caller's, who is in the list
+		self := slices.IndexFunc(entries, func(e models.LeaderboardEntry) bool { return e.UserID == userID })
+		for i := range entries {
+			entries[i].Rank = me.Rank - self + i
+			entries[i].Me = i == self
+		}
+		if entries != nil {
+			me.Me = true
+			resp["ranked"], resp["me"], resp["entries"] = true, me, entries
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// LeaderboardPrivacyHandler sets whether the caller appears on leaderboards.
+// Hidden users keep earning scores and reappear with them when they opt
+// back in.
+func (s *Server) LeaderboardPrivacyHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := r.Context().Value("userID").(string)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var payload struct {
+		Hide *bool `json:"hide_from_leaderboards"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if payload.Hide == nil {
+		http.Error(w, "hide_from_leaderboards is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Store.Leaderboards.SetHidden(r.Context(), userID, *payload.Hide); err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "hide_from_leaderboards": *payload.Hide})
+}
+
+// addLeaderboardScore counts a first attempt's score towards the overall
+// and category boards. Only the authenticated user's own score counts. Like
+// league XP, errors are logged rather than failing the submission.
+func (s *Server) addLeaderboardScore(ctx context.Context, userID, testID string, score int) {
+	if score <= 0 {
+		return
+	}
+	if !isCaller(ctx, userID) {
+		log.Printf("Leaderboards: refusing %d points for %s from another caller", score, userID)
+		return
+	}
+	category := ""
+	if t, err := s.Store.Tests.Get(ctx, testID); err == nil {
+		category = t.CategorySlug
+	} else {
+		log.Printf("Leaderboards: loading test %s: %v", testID, err)
+	}
+	if err := s.Store.Leaderboards.Add(ctx, userID, score, leaderboard.PeriodsFor(category, time.Now())); err != nil {
+		log.Printf("Leaderboards: adding %d points for %s: %v", score, userID, err)
 	}
-	json.NewEncoder(w).Encode(list)
 }
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"backend/internal/leagues"
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// LeagueRow is a line of a league group's table.
+type LeagueRow struct {
+	Rank int `json:"rank"`
+	models.LeagueStanding
+	// Zone is "promotion" or "relegation" for members who would move if the
+	// week ended now, and empty otherwise.
+	Zone string `json:"zone,omitempty"`
+	Me   bool   `json:"me"`
+}
+
+// LeagueStatus is the user's league this week. Users join a group with
+// their first XP of the week, so Joined is false until then and there are
+// no standings.
+type LeagueStatus struct {
+	Week     string      `json:"week"`
+	EndsAt   time.Time   `json:"ends_at"`
+	Tier     int         `json:"tier"`
+	TierName string      `json:"tier_name"`
+	Tiers    []string    `json:"tiers"`
+	Joined   bool        `json:"joined"`
+	XP       int         `json:"xp"`
+	Rank     int         `json:"rank,omitempty"`
+	Promote  int         `json:"promote"`  // how many move up at the end of the week
+	Relegate int         `json:"relegate"` // how many move down
+	Table    []LeagueRow `json:"standings"`
+}
+
+// CurrentLeagueHandler returns the standings of the user's league group
+// for the current week.
+func (s *Server) CurrentLeagueHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := s.Store.Users.Get(ctx, userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	week := leagues.Week(time.Now())
+	endsAt, _ := leagues.WeekEnd(week)
+	status := LeagueStatus{Week: week, EndsAt: endsAt, Tier: user.LeagueTier, TierName: leagues.TierName(user.LeagueTier),
+		Tiers: leagues.Tiers, Table: []LeagueRow{}}
+
+	m, err := s.Store.Leagues.Membership(ctx, userID, week)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		storeError(w, err, "User not found")
+		return
+	}
+	if m != nil {
+		standings, err := s.Store.Leagues.Standings(ctx, m.GroupID)
+		if err != nil {
+			storeError(w, err, "League not found")
+			return
+		}
+		// The group's tier is the one the user plays in this week
+		status.Tier, status.TierName = m.Tier, leagues.TierName(m.Tier)
+		status.Joined, status.XP = true, m.XP
+		status.Promote, status.Relegate = leagues.Zones(m.Tier, len(standings))
+		for i, st := range standings {
+			row := LeagueRow{Rank: i + 1, LeagueStanding: st, Me: st.UserID == userID}
+			switch {
+			case i < status.Promote:
+				row.Zone = "promotion"
+			case i >= len(standings)-status.Relegate:
+				row.Zone = "relegation"
+			}
+			if row.Me {
+				status.Rank = row.Rank
+			}
+			status.Table = append(status.Table, row)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// LeagueHistoryHandler lists the user's finished league weeks, newest first.
+func (s *Server) LeagueHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	user, err := s.Store.Users.Get(r.Context(), userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	history, err := s.Store.Leagues.History(r.Context(), userID, limit)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tier":      user.LeagueTier,
+		"tier_name": leagues.TierName(user.LeagueTier),
+		"tiers":     leagues.Tiers,
+		"history":   history,
+	})
+}
+
+// addLeagueXP counts xp towards the user's league this week. Only the
+// authenticated user's own XP counts. Errors are logged: the XP itself is
+// already saved and leagues must not fail the request that earned it.
+func (s *Server) addLeagueXP(ctx context.Context, userID string, level, xp int) {
+	if xp <= 0 {
+		return
+	}
+	if !isCaller(ctx, userID) {
+		log.Printf("Leagues: refusing %d XP for %s from another caller", xp, userID)
+		return
+	}
+	m := &models.LeagueMembership{UserID: userID, Week: leagues.Week(time.Now()), XP: xp}
+	if err := s.Store.Leagues.AddXP(ctx, m, leagues.LevelBand(level), leagues.GroupSize); err != nil {
+		log.Printf("Leagues: adding %d XP for %s: %v", xp, userID, err)
+	}
+}
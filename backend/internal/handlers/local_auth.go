@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"backend/internal/credentials"
+	"backend/internal/mail"
+	"backend/internal/middleware"
+	"backend/internal/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// emailVerificationTTL is how long an emailed verification link stays valid.
+const emailVerificationTTL = 24 * time.Hour
+
+// issueDeviceSecret stores a fresh device secret for the user and returns the raw value.
+func (s *Server) issueDeviceSecret(ctx context.Context, userID string) (string, error) {
+	raw, hash, err := credentials.NewSecret()
+	if err != nil {
+		return "", err
+	}
+	if err := s.Store.Credentials.SetDeviceSecret(ctx, userID, hash); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// sendVerification emails a one-time link that confirms the user owns email.
+func (s *Server) sendVerification(ctx context.Context, userID, email string) error {
+	raw, hash, err := credentials.NewSecret()
+	if err != nil {
+		return err
+	}
+	if err := s.Store.Credentials.AddEmailVerification(ctx, userID, email, hash, time.Now().Add(emailVerificationTTL)); err != nil {
+		return err
+	}
+
+	link := s.VerifyEmailURL + "?token=" + url.QueryEscape(raw)
+	return s.Mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body:    "Confirm this email address for your account by opening the link below.\n\n" + link + "\n\nThe link expires in 24 hours.",
+	})
+}
+
+// DeviceLoginHandler signs a local account in with the device secret it
+// received at registration.
+func (s *Server) DeviceLoginHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		UserID       string `json:"user_id"`
+		DeviceSecret string `json:"device_secret"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	creds, err := s.Store.Credentials.Get(r.Context(), payload.UserID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		storeError(w, err, "User not found")
+		return
+	}
+	if err != nil || creds.DeviceSecretHash == "" || !credentials.SecretMatches(payload.DeviceSecret, creds.DeviceSecretHash) {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	resp, err := s.startSession(r, creds.UserID, "Login successful")
+	if err != nil {
+		http.Error(w, "Failed to start session", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// checkAgainstDummy spends the same time as a real password check, so
+// response times don't reveal which emails have an account.
+func checkAgainstDummy(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = credentials.HashPassword("not-a-real-password")
+	})
+	credentials.CheckPassword(password, dummyHash)
+}
+
+// LoginHandler signs a user in with email and password. The email must have
+// been verified first.
+func (s *Server) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	creds, err := s.Store.Credentials.GetByEmail(r.Context(), strings.TrimSpace(payload.Email))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		storeError(w, err, "User not found")
+		return
+	}
+	if err != nil || creds.PasswordHash == "" {
+		checkAgainstDummy(payload.Password)
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+
+	ok, err := credentials.CheckPassword(payload.Password, creds.PasswordHash)
+	if err != nil {
+		log.Printf("Login: bad password hash for user %s: %v", creds.UserID, err)
+	}
+	if !ok {
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+	if !creds.EmailVerified {
+		http.Error(w, "Email address is not verified", http.StatusForbidden)
+		return
+	}
+
+	resp, err := s.startSession(r, creds.UserID, "Login successful")
+	if err != nil {
+		http.Error(w, "Failed to start session", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// UpgradeAccountHandler adds an email and password to the signed-in account.
+// The user keeps their ID and results; the email must be verified before it
+// can be used to log in.
+func (s *Server) UpgradeAccountHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := r.Context().Value("userID").(string)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var payload struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	addr, err := netmail.ParseAddress(strings.TrimSpace(payload.Email))
+	if err != nil || addr.Name != "" {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+	if len(payload.Password) < credentials.MinPasswordLength {
+		http.Error(w, "Password is too short", http.StatusBadRequest)
+		return
+	}
+
+	hash, err := credentials.HashPassword(payload.Password)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+	err = s.Store.Credentials.SetPassword(r.Context(), userID, addr.Address, hash)
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "Email already in use", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+
+	creds, err := s.Store.Credentials.Get(r.Context(), userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	if !creds.EmailVerified {
+		if err := s.sendVerification(r.Context(), userID, creds.Email); err != nil {
+			log.Printf("Upgrade: sending verification to user %s failed: %v", userID, err)
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":        true,
+		"id":             userID,
+		"email":          creds.Email,
+		"email_verified": creds.EmailVerified,
+	})
+}
+
+// ResendVerificationHandler emails a new verification link for the account's
+// current email.
+func (s *Server) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := r.Context().Value("userID").(string)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	creds, err := s.Store.Credentials.Get(r.Context(), userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	if creds.Email == "" {
+		http.Error(w, "Account has no email address", http.StatusBadRequest)
+		return
+	}
+	if !creds.EmailVerified {
+		if err := s.sendVerification(r.Context(), userID, creds.Email); err != nil {
+			http.Error(w, "Failed to send verification email", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "email_verified": creds.EmailVerified})
+}
+
+// VerifyEmailHandler consumes a verification token, taken from the "token"
+// query parameter (the emailed link) or a JSON body.
+func (s *Server) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	switch r.Method {
+	case "GET":
+	case "POST":
+		var payload struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		token = payload.Token
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := s.Store.Credentials.VerifyEmail(r.Context(), credentials.HashSecret(token), time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Invalid or expired verification link", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "id": userID, "email_verified": true})
+}
+
+// RotateDeviceSecretHandler issues a new device secret for the signed-in
+// account, replacing the old one. Accounts created before device secrets
+// existed use it to obtain their first one.
+func (s *Server) RotateDeviceSecretHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := r.Context().Value("userID").(string)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	secret, err := s.issueDeviceSecret(r.Context(), userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": userID, "device_secret": secret})
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"backend/internal/progression"
+	"backend/internal/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+)
+
+// payLevelRewards pays the tokens and badges of the levels the user reached
+// going from level from to level to. Each level pays once, so concurrent
+// requests crossing the same level are safe. Errors are logged: the
+// recompute job pays what was missed.
+func (s *Server) payLevelRewards(ctx context.Context, userID string, from, to int) {
+	for _, r := range s.Progression.RewardsBetween(from, to) {
+		if a := r.Achievement(userID); a != nil {
+			err := s.Store.Achievements.Award(ctx, a, s.Progression.Curve)
+			if err != nil && !errors.Is(err, store.ErrDuplicate) {
+				log.Printf("Progression: awarding level %d badge to %s: %v", r.Level, userID, err)
+			}
+		}
+		if r.Tokens == 0 {
+			continue
+		}
+		err := s.Store.Tokens.Record(ctx, r.Transaction(userID))
+		if err != nil && !errors.Is(err, store.ErrDuplicate) {
+			log.Printf("Progression: paying level %d reward to %s: %v", r.Level, userID, err)
+		}
+	}
+}
+
+// ProgressionResponse is where the user stands on the level curve. Rewards
+// are the level rewards reached so far, badges included, and NextReward the
+// one after them, if any.
+type ProgressionResponse struct {
+	Level      int                       `json:"level"`
+	XP         int                       `json:"xp"`
+	TotalXP    int                       `json:"total_xp"`
+	ToNext     int                       `json:"xp_to_next"`
+	Rewards    []progression.LevelReward `json:"level_rewards"`
+	NextReward *progression.LevelReward  `json:"next_reward"`
+	Sources    progression.Sources       `json:"xp_sources"`
+}
+
+// ProgressionHandler returns the user's level, XP and level rewards along
+// with the ways to earn XP, so the app doesn't hard-code the rules.
+func (s *Server) ProgressionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.Store.Users.Get(r.Context(), userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+
+	resp := ProgressionResponse{
+		Level:   user.Level,
+		XP:      user.XP,
+		TotalXP: user.TotalXP,
+		ToNext:  s.Progression.Curve.ToNext(user.Level) - user.XP,
+		Rewards: s.Progression.RewardsBetween(0, user.Level),
+		Sources: s.Progression.XP,
+	}
+	if resp.Rewards == nil {
+		resp.Rewards = []progression.LevelReward{}
+	}
+	if next := s.Progression.RewardsBetween(user.Level, math.MaxInt); len(next) > 0 {
+		resp.NextReward = &next[0]
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"backend/internal/achievements"
+	"backend/internal/admob"
+	"backend/internal/appenv"
+	"backend/internal/authtoken"
+	"backend/internal/database"
+	"backend/internal/iap"
+	"backend/internal/identity"
+	"backend/internal/mail"
+	"backend/internal/progression"
+	"backend/internal/ratelimit"
+	"backend/internal/store"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Server holds the dependencies shared by the HTTP handlers. Handlers are
+// methods on it so tests can swap the Postgres store for the in-memory one.
+type Server struct {
+	Store *store.Store
+	// Env decides which routes are mounted; see routes.RegisterRoutes.
+	Env appenv.Env
+	// Tokens issues and verifies access tokens.
+	Tokens *authtoken.Issuer
+	// SyncContent reconciles the questions table with the bundled content
+	// files. It is nil when the server runs without a database.
+	SyncContent func(opts database.SyncOptions) (*database.SyncReport, error)
+	// Identity verifies Google and Apple ID tokens for social login.
+	Identity *identity.Verifier
+	// Mailer delivers email verification links.
+	Mailer mail.Sender
+	// VerifyEmailURL is the link sent for email verification; the token is
+	// appended as the "token" query parameter.
+	VerifyEmailURL string
+	// DeletionGracePeriod is how long a deleted account can still be
+	// restored by signing in. Zero or less purges it right away.
+	DeletionGracePeriod time.Duration
+	// Limiter rate limits the routes that can be abused; nil disables it.
+	Limiter *ratelimit.Limiter
+	// AdMob verifies rewarded ad callbacks. Without it the callback route
+	// answers 503.
+	AdMob *admob.Verifier
+	// AdRewardDailyCap is how many ad views a user is paid for per day in their timezone.
+	AdRewardDailyCap int
+	// IAP validates App Store and Google Play subscriptions. Without it the
+	// purchase routes answer 503.
+	IAP *iap.Validator
+	// Achievements are the badge rules; see achievements.Load. Without them
+	// nothing is awarded and the achievements route answers 503.
+	Achievements *achievements.Catalog
+	// Progression is how finished tests earn XP, how much XP each level
+	// takes and what reaching a level pays; see progression.Load.
+	Progression *progression.Config
+}
+
+func NewServer(s *store.Store, tokens *authtoken.Issuer) *Server {
+	return &Server{
+		Store:               s,
+		Env:                 appenv.Production,
+		Tokens:              tokens,
+		Mailer:              mail.LogSender{},
+		VerifyEmailURL:      "/auth/verify-email",
+		DeletionGracePeriod: 30 * 24 * time.Hour,
+		Limiter:             ratelimit.New(ratelimit.NewMemory(), ratelimit.DefaultPolicies()),
+		AdRewardDailyCap:    10,
+		Progression:         progression.Flat(100),
+	}
+}
+
+// isCaller reports whether ctx is a request authenticated as userID. Writes
+// that rank users against each other check it themselves, so that no
+// request path can credit a user it didn't authenticate as.
+func isCaller(ctx context.Context, userID string) bool {
+	caller, _ := ctx.Value("userID").(string)
+	return caller != "" && caller == userID
+}
+
+// storeError writes the HTTP status matching a store error: 404 for
+// ErrNotFound, 409 for ErrConflict and 500 with the error text otherwise.
+func storeError(w http.ResponseWriter, err error, notFoundMsg string) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, notFoundMsg, http.StatusNotFound)
+	case errors.Is(err, store.ErrConflict):
+		http.Error(w, "Conflict", http.StatusConflict)
+	default:
+		log.Printf("Store error: %v", err)
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"backend/internal/models"
+	"backend/internal/shop"
+	"backend/internal/store"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// PurchaseRequest names a shop item. Question items also name the question
+// they act on.
+type PurchaseRequest struct {
+	Item       string `json:"item"`
+	QuestionID string `json:"question_id"`
+}
+
+// ShopItemsHandler lists what the shop sells and for how much.
+func (s *Server) ShopItemsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items":              shop.Items(),
+		"max_streak_freezes": shop.MaxStreakFreezes,
+	})
+}
+
+// PurchaseHandler sells a shop item at the catalog price and returns its
+// effect. Buying a question item again for the same question returns the
+// same effect without charging twice.
+func (s *Server) PurchaseHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req PurchaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	item, ok := shop.Lookup(req.Item)
+	if !ok {
+		http.Error(w, "Unknown item", http.StatusBadRequest)
+		return
+	}
+
+	res, ok := s.purchase(w, r, userID, item, req.QuestionID)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// purchase charges the user for item and applies it. On failure it has
+// already written the error response and returns false.
+func (s *Server) purchase(w http.ResponseWriter, r *http.Request, userID string, item shop.Item, questionID string) (map[string]interface{}, bool) {
+	ctx := r.Context()
+	user, err := s.Store.Users.Get(ctx, userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return nil, false
+	}
+
+	// The effect is worked out before anything is charged
+	effect := map[string]interface{}{}
+	t := &models.TokenTransaction{UserID: userID, Amount: -item.Price, Reason: "shop", Reference: item.ID,
+		IdempotencyKey: r.Header.Get("Idempotency-Key")}
+	if item.NeedsQuestion {
+		if questionID == "" {
+			http.Error(w, "question_id is required", http.StatusBadRequest)
+			return nil, false
+		}
+		q, err := s.Store.Questions.Get(ctx, questionID)
+		if err != nil {
+			storeError(w, err, "Question not found")
+			return nil, false
+		}
+		// One purchase per question: a retry or a second device gets the
+		// original entry back
+		t.Reference = item.ID + ":" + q.ID
+		t.IdempotencyKey = "shop:" + item.ID + ":" + q.ID
+
+		switch item.ID {
+		case shop.FiftyFifty:
+			hidden := shop.HiddenOptions(userID, q)
+			if hidden == nil {
+				http.Error(w, "This question has too few wrong options", http.StatusConflict)
+				return nil, false
+			}
+			effect["hide_options"] = hidden
+		case shop.RevealExplanation:
+			if q.Solution.ExplanationText == "" && q.Solution.VideoSolutionURL == nil {
+				http.Error(w, "This question has no explanation", http.StatusConflict)
+				return nil, false
+			}
+			effect["explanation_text"] = q.Solution.ExplanationText
+			effect["video_solution_url"] = q.Solution.VideoSolutionURL
+		}
+	}
+	if item.ID == shop.ExtraTime {
+		effect["extra_seconds"] = shop.ExtraSeconds
+	}
+
+	res := map[string]interface{}{"success": true, "item": item.ID, "effect": effect}
+	if item.PremiumFree && user.IsPremium {
+		res["price_paid"] = 0
+		res["new_balance"] = user.Tokens
+		return res, true
+	}
+
+	if item.ID == shop.StreakFreeze {
+		held, err := s.Store.Users.AddStreakFreeze(ctx, userID, t, shop.MaxStreakFreezes)
+		if errors.Is(err, store.ErrLimitReached) {
+			http.Error(w, "You already hold the maximum number of streak freezes", http.StatusConflict)
+			return nil, false
+		}
+		if !purchaseRecorded(w, err) {
+			return nil, false
+		}
+		effect["streak_freezes"] = held
+	} else if !purchaseRecorded(w, s.Store.Tokens.Record(ctx, t)) {
+		return nil, false
+	}
+
+	res["price_paid"] = -t.Amount
+	res["new_balance"] = t.BalanceAfter
+	res["transaction_id"] = t.ID
+	return res, true
+}
+
+// purchaseRecorded reports whether the charge went through, treating a
+// repeated purchase as done, and writes the error response otherwise.
+func purchaseRecorded(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil, errors.Is(err, store.ErrDuplicate):
+		return true
+	case errors.Is(err, store.ErrInsufficientTokens):
+		http.Error(w, "Insufficient tokens", http.StatusPaymentRequired)
+	default:
+		storeError(w, err, "User not found")
+	}
+	return false
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"backend/internal/iap"
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// refreshSubscription looks a purchase up with the store and saves it for
+// userID, then brings the user's premium status in line.
+func (s *Server) refreshSubscription(ctx context.Context, platform, externalID, userID string) (*models.Subscription, bool, error) {
+	sub, err := s.IAP.Check(ctx, platform, externalID)
+	if err != nil {
+		return nil, false, err
+	}
+	sub.UserID = userID
+	if err := s.Store.Subs.Upsert(ctx, sub); err != nil {
+		return nil, false, err
+	}
+	premium, err := s.Store.Subs.SyncEntitlement(ctx, userID, time.Now())
+	return sub, premium, err
+}
+
+// iapError writes the status for a failed store lookup.
+func iapError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, iap.ErrInvalidPurchase), errors.Is(err, iap.ErrUnknownPlatform):
+		http.Error(w, "Invalid purchase", http.StatusBadRequest)
+	case errors.Is(err, iap.ErrNotConfigured):
+		http.Error(w, "Purchases are not configured for this platform", http.StatusServiceUnavailable)
+	case errors.Is(err, store.ErrConflict):
+		http.Error(w, "This purchase belongs to another account", http.StatusConflict)
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	default:
+		log.Printf("Subscription check failed: %v", err)
+		http.Error(w, "Could not reach the store", http.StatusBadGateway)
+	}
+}
+
+// VerifySubscriptionHandler serves POST /api/v1/user/subscriptions/verify.
+// The app sends what the store gave it after a purchase or restore:
+// {"platform": "apple", "transaction_id": "..."} or
+// {"platform": "google", "purchase_token": "..."}.
+func (s *Server) VerifySubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if s.IAP == nil {
+		iapError(w, iap.ErrNotConfigured)
+		return
+	}
+
+	var req struct {
+		Platform      string `json:"platform"`
+		TransactionID string `json:"transaction_id"`
+		PurchaseToken string `json:"purchase_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	externalID := req.TransactionID
+	if req.Platform == iap.PlatformGoogle {
+		externalID = req.PurchaseToken
+	}
+	if externalID == "" {
+		http.Error(w, "transaction_id (Apple) or purchase_token (Google) is required", http.StatusBadRequest)
+		return
+	}
+
+	sub, premium, err := s.refreshSubscription(r.Context(), req.Platform, externalID, userID)
+	if err != nil {
+		iapError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"subscription": sub,
+		"is_premium":   premium,
+	})
+}
+
+// SubscriptionsHandler serves GET /api/v1/user/subscriptions.
+func (s *Server) SubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.Store.Users.Get(r.Context(), userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	subs, err := s.Store.Subs.ListForUser(r.Context(), userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"is_premium":    user.IsPremium,
+		"subscriptions": subs,
+	})
+}
+
+// notifiedSubscription refreshes a subscription a store notification was
+// about. Purchases nobody verified yet are ignored; the app's verify call
+// will pick them up.
+func (s *Server) notifiedSubscription(w http.ResponseWriter, r *http.Request, platform, externalID string) {
+	if externalID != "" {
+		known, err := s.Store.Subs.GetByExternalID(r.Context(), platform, externalID)
+		if err == nil {
+			_, _, err = s.refreshSubscription(r.Context(), platform, externalID, known.UserID)
+		}
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			// Anything but 2xx makes the store retry later
+			log.Printf("%s notification for a subscription failed: %v", platform, err)
+			http.Error(w, "Could not process notification", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// AppleNotificationHandler receives App Store Server Notifications v2.
+func (s *Server) AppleNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.IAP == nil || s.IAP.Apple == nil {
+		iapError(w, iap.ErrNotConfigured)
+		return
+	}
+
+	var body struct {
+		SignedPayload string `json:"signedPayload"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	n, err := iap.ParseAppleNotification(body.SignedPayload)
+	if err != nil {
+		http.Error(w, "Invalid notification", http.StatusBadRequest)
+		return
+	}
+	s.notifiedSubscription(w, r, iap.PlatformApple, n.TransactionID)
+}
+
+// GoogleNotificationHandler receives Google Play real-time developer
+// notifications pushed by Pub/Sub. The push subscription's URL carries
+// ?token=GOOGLE_RTDN_TOKEN; until that is set, pushes are refused.
+func (s *Server) GoogleNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.IAP == nil || s.IAP.Google == nil {
+		iapError(w, iap.ErrNotConfigured)
+		return
+	}
+	if s.IAP.GooglePushToken == "" {
+		log.Printf("Refused Google notification: GOOGLE_RTDN_TOKEN is not set")
+		http.Error(w, "Google notifications are not configured", http.StatusServiceUnavailable)
+		return
+	}
+	token := r.URL.Query().Get("token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.IAP.GooglePushToken)) != 1 {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	n, err := iap.ParseGoogleNotification(body)
+	if err != nil {
+		http.Error(w, "Invalid notification", http.StatusBadRequest)
+		return
+	}
+	if n.PackageName != s.IAP.Google.PackageName {
+		w.WriteHeader(http.StatusOK) // not ours; acknowledging stops redelivery
+		return
+	}
+	s.notifiedSubscription(w, r, iap.PlatformGoogle, n.PurchaseToken)
+}
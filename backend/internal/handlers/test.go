@@ -1,150 +1,74 @@
 package handlers
 
 import (
-	"backend/internal/database"
+	"backend/internal/achievements"
+	"backend/internal/days"
 	"backend/internal/middleware"
 	"backend/internal/models"
-	"database/sql"
+	"backend/internal/progression"
+	"backend/internal/store"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
 	"time"
-
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/google/uuid"
 )
 
-func GetTestsHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetTestsHandler(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCors(&w)
 	userID := r.URL.Query().Get("userId")
-	category := r.URL.Query().Get("category")
-
-	var rows *sql.Rows
-	var err error
-
-	query := `SELECT t.id, t.title, t.description, COALESCE(t.category, ''), 
-			  EXISTS(SELECT 1 FROM test_results r WHERE r.test_id = t.id AND r.user_id = $1) as completed
-			  FROM tests t`
-
-	if category != "" {
-		rows, err = database.DB.Query(query+" WHERE t.category = $2 ORDER BY t.title", userID, category)
-	} else {
-		rows, err = database.DB.Query(query+" ORDER BY t.title", userID)
-	}
 
+	// category may be either the display name or the slug
+	tests, err := s.Store.Tests.List(r.Context(), store.TestFilter{
+		UserID:   userID,
+		Category: r.URL.Query().Get("category"),
+		Exam:     s.examScope(r, userID),
+	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	tests := []models.Test{}
-	for rows.Next() {
-		var t models.Test
-		rows.Scan(&t.ID, &t.Title, &t.Description, &t.Category, &t.Completed)
-		tests = append(tests, t)
-	}
 	json.NewEncoder(w).Encode(tests)
 }
 
-func GetCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetCategoriesHandler(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCors(&w)
 	userID := r.URL.Query().Get("userId")
+	exam := s.examScope(r, userID)
 
 	if userID == "" {
 		// Eski davranış - sadece kategori listesi
-		rows, err := database.DB.Query("SELECT DISTINCT category FROM tests WHERE category IS NOT NULL AND category != '' ORDER BY category")
+		categories, err := s.Store.Tests.CategoryNames(r.Context(), exam)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
-
-		categories := []string{}
-		for rows.Next() {
-			var c string
-			rows.Scan(&c)
-			categories = append(categories, c)
-		}
 		json.NewEncoder(w).Encode(categories)
 		return
 	}
 
 	// Yeni davranış - kategori progress bilgisi ile
-	type CategoryProgress struct {
-		Category       string `json:"category"`
-		TotalTests     int    `json:"total_tests"`
-		CompletedTests int    `json:"completed_tests"`
-	}
-
-	rows, err := database.DB.Query(`
-		SELECT 
-			t.category,
-			COUNT(DISTINCT t.id) as total_tests,
-			COUNT(DISTINCT tr.test_id) as completed_tests
-		FROM tests t
-		LEFT JOIN test_results tr ON t.id = tr.test_id AND tr.user_id = $1
-		WHERE t.category IS NOT NULL AND t.category != ''
-		GROUP BY t.category
-		ORDER BY t.category
-	`, userID)
-
+	categories, err := s.Store.Tests.CategoryProgress(r.Context(), userID, exam)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	categories := []CategoryProgress{}
-	for rows.Next() {
-		var cp CategoryProgress
-		err := rows.Scan(&cp.Category, &cp.TotalTests, &cp.CompletedTests)
-		if err != nil {
-			continue
-		}
-		categories = append(categories, cp)
-	}
-
 	json.NewEncoder(w).Encode(categories)
 }
 
-func GetQuestionsHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetQuestionsHandler(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCors(&w)
-	rows, err := database.DB.Query(`
-        SELECT id, test_id, question_id, category, subject, topic, sub_topic, difficulty, skill_level, text, options, solution, metadata, image_url, related_concept_id 
-        FROM questions LIMIT 100`)
+	questions, err := s.Store.Questions.List(r.Context(), 100)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	questions := []models.Question{}
-	for rows.Next() {
-		var q models.Question
-		var optsStr, solStr, metaStr []byte
-
-		err := rows.Scan(
-			&q.ID, &q.TestID, &q.QuestionID, &q.Category, &q.Subject, &q.Topic, &q.SubTopic,
-			&q.Difficulty, &q.SkillLevel, &q.Text, &optsStr, &solStr, &metaStr, &q.ImageURL, &q.RelatedConceptID,
-		)
-		if err != nil {
-			log.Printf("Error scanning question: %v", err)
-			continue
-		}
-
-		json.Unmarshal(optsStr, &q.Options)
-		json.Unmarshal(solStr, &q.Solution)
-		json.Unmarshal(metaStr, &q.Metadata)
-
-		questions = append(questions, q)
-	}
-	json.NewEncoder(w).Encode(questions)
+	json.NewEncoder(w).Encode(publicQuestions(questions))
 }
 
-func GetTestQuestionsHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetTestQuestionsHandler(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCors(&w)
 	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
 	if len(parts) < 2 {
@@ -155,86 +79,205 @@ func GetTestQuestionsHandler(w http.ResponseWriter, r *http.Request) {
 	testID := parts[1]
 	log.Printf("Fetching questions for testID: %s", testID)
 
-	rows, err := database.DB.Query(`
-		SELECT id, test_id, question_id, category, subject, topic, sub_topic, difficulty, skill_level, text, options, solution, metadata, image_url, related_concept_id 
-		FROM questions WHERE test_id=$1`, testID)
+	questions, err := s.Store.Questions.ListByTest(r.Context(), testID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	questions := []models.Question{}
-	for rows.Next() {
-		var q models.Question
-		var optsStr, solStr, metaStr []byte
+	json.NewEncoder(w).Encode(publicQuestions(questions))
+}
 
-		err := rows.Scan(
-			&q.ID, &q.TestID, &q.QuestionID, &q.Category, &q.Subject, &q.Topic, &q.SubTopic,
-			&q.Difficulty, &q.SkillLevel, &q.Text, &optsStr, &solStr, &metaStr, &q.ImageURL, &q.RelatedConceptID,
-		)
-		if err != nil {
-			log.Printf("Error scanning question: %v", err)
-			continue
-		}
+// publicQuestion is a question as players get it before answering: which
+// option is correct and the solution stay on the server until the attempt
+// is submitted (SubmitTestHandler) or the explanation is bought.
+type publicQuestion struct {
+	models.Question
+	Options []publicOption `json:"options"`
+	// Solution shadows the embedded one and is never set
+	Solution *models.Solution `json:"solution,omitempty"`
+}
 
-		json.Unmarshal(optsStr, &q.Options)
-		json.Unmarshal(solStr, &q.Solution)
-		json.Unmarshal(metaStr, &q.Metadata)
+type publicOption struct {
+	Text string `json:"option_text"`
+}
 
-		questions = append(questions, q)
+func publicQuestions(list []models.Question) []publicQuestion {
+	public := make([]publicQuestion, len(list))
+	for i, q := range list {
+		public[i] = publicQuestion{Question: q, Options: make([]publicOption, len(q.Options))}
+		for j, o := range q.Options {
+			public[i].Options[j] = publicOption{Text: o.Text}
+		}
 	}
-	json.NewEncoder(w).Encode(questions)
+	return public
 }
 
-func SubmitTestHandler(w http.ResponseWriter, r *http.Request) {
+// StartAttemptHandler opens an attempt at a test for the caller. Answers
+// are given against it (AnswerQuestionHandler) and graded when it is
+// submitted with the test.
+func (s *Server) StartAttemptHandler(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCors(&w)
-	if r.Method != "POST" {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Parse request body
-	var requestBody struct {
+	userID, _ := r.Context().Value("userID").(string)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
 		TestID string `json:"test_id"`
-		Score  int    `json:"score"`
-		UserID string `json:"user_id,omitempty"` // Optional, for backward compatibility
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	ctx := r.Context()
+	if _, err := s.Store.Tests.Get(ctx, req.TestID); err != nil {
+		storeError(w, err, "Test not found")
+		return
+	}
+	a := &models.TestAttempt{UserID: userID, TestID: req.TestID}
+	if err := s.Store.Attempts.Start(ctx, a); err != nil {
+		storeError(w, err, "Test not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"attempt_id": a.ID,
+		"test_id":    a.TestID,
+		"started_at": a.StartedAt,
+	})
+}
+
+// AnswerQuestionHandler records the caller's answer to a question of their
+// open attempt, given as the text of the chosen option since the app
+// shuffles them. Whether it was correct is only told when the attempt is
+// submitted, so answers can't be probed one option at a time.
+func (s *Server) AnswerQuestionHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Try to get UserID from context (if authenticated) or from request body
 	userID, _ := r.Context().Value("userID").(string)
 	if userID == "" {
-		userID = requestBody.UserID
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		AttemptID  string `json:"attempt_id"`
+		QuestionID string `json:"question_id"`
+		OptionText string `json:"option_text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.AttemptID == "" || req.QuestionID == "" {
+		http.Error(w, "attempt_id and question_id are required", http.StatusBadRequest)
+		return
 	}
 
-	// If still no userID, try to get from Authorization header manually
-	if userID == "" {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader != "" {
-			bearerToken := strings.Split(authHeader, " ")
-			if len(bearerToken) == 2 {
-				tokenString := bearerToken[1]
-				claims := &middleware.Claims{}
-
-				// Get JWT key (same as middleware)
-				jwtKey := []byte(os.Getenv("JWT_SECRET"))
-				if len(jwtKey) == 0 {
-					jwtKey = []byte("default_oabt_secret_key_for_dev")
-				}
-
-				token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-					return jwtKey, nil
-				})
-				if err == nil && token.Valid {
-					userID = claims.UserID
-				}
+	ctx := r.Context()
+	attempt, err := s.Store.Attempts.Get(ctx, req.AttemptID)
+	if err == nil && attempt.UserID != userID {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		storeError(w, err, "Attempt not found")
+		return
+	}
+	q, err := s.Store.Questions.Get(ctx, req.QuestionID)
+	if err == nil && q.TestID != attempt.TestID {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		storeError(w, err, "Question not found")
+		return
+	}
+	answer := models.AttemptAnswer{QuestionID: q.ID, OptionText: req.OptionText}
+	chosen := false
+	for _, o := range q.Options {
+		if o.Text == req.OptionText {
+			chosen, answer.Correct = true, o.IsCorrect
+			break
+		}
+	}
+	if !chosen {
+		http.Error(w, "option_text is not an option of this question", http.StatusBadRequest)
+		return
+	}
+
+	switch err := s.Store.Attempts.Answer(ctx, attempt.ID, answer); {
+	case errors.Is(err, store.ErrDuplicate):
+		http.Error(w, "Question already answered", http.StatusConflict)
+		return
+	case errors.Is(err, store.ErrConflict):
+		http.Error(w, "Attempt already submitted", http.StatusConflict)
+		return
+	case err != nil:
+		storeError(w, err, "Attempt not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"recorded": true, "answered": len(attempt.Answers) + 1})
+}
+
+// AnswerReview is one question of a submitted attempt with its grade.
+type AnswerReview struct {
+	QuestionID    string `json:"question_id"`
+	OptionText    string `json:"option_text,omitempty"` // empty if unanswered
+	Correct       bool   `json:"correct"`
+	CorrectOption string `json:"correct_option"`
+}
+
+// reviewAttempt grades a against the test's questions.
+func reviewAttempt(a *models.TestAttempt, questions []models.Question) []AnswerReview {
+	chosen := map[string]models.AttemptAnswer{}
+	for _, answer := range a.Answers {
+		chosen[answer.QuestionID] = answer
+	}
+	review := make([]AnswerReview, len(questions))
+	for i, q := range questions {
+		review[i] = AnswerReview{QuestionID: q.ID, OptionText: chosen[q.ID].OptionText, Correct: chosen[q.ID].Correct}
+		for _, o := range q.Options {
+			if o.IsCorrect {
+				review[i].CorrectOption = o.Text
+				break
 			}
 		}
 	}
+	return review
+}
+
+func (s *Server) SubmitTestHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	if r.Method != "POST" {
+		return
+	}
+
+	// Parse request body
+	// With attempt_id the score is what the attempt's answers earn and
+	// score is ignored
+	var requestBody struct {
+		TestID    string `json:"test_id"`
+		AttemptID string `json:"attempt_id"`
+		Score     int    `json:"score"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Only a verified token (set by OptionalAuth) names the user: results
+	// pay XP and tokens, so a user_id in the body is not trusted
+	userID, _ := r.Context().Value("userID").(string)
 
 	log.Printf("SubmitTest: UserID resolved to: %s", userID)
 
@@ -253,6 +296,68 @@ func SubmitTestHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx := r.Context()
+	user, err := s.Store.Users.Get(ctx, userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+
+	var attempt *models.TestAttempt
+	if requestBody.AttemptID != "" {
+		attempt, err = s.Store.Attempts.Get(ctx, requestBody.AttemptID)
+		if err == nil && (attempt.UserID != userID || requestBody.TestID != "" && requestBody.TestID != attempt.TestID) {
+			err = store.ErrNotFound
+		}
+		if err != nil {
+			storeError(w, err, "Attempt not found")
+			return
+		}
+		requestBody.TestID = attempt.TestID
+	}
+
+	if _, err := s.Store.Tests.Get(ctx, requestBody.TestID); err != nil {
+		storeError(w, err, "Test not found")
+		return
+	}
+	// The score pays XP, tokens and leaderboard points, so it can be no
+	// more than the test's questions are worth
+	questions, err := s.Store.Questions.ListByTest(ctx, requestBody.TestID)
+	if err != nil {
+		storeError(w, err, "Test not found")
+		return
+	}
+	if len(questions) == 0 {
+		http.Error(w, "Test not found", http.StatusNotFound)
+		return
+	}
+	result := s.Progression.ForTest(questions, store.PointsPerQuestion)
+	if attempt == nil && (requestBody.Score < 0 || requestBody.Score > result.MaxScore) {
+		http.Error(w, "score must be between 0 and "+strconv.Itoa(result.MaxScore), http.StatusBadRequest)
+		return
+	}
+
+	var review []AnswerReview
+	if attempt != nil {
+		// Closing the attempt before paying for it pays it once
+		attempt, err = s.Store.Attempts.Submit(ctx, attempt.ID)
+		if errors.Is(err, store.ErrConflict) {
+			http.Error(w, "Attempt already submitted", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			storeError(w, err, "Attempt not found")
+			return
+		}
+		requestBody.Score = 0
+		for _, a := range attempt.Answers {
+			if a.Correct {
+				requestBody.Score += store.PointsPerQuestion
+			}
+		}
+		review = reviewAttempt(attempt, questions)
+	}
+
 	// Create TestResult
 	res := models.TestResult{
 		UserID: userID,
@@ -262,85 +367,103 @@ func SubmitTestHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("SubmitTest: User %s submitting test %s with score %d", res.UserID, res.TestID, res.Score)
 
-	var existingScore int
-	err := database.DB.QueryRow("SELECT score FROM test_results WHERE user_id=$1 AND test_id=$2", res.UserID, res.TestID).Scan(&existingScore)
-	alreadyTaken := err == nil
-	scoreDiff := 0
-	resultID, _ := uuid.NewV7()
+	best, err := s.Store.Results.BestScore(ctx, res.UserID, res.TestID)
+	firstTime := errors.Is(err, store.ErrNotFound)
+	if err != nil && !firstTime {
+		log.Printf("SubmitTest: Error checking previous results: %v", err)
+		http.Error(w, "Failed to save result", http.StatusInternalServerError)
+		return
+	}
+	if err := s.Store.Results.Create(ctx, &res); err != nil {
+		log.Printf("SubmitTest: Error inserting result: %v", err)
+		http.Error(w, "Failed to save result", http.StatusInternalServerError)
+		return
+	}
 
-	if alreadyTaken {
-		log.Printf("SubmitTest: User %s retaking test %s", res.UserID, res.TestID)
-		_, err = database.DB.Exec("INSERT INTO test_results (id, user_id, test_id, score, completed_at) VALUES ($1, $2, $3, $4, NOW())",
-			resultID.String(), res.UserID, res.TestID, res.Score)
-		if err != nil {
-			log.Printf("SubmitTest: Error inserting retake result: %v", err)
-		}
-		scoreDiff = 0
-	} else {
+	// Only a first or better result pays, so retakes can't farm XP; the
+	// total score grows by the improvement and stays the sum of best scores
+	scoreDiff := 0
+	improved := firstTime || res.Score > best
+	if firstTime {
 		log.Printf("SubmitTest: User %s taking test %s for first time", res.UserID, res.TestID)
-		_, err = database.DB.Exec("INSERT INTO test_results (id, user_id, test_id, score, completed_at) VALUES ($1, $2, $3, $4, NOW())",
-			resultID.String(), res.UserID, res.TestID, res.Score)
-		if err != nil {
-			log.Printf("SubmitTest: Error inserting new result: %v", err)
-		}
 		scoreDiff = res.Score
+	} else {
+		log.Printf("SubmitTest: User %s retaking test %s", res.UserID, res.TestID)
+		scoreDiff = max(res.Score-best, 0)
 	}
 
-	var streak int
-	var lastActiveStr string
-	database.DB.QueryRow("SELECT streak, COALESCE(TO_CHAR(last_active_date, 'YYYY-MM-DD'), '') FROM users WHERE id=$1", res.UserID).Scan(&streak, &lastActiveStr)
-	today := time.Now().Format("2006-01-02")
-	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
-	newStreak := streak
-
-	if lastActiveStr != today || streak == 0 {
-		if lastActiveStr == yesterday && streak > 0 {
-			newStreak++
-		} else {
-			newStreak = 1
-		}
-		_, _ = database.DB.Exec("UPDATE users SET streak=$1, last_active_date=$2 WHERE id=$3", newStreak, today, res.UserID)
+	// Days are counted in the user's timezone
+	streak := user.Streak
+	today := days.Today(time.Now(), userLocation(user))
+	newStreak, update := s.advanceStreak(ctx, user, today)
+	testsToday := 1
+	if days, err := s.Store.Activity.List(ctx, res.UserID, today, today); err == nil && len(days) > 0 {
+		testsToday += days[0].Tests
 	}
 
-	// Level & XP Logic
-	var currentXP int
-	var currentLevel int
-	database.DB.QueryRow("SELECT xp, level FROM users WHERE id=$1", res.UserID).Scan(&currentXP, &currentLevel)
-
-	// Users always gain XP for solving tests!
-	newXP := currentXP + res.Score
-	newLevel := currentLevel
-	for newXP >= 100 {
-		newXP -= 100
-		newLevel++
+	currentLevel := user.Level
+	result.Score, result.TestsToday = res.Score, testsToday
+	var gained progression.Breakdown
+	if improved {
+		gained = s.Progression.TestXP(result)
 	}
+	s.recordActivity(ctx, &models.DailyActivity{UserID: res.UserID, Day: today, Tests: 1, Score: res.Score, XP: gained.Total})
 
-	// Update everything in ONE query
-	_, err = database.DB.Exec("UPDATE users SET xp=$1, level=$2, total_score = total_score + $3 WHERE id=$4",
-		newXP, newLevel, scoreDiff, res.UserID)
-	if err != nil {
+	newXP, newLevel := user.XP, user.Level
+	if u, err := s.Store.Users.AddProgress(ctx, res.UserID, gained.Total, scoreDiff, s.Progression.Curve); err != nil {
 		log.Printf("Error updating user stats: %v", err)
+	} else {
+		newXP, newLevel = u.XP, u.Level
+		s.payLevelRewards(ctx, res.UserID, currentLevel, newLevel)
 	}
+	s.addLeagueXP(ctx, res.UserID, newLevel, gained.Total)
+	s.addLeaderboardScore(ctx, res.UserID, res.TestID, scoreDiff)
 
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":        true,
-		"streak_updated": newStreak > streak,
-		"current_streak": newStreak,
-		"score_added":    scoreDiff,
-		"new_level":      newLevel,
-		"new_xp":         newXP,
-		"leveled_up":     newLevel > currentLevel,
-	})
+	// Achievement XP counts towards the level shown with this result
+	earned := s.checkAchievements(ctx, res.UserID, achievements.TestCompleted)
+	if earned == nil {
+		earned = []achievements.Definition{}
+	} else {
+		if u, err := s.Store.Users.Get(ctx, res.UserID); err == nil {
+			newXP, newLevel = u.XP, u.Level
+		}
+	}
+	levelRewards := s.Progression.RewardsBetween(currentLevel, newLevel)
+	if levelRewards == nil {
+		levelRewards = []progression.LevelReward{}
+	}
+
+	resp := map[string]interface{}{
+		"success":              true,
+		"score":                res.Score,
+		"streak_updated":       newStreak > streak,
+		"current_streak":       newStreak,
+		"score_added":          scoreDiff,
+		"new_level":            newLevel,
+		"new_xp":               newXP,
+		"leveled_up":           newLevel > currentLevel,
+		"achievements_earned":  earned,
+		"streak_freezes_used":  len(update.Frozen),
+		"streak_freeze_earned": update.EarnFreeze,
+		"xp_gained":            gained.Total,
+		"xp_breakdown":         gained,
+		"xp_to_next":           s.Progression.Curve.ToNext(newLevel) - newXP,
+		"level_rewards":        levelRewards,
+	}
+	if review != nil {
+		resp["answers"] = review
+	}
+	json.NewEncoder(w).Encode(resp)
 }
 
-func DBStatsHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) DBStatsHandler(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCors(&w)
 	userID := r.URL.Query().Get("userId")
+	ctx := r.Context()
 
-	var testCount, questionCount, testResultsCount int
-	database.DB.QueryRow("SELECT COUNT(*) FROM tests").Scan(&testCount)
-	database.DB.QueryRow("SELECT COUNT(*) FROM questions").Scan(&questionCount)
-	database.DB.QueryRow("SELECT COUNT(*) FROM test_results").Scan(&testResultsCount)
+	testCount, _ := s.Store.Tests.Count(ctx)
+	questionCount, _ := s.Store.Questions.Count(ctx)
+	testResultsCount, _ := s.Store.Results.Count(ctx)
 
 	result := map[string]interface{}{
 		"tests_count":        testCount,
@@ -349,31 +472,17 @@ func DBStatsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if userID != "" {
-		var userTestResults int
-		database.DB.QueryRow("SELECT COUNT(*) FROM test_results WHERE user_id = $1", userID).Scan(&userTestResults)
+		userTestResults, _ := s.Store.Results.CountForUser(ctx, userID)
 		result["user_test_results"] = userTestResults
 
 		// Debug: Show some sample data
-		rows, err := database.DB.Query(`
-			SELECT t.category, COUNT(DISTINCT t.id) as total, COUNT(DISTINCT tr.test_id) as completed
-			FROM tests t 
-			LEFT JOIN test_results tr ON t.id = tr.test_id AND tr.user_id = $1
-			WHERE t.category IS NOT NULL AND t.category != ''
-			GROUP BY t.category
-			ORDER BY t.category
-		`, userID)
-
-		if err == nil {
-			defer rows.Close()
+		if progress, err := s.Store.Tests.CategoryProgress(ctx, userID, ""); err == nil {
 			categories := []map[string]interface{}{}
-			for rows.Next() {
-				var category string
-				var total, completed int
-				rows.Scan(&category, &total, &completed)
+			for _, c := range progress {
 				categories = append(categories, map[string]interface{}{
-					"category":  category,
-					"total":     total,
-					"completed": completed,
+					"category":  c.Category,
+					"total":     c.TotalTests,
+					"completed": c.CompletedTests,
 				})
 			}
 			result["debug_categories"] = categories
@@ -383,7 +492,7 @@ func DBStatsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(result)
 }
 
-func GetRandomUnsolvedTestHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetRandomUnsolvedTestHandler(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCors(&w)
 	w.Header().Set("Content-Type", "application/json")
 	userID := r.URL.Query().Get("userId")
@@ -392,24 +501,11 @@ func GetRandomUnsolvedTestHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var t models.Test
-	err := database.DB.QueryRow(`
-		SELECT id, title, description 
-		FROM tests 
-		WHERE id NOT IN (SELECT test_id FROM test_results WHERE user_id = $1)
-		ORDER BY RANDOM() 
-		LIMIT 1`, userID).Scan(&t.ID, &t.Title, &t.Description)
-
+	t, err := s.Store.Tests.RandomUnsolved(r.Context(), userID, s.examScope(r, userID))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			// If all tests solved, just return any random test
-			err = database.DB.QueryRow("SELECT id, title, description FROM tests ORDER BY RANDOM() LIMIT 1").Scan(&t.ID, &t.Title, &t.Description)
-		}
-		if err != nil {
-			http.Error(w, "No tests available", http.StatusNotFound)
-			return
-		}
+		http.Error(w, "No tests available", http.StatusNotFound)
+		return
 	}
 
-	json.NewEncoder(w).Encode(t)
+	json.NewEncoder(w).Encode(models.Test{ID: t.ID, Title: t.Title, Description: t.Description})
 }
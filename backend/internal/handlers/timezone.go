@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/models"
+	"backend/internal/store"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// userLocation returns the user's timezone, falling back to the default for
+// names the tz database doesn't know (e.g. after a tzdata change).
+func userLocation(u *models.User) *time.Location {
+	if loc, err := time.LoadLocation(u.Timezone); err == nil && u.Timezone != "" {
+		return loc
+	}
+	loc, err := time.LoadLocation(store.DefaultTimezone)
+	if err != nil {
+		log.Printf("Loading %s failed, using UTC: %v", store.DefaultTimezone, err)
+		return time.UTC
+	}
+	return loc
+}
+
+// SetTimezoneHandler stores the IANA timezone the app reports for the
+// device, e.g. {"timezone": "Europe/Istanbul"}. Daily rewards and streaks
+// count days in it.
+func (s *Server) SetTimezoneHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := r.Context().Value("userID").(string)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var payload struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// LoadLocation also accepts "" and "Local", which mean the server's zone
+	if _, err := time.LoadLocation(payload.Timezone); err != nil || payload.Timezone == "" || payload.Timezone == "Local" {
+		http.Error(w, "Unknown timezone", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Store.Users.SetTimezone(r.Context(), userID, payload.Timezone); err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "timezone": payload.Timezone})
+}
@@ -1,17 +1,20 @@
 package handlers
 
 import (
-	"backend/internal/database"
 	"backend/internal/middleware"
 	"backend/internal/models"
+	"backend/internal/store"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
-
-	"github.com/google/uuid"
+	"time"
 )
 
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+// RegisterHandler creates a local (guest) account. The response carries a
+// device secret that is shown only once; the client keeps it to sign in
+// again through /auth/device-login.
+func (s *Server) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCors(&w)
 	if r.Method == "OPTIONS" {
 		return
@@ -28,94 +31,81 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	var existingID string
-	err := database.DB.QueryRow("SELECT id FROM users WHERE nickname=$1", payload.Nickname).Scan(&existingID)
-	if err == nil {
-		token, _ := middleware.GenerateToken(existingID)
-		refreshToken, _ := middleware.GenerateRefreshToken(existingID)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"id":            existingID,
-			"access_token":  token,
-			"refresh_token": refreshToken,
-			"token_type":    "Bearer",
-			"expires_in":    72 * 3600,
-			"message":       "Login successful",
-		})
+	payload.Nickname = strings.TrimSpace(payload.Nickname)
+	if payload.Nickname == "" {
+		http.Error(w, "nickname is required", http.StatusBadRequest)
 		return
 	}
 
-	newID, _ := uuid.NewV7()
-	_, err = database.DB.Exec("INSERT INTO users (id, nickname, emoji, streak, last_active_date, level, xp, provider) VALUES ($1, $2, $3, 1, CURRENT_DATE, 1, 0, 'local')",
-		newID.String(), payload.Nickname, payload.Emoji)
+	// A nickname is public, so it never signs anyone in
+	if _, err := s.Store.Users.GetByNickname(r.Context(), payload.Nickname); err == nil {
+		http.Error(w, "Nickname already taken", http.StatusConflict)
+		return
+	}
 
+	user := models.User{Nickname: payload.Nickname, Emoji: payload.Emoji, Provider: "local"}
+	err := s.Store.Users.Create(r.Context(), &user)
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "Nickname already taken", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error creating user: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	token, _ := middleware.GenerateToken(newID.String())
-	refreshToken, _ := middleware.GenerateRefreshToken(newID.String())
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"id":            newID.String(),
-		"access_token":  token,
-		"refresh_token": refreshToken,
-		"token_type":    "Bearer",
-		"expires_in":    72 * 3600,
-		"message":       "Registered successfully",
-	})
+	secret, err := s.issueDeviceSecret(r.Context(), user.ID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	resp, err := s.startSession(r, user.ID, "Registered successfully")
+	if err != nil {
+		http.Error(w, "Failed to start session", http.StatusInternalServerError)
+		return
+	}
+	resp["device_secret"] = secret
+	json.NewEncoder(w).Encode(resp)
 }
 
-func GetUserHandler(w http.ResponseWriter, r *http.Request) {
+// GetUserHandler serves GET /user/{id}. Callers get their whole account;
+// anyone else's comes back as its public profile.
+func (s *Server) GetUserHandler(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCors(&w)
+	callerID, _ := r.Context().Value("userID").(string)
 	idStr := strings.TrimPrefix(r.URL.Path, "/user/")
-	var u models.User
-	err := database.DB.QueryRow(`
-		SELECT id, nickname, emoji, streak, COALESCE(last_active_date::text, ''), total_score, level, xp, 
-		COALESCE(email, ''), COALESCE(google_id, ''), COALESCE(apple_id, ''), provider 
-		FROM users WHERE id=$1`, idStr).
-		Scan(&u.ID, &u.Nickname, &u.Emoji, &u.Streak, &u.LastActiveDate, &u.TotalScore, &u.Level, &u.XP,
-			&u.Email, &u.GoogleID, &u.AppleID, &u.Provider)
-
+	u, err := s.Store.Users.Get(r.Context(), idStr)
 	if err != nil {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
+	if u.ID != callerID {
+		json.NewEncoder(w).Encode(u.Public())
+		return
+	}
 	json.NewEncoder(w).Encode(u)
 }
 
-func GetHistoryHandler(w http.ResponseWriter, r *http.Request) {
+// GetHistoryHandler serves GET /user/history/{id}, which only the user
+// themselves may read.
+func (s *Server) GetHistoryHandler(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCors(&w)
+	callerID, _ := r.Context().Value("userID").(string)
 	parts := strings.Split(r.URL.Path, "/")
 	userID := parts[len(parts)-1]
-	rows, err := database.DB.Query(`
-		SELECT r.score, TO_CHAR(r.completed_at, 'YYYY-MM-DD HH24:MI'), t.title 
-		FROM test_results r 
-		JOIN tests t ON r.test_id = t.id 
-		WHERE r.user_id = $1 
-		ORDER BY r.completed_at DESC
-	`, userID)
+	if userID != callerID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	history, err := s.Store.Results.History(r.Context(), userID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	type HistoryEntry struct {
-		Title string `json:"title"`
-		Score int    `json:"score"`
-		Date  string `json:"date"`
-	}
-	var history []HistoryEntry = []HistoryEntry{}
-	for rows.Next() {
-		var h HistoryEntry
-		rows.Scan(&h.Score, &h.Date, &h.Title)
-		history = append(history, h)
-	}
 	json.NewEncoder(w).Encode(history)
 }
 
-func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCors(&w)
 	if r.Method == "OPTIONS" {
 		return
@@ -140,14 +130,16 @@ func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if nickname is taken by someone else
-	var conflictID string
-	err := database.DB.QueryRow("SELECT id FROM users WHERE nickname=$1 AND id != $2", payload.Nickname, userID).Scan(&conflictID)
-	if err == nil {
+	if other, err := s.Store.Users.GetByNickname(r.Context(), payload.Nickname); err == nil && other.ID != userID {
 		http.Error(w, "Nickname already taken", http.StatusConflict)
 		return
 	}
 
-	_, err = database.DB.Exec("UPDATE users SET nickname=$1, emoji=$2 WHERE id=$3", payload.Nickname, payload.Emoji, userID)
+	err := s.Store.Users.UpdateProfile(r.Context(), userID, payload.Nickname, payload.Emoji)
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "Nickname already taken", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error updating user: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -156,7 +148,10 @@ func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
 }
 
-func SocialLoginHandler(w http.ResponseWriter, r *http.Request) {
+// SocialLoginHandler signs a user in with a Google or Apple ID token. The
+// account is looked up by the token's verified subject; a verified email is
+// used to attach the provider to an existing account.
+func (s *Server) SocialLoginHandler(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCors(&w)
 	if r.Method == "OPTIONS" {
 		return
@@ -165,83 +160,67 @@ func SocialLoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var payload struct {
-		Email    string `json:"email"`
-		Nickname string `json:"nickname"`
-		Emoji    string `json:"emoji"`
-		OauthID  string `json:"oauth_id"`
-		Provider string `json:"provider"` // "google" or "apple"
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	ident, payload, ok := s.verifyIdentityPayload(w, r)
+	if !ok {
 		return
 	}
+	ctx := r.Context()
 
+	// Only a provider-verified email may be trusted to identify an account
+	email := ""
+	if ident.EmailVerified {
+		email = ident.Email
+	}
 	isNewUser := false
-	var userID string
-	var err error
-
-	// Search by Provider ID first
-	query := "SELECT id FROM users WHERE google_id = $1 OR apple_id = $1"
-	if payload.Provider == "google" {
-		query = "SELECT id FROM users WHERE google_id = $1"
-	} else if payload.Provider == "apple" {
-		query = "SELECT id FROM users WHERE apple_id = $1"
-	}
-	err = database.DB.QueryRow(query, payload.OauthID).Scan(&userID)
 
-	if err != nil {
-		// Not found by ID, try email (case-insensitive)
-		err = database.DB.QueryRow("SELECT id FROM users WHERE LOWER(email) = LOWER($1)", payload.Email).Scan(&userID)
+	// Search by linked identity first
+	var user *models.User
+	linked, err := s.Store.Identities.Get(ctx, ident.Provider, ident.Subject)
+	if err == nil {
+		user, err = s.Store.Users.Get(ctx, linked.UserID)
+	} else if errors.Is(err, store.ErrNotFound) && email != "" {
+		user, err = s.Store.Users.GetByEmail(ctx, email)
+		// Only link when both sides proved the email. An unverified account
+		// keeps the address and the new account starts without one.
+		if err == nil && !user.EmailVerified {
+			user, err, email = nil, store.ErrNotFound, ""
+		}
 		if err == nil {
-			// Found by email, link the provider ID
-			updateQuery := "UPDATE users SET " + payload.Provider + "_id = $1, provider = $2 WHERE id = $3"
-			database.DB.Exec(updateQuery, payload.OauthID, payload.Provider, userID)
-		} else {
-			// New User
-			newID, _ := uuid.NewV7()
-			userID = newID.String()
-			isNewUser = true
-			// Use OauthID as temporary nickname to satisfy UNIQUE constraint
-			safeOauthID := payload.OauthID
-			if len(safeOauthID) > 8 {
-				safeOauthID = safeOauthID[:8]
-			}
-			tempNickname := "user_" + safeOauthID + "_" + uuid.NewString()[:4]
-			insertQuery := "INSERT INTO users (id, nickname, emoji, email, " + payload.Provider + "_id, provider, streak, last_active_date) VALUES ($1, $2, $3, $4, $5, $6, 1, CURRENT_DATE)"
-			_, err = database.DB.Exec(insertQuery, userID, tempNickname, payload.Emoji, payload.Email, payload.OauthID, payload.Provider)
-			if err != nil {
-
-				http.Error(w, "Error creating user", http.StatusInternalServerError)
-				return
+			err = s.Store.Identities.Link(ctx, identityRecord(user.ID, ident))
+			if errors.Is(err, store.ErrConflict) {
+				// The account already has another identity from this provider
+				user, err, email = nil, store.ErrNotFound, ""
 			}
 		}
 	}
+	if errors.Is(err, store.ErrNotFound) {
+		isNewUser = true
+		user, err = s.createSocialUser(ctx, ident, email, payload.Emoji)
+	}
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
 
 	// Double check if nickname is still temporary or empty
-	var nick string
-	err = database.DB.QueryRow("SELECT nickname FROM users WHERE id = $1", userID).Scan(&nick)
-	if err == nil {
-		if nick == "" || strings.HasPrefix(nick, "user_") {
-			isNewUser = true
-		}
+	if user.Nickname == "" || strings.HasPrefix(user.Nickname, "user_") {
+		isNewUser = true
 	}
 
-	token, _ := middleware.GenerateToken(userID)
-	refreshToken, _ := middleware.GenerateRefreshToken(userID)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"id":            userID,
-		"access_token":  token,
-		"refresh_token": refreshToken,
-		"token_type":    "Bearer",
-		"expires_in":    72 * 3600,
-		"is_new_user":   isNewUser,
-		"message":       "Social login successful",
-	})
+	resp, err := s.startSession(r, user.ID, "Social login successful")
+	if err != nil {
+		http.Error(w, "Failed to start session", http.StatusInternalServerError)
+		return
+	}
+	resp["is_new_user"] = isNewUser
+	json.NewEncoder(w).Encode(resp)
 }
 
-func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+// DeleteUserHandler schedules the account for deletion after the grace
+// period and signs it out everywhere. Signing in again before then cancels
+// the deletion; afterwards the purge job removes the account and keeps its
+// test results only under the tombstone user.
+func (s *Server) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCors(&w)
 	if r.Method == "OPTIONS" {
 		return
@@ -257,20 +236,25 @@ func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete user's test results first (foreign key constraint)
-	_, err := database.DB.Exec("DELETE FROM test_results WHERE user_id = $1", userID)
-	if err != nil {
-		http.Error(w, "Error deleting user data: "+err.Error(), http.StatusInternalServerError)
+	if s.DeletionGracePeriod <= 0 {
+		if err := s.Store.Users.Purge(r.Context(), userID); err != nil {
+			storeError(w, err, "User not found")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "Account deleted successfully"})
 		return
 	}
 
-	// Delete user
-	_, err = database.DB.Exec("DELETE FROM users WHERE id = $1", userID)
-	if err != nil {
-		http.Error(w, "Error deleting user account: "+err.Error(), http.StatusInternalServerError)
+	purgeAt := time.Now().Add(s.DeletionGracePeriod).UTC()
+	if err := s.Store.Users.ScheduleDeletion(r.Context(), userID, purgeAt); err != nil {
+		storeError(w, err, "User not found")
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "Account deleted successfully"})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":                true,
+		"message":                "Account scheduled for deletion. Sign in again before the date below to keep it.",
+		"deletion_scheduled_for": purgeAt,
+	})
 }
@@ -1,9 +1,15 @@
 package handlers
 
 import (
-	"backend/internal/database"
+	"backend/internal/appenv"
+	"backend/internal/models"
+	"backend/internal/shop"
+	"backend/internal/store"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type RewardRequest struct {
@@ -11,7 +17,7 @@ type RewardRequest struct {
 }
 
 // RewardHandler grants tokens to the user
-func RewardHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) RewardHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -29,52 +35,55 @@ func RewardHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Security/Limiting logic should go here.
-	// For example, verify ad signature or limit daily rewards.
-	// For this phase, we'll implement a basic logic:
-	// "ad_watch" -> 5 tokens
-	// "daily_login" -> 10 tokens (usually handled on login, but can be explicit claim)
-
-	tokensToAdd := 0
+	t := &models.TokenTransaction{UserID: userID, Reason: req.RewardType, IdempotencyKey: r.Header.Get("Idempotency-Key")}
+	var err error
 	switch req.RewardType {
 	case "ad_watch":
-		tokensToAdd = 5
+		// In production AdMob reports ad views itself; see AdMobCallbackHandler.
+		// Development keeps this path for emulators that can't load real ads.
+		if s.Env != appenv.Development {
+			http.Error(w, "Ad rewards are credited by server-side verification", http.StatusForbidden)
+			return
+		}
+		err = s.grantAdReward(r.Context(), t)
 	case "daily_login":
-		// Check if already claimed today?
-		// For simplicity, just give 10
-		tokensToAdd = 10
+		// Kept for older app versions; see DailyRewardHandler
+		s.claimDailyReward(w, r, userID)
+		return
 	default:
 		http.Error(w, "Invalid reward type", http.StatusBadRequest)
 		return
 	}
-
-	var newBalance int
-	err := database.DB.QueryRow(`
-		UPDATE users 
-		SET tokens = tokens + $1 
-		WHERE id = $2 
-		RETURNING tokens`, tokensToAdd, userID).Scan(&newBalance)
-
-	if err != nil {
-		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+	if errors.Is(err, store.ErrLimitReached) {
+		http.Error(w, "Daily reward limit reached", http.StatusTooManyRequests)
+		return
+	}
+	if err != nil && !errors.Is(err, store.ErrDuplicate) {
+		storeError(w, err, "User not found")
 		return
 	}
 
+	// A retried request gets the original outcome instead of a second reward
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":     true,
-		"added":       tokensToAdd,
-		"new_balance": newBalance,
-		"message":     "Reward granted",
+		"success":        true,
+		"added":          t.Amount,
+		"new_balance":    t.BalanceAfter,
+		"transaction_id": t.ID,
+		"message":        "Reward granted",
 	})
 }
 
+// SpendRequest is the older form of PurchaseRequest. Amount, if sent, must
+// match the catalog price; the server never charges what the client asks.
 type SpendRequest struct {
-	Amount int    `json:"amount"`
-	Reason string `json:"reason"`
+	Item       string `json:"item"`
+	QuestionID string `json:"question_id"`
+	Amount     int    `json:"amount"`
 }
 
-func SpendTokensHandler(w http.ResponseWriter, r *http.Request) {
+// SpendTokensHandler is kept for older app versions; see PurchaseHandler.
+func (s *Server) SpendTokensHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -91,48 +100,73 @@ func SpendTokensHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	item, ok := shop.Lookup(req.Item)
+	if !ok {
+		http.Error(w, "Unknown item", http.StatusBadRequest)
+		return
+	}
+	if req.Amount != 0 && req.Amount != item.Price {
+		http.Error(w, "Amount does not match the item price", http.StatusBadRequest)
+		return
+	}
 
-	// Check if user is premium
-	var isPremium bool
-	database.DB.QueryRow("SELECT is_premium FROM users WHERE id=$1", userID).Scan(&isPremium)
-	if isPremium {
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": true,
-			"message": "Premium user - no tokens spent",
-		})
+	res, ok := s.purchase(w, r, userID, item, req.QuestionID)
+	if !ok {
 		return
 	}
+	res["spent"] = res["price_paid"]
+	res["message"] = "Tokens deducted successfully"
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
 
-	// Double check user tokens
-	var tokens int
-	err := database.DB.QueryRow("SELECT tokens FROM users WHERE id=$1", userID).Scan(&tokens)
-	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+// TokenHistoryHandler lists the user's ledger entries, newest first.
+// Pages continue with ?before=<created_at of the last entry>.
+func (s *Server) TokenHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if tokens < req.Amount {
-		http.Error(w, "Insufficient tokens", http.StatusPaymentRequired)
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	var newBalance int
-	err = database.DB.QueryRow(`
-		UPDATE users 
-		SET tokens = tokens - $1 
-		WHERE id = $2 AND tokens >= $1
-		RETURNING tokens`, req.Amount, userID).Scan(&newBalance)
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 200 {
+			http.Error(w, "limit must be between 1 and 200", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	var before time.Time
+	if v := r.URL.Query().Get("before"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			http.Error(w, "before must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		before = t
+	}
 
+	balance, err := s.Store.Tokens.Balance(r.Context(), userID)
+	if err != nil {
+		storeError(w, err, "User not found")
+		return
+	}
+	list, err := s.Store.Tokens.History(r.Context(), userID, before, limit)
 	if err != nil {
-		http.Error(w, "Insufficient tokens or update error", http.StatusPaymentRequired)
+		storeError(w, err, "User not found")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":     true,
-		"spent":       req.Amount,
-		"new_balance": newBalance,
-		"message":     "Tokens deducted successfully",
+		"balance":      balance,
+		"transactions": list,
 	})
 }
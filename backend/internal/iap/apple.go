@@ -0,0 +1,212 @@
+package iap
+
+import (
+	"backend/internal/models"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AppleAPIURL        = "https://api.storekit.itunes.apple.com"
+	AppleSandboxAPIURL = "https://api.storekit-sandbox.itunes.apple.com"
+)
+
+// AppleClient calls the App Store Server API with an in-app purchase key.
+type AppleClient struct {
+	BaseURL string
+	// SandboxURL is tried when BaseURL doesn't know a transaction, as
+	// TestFlight and review purchases live in the sandbox. Empty disables it.
+	SandboxURL string
+	IssuerID   string
+	KeyID      string
+	BundleID   string
+	Key        *ecdsa.PrivateKey
+	Client     *http.Client
+}
+
+// NewAppleClient parses the PKCS #8 key downloaded from App Store Connect.
+func NewAppleClient(issuerID, keyID, bundleID string, keyPEM []byte) (*AppleClient, error) {
+	if issuerID == "" || keyID == "" || bundleID == "" {
+		return nil, errors.New("App Store credentials need an issuer ID, key ID and bundle ID")
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("parsing App Store key: %w", err)
+	}
+	return &AppleClient{
+		BaseURL:    AppleAPIURL,
+		SandboxURL: AppleSandboxAPIURL,
+		IssuerID:   issuerID,
+		KeyID:      keyID,
+		BundleID:   bundleID,
+		Key:        key,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// authToken signs the short-lived bearer token the API expects.
+func (c *AppleClient) authToken() (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": c.IssuerID,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+		"aud": "appstoreconnect-v1",
+		"bid": c.BundleID,
+	})
+	token.Header["kid"] = c.KeyID
+	return token.SignedString(c.Key)
+}
+
+type appleStatusResponse struct {
+	Environment string `json:"environment"`
+	BundleID    string `json:"bundleId"`
+	Data        []struct {
+		LastTransactions []struct {
+			OriginalTransactionID string `json:"originalTransactionId"`
+			Status                int    `json:"status"`
+			SignedTransactionInfo string `json:"signedTransactionInfo"`
+			SignedRenewalInfo     string `json:"signedRenewalInfo"`
+		} `json:"lastTransactions"`
+	} `json:"data"`
+}
+
+type appleTransaction struct {
+	OriginalTransactionID string `json:"originalTransactionId"`
+	BundleID              string `json:"bundleId"`
+	ProductID             string `json:"productId"`
+	PurchaseDate          int64  `json:"purchaseDate"`
+	ExpiresDate           int64  `json:"expiresDate"`
+	RevocationDate        int64  `json:"revocationDate"`
+}
+
+type appleRenewal struct {
+	AutoRenewStatus        int   `json:"autoRenewStatus"`
+	GracePeriodExpiresDate int64 `json:"gracePeriodExpiresDate"`
+}
+
+// appleStatuses maps the API's subscription status codes.
+var appleStatuses = map[int]string{
+	1: models.SubscriptionActive,
+	2: models.SubscriptionExpired,
+	3: models.SubscriptionOnHold, // billing retry
+	4: models.SubscriptionGrace,
+	5: models.SubscriptionRevoked,
+}
+
+// Subscription looks up the subscription that transactionID belongs to.
+func (c *AppleClient) Subscription(ctx context.Context, transactionID string) (*models.Subscription, error) {
+	resp, err := c.statuses(ctx, c.BaseURL, transactionID)
+	if errors.Is(err, ErrInvalidPurchase) && c.SandboxURL != "" {
+		resp, err = c.statuses(ctx, c.SandboxURL, transactionID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.BundleID != c.BundleID {
+		return nil, fmt.Errorf("%w: bundle %q", ErrInvalidPurchase, resp.BundleID)
+	}
+
+	// A subscription group lists one entry per original transaction, e.g.
+	// for family sharing; the latest expiry is the one that counts
+	var best *models.Subscription
+	for _, group := range resp.Data {
+		for _, last := range group.LastTransactions {
+			var tx appleTransaction
+			var renewal appleRenewal
+			if err := jwsPayload(last.SignedTransactionInfo, &tx); err != nil {
+				return nil, err
+			}
+			if last.SignedRenewalInfo != "" {
+				if err := jwsPayload(last.SignedRenewalInfo, &renewal); err != nil {
+					return nil, err
+				}
+			}
+			status, ok := appleStatuses[last.Status]
+			if !ok || tx.ExpiresDate == 0 {
+				continue
+			}
+			if tx.RevocationDate != 0 {
+				status = models.SubscriptionRevoked
+			}
+			sub := &models.Subscription{
+				Platform:       PlatformApple,
+				ProductID:      tx.ProductID,
+				ExternalID:     tx.OriginalTransactionID,
+				Status:         status,
+				AutoRenew:      renewal.AutoRenewStatus == 1,
+				Environment:    strings.ToLower(resp.Environment),
+				PeriodStart:    millis(tx.PurchaseDate),
+				ExpiresAt:      *millis(tx.ExpiresDate),
+				GraceExpiresAt: millis(renewal.GracePeriodExpiresDate),
+			}
+			if best == nil || sub.ExpiresAt.After(best.ExpiresAt) {
+				best = sub
+			}
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("%w: no subscription for transaction", ErrInvalidPurchase)
+	}
+	return best, nil
+}
+
+func (c *AppleClient) statuses(ctx context.Context, baseURL, transactionID string) (*appleStatusResponse, error) {
+	token, err := c.authToken()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(baseURL, "/")+"/inApps/v1/subscriptions/"+url.PathEscape(transactionID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var resp appleStatusResponse
+	if err := getJSON(c.Client, req, &resp); err != nil {
+		return nil, fmt.Errorf("App Store: %w", err)
+	}
+	return &resp, nil
+}
+
+// AppleNotification is the part of an App Store Server Notification v2 the
+// server acts on.
+type AppleNotification struct {
+	Type          string
+	Subtype       string
+	TransactionID string // original transaction ID, empty for TEST notifications
+}
+
+// ParseAppleNotification reads a notification's signedPayload. The signature
+// isn't checked: the subscription is looked up again with Check, so a forged
+// notification can at most cause a refresh.
+func ParseAppleNotification(signedPayload string) (*AppleNotification, error) {
+	var payload struct {
+		NotificationType string `json:"notificationType"`
+		Subtype          string `json:"subtype"`
+		Data             struct {
+			SignedTransactionInfo string `json:"signedTransactionInfo"`
+		} `json:"data"`
+	}
+	if err := jwsPayload(signedPayload, &payload); err != nil {
+		return nil, err
+	}
+	n := &AppleNotification{Type: payload.NotificationType, Subtype: payload.Subtype}
+	if payload.Data.SignedTransactionInfo != "" {
+		var tx appleTransaction
+		if err := jwsPayload(payload.Data.SignedTransactionInfo, &tx); err != nil {
+			return nil, err
+		}
+		n.TransactionID = tx.OriginalTransactionID
+	}
+	return n, nil
+}
@@ -0,0 +1,228 @@
+package iap
+
+import (
+	"backend/internal/models"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const GoogleAPIURL = "https://androidpublisher.googleapis.com"
+
+const androidPublisherScope = "https://www.googleapis.com/auth/androidpublisher"
+
+// GoogleClient calls the Play Developer API as a service account.
+type GoogleClient struct {
+	BaseURL     string
+	PackageName string
+	Client      *http.Client
+
+	email    string
+	key      *rsa.PrivateKey
+	tokenURI string
+
+	mu          sync.Mutex
+	accessToken string
+	expires     time.Time
+}
+
+// NewGoogleClient reads a service account key file as downloaded from the
+// Google Cloud console.
+func NewGoogleClient(packageName string, serviceAccountJSON []byte) (*GoogleClient, error) {
+	if packageName == "" {
+		return nil, errors.New("Google Play needs a package name")
+	}
+	var account struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(serviceAccountJSON, &account); err != nil {
+		return nil, fmt.Errorf("parsing service account: %w", err)
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("parsing service account key: %w", err)
+	}
+	if account.ClientEmail == "" || account.TokenURI == "" {
+		return nil, errors.New("service account needs client_email and token_uri")
+	}
+	return &GoogleClient{
+		BaseURL:     GoogleAPIURL,
+		PackageName: packageName,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		email:       account.ClientEmail,
+		key:         key,
+		tokenURI:    account.TokenURI,
+	}, nil
+}
+
+// token returns a cached OAuth access token, exchanging a signed assertion
+// for a new one shortly before it expires.
+func (c *GoogleClient) token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.accessToken != "" && time.Now().Before(c.expires) {
+		return c.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   c.email,
+		"scope": androidPublisherScope,
+		"aud":   c.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(c.key)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := getJSON(c.Client, req, &resp); err != nil {
+		return "", fmt.Errorf("Google OAuth: %w", err)
+	}
+	c.accessToken = resp.AccessToken
+	c.expires = now.Add(time.Duration(resp.ExpiresIn)*time.Second - time.Minute)
+	return c.accessToken, nil
+}
+
+func (c *GoogleClient) do(ctx context.Context, method, path string, v any) error {
+	token, err := c.token(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.BaseURL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if err := getJSON(c.Client, req, v); err != nil {
+		return fmt.Errorf("Google Play: %w", err)
+	}
+	return nil
+}
+
+// googleStates maps SubscriptionPurchaseV2.subscriptionState. A canceled
+// subscription only stopped renewing and runs until it expires.
+var googleStates = map[string]string{
+	"SUBSCRIPTION_STATE_ACTIVE":                    models.SubscriptionActive,
+	"SUBSCRIPTION_STATE_CANCELED":                  models.SubscriptionActive,
+	"SUBSCRIPTION_STATE_IN_GRACE_PERIOD":           models.SubscriptionGrace,
+	"SUBSCRIPTION_STATE_ON_HOLD":                   models.SubscriptionOnHold,
+	"SUBSCRIPTION_STATE_PAUSED":                    models.SubscriptionPaused,
+	"SUBSCRIPTION_STATE_PENDING":                   models.SubscriptionPending,
+	"SUBSCRIPTION_STATE_EXPIRED":                   models.SubscriptionExpired,
+	"SUBSCRIPTION_STATE_PENDING_PURCHASE_CANCELED": models.SubscriptionExpired,
+}
+
+// Subscription looks up a purchase token. New purchases are acknowledged,
+// which Google requires within three days or it refunds them.
+func (c *GoogleClient) Subscription(ctx context.Context, purchaseToken string) (*models.Subscription, error) {
+	var resp struct {
+		SubscriptionState    string    `json:"subscriptionState"`
+		StartTime            time.Time `json:"startTime"`
+		AcknowledgementState string    `json:"acknowledgementState"`
+		TestPurchase         *struct{} `json:"testPurchase"`
+		LineItems            []struct {
+			ProductID        string    `json:"productId"`
+			ExpiryTime       time.Time `json:"expiryTime"`
+			AutoRenewingPlan *struct {
+				AutoRenewEnabled bool `json:"autoRenewEnabled"`
+			} `json:"autoRenewingPlan"`
+		} `json:"lineItems"`
+	}
+	path := "/androidpublisher/v3/applications/" + url.PathEscape(c.PackageName) +
+		"/purchases/subscriptionsv2/tokens/" + url.PathEscape(purchaseToken)
+	if err := c.do(ctx, http.MethodGet, path, &resp); err != nil {
+		return nil, err
+	}
+	status, ok := googleStates[resp.SubscriptionState]
+	if !ok || len(resp.LineItems) == 0 {
+		return nil, fmt.Errorf("%w: state %q", ErrInvalidPurchase, resp.SubscriptionState)
+	}
+
+	item := resp.LineItems[0]
+	sub := &models.Subscription{
+		Platform:    PlatformGoogle,
+		ProductID:   item.ProductID,
+		ExternalID:  purchaseToken,
+		Status:      status,
+		AutoRenew:   item.AutoRenewingPlan != nil && item.AutoRenewingPlan.AutoRenewEnabled && resp.SubscriptionState != "SUBSCRIPTION_STATE_CANCELED",
+		Environment: "production",
+		ExpiresAt:   item.ExpiryTime,
+	}
+	if !resp.StartTime.IsZero() {
+		sub.PeriodStart = &resp.StartTime
+	}
+	if resp.TestPurchase != nil {
+		sub.Environment = "sandbox"
+	}
+	if status == models.SubscriptionGrace {
+		// During the grace period expiryTime is the end of it
+		grace := item.ExpiryTime
+		sub.GraceExpiresAt = &grace
+	}
+
+	if resp.AcknowledgementState == "ACKNOWLEDGEMENT_STATE_PENDING" && status == models.SubscriptionActive {
+		path := "/androidpublisher/v3/applications/" + url.PathEscape(c.PackageName) + "/purchases/subscriptions/" +
+			url.PathEscape(item.ProductID) + "/tokens/" + url.PathEscape(purchaseToken) + ":acknowledge"
+		if err := c.do(ctx, http.MethodPost, path, nil); err != nil {
+			return nil, err
+		}
+	}
+	return sub, nil
+}
+
+// GoogleNotification is the part of a real-time developer notification the
+// server acts on.
+type GoogleNotification struct {
+	PackageName   string
+	Type          int    // subscriptionNotification.notificationType, 0 for other notifications
+	PurchaseToken string // empty unless it is about a subscription
+}
+
+// ParseGoogleNotification reads the body of a Pub/Sub push.
+func ParseGoogleNotification(body []byte) (*GoogleNotification, error) {
+	var push struct {
+		Message struct {
+			Data []byte `json:"data"` // base64 in JSON
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(body, &push); err != nil {
+		return nil, err
+	}
+	var rtdn struct {
+		PackageName              string `json:"packageName"`
+		SubscriptionNotification *struct {
+			NotificationType int    `json:"notificationType"`
+			PurchaseToken    string `json:"purchaseToken"`
+		} `json:"subscriptionNotification"`
+	}
+	if err := json.Unmarshal(push.Message.Data, &rtdn); err != nil {
+		return nil, fmt.Errorf("decoding notification: %w", err)
+	}
+	n := &GoogleNotification{PackageName: rtdn.PackageName}
+	if sn := rtdn.SubscriptionNotification; sn != nil {
+		n.Type, n.PurchaseToken = sn.NotificationType, sn.PurchaseToken
+	}
+	return n, nil
+}
@@ -0,0 +1,148 @@
+// Package iap validates in-app subscription purchases with the App Store
+// Server API and the Google Play Developer API. Store notifications are only
+// used as a hint to look a subscription up again, so nothing the client or a
+// notification sender claims is trusted on its own.
+package iap
+
+import (
+	"backend/internal/models"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	PlatformApple  = "apple"
+	PlatformGoogle = "google"
+)
+
+var (
+	// ErrInvalidPurchase means the store doesn't know the purchase or it
+	// belongs to another app.
+	ErrInvalidPurchase = errors.New("invalid purchase")
+	// ErrNotConfigured means the platform has no credentials configured.
+	ErrNotConfigured   = errors.New("store is not configured")
+	ErrUnknownPlatform = errors.New("unknown platform")
+)
+
+// Validator looks subscriptions up with the stores. A nil client means the
+// platform isn't configured.
+type Validator struct {
+	Apple  *AppleClient
+	Google *GoogleClient
+	// GooglePushToken must be sent as the token query parameter of Google's
+	// real-time developer notification pushes. Without it pushes are refused.
+	GooglePushToken string
+}
+
+// Check returns the current state of a subscription. externalID is a
+// transaction ID on Apple and a purchase token on Google. The returned
+// subscription has no user or ID set.
+func (v *Validator) Check(ctx context.Context, platform, externalID string) (*models.Subscription, error) {
+	switch platform {
+	case PlatformApple:
+		if v.Apple == nil {
+			return nil, ErrNotConfigured
+		}
+		return v.Apple.Subscription(ctx, externalID)
+	case PlatformGoogle:
+		if v.Google == nil {
+			return nil, ErrNotConfigured
+		}
+		return v.Google.Subscription(ctx, externalID)
+	}
+	return nil, ErrUnknownPlatform
+}
+
+// FromEnv configures each platform whose credentials are set:
+//
+//	APPLE_IAP_ISSUER_ID, APPLE_IAP_KEY_ID, APPLE_IAP_KEY_FILE (.p8), APPLE_BUNDLE_ID
+//	APPLE_IAP_API_URL, APPLE_IAP_SANDBOX_API_URL (optional overrides)
+//	GOOGLE_PLAY_PACKAGE_NAME, GOOGLE_PLAY_SERVICE_ACCOUNT_FILE
+//	GOOGLE_PLAY_API_URL (optional override), GOOGLE_RTDN_TOKEN
+func FromEnv() (*Validator, error) {
+	v := &Validator{GooglePushToken: os.Getenv("GOOGLE_RTDN_TOKEN")}
+
+	if path := os.Getenv("APPLE_IAP_KEY_FILE"); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading APPLE_IAP_KEY_FILE: %w", err)
+		}
+		apple, err := NewAppleClient(os.Getenv("APPLE_IAP_ISSUER_ID"), os.Getenv("APPLE_IAP_KEY_ID"), os.Getenv("APPLE_BUNDLE_ID"), pem)
+		if err != nil {
+			return nil, err
+		}
+		if url := os.Getenv("APPLE_IAP_API_URL"); url != "" {
+			apple.BaseURL = url
+		}
+		if url, ok := os.LookupEnv("APPLE_IAP_SANDBOX_API_URL"); ok {
+			apple.SandboxURL = url
+		}
+		v.Apple = apple
+	}
+
+	if path := os.Getenv("GOOGLE_PLAY_SERVICE_ACCOUNT_FILE"); path != "" {
+		account, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading GOOGLE_PLAY_SERVICE_ACCOUNT_FILE: %w", err)
+		}
+		google, err := NewGoogleClient(os.Getenv("GOOGLE_PLAY_PACKAGE_NAME"), account)
+		if err != nil {
+			return nil, err
+		}
+		if url := os.Getenv("GOOGLE_PLAY_API_URL"); url != "" {
+			google.BaseURL = url
+		}
+		v.Google = google
+	}
+	return v, nil
+}
+
+// getJSON sends req and decodes a 200 response into v. A 404 is reported as
+// ErrInvalidPurchase.
+func getJSON(client *http.Client, req *http.Request, v any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrInvalidPurchase
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("%s %s returned %s", req.Method, req.URL.Path, resp.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// jwsPayload decodes the payload of a compact JWS without checking its
+// signature. It is only used on responses fetched from the stores over
+// authenticated TLS.
+func jwsPayload(jws string, v any) error {
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed JWS")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("decoding JWS payload: %w", err)
+	}
+	return json.Unmarshal(payload, v)
+}
+
+func millis(ms int64) *time.Time {
+	if ms == 0 {
+		return nil
+	}
+	t := time.UnixMilli(ms).UTC()
+	return &t
+}
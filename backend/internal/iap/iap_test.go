@@ -0,0 +1,95 @@
+package iap_test
+
+import (
+	"backend/internal/iap"
+	"backend/internal/iap/iaptest"
+	"backend/internal/models"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func appleClient(t *testing.T, s *iaptest.AppleServer) *iap.AppleClient {
+	t.Helper()
+	c, err := iap.NewAppleClient("issuer", "KEY123", s.BundleID, s.KeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.BaseURL, c.SandboxURL = s.URL, ""
+	return c
+}
+
+func TestAppleSubscription(t *testing.T) {
+	s := iaptest.NewAppleServer(t, "com.example.app")
+	expires := time.Now().Add(24 * time.Hour).Truncate(time.Millisecond)
+	graceEnds := expires.Add(6 * 24 * time.Hour)
+	s.Set("1000", iaptest.AppleSubscription{ProductID: "premium.monthly", Status: 4, ExpiresAt: expires, GraceEndsAt: graceEnds})
+
+	// Production doesn't know the transaction, the sandbox does
+	production := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(production.Close)
+	c := appleClient(t, s)
+	c.BaseURL, c.SandboxURL = production.URL, s.URL
+	sub, err := c.Subscription(context.Background(), "1000")
+	if err != nil {
+		t.Fatalf("Subscription: %v", err)
+	}
+	if sub.Status != models.SubscriptionGrace || sub.ProductID != "premium.monthly" || sub.ExternalID != "1000" ||
+		!sub.ExpiresAt.Equal(expires) || sub.GraceExpiresAt == nil || !sub.GraceExpiresAt.Equal(graceEnds) || sub.Environment != "sandbox" {
+		t.Fatalf("unexpected subscription: %+v", sub)
+	}
+
+	if _, err := appleClient(t, s).Subscription(context.Background(), "404"); !errors.Is(err, iap.ErrInvalidPurchase) {
+		t.Fatalf("unknown transaction: err = %v, want ErrInvalidPurchase", err)
+	}
+	other := appleClient(t, s)
+	other.BundleID = "com.example.other"
+	if _, err := other.Subscription(context.Background(), "1000"); err == nil {
+		t.Fatal("a token for another bundle must not be accepted")
+	}
+}
+
+func TestAppleNotification(t *testing.T) {
+	s := iaptest.NewAppleServer(t, "com.example.app")
+	n, err := iap.ParseAppleNotification(s.Notification("DID_RENEW", "1000")["signedPayload"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Type != "DID_RENEW" || n.TransactionID != "1000" {
+		t.Fatalf("unexpected notification: %+v", n)
+	}
+}
+
+func TestGoogleSubscription(t *testing.T) {
+	g := iaptest.NewGooglePlay(t, "com.example.app")
+	expires := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	g.Set("tok-1", iaptest.GoogleSubscription{ProductID: "premium_monthly", State: "SUBSCRIPTION_STATE_CANCELED", ExpiresAt: expires, AutoRenew: true})
+
+	c, err := iap.NewGoogleClient(g.PackageName, g.ServiceAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.BaseURL = g.URL
+	sub, err := c.Subscription(context.Background(), "tok-1")
+	if err != nil {
+		t.Fatalf("Subscription: %v", err)
+	}
+	// Canceled only stops renewal; access runs until expiry
+	if sub.Status != models.SubscriptionActive || sub.AutoRenew || !sub.ExpiresAt.Equal(expires) {
+		t.Fatalf("unexpected subscription: %+v", sub)
+	}
+	if !g.Acknowledged("tok-1") {
+		t.Fatal("new purchases must be acknowledged")
+	}
+	if _, err := c.Subscription(context.Background(), "missing"); !errors.Is(err, iap.ErrInvalidPurchase) {
+		t.Fatalf("unknown token: err = %v, want ErrInvalidPurchase", err)
+	}
+
+	n, err := iap.ParseGoogleNotification(g.Push(2, "tok-1"))
+	if err != nil || n.PurchaseToken != "tok-1" || n.Type != 2 || n.PackageName != g.PackageName {
+		t.Fatalf("unexpected notification: %+v, %v", n, err)
+	}
+}
@@ -0,0 +1,272 @@
+// Package iaptest provides stand-ins for the App Store Server API and the
+// Google Play Developer API, for testing purchase validation.
+package iaptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AppleSubscription is the state the App Store stand-in reports.
+type AppleSubscription struct {
+	ProductID   string
+	Status      int // 1 active, 2 expired, 3 billing retry, 4 grace, 5 revoked
+	ExpiresAt   time.Time
+	AutoRenew   bool
+	GraceEndsAt time.Time
+}
+
+// AppleServer answers subscription status requests for the bundle ID it
+// was created with, signed by KeyPEM.
+type AppleServer struct {
+	*httptest.Server
+	BundleID string
+	KeyPEM   []byte
+
+	key  *ecdsa.PrivateKey
+	mu   sync.Mutex
+	subs map[string]AppleSubscription // by original transaction ID
+}
+
+func NewAppleServer(t testing.TB, bundleID string) *AppleServer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating ECDSA key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("encoding key: %v", err)
+	}
+	s := &AppleServer{
+		BundleID: bundleID,
+		KeyPEM:   pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}),
+		key:      key,
+		subs:     map[string]AppleSubscription{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Set stores the subscription reported for an original transaction ID.
+func (s *AppleServer) Set(transactionID string, sub AppleSubscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs[transactionID] = sub
+}
+
+func (s *AppleServer) serve(w http.ResponseWriter, r *http.Request) {
+	token, err := jwt.Parse(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "),
+		func(*jwt.Token) (any, error) { return &s.key.PublicKey, nil },
+		jwt.WithValidMethods([]string{"ES256"}), jwt.WithAudience("appstoreconnect-v1"))
+	if err != nil || token.Claims.(jwt.MapClaims)["bid"] != s.BundleID {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, ok := strings.CutPrefix(r.URL.Path, "/inApps/v1/subscriptions/")
+	s.mu.Lock()
+	sub, found := s.subs[id]
+	s.mu.Unlock()
+	if !ok || !found {
+		http.Error(w, `{"errorCode":4040010}`, http.StatusNotFound)
+		return
+	}
+
+	tx := s.sign(jwt.MapClaims{
+		"originalTransactionId": id,
+		"bundleId":              s.BundleID,
+		"productId":             sub.ProductID,
+		"purchaseDate":          sub.ExpiresAt.AddDate(0, -1, 0).UnixMilli(),
+		"expiresDate":           sub.ExpiresAt.UnixMilli(),
+	})
+	renewal := jwt.MapClaims{"autoRenewStatus": 0}
+	if sub.AutoRenew {
+		renewal["autoRenewStatus"] = 1
+	}
+	if !sub.GraceEndsAt.IsZero() {
+		renewal["gracePeriodExpiresDate"] = sub.GraceEndsAt.UnixMilli()
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"environment": "Sandbox",
+		"bundleId":    s.BundleID,
+		"data": []any{map[string]any{
+			"subscriptionGroupIdentifier": "premium",
+			"lastTransactions": []any{map[string]any{
+				"originalTransactionId": id,
+				"status":                sub.Status,
+				"signedTransactionInfo": tx,
+				"signedRenewalInfo":     s.sign(renewal),
+			}},
+		}},
+	})
+}
+
+func (s *AppleServer) sign(claims jwt.MapClaims) string {
+	signed, _ := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(s.key)
+	return signed
+}
+
+// Notification returns the body of an App Store Server Notification v2
+// about an original transaction ID.
+func (s *AppleServer) Notification(notificationType, transactionID string) map[string]string {
+	payload := s.sign(jwt.MapClaims{
+		"notificationType": notificationType,
+		"data": map[string]any{
+			"bundleId":              s.BundleID,
+			"signedTransactionInfo": s.sign(jwt.MapClaims{"originalTransactionId": transactionID, "bundleId": s.BundleID}),
+		},
+	})
+	return map[string]string{"signedPayload": payload}
+}
+
+// GoogleSubscription is the state the Google Play stand-in reports.
+type GoogleSubscription struct {
+	ProductID string
+	State     string // e.g. SUBSCRIPTION_STATE_ACTIVE
+	ExpiresAt time.Time
+	AutoRenew bool
+}
+
+// GooglePlay serves the OAuth token endpoint and the subscription endpoints
+// for one package. ServiceAccount is a key file pointing at it.
+type GooglePlay struct {
+	*httptest.Server
+	PackageName    string
+	ServiceAccount []byte
+
+	key          *rsa.PrivateKey
+	mu           sync.Mutex
+	subs         map[string]GoogleSubscription // by purchase token
+	acknowledged map[string]bool
+}
+
+func NewGooglePlay(t testing.TB, packageName string) *GooglePlay {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+	g := &GooglePlay{PackageName: packageName, key: key, subs: map[string]GoogleSubscription{}, acknowledged: map[string]bool{}}
+	g.Server = httptest.NewServer(http.HandlerFunc(g.serve))
+	t.Cleanup(g.Close)
+
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	g.ServiceAccount, _ = json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "play@test.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    g.URL + "/token",
+	})
+	return g
+}
+
+// Set stores the subscription reported for a purchase token.
+func (g *GooglePlay) Set(purchaseToken string, sub GoogleSubscription) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.subs[purchaseToken] = sub
+}
+
+// Acknowledged reports whether the purchase was acknowledged.
+func (g *GooglePlay) Acknowledged(purchaseToken string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.acknowledged[purchaseToken]
+}
+
+const accessToken = "test-access-token"
+
+func (g *GooglePlay) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		_, err := jwt.Parse(r.FormValue("assertion"), func(*jwt.Token) (any, error) { return &g.key.PublicKey, nil },
+			jwt.WithValidMethods([]string{"RS256"}))
+		if err != nil || r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"access_token": accessToken, "expires_in": 3600, "token_type": "Bearer"})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+accessToken {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	prefix := "/androidpublisher/v3/applications/" + g.PackageName + "/purchases/"
+	rest, ok := strings.CutPrefix(r.URL.Path, prefix)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if token, ok := strings.CutPrefix(rest, "subscriptionsv2/tokens/"); ok && r.Method == http.MethodGet {
+		sub, found := g.subs[token]
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		ack := "ACKNOWLEDGEMENT_STATE_PENDING"
+		if g.acknowledged[token] {
+			ack = "ACKNOWLEDGEMENT_STATE_ACKNOWLEDGED"
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"subscriptionState":    sub.State,
+			"startTime":            sub.ExpiresAt.AddDate(0, -1, 0).Format(time.RFC3339),
+			"acknowledgementState": ack,
+			"lineItems": []any{map[string]any{
+				"productId":        sub.ProductID,
+				"expiryTime":       sub.ExpiresAt.Format(time.RFC3339),
+				"autoRenewingPlan": map[string]any{"autoRenewEnabled": sub.AutoRenew},
+			}},
+		})
+		return
+	}
+	// subscriptions/{productId}/tokens/{token}:acknowledge
+	if strings.HasSuffix(rest, ":acknowledge") && r.Method == http.MethodPost {
+		parts := strings.Split(strings.TrimSuffix(rest, ":acknowledge"), "/")
+		token := parts[len(parts)-1]
+		if _, found := g.subs[token]; !found {
+			http.NotFound(w, r)
+			return
+		}
+		g.acknowledged[token] = true
+		w.Write([]byte("{}"))
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// Push returns the body of a Pub/Sub push carrying a subscription
+// notification for the purchase token.
+func (g *GooglePlay) Push(notificationType int, purchaseToken string) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"version":     "1.0",
+		"packageName": g.PackageName,
+		"subscriptionNotification": map[string]any{
+			"version": "1.0", "notificationType": notificationType, "purchaseToken": purchaseToken,
+		},
+	})
+	body, _ := json.Marshal(map[string]any{
+		"message":      map[string]any{"data": base64.StdEncoding.EncodeToString(data), "messageId": "1"},
+		"subscription": "projects/test/subscriptions/play",
+	})
+	return body
+}
@@ -0,0 +1,145 @@
+package identity
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultKeyTTL is used when the JWKS response has no Cache-Control max-age.
+	defaultKeyTTL = time.Hour
+	// defaultMinRefresh limits refetches triggered by unknown key IDs, so a
+	// stream of forged tokens can't turn into a stream of requests to the provider.
+	defaultMinRefresh = time.Minute
+)
+
+var errUnknownKey = errors.New("unknown signing key")
+
+// KeySet fetches and caches the RSA signing keys published at a JWKS URL.
+// Keys are refreshed when the cache expires or when a token names a key ID
+// that isn't cached yet, which is how providers roll out rotated keys.
+type KeySet struct {
+	URL                string
+	Client             *http.Client
+	MinRefreshInterval time.Duration
+
+	mu          sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	expires     time.Time
+	lastFetched time.Time
+}
+
+func NewKeySet(url string) *KeySet {
+	return &KeySet{
+		URL:                url,
+		Client:             &http.Client{Timeout: 10 * time.Second},
+		MinRefreshInterval: defaultMinRefresh,
+	}
+}
+
+// Key returns the public key with the given key ID.
+func (ks *KeySet) Key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := time.Now()
+	key, ok := ks.keys[kid]
+	if ok && now.Before(ks.expires) {
+		return key, nil
+	}
+	if !ks.lastFetched.IsZero() && now.Sub(ks.lastFetched) < ks.MinRefreshInterval {
+		if ok {
+			return key, nil
+		}
+		return nil, errUnknownKey
+	}
+
+	if err := ks.refresh(ctx); err != nil {
+		// Keep serving cached keys if the provider is briefly unreachable
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+	if key, ok = ks.keys[kid]; !ok {
+		return nil, errUnknownKey
+	}
+	return key, nil
+}
+
+// refresh replaces the cached keys. Callers hold ks.mu.
+func (ks *KeySet) refresh(ctx context.Context) error {
+	ks.lastFetched = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := ks.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching JWKS: %s returned %s", ks.URL, resp.Status)
+	}
+
+	var doc struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("decoding JWKS: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range doc.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		return errors.New("JWKS contains no usable RSA signing keys")
+	}
+
+	ks.keys = keys
+	ks.expires = time.Now().Add(maxAge(resp.Header.Get("Cache-Control")))
+	return nil
+}
+
+// maxAge reads max-age from a Cache-Control header, falling back to defaultKeyTTL.
+func maxAge(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if strings.EqualFold(name, "max-age") {
+			if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return defaultKeyTTL
+}
@@ -0,0 +1,181 @@
+package identity_test
+
+import (
+	"backend/internal/identity"
+	"backend/internal/identity/identitytest"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const clientID = "com.example.app"
+
+func newVerifier(ks *identitytest.KeyServer) *identity.Verifier {
+	keys := identity.NewKeySet(ks.URL)
+	keys.MinRefreshInterval = 0
+	return identity.NewVerifier(&identity.Provider{
+		Name:      "google",
+		Issuers:   []string{"https://accounts.google.com"},
+		Audiences: []string{clientID},
+		Keys:      keys,
+	})
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            "https://accounts.google.com",
+		"aud":            clientID,
+		"sub":            "subject-1",
+		"email":          "a@example.com",
+		"email_verified": "true",
+		"nonce":          "raw-nonce",
+	}
+}
+
+func TestVerifyAcceptsValidToken(t *testing.T) {
+	ks := identitytest.NewKeyServer(t)
+	id, err := newVerifier(ks).Verify(context.Background(), "google", ks.Token(t, validClaims()), "raw-nonce")
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if id.Subject != "subject-1" || id.Email != "a@example.com" || !id.EmailVerified {
+		t.Fatalf("unexpected identity: %+v", id)
+	}
+}
+
+func TestVerifyRejectsBadClaims(t *testing.T) {
+	ks := identitytest.NewKeyServer(t)
+	v := newVerifier(ks)
+
+	cases := map[string]func(c jwt.MapClaims){
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example" },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"no expiry":      func(c jwt.MapClaims) { c["exp"] = nil },
+		"no subject":     func(c jwt.MapClaims) { delete(c, "sub") },
+		"no nonce":       func(c jwt.MapClaims) { delete(c, "nonce") },
+		"other nonce":    func(c jwt.MapClaims) { c["nonce"] = "n" },
+	}
+	for name, edit := range cases {
+		t.Run(name, func(t *testing.T) {
+			claims := validClaims()
+			edit(claims)
+			_, err := v.Verify(context.Background(), "google", ks.Token(t, claims), "raw-nonce")
+			if !errors.Is(err, identity.ErrInvalidToken) {
+				t.Fatalf("err = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsForeignSignature(t *testing.T) {
+	ks := identitytest.NewKeyServer(t)
+	other := identitytest.NewKeyServer(t)
+	_, err := newVerifier(ks).Verify(context.Background(), "google", other.Token(t, validClaims()), "raw-nonce")
+	if !errors.Is(err, identity.ErrInvalidToken) {
+		t.Fatalf("err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestVerifyChecksNonce(t *testing.T) {
+	ks := identitytest.NewKeyServer(t)
+	v := newVerifier(ks)
+
+	// Google tokens carry the nonce verbatim, never its hash
+	hashed := sha256.Sum256([]byte("raw-nonce"))
+	claims := validClaims()
+	claims["nonce"] = hex.EncodeToString(hashed[:])
+	if _, err := v.Verify(context.Background(), "google", ks.Token(t, claims), "raw-nonce"); !errors.Is(err, identity.ErrInvalidToken) {
+		t.Fatalf("hashed nonce: err = %v", err)
+	}
+
+	claims["nonce"] = "raw-nonce"
+	if _, err := v.Verify(context.Background(), "google", ks.Token(t, claims), "other"); !errors.Is(err, identity.ErrInvalidToken) {
+		t.Fatalf("mismatched nonce: err = %v", err)
+	}
+	delete(claims, "nonce")
+	if _, err := v.Verify(context.Background(), "google", ks.Token(t, claims), "raw-nonce"); !errors.Is(err, identity.ErrInvalidToken) {
+		t.Fatalf("missing nonce claim: err = %v", err)
+	}
+	// Without a nonce from the client any token minted for the app would do
+	if _, err := v.Verify(context.Background(), "google", ks.Token(t, validClaims()), ""); !errors.Is(err, identity.ErrMissingNonce) {
+		t.Fatalf("no client nonce: err = %v", err)
+	}
+}
+
+func TestVerifyChecksHashedNonce(t *testing.T) {
+	ks := identitytest.NewKeyServer(t)
+	keys := identity.NewKeySet(ks.URL)
+	v := identity.NewVerifier(&identity.Provider{
+		Name:        "apple",
+		Issuers:     []string{"https://accounts.google.com"},
+		Audiences:   []string{clientID},
+		Keys:        keys,
+		HashedNonce: true,
+	})
+
+	hashed := sha256.Sum256([]byte("raw-nonce"))
+	claims := validClaims()
+	claims["nonce"] = hex.EncodeToString(hashed[:])
+	if _, err := v.Verify(context.Background(), "apple", ks.Token(t, claims), "raw-nonce"); err != nil {
+		t.Fatalf("hashed nonce: %v", err)
+	}
+	// Knowing the hash from the token must not be enough to use it
+	if _, err := v.Verify(context.Background(), "apple", ks.Token(t, claims), hex.EncodeToString(hashed[:])); !errors.Is(err, identity.ErrInvalidToken) {
+		t.Fatalf("hash as nonce: err = %v", err)
+	}
+	if _, err := v.Verify(context.Background(), "apple", ks.Token(t, validClaims()), "raw-nonce"); !errors.Is(err, identity.ErrInvalidToken) {
+		t.Fatalf("verbatim nonce: err = %v", err)
+	}
+}
+
+func TestKeySetPicksUpRotatedKeys(t *testing.T) {
+	ks := identitytest.NewKeyServer(t)
+	v := newVerifier(ks)
+
+	if _, err := v.Verify(context.Background(), "google", ks.Token(t, validClaims()), "raw-nonce"); err != nil {
+		t.Fatalf("first key: %v", err)
+	}
+	ks.Rotate(t)
+	if _, err := v.Verify(context.Background(), "google", ks.Token(t, validClaims()), "raw-nonce"); err != nil {
+		t.Fatalf("rotated key: %v", err)
+	}
+	if got := ks.Fetches.Load(); got != 2 {
+		t.Fatalf("JWKS fetched %d times, want 2", got)
+	}
+
+	// Cached keys are reused
+	v.Verify(context.Background(), "google", ks.Token(t, validClaims()), "raw-nonce")
+	if got := ks.Fetches.Load(); got != 2 {
+		t.Fatalf("JWKS fetched %d times after cache hit, want 2", got)
+	}
+}
+
+func TestKeySetLimitsRefetchesForUnknownKeys(t *testing.T) {
+	ks := identitytest.NewKeyServer(t)
+	keys := identity.NewKeySet(ks.URL)
+	if _, err := keys.Key(context.Background(), "missing"); err == nil {
+		t.Fatal("expected an error for an unknown key")
+	}
+	for i := 0; i < 5; i++ {
+		keys.Key(context.Background(), "missing")
+	}
+	if got := ks.Fetches.Load(); got != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", got)
+	}
+}
+
+func TestVerifyUnconfiguredProvider(t *testing.T) {
+	v := identity.NewVerifier(&identity.Provider{Name: "apple"})
+	if _, err := v.Verify(context.Background(), "apple", "x", ""); !errors.Is(err, identity.ErrNotConfigured) {
+		t.Fatalf("err = %v, want ErrNotConfigured", err)
+	}
+	if _, err := v.Verify(context.Background(), "facebook", "x", ""); !errors.Is(err, identity.ErrUnknownProvider) {
+		t.Fatalf("err = %v, want ErrUnknownProvider", err)
+	}
+}
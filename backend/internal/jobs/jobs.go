@@ -0,0 +1,39 @@
+// Package jobs runs periodic background work inside the API process. Jobs
+// must be safe to run on several instances at once.
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Job is a unit of periodic work. Run is called once at start and then
+// every Interval until the context passed to Start is cancelled.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Start runs each job in its own goroutine and returns immediately.
+func Start(ctx context.Context, list ...Job) {
+	for _, j := range list {
+		go loop(ctx, j)
+	}
+}
+
+func loop(ctx context.Context, j Job) {
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+	for {
+		if err := j.Run(ctx); err != nil {
+			log.Printf("Job %s: %v", j.Name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
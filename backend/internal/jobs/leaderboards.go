@@ -0,0 +1,25 @@
+package jobs
+
+import (
+	"backend/internal/store"
+	"context"
+	"log"
+	"time"
+)
+
+// PruneLeaderboards deletes the scores of daily, weekly and monthly
+// leaderboard periods that are over. Nothing reads them once a new period
+// starts, so this only keeps the table small.
+func PruneLeaderboards(st *store.Store) Job {
+	return Job{
+		Name:     "prune-leaderboards",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			n, err := st.Leaderboards.Prune(ctx, time.Now())
+			if n > 0 {
+				log.Printf("Pruned %d expired leaderboard scores", n)
+			}
+			return err
+		},
+	}
+}
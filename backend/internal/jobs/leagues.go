@@ -0,0 +1,67 @@
+package jobs
+
+import (
+	"backend/internal/leagues"
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// leagueBatch bounds the league groups closed per query.
+const leagueBatch = 100
+
+// CloseLeagueWeeks promotes and relegates the members of every league group
+// whose week is over. Weeks end on Monday 00:00 in Istanbul; see leagues.Week.
+func CloseLeagueWeeks(st *store.Store) Job {
+	return Job{
+		Name:     "close-league-weeks",
+		Interval: 10 * time.Minute,
+		Run: func(ctx context.Context) error {
+			_, err := CloseLeagues(ctx, st, time.Now())
+			return err
+		},
+	}
+}
+
+// CloseLeagues closes the groups of weeks before the one now falls in and
+// returns how many it closed.
+func CloseLeagues(ctx context.Context, st *store.Store, now time.Time) (int, error) {
+	week := leagues.Week(now)
+	closed := 0
+	for {
+		groups, err := st.Leagues.Unclosed(ctx, week, leagueBatch)
+		if err != nil {
+			return closed, err
+		}
+		for _, g := range groups {
+			standings, err := st.Leagues.Standings(ctx, g.ID)
+			if err != nil {
+				return closed, err
+			}
+			outcomes := leagues.Outcomes(g.Tier, len(standings))
+			results := make([]models.LeagueResult, len(standings))
+			for i, s := range standings {
+				results[i] = models.LeagueResult{UserID: s.UserID, Rank: i + 1, Outcome: outcomes[i],
+					Tier: leagues.NextTier(g.Tier, outcomes[i])}
+			}
+			err = st.Leagues.Close(ctx, g.ID, results)
+			if errors.Is(err, store.ErrConflict) {
+				continue // closed by another instance
+			}
+			if err != nil {
+				return closed, err
+			}
+			closed++
+		}
+		if len(groups) < leagueBatch {
+			break
+		}
+	}
+	if closed > 0 {
+		log.Printf("Closed %d league groups", closed)
+	}
+	return closed, nil
+}
@@ -0,0 +1,128 @@
+package jobs
+
+import (
+	"backend/internal/days"
+	"backend/internal/progression"
+	"backend/internal/store"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// levelBatch bounds the users recomputed per query.
+const levelBatch = 100
+
+// RecomputeLevels sets every user's lifetime XP to what their test results
+// and achievements earn under cfg, moving their level along its curve, and
+// pays the level rewards they reached. Levels never go down: a user whose
+// history earns less than they have keeps their XP. It runs once, when the
+// rules change, and is safe to run again. It returns how many users it
+// updated.
+func RecomputeLevels(ctx context.Context, st *store.Store, cfg *progression.Config) (int, error) {
+	// Every result of a test earns from the same questions
+	tests := map[string]progression.Result{}
+	forTest := func(testID string) (progression.Result, error) {
+		if r, ok := tests[testID]; ok {
+			return r, nil
+		}
+		questions, err := st.Questions.ListByTest(ctx, testID)
+		if err != nil {
+			return progression.Result{}, err
+		}
+		tests[testID] = cfg.ForTest(questions, store.PointsPerQuestion)
+		return tests[testID], nil
+	}
+
+	updated := 0
+	after := ""
+	for {
+		ids, err := st.Users.ListIDs(ctx, after, levelBatch)
+		if err != nil {
+			return updated, err
+		}
+		for _, id := range ids {
+			changed, err := recomputeUser(ctx, st, cfg, id, forTest)
+			if errors.Is(err, store.ErrNotFound) {
+				continue // deleted since it was listed
+			}
+			if err != nil {
+				return updated, fmt.Errorf("user %s: %w", id, err)
+			}
+			if changed {
+				updated++
+			}
+		}
+		if len(ids) < levelBatch {
+			return updated, nil
+		}
+		after = ids[len(ids)-1]
+	}
+}
+
+func recomputeUser(ctx context.Context, st *store.Store, cfg *progression.Config, id string,
+	forTest func(string) (progression.Result, error)) (bool, error) {
+	user, err := st.Users.Get(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil || user.Timezone == "" {
+		if loc, err = time.LoadLocation(store.DefaultTimezone); err != nil {
+			loc = time.UTC
+		}
+	}
+
+	results, err := st.Results.ListForUser(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	total := 0
+	perDay := map[string]int{}
+	best := map[string]int{}
+	for _, res := range results {
+		r, err := forTest(res.TestID)
+		if err != nil {
+			return false, err
+		}
+		day := days.Today(res.CompletedAt, loc)
+		perDay[day]++
+		// Like submitting, only a first or better result of a test pays
+		if prev, taken := best[res.TestID]; taken && res.Score <= prev {
+			continue
+		}
+		best[res.TestID] = res.Score
+		r.Score, r.TestsToday = res.Score, perDay[day]
+		total += cfg.TestXP(r).Total
+	}
+	earned, err := st.Achievements.List(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	for _, a := range earned {
+		total += a.XP
+	}
+
+	total = max(total, user.TotalXP)
+	level, xp := cfg.Curve.Level(total)
+	changed := total != user.TotalXP || level != user.Level || xp != user.XP
+	if changed {
+		if err := st.Users.SetTotalXP(ctx, id, total, cfg.Curve); err != nil {
+			return false, err
+		}
+	}
+	for _, r := range cfg.RewardsBetween(0, level) {
+		if a := r.Achievement(id); a != nil {
+			if err := st.Achievements.Award(ctx, a, cfg.Curve); err != nil && !errors.Is(err, store.ErrDuplicate) {
+				return changed, err
+			}
+		}
+		if r.Tokens == 0 {
+			continue
+		}
+		if err := st.Tokens.Record(ctx, r.Transaction(id)); err != nil && !errors.Is(err, store.ErrDuplicate) {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
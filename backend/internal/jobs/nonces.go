@@ -0,0 +1,24 @@
+package jobs
+
+import (
+	"backend/internal/store"
+	"context"
+	"log"
+	"time"
+)
+
+// PruneNonces deletes nonces that expired without being used. Expired ones
+// are refused anyway, so this only keeps the table small.
+func PruneNonces(st *store.Store) Job {
+	return Job{
+		Name:     "prune-nonces",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			n, err := st.Nonces.Prune(ctx, time.Now())
+			if n > 0 {
+				log.Printf("Pruned %d expired nonces", n)
+			}
+			return err
+		},
+	}
+}
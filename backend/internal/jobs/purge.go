@@ -0,0 +1,53 @@
+package jobs
+
+import (
+	"backend/internal/store"
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// purgeBatch bounds the accounts purged per run.
+const purgeBatch = 100
+
+// PurgeDeletedAccounts purges accounts whose deletion grace period is over.
+func PurgeDeletedAccounts(st *store.Store) Job {
+	return Job{
+		Name:     "purge-deleted-accounts",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			_, err := PurgeDue(ctx, st, time.Now())
+			return err
+		},
+	}
+}
+
+// PurgeDue purges every account due for deletion at now and returns how
+// many were purged.
+func PurgeDue(ctx context.Context, st *store.Store, now time.Time) (int, error) {
+	purged := 0
+	for {
+		ids, err := st.Users.DueForDeletion(ctx, now, purgeBatch)
+		if err != nil {
+			return purged, err
+		}
+		for _, id := range ids {
+			err := st.Users.Purge(ctx, id)
+			if errors.Is(err, store.ErrNotFound) {
+				continue // purged by another instance
+			}
+			if err != nil {
+				return purged, err
+			}
+			purged++
+		}
+		if len(ids) < purgeBatch {
+			break
+		}
+	}
+	if purged > 0 {
+		log.Printf("Purged %d deleted accounts", purged)
+	}
+	return purged, nil
+}
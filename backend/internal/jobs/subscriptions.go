@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// subscriptionBatch bounds the subscriptions rechecked per run.
+const subscriptionBatch = 100
+
+// CheckFunc looks a subscription up with its store, like iap.Validator.Check.
+type CheckFunc func(ctx context.Context, platform, externalID string) (*models.Subscription, error)
+
+// ExpireSubscriptions downgrades users whose subscriptions ran out. check may
+// be nil; otherwise subscriptions that look expired are looked up first, in
+// case a renewal notification was missed.
+func ExpireSubscriptions(st *store.Store, check CheckFunc) Job {
+	return Job{
+		Name:     "expire-subscriptions",
+		Interval: 15 * time.Minute,
+		Run: func(ctx context.Context) error {
+			_, err := ExpireDue(ctx, st, check, time.Now())
+			return err
+		},
+	}
+}
+
+// ExpireDue rechecks stale subscriptions and downgrades every user without
+// an entitling one at now. It returns how many users were downgraded.
+func ExpireDue(ctx context.Context, st *store.Store, check CheckFunc, now time.Time) (int, error) {
+	if check != nil {
+		stale, err := st.Subs.Stale(ctx, now, now.Add(-time.Hour), subscriptionBatch)
+		if err != nil {
+			return 0, err
+		}
+		for _, sub := range stale {
+			fresh, err := check(ctx, sub.Platform, sub.ExternalID)
+			if err != nil {
+				log.Printf("Rechecking %s subscription %s: %v", sub.Platform, sub.ID, err)
+				continue
+			}
+			fresh.UserID = sub.UserID
+			if err := st.Subs.Upsert(ctx, fresh); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	downgraded := 0
+	for {
+		ids, err := st.Subs.Lapsed(ctx, now, subscriptionBatch)
+		if err != nil {
+			return downgraded, err
+		}
+		for _, id := range ids {
+			_, err := st.Subs.SyncEntitlement(ctx, id, now)
+			if errors.Is(err, store.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return downgraded, err
+			}
+			downgraded++
+		}
+		if len(ids) < subscriptionBatch {
+			break
+		}
+	}
+	if downgraded > 0 {
+		log.Printf("Downgraded %d users with expired subscriptions", downgraded)
+	}
+	return downgraded, nil
+}
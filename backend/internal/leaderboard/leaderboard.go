@@ -0,0 +1,99 @@
+// Package leaderboard names the boards and time windows that scores are
+// ranked on. Every first attempt at a test counts towards the overall
+// board and its category's board, once for each window. Days, weeks and
+// months are those of Istanbul, like the leagues. There are no friends
+// boards yet: users have no friend list to rank them against.
+package leaderboard
+
+import (
+	"backend/internal/leagues"
+	"backend/internal/models"
+	"time"
+)
+
+// Window is a span of time that scores are summed over.
+type Window string
+
+const (
+	Daily   Window = "daily"
+	Weekly  Window = "weekly"
+	Monthly Window = "monthly"
+	AllTime Window = "all_time"
+)
+
+// Windows lists every window.
+var Windows = []Window{Daily, Weekly, Monthly, AllTime}
+
+// ParseWindow returns the window named s; empty means AllTime.
+func ParseWindow(s string) (Window, bool) {
+	if s == "" {
+		return AllTime, true
+	}
+	for _, w := range Windows {
+		if string(w) == s {
+			return w, true
+		}
+	}
+	return "", false
+}
+
+// Overall is the board of every test.
+const Overall = "all"
+
+// CategoryBoard returns the board of a category.
+func CategoryBoard(slug string) string {
+	return "category:" + slug
+}
+
+// location is the timezone of days, weeks and months.
+var location = mustLoadLocation("Europe/Istanbul")
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// Period returns the period of w that now falls in on board. It expires
+// when the period ends; all-time periods never do.
+func Period(board string, w Window, now time.Time) models.BoardPeriod {
+	p := models.BoardPeriod{Board: board, Window: string(w)}
+	t := now.In(location)
+	y, m, d := t.Date()
+	var end time.Time
+	switch w {
+	case Daily:
+		p.Period = t.Format("2006-01-02")
+		end = time.Date(y, m, d+1, 0, 0, 0, 0, location)
+	case Weekly:
+		start := leagues.WeekStart(now)
+		p.Period = start.Format("2006-01-02")
+		end = start.AddDate(0, 0, 7)
+	case Monthly:
+		p.Period = t.Format("2006-01")
+		end = time.Date(y, m+1, 1, 0, 0, 0, 0, location)
+	default:
+		p.Period = "all"
+		return p
+	}
+	p.ExpiresAt = &end
+	return p
+}
+
+// PeriodsFor returns every period a score earned at now in a test of
+// categorySlug counts towards.
+func PeriodsFor(categorySlug string, now time.Time) []models.BoardPeriod {
+	boards := []string{Overall}
+	if categorySlug != "" {
+		boards = append(boards, CategoryBoard(categorySlug))
+	}
+	var list []models.BoardPeriod
+	for _, b := range boards {
+		for _, w := range Windows {
+			list = append(list, Period(b, w, now))
+		}
+	}
+	return list
+}
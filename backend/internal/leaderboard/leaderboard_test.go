@@ -0,0 +1,48 @@
+package leaderboard_test
+
+import (
+	"backend/internal/leaderboard"
+	"testing"
+	"time"
+)
+
+func TestPeriodsUseIstanbulTime(t *testing.T) {
+	// 22:30 UTC on the last day of October is already November 1st in Istanbul
+	now := time.Date(2026, 10, 31, 22, 30, 0, 0, time.UTC)
+	cases := []struct {
+		window leaderboard.Window
+		period string
+		end    time.Time
+	}{
+		{leaderboard.Daily, "2026-11-01", time.Date(2026, 11, 1, 21, 0, 0, 0, time.UTC)},
+		{leaderboard.Weekly, "2026-10-26", time.Date(2026, 11, 1, 21, 0, 0, 0, time.UTC)},
+		{leaderboard.Monthly, "2026-11", time.Date(2026, 11, 30, 21, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		p := leaderboard.Period(leaderboard.Overall, c.window, now)
+		if p.Period != c.period || p.ExpiresAt == nil || !p.ExpiresAt.Equal(c.end) {
+			t.Errorf("%s period = %s ending %v, want %s ending %v", c.window, p.Period, p.ExpiresAt, c.period, c.end)
+		}
+	}
+	if p := leaderboard.Period(leaderboard.Overall, leaderboard.AllTime, now); p.Period != "all" || p.ExpiresAt != nil {
+		t.Errorf("all-time period = %+v", p)
+	}
+}
+
+func TestPeriodsFor(t *testing.T) {
+	now := time.Now()
+	if got := len(leaderboard.PeriodsFor("tarih", now)); got != 2*len(leaderboard.Windows) {
+		t.Fatalf("a categorized test counts on %d periods, want %d", got, 2*len(leaderboard.Windows))
+	}
+	for _, p := range leaderboard.PeriodsFor("", now) {
+		if p.Board != leaderboard.Overall {
+			t.Fatalf("an uncategorized test counted on %s", p.Board)
+		}
+	}
+	if w, ok := leaderboard.ParseWindow(""); !ok || w != leaderboard.AllTime {
+		t.Fatalf("ParseWindow(\"\") = %s, %v", w, ok)
+	}
+	if _, ok := leaderboard.ParseWindow("yearly"); ok {
+		t.Fatal("ParseWindow accepted an unknown window")
+	}
+}
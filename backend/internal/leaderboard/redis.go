@@ -0,0 +1,197 @@
+package leaderboard
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRankTTL is how long RedisRanks uses a copy of a period before it
+// loads it again.
+const DefaultRankTTL = 10 * time.Minute
+
+// errNoCopy means the period's sorted set isn't loaded, and another
+// instance is loading it or there is nothing to load.
+var errNoCopy = errors.New("leaderboard period not loaded")
+
+// Members are scored with the negated score, so that ZRANK orders them
+// best first and breaks ties by user ID like the store does.
+var rankScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return -1 end
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+return redis.call('ZRANK', KEYS[1], ARGV[2])
+`)
+
+var countScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return -1 end
+return redis.call('ZCARD', KEYS[1])
+`)
+
+// setScript writes a member's score into a loaded set, or removes the
+// member if the score is empty.
+var setScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return 0 end
+if ARGV[1] == '' then return redis.call('ZREM', KEYS[1], ARGV[2]) end
+return redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+`)
+
+// RedisRanks answers Rank and Count of a leaderboard store from Redis
+// sorted sets, one per period, so that they are O(log n) lookups rather
+// than counts over the period's entries. The sets are copies: each is
+// loaded from the store when first needed and again every TTL, and scores
+// are written through as they are added. Opt-outs, merges and deletions
+// reach other users' ranks with the next load. When Redis fails, ranks
+// are counted in the store.
+type RedisRanks struct {
+	store.LeaderboardStore
+	client *redis.Client
+	TTL    time.Duration
+}
+
+// NewRedisRanks wraps st, keeping the sorted sets on the server at url
+// (redis:// or rediss://).
+func NewRedisRanks(st store.LeaderboardStore, url string) (*RedisRanks, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisRanks{LeaderboardStore: st, client: redis.NewClient(opts), TTL: DefaultRankTTL}, nil
+}
+
+// RanksFromEnv returns st as is, or wrapped in RedisRanks when
+// LEADERBOARD_RANKS is "redis", which uses REDIS_URL like the rate limiter.
+func RanksFromEnv(st store.LeaderboardStore) (store.LeaderboardStore, error) {
+	switch kind := os.Getenv("LEADERBOARD_RANKS"); kind {
+	case "", "store":
+		return st, nil
+	case "redis":
+		url := os.Getenv("REDIS_URL")
+		if url == "" {
+			return nil, errors.New("LEADERBOARD_RANKS=redis requires REDIS_URL")
+		}
+		return NewRedisRanks(st, url)
+	default:
+		return nil, fmt.Errorf("unknown LEADERBOARD_RANKS %q", kind)
+	}
+}
+
+func rankKey(p models.BoardPeriod) string {
+	return "lb:" + p.Board + ":" + p.Window + ":" + p.Period
+}
+
+// load makes sure the period's set is in Redis, loading it from the store
+// if it isn't.
+func (r *RedisRanks) load(ctx context.Context, p models.BoardPeriod) error {
+	key := rankKey(p)
+	n, err := r.client.Exists(ctx, key).Result()
+	if err != nil || n == 1 {
+		return err
+	}
+	// One instance loads a period; the others count in the store meanwhile
+	loaded, err := r.client.SetNX(ctx, key+":loading", 1, time.Minute).Result()
+	if err != nil {
+		return err
+	}
+	if !loaded {
+		return errNoCopy
+	}
+	defer r.client.Del(context.WithoutCancel(ctx), key+":loading")
+
+	scores, err := r.LeaderboardStore.Scores(ctx, p)
+	if err != nil {
+		return err
+	}
+	if len(scores) == 0 {
+		return errNoCopy
+	}
+	tmp := key + ":new"
+	pipe := r.client.Pipeline()
+	pipe.Del(ctx, tmp)
+	for start := 0; start < len(scores); start += 1000 {
+		members := []redis.Z{}
+		for _, e := range scores[start:min(start+1000, len(scores))] {
+			members = append(members, redis.Z{Score: float64(-e.Score), Member: e.UserID})
+		}
+		pipe.ZAdd(ctx, tmp, members...)
+	}
+	pipe.Expire(ctx, tmp, r.TTL)
+	pipe.Rename(ctx, tmp, key)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// fallback logs err unless it only means the set isn't loaded yet.
+func fallback(err error) {
+	if !errors.Is(err, errNoCopy) {
+		log.Printf("Leaderboards: ranking in Redis failed, counting in the store: %v", err)
+	}
+}
+
+func (r *RedisRanks) Rank(ctx context.Context, p models.BoardPeriod, userID string) (*models.LeaderboardEntry, error) {
+	around, err := r.LeaderboardStore.Around(ctx, p, userID, 0)
+	if err != nil {
+		return nil, err
+	}
+	e := around[0]
+	err = r.load(ctx, p)
+	if err == nil {
+		// Writing the user's own score first corrects a copy loaded before it
+		var rank int
+		rank, err = rankScript.Run(ctx, r.client, []string{rankKey(p)}, -e.Score, e.UserID).Int()
+		if err == nil && rank < 0 {
+			err = errNoCopy
+		}
+		e.Rank = rank + 1
+	}
+	if err != nil {
+		fallback(err)
+		return r.LeaderboardStore.Rank(ctx, p, userID)
+	}
+	return &e, nil
+}
+
+func (r *RedisRanks) Count(ctx context.Context, p models.BoardPeriod) (int, error) {
+	err := r.load(ctx, p)
+	if err == nil {
+		var n int
+		n, err = countScript.Run(ctx, r.client, []string{rankKey(p)}).Int()
+		if err == nil && n >= 0 {
+			return n, nil
+		}
+		if err == nil {
+			err = errNoCopy
+		}
+	}
+	fallback(err)
+	return r.LeaderboardStore.Count(ctx, p)
+}
+
+func (r *RedisRanks) Add(ctx context.Context, userID string, score int, periods []models.BoardPeriod) error {
+	if err := r.LeaderboardStore.Add(ctx, userID, score, periods); err != nil {
+		return err
+	}
+	// Loaded sets take the new totals; the others are loaded with them.
+	// Hidden users have no entry and are taken out.
+	for _, p := range periods {
+		value := ""
+		around, err := r.LeaderboardStore.Around(ctx, p, userID, 0)
+		if err == nil {
+			value = strconv.Itoa(-around[0].Score)
+		} else if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("Leaderboards: reading %s's score for Redis: %v", userID, err)
+			continue
+		}
+		if err := setScript.Run(ctx, r.client, []string{rankKey(p)}, value, userID).Err(); err != nil {
+			log.Printf("Leaderboards: writing %s's score to Redis: %v", userID, err)
+		}
+	}
+	return nil
+}
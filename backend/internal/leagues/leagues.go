@@ -0,0 +1,134 @@
+// Package leagues holds the rules of the weekly leagues. Users who earn XP
+// in a week are placed in a group of up to GroupSize users of the same tier
+// and similar level. When the week ends the best of each group move up a
+// tier and the worst move down.
+package leagues
+
+import (
+	"time"
+)
+
+// GroupSize is the most users in one league group.
+const GroupSize = 30
+
+// PromoteCount and RelegateCount are how many users of a full group move up
+// and down at the end of the week. Smaller groups move fewer; see Outcomes.
+const (
+	PromoteCount  = 5
+	RelegateCount = 5
+)
+
+// Outcomes of a finished week.
+const (
+	Promoted  = "promoted"
+	Relegated = "relegated"
+	Stayed    = "stayed"
+)
+
+// Tiers are the league tiers from lowest to highest. A user's tier is an
+// index into it.
+var Tiers = []string{"bronze", "silver", "gold", "sapphire", "diamond"}
+
+// TierName returns the name of a tier.
+func TierName(tier int) string {
+	return Tiers[ClampTier(tier)]
+}
+
+// ClampTier keeps tier within Tiers.
+func ClampTier(tier int) int {
+	return max(0, min(tier, len(Tiers)-1))
+}
+
+// levelBands are the lowest level of each band. Users are only grouped with
+// users of the same band, so newcomers don't compete with veterans.
+var levelBands = []int{1, 5, 10, 20, 50}
+
+// LevelBand returns the band of a level.
+func LevelBand(level int) int {
+	band := 0
+	for i, lowest := range levelBands {
+		if level >= lowest {
+			band = i
+		}
+	}
+	return band
+}
+
+// location is where weeks start and end.
+var location = mustLoadLocation("Europe/Istanbul")
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// Week returns the week now falls in, as the date (YYYY-MM-DD) of its
+// Monday in Istanbul.
+func Week(now time.Time) string {
+	return WeekStart(now).Format("2006-01-02")
+}
+
+// WeekStart returns when the week of now started: Monday 00:00 in Istanbul.
+func WeekStart(now time.Time) time.Time {
+	t := now.In(location)
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	y, m, d := t.Date()
+	return time.Date(y, m, d-daysSinceMonday, 0, 0, 0, 0, location)
+}
+
+// WeekEnd returns when week (as returned by Week) ends.
+func WeekEnd(week string) (time.Time, error) {
+	start, err := time.ParseInLocation("2006-01-02", week, location)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return start.AddDate(0, 0, 7), nil
+}
+
+// Zones returns how many users of a group of n in tier move up and down.
+// Full groups move PromoteCount and RelegateCount; smaller ones move about
+// a third each way, rounding in favor of promotion. Nobody leaves the
+// lowest tier downwards or the highest upwards.
+func Zones(tier, n int) (promote, relegate int) {
+	promote = min(PromoteCount, (n+2)/3)
+	relegate = min(RelegateCount, n/3)
+	if tier >= len(Tiers)-1 {
+		promote = 0
+	}
+	if tier <= 0 {
+		relegate = 0
+	}
+	return promote, relegate
+}
+
+// Outcomes decides the outcome for each member of a group in tier, given
+// in final order (most weekly XP first).
+func Outcomes(tier, n int) []string {
+	promote, relegate := Zones(tier, n)
+	list := make([]string, n)
+	for i := range list {
+		switch {
+		case i < promote:
+			list[i] = Promoted
+		case i >= n-relegate:
+			list[i] = Relegated
+		default:
+			list[i] = Stayed
+		}
+	}
+	return list
+}
+
+// NextTier returns the tier after an outcome.
+func NextTier(tier int, outcome string) int {
+	switch outcome {
+	case Promoted:
+		tier++
+	case Relegated:
+		tier--
+	}
+	return ClampTier(tier)
+}
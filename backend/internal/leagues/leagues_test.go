@@ -0,0 +1,65 @@
+package leagues_test
+
+import (
+	"backend/internal/leagues"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWeekUsesIstanbulTime(t *testing.T) {
+	// Sunday 21:30 UTC is already Monday in Istanbul
+	sunday := time.Date(2026, 10, 18, 21, 30, 0, 0, time.UTC)
+	if got := leagues.Week(sunday); got != "2026-10-19" {
+		t.Fatalf("Week = %s, want 2026-10-19", got)
+	}
+	if got := leagues.Week(sunday.Add(-time.Hour)); got != "2026-10-12" {
+		t.Fatalf("Week = %s, want 2026-10-12", got)
+	}
+	end, err := leagues.WeekEnd("2026-10-12")
+	if err != nil || !end.Equal(time.Date(2026, 10, 18, 21, 0, 0, 0, time.UTC)) {
+		t.Fatalf("WeekEnd = %v, %v", end, err)
+	}
+}
+
+func TestOutcomes(t *testing.T) {
+	cases := []struct {
+		tier, n int
+		want    string
+	}{
+		{1, 30, "promoted×5 stayed×20 relegated×5"},
+		{1, 7, "promoted×3 stayed×2 relegated×2"},
+		{1, 1, "promoted×1"},
+		{0, 6, "promoted×2 stayed×4"},
+		{len(leagues.Tiers) - 1, 6, "stayed×4 relegated×2"},
+	}
+	for _, c := range cases {
+		if got := summarize(leagues.Outcomes(c.tier, c.n)); got != c.want {
+			t.Errorf("Outcomes(%d, %d) = %s, want %s", c.tier, c.n, got, c.want)
+		}
+	}
+}
+
+func summarize(outcomes []string) string {
+	s := ""
+	for i := 0; i < len(outcomes); {
+		j := i
+		for j < len(outcomes) && outcomes[j] == outcomes[i] {
+			j++
+		}
+		if s != "" {
+			s += " "
+		}
+		s += fmt.Sprintf("%s×%d", outcomes[i], j-i)
+		i = j
+	}
+	return s
+}
+
+func TestLevelBand(t *testing.T) {
+	for level, want := range map[int]int{1: 0, 4: 0, 5: 1, 19: 2, 20: 3, 120: 4} {
+		if got := leagues.LevelBand(level); got != want {
+			t.Errorf("LevelBand(%d) = %d, want %d", level, got, want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+// Package mail sends the transactional emails the backend needs, such as
+// email verification links.
+package mail
+
+import (
+	"context"
+	"log"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers a message. Implementations must be safe for concurrent use.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogSender writes messages to the server log instead of delivering them.
+// It is the default until a real mail provider is configured.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, msg Message) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
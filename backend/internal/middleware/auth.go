@@ -1,94 +1,46 @@
 package middleware
 
 import (
+	"backend/internal/authtoken"
 	"context"
 	"net/http"
-	"os"
-	"strings"
-	"time"
-
-	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey = []byte(os.Getenv("JWT_SECRET"))
-
-func init() {
-	if len(jwtKey) == 0 {
-		jwtKey = []byte("default_oabt_secret_key_for_dev")
-	}
-}
-
-type Claims struct {
-	UserID string `json:"user_id"`
-	jwt.RegisteredClaims
-}
-
-func GenerateToken(userID string) (string, error) {
-	expirationTime := time.Now().Add(72 * time.Hour)
-	claims := &Claims{
-		UserID: userID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
-}
-
-func GenerateRefreshToken(userID string) (string, error) {
-	expirationTime := time.Now().Add(30 * 24 * time.Hour) // 30 days
-	claims := &Claims{
-		UserID: userID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
-}
-
-func ValidateToken(tokenString string) (*Claims, error) {
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-
-	if err != nil || !token.Valid {
-		return nil, err
-	}
-
-	return claims, nil
-}
-
-func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+func AuthMiddleware(tokens *authtoken.Issuer, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		EnableCors(&w)
 		if r.Method == "OPTIONS" {
 			return
 		}
 
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
+		if r.Header.Get("Authorization") == "" {
 			http.Error(w, "Authorization header required", http.StatusUnauthorized)
 			return
 		}
 
-		bearerToken := strings.Split(authHeader, " ")
-		if len(bearerToken) != 2 {
-			http.Error(w, "Invalid token format", http.StatusUnauthorized)
-			return
-		}
-
-		tokenString := bearerToken[1]
-		claims, err := ValidateToken(tokenString)
-
+		claims, err := tokens.FromRequest(r)
 		if err != nil {
 			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
-		// Add userID to context
-		ctx := context.WithValue(r.Context(), "userID", claims.UserID)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
 	}
 }
+
+// OptionalAuth is AuthMiddleware for endpoints that also serve anonymous
+// users: a valid token adds the user to the context, anything else is ignored.
+func OptionalAuth(tokens *authtoken.Issuer, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if claims, err := tokens.FromRequest(r); err == nil {
+			r = r.WithContext(withClaims(r.Context(), claims))
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// withClaims adds userID and sessionID to the context.
+func withClaims(ctx context.Context, claims *authtoken.Claims) context.Context {
+	ctx = context.WithValue(ctx, "userID", claims.UserID)
+	return context.WithValue(ctx, "sessionID", claims.SessionID)
+}
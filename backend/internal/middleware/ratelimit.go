@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"backend/internal/ratelimit"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// RateLimit applies the named policy of limiter to next. Policies counted
+// by user must sit inside AuthMiddleware or OptionalAuth to see the user.
+// A nil limiter or an unconfigured policy lets every request through, and
+// so does a failing backend: an outage shouldn't take the API down with it.
+func RateLimit(limiter *ratelimit.Limiter, policy string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if limiter == nil || r.Method == "OPTIONS" {
+			next(w, r)
+			return
+		}
+		p, ok := limiter.Policy(policy)
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		subject := "ip:" + limiter.ClientIP(r)
+		if userID, _ := r.Context().Value("userID").(string); p.By == ratelimit.ByUser && userID != "" {
+			subject = "user:" + userID
+		}
+
+		d, err := limiter.Take(r.Context(), p, subject)
+		if err != nil {
+			log.Printf("RateLimit: %s: %v", policy, err)
+			next(w, r)
+			return
+		}
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(p.Burst))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+		if !d.Allowed {
+			EnableCors(&w)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.RetryAfter.Seconds()))))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
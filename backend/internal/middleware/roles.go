@@ -1,13 +1,14 @@
 package middleware
 
 import (
-	"backend/internal/database"
+	"backend/internal/permissions"
+	"backend/internal/store"
 	"context"
 	"net/http"
 )
 
-// RequirePro middleware ensures the user has a 'pro' role or is_premium is true
-func RequirePro(next http.HandlerFunc) http.HandlerFunc {
+// RequirePro middleware ensures the user is premium or has a role with premium.content
+func RequirePro(users store.UserStore, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, ok := r.Context().Value("userID").(string)
 		if !ok || userID == "" {
@@ -15,16 +16,13 @@ func RequirePro(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		var role string
-		var isPremium bool
-
-		err := database.DB.QueryRow("SELECT role, is_premium FROM users WHERE id=$1", userID).Scan(&role, &isPremium)
+		user, err := users.Get(r.Context(), userID)
 		if err != nil {
 			http.Error(w, "User lookup failed", http.StatusInternalServerError)
 			return
 		}
 
-		if role != "pro" && !isPremium && role != "admin" {
+		if !user.IsPremium && !permissions.Has(user.Role, permissions.PremiumContent) {
 			http.Error(w, "Pro subscription required", http.StatusForbidden)
 			return
 		}
@@ -39,7 +37,7 @@ func RequirePro(next http.HandlerFunc) http.HandlerFunc {
 // Since standard middleware signature doesn't allow arguments, we usually wrap the handler logic
 // or use a higher-order function.
 // Here is a higher-order version:
-func RequireTokens(amount int, next http.HandlerFunc) http.HandlerFunc {
+func RequireTokens(users store.UserStore, amount int, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, ok := r.Context().Value("userID").(string)
 		if !ok || userID == "" {
@@ -47,26 +45,25 @@ func RequireTokens(amount int, next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		var tokens int
-		err := database.DB.QueryRow("SELECT tokens FROM users WHERE id=$1", userID).Scan(&tokens)
+		user, err := users.Get(r.Context(), userID)
 		if err != nil {
 			http.Error(w, "User lookup failed", http.StatusInternalServerError)
 			return
 		}
 
-		if tokens < amount {
+		if user.Tokens < amount {
 			http.Error(w, "Insufficient tokens", http.StatusPaymentRequired)
 			return
 		}
 
 		// Pass token balance to context if needed?
-		ctx := context.WithValue(r.Context(), "userTokens", tokens)
+		ctx := context.WithValue(r.Context(), "userTokens", user.Tokens)
 		next(w, r.WithContext(ctx))
 	}
 }
 
-// RequireAdmin middleware ensures the user has 'admin' role
-func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+// RequirePermission middleware ensures the user's role grants perm
+func RequirePermission(users store.UserStore, perm permissions.Permission, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, ok := r.Context().Value("userID").(string)
 		if !ok || userID == "" {
@@ -74,15 +71,14 @@ func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		var role string
-		err := database.DB.QueryRow("SELECT role FROM users WHERE id=$1", userID).Scan(&role)
+		user, err := users.Get(r.Context(), userID)
 		if err != nil {
 			http.Error(w, "User lookup failed", http.StatusInternalServerError)
 			return
 		}
 
-		if role != "admin" {
-			http.Error(w, "Admin access required", http.StatusForbidden)
+		if !permissions.Has(user.Role, perm) {
+			http.Error(w, "Missing permission: "+string(perm), http.StatusForbidden)
 			return
 		}
 
@@ -1,31 +1,65 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type User struct {
 	ID             string `json:"id"`
 	Nickname       string `json:"nickname"`
 	Emoji          string `json:"emoji"`
 	Streak         int    `json:"streak"`
+	StreakFreezes  int    `json:"streak_freezes"`   // held, used up on a missed day
 	LastActiveDate string `json:"last_active_date"` // YYYY-MM-DD
 	TotalScore     int    `json:"total_score"`
 	Level          int    `json:"level"`
-	XP             int    `json:"xp"`
+	XP             int    `json:"xp"`       // into the current level
+	TotalXP        int    `json:"total_xp"` // lifetime; Level and XP follow from it
 	Email          string `json:"email"`
-	GoogleID       string `json:"google_id"`
-	AppleID        string `json:"apple_id"`
 	Provider       string `json:"provider"`
-	Role           string `json:"role"`
-	Tokens         int    `json:"tokens"`
-	IsPremium      bool   `json:"is_premium"`
+	// Providers lists the sign-in providers linked to the account.
+	Providers     []string `json:"providers"`
+	Role          string   `json:"role"`
+	Tokens        int      `json:"tokens"`
+	IsPremium     bool     `json:"is_premium"`
+	SelectedExam  string   `json:"selected_exam"` // exam slug, empty if none chosen
+	EmailVerified bool     `json:"email_verified"`
+	// DeletionScheduledFor is set while the account waits to be purged.
+	DeletionScheduledFor *time.Time `json:"deletion_scheduled_for,omitempty"`
+	// Timezone is an IANA name; daily rewards and streaks count its days.
+	Timezone string `json:"timezone"`
+	// LeagueTier is an index into leagues.Tiers.
+	LeagueTier int `json:"league_tier"`
+	// LeaderboardHidden keeps the user off every leaderboard.
+	LeaderboardHidden bool `json:"leaderboard_hidden"`
+}
+
+// PublicProfile is what other users see of a user.
+type PublicProfile struct {
+	ID         string `json:"id"`
+	Nickname   string `json:"nickname"`
+	Emoji      string `json:"emoji"`
+	Streak     int    `json:"streak"`
+	Level      int    `json:"level"`
+	LeagueTier int    `json:"league_tier"`
+}
+
+// Public returns the user's public profile.
+func (u *User) Public() *PublicProfile {
+	return &PublicProfile{ID: u.ID, Nickname: u.Nickname, Emoji: u.Emoji, Streak: u.Streak, Level: u.Level, LeagueTier: u.LeagueTier}
 }
 
 type Test struct {
-	ID          string `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Category    string `json:"category"`
-	Completed   bool   `json:"completed"`
+	ID               string `json:"id"`
+	Slug             string `json:"slug"`
+	Title            string `json:"title"`
+	Description      string `json:"description"`
+	Category         string `json:"category"`
+	CategorySlug     string `json:"category_slug"`
+	Exam             string `json:"exam"` // exam slug
+	TimeLimitMinutes int    `json:"time_limit_minutes"`
+	Completed        bool   `json:"completed"`
 }
 
 type Question struct {
@@ -44,6 +78,9 @@ type Question struct {
 	Metadata         Metadata `json:"metadata"`
 	ImageURL         *string  `json:"image_url"`
 	RelatedConceptID string   `json:"related_concept_id"`
+	CategoryID       string   `json:"category_id,omitempty"`
+	SubjectID        string   `json:"subject_id,omitempty"`
+	TopicID          string   `json:"topic_id,omitempty"`
 }
 
 type Option struct {
@@ -69,6 +106,25 @@ type TestResult struct {
 	TestID      string    `json:"test_id"`
 	Score       int       `json:"score"`
 	CompletedAt time.Time `json:"completed_at"`
+	TestTitle   string    `json:"test_title,omitempty"`
+}
+
+// TestAttempt is one sitting of a test. Answers are recorded against it
+// as they are given and only graded for the user once it is submitted.
+type TestAttempt struct {
+	ID          string          `json:"id"`
+	UserID      string          `json:"user_id"`
+	TestID      string          `json:"test_id"`
+	StartedAt   time.Time       `json:"started_at"`
+	SubmittedAt *time.Time      `json:"submitted_at,omitempty"`
+	Answers     []AttemptAnswer `json:"answers"`
+}
+
+// AttemptAnswer is the option chosen for one question of an attempt.
+type AttemptAnswer struct {
+	QuestionID string `json:"question_id"`
+	OptionText string `json:"option_text"`
+	Correct    bool   `json:"correct"`
 }
 
 type Subject struct {
@@ -79,3 +135,252 @@ type Subject struct {
 	Content  string   `json:"content"`
 	Related  []string `json:"related"`
 }
+
+type Exam struct {
+	ID    string `json:"id"`
+	Slug  string `json:"slug"`
+	Name  string `json:"name"`
+	Order int    `json:"order"`
+}
+
+// ExamCategory is a category node of an exam's taxonomy tree.
+type ExamCategory struct {
+	ID       string            `json:"id"`
+	Slug     string            `json:"slug"`
+	Name     string            `json:"name"`
+	Icon     string            `json:"icon"`
+	Order    int               `json:"order"`
+	Subjects []TaxonomySubject `json:"subjects"`
+}
+
+type TaxonomySubject struct {
+	ID     string          `json:"id"`
+	Slug   string          `json:"slug"`
+	Name   string          `json:"name"`
+	Topics []TaxonomyTopic `json:"topics"`
+}
+
+type TaxonomyTopic struct {
+	ID   string `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// CategoryProgress is a category with how many of its tests a user has completed.
+type CategoryProgress struct {
+	Category       string `json:"category"`
+	Slug           string `json:"slug"`
+	Icon           string `json:"icon"`
+	Order          int    `json:"order"`
+	Exam           string `json:"exam"`
+	TotalTests     int    `json:"total_tests"`
+	CompletedTests int    `json:"completed_tests"`
+}
+
+type HistoryEntry struct {
+	Title string `json:"title"`
+	Score int    `json:"score"`
+	Date  string `json:"date"` // YYYY-MM-DD HH:MM
+}
+
+type LeaderboardEntry struct {
+	UserID   string `json:"-"`
+	Rank     int    `json:"rank,omitempty"`
+	Nickname string `json:"nickname"`
+	Emoji    string `json:"emoji"`
+	Score    int    `json:"score"`
+	Streak   int    `json:"streak"`
+	Me       bool   `json:"me,omitempty"`
+}
+
+// BoardPeriod identifies one ranking: a board (overall or a category), a
+// time window and the period of that window, e.g. the week of 2026-10-19.
+// ExpiresAt is when the period ends; nil for all-time.
+type BoardPeriod struct {
+	Board     string     `json:"board"`
+	Window    string     `json:"window"`
+	Period    string     `json:"period"`
+	ExpiresAt *time.Time `json:"ends_at,omitempty"`
+}
+
+// Session is a signed-in device. Current is set when listing sessions for
+// the session that made the request.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"-"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// Identity is a sign-in provider account (Google, Apple) linked to a user.
+type Identity struct {
+	Provider string    `json:"provider"`
+	Subject  string    `json:"-"`
+	UserID   string    `json:"-"`
+	Email    string    `json:"email"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+// AuditEntry records one admin action. Before and After hold JSON snapshots
+// of the target and are null when there is nothing to show (e.g. Before on create).
+type AuditEntry struct {
+	ID         string          `json:"id"`
+	ActorID    string          `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// DataExport is a background personal data export. Status is "pending",
+// "ready" or "failed"; the archive itself is fetched separately.
+type DataExport struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"-"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	SizeBytes   int        `json:"size_bytes"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// TokenTransaction is one entry of a user's token ledger. Amount is
+// positive for credits and negative for debits.
+type TokenTransaction struct {
+	ID           string `json:"id"`
+	UserID       string `json:"-"`
+	Amount       int    `json:"amount"`
+	BalanceAfter int    `json:"balance_after"`
+	Reason       string `json:"reason"`
+	Reference    string `json:"reference,omitempty"`
+	// IdempotencyKey makes retries of the same request record one entry.
+	IdempotencyKey string    `json:"-"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// TokenDrift is a user whose cached balance differs from their ledger.
+type TokenDrift struct {
+	UserID   string `json:"user_id"`
+	Nickname string `json:"nickname"`
+	Cached   int    `json:"cached"`
+	Ledger   int    `json:"ledger"`
+	Drift    int    `json:"drift"` // Cached - Ledger
+}
+
+// DailyRewardClaim is one claimed daily login reward.
+type DailyRewardClaim struct {
+	UserID        string    `json:"-"`
+	Day           string    `json:"day"`          // YYYY-MM-DD in the user's timezone
+	CalendarDay   int       `json:"calendar_day"` // 1-7 in the reward cycle
+	Tokens        int       `json:"tokens"`
+	Bonus         int       `json:"bonus"` // streak bonus on top of Tokens
+	TransactionID string    `json:"transaction_id"`
+	ClaimedAt     time.Time `json:"claimed_at"`
+}
+
+// DailyActivity is what a user did on one day in their timezone. Frozen
+// marks a missed day that a streak freeze kept in the streak.
+type DailyActivity struct {
+	UserID string `json:"-"`
+	Day    string `json:"date"` // YYYY-MM-DD
+	Tests  int    `json:"tests"`
+	Score  int    `json:"score"`
+	XP     int    `json:"xp"`
+	Frozen bool   `json:"frozen"`
+}
+
+// UserAchievement is an achievement the user has earned, with the rewards
+// it paid at the time.
+type UserAchievement struct {
+	UserID        string    `json:"-"`
+	AchievementID string    `json:"id"`
+	XP            int       `json:"xp"`
+	Tokens        int       `json:"tokens"`
+	EarnedAt      time.Time `json:"earned_at"`
+}
+
+// AchievementStats are the achievement metrics that are counted from
+// stored data rather than read off the user.
+type AchievementStats struct {
+	TestsCompleted    int // distinct tests
+	PerfectScores     int // distinct tests
+	QuestionsAnswered int // in distinct tests
+}
+
+// LeagueGroup is one group of a week's league.
+type LeagueGroup struct {
+	ID   string `json:"id"`
+	Week string `json:"week"` // Monday, YYYY-MM-DD
+	Tier int    `json:"tier"`
+	Band int    `json:"band"` // see leagues.LevelBand
+}
+
+// LeagueMembership is a user's place in one week's league group. Rank and
+// Outcome are set when the week is closed.
+type LeagueMembership struct {
+	GroupID  string    `json:"group_id"`
+	UserID   string    `json:"-"`
+	Week     string    `json:"week"`
+	Tier     int       `json:"tier"`
+	XP       int       `json:"xp"` // earned in the week
+	Rank     int       `json:"rank,omitempty"`
+	Outcome  string    `json:"outcome,omitempty"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// LeagueStanding is a member of a league group as the other members see them.
+type LeagueStanding struct {
+	UserID   string `json:"-"`
+	Nickname string `json:"nickname"`
+	Emoji    string `json:"emoji"`
+	Level    int    `json:"level"`
+	XP       int    `json:"xp"` // earned in the week
+}
+
+// LeagueResult is a member's final place when a week is closed, and the
+// tier they move to.
+type LeagueResult struct {
+	UserID  string
+	Rank    int
+	Outcome string
+	Tier    int
+}
+
+// Subscription statuses. Only active and grace entitle the user, and only
+// until the subscription (or its grace period) expires.
+const (
+	SubscriptionActive  = "active"
+	SubscriptionGrace   = "grace"   // renewal failed, access continues until GraceExpiresAt
+	SubscriptionOnHold  = "on_hold" // renewal failed and the grace period is over
+	SubscriptionPaused  = "paused"
+	SubscriptionPending = "pending"
+	SubscriptionExpired = "expired"
+	SubscriptionRevoked = "revoked" // refunded or revoked by the store
+)
+
+// Subscription is an App Store or Google Play subscription as last reported
+// by the store.
+type Subscription struct {
+	ID        string `json:"id"`
+	UserID    string `json:"-"`
+	Platform  string `json:"platform"` // apple or google
+	ProductID string `json:"product_id"`
+	// ExternalID is the original transaction ID (Apple) or purchase token (Google).
+	ExternalID     string     `json:"-"`
+	Status         string     `json:"status"`
+	AutoRenew      bool       `json:"auto_renew"`
+	Environment    string     `json:"environment"` // production or sandbox
+	PeriodStart    *time.Time `json:"period_start,omitempty"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	GraceExpiresAt *time.Time `json:"grace_expires_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
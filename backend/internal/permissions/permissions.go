@@ -0,0 +1,63 @@
+// Package permissions maps user roles to what they're allowed to do. Access
+// checks ask for a permission rather than a role, so new roles only need an
+// entry here.
+package permissions
+
+import "slices"
+
+type Permission string
+
+const (
+	QuestionsWrite Permission = "questions.write" // create, edit and delete questions
+	ContentSync    Permission = "content.sync"    // reconcile questions with the content files
+	UsersManage    Permission = "users.manage"    // assign roles
+	ReportsTriage  Permission = "reports.triage"  // review reported questions and users
+	AuditRead      Permission = "audit.read"      // read the admin audit log
+	PremiumContent Permission = "premium.content" // use pro-only features
+	DebugRead      Permission = "debug.read"      // debug endpoints outside development
+	TokensAudit    Permission = "tokens.audit"    // reconcile token balances with the ledger
+)
+
+const (
+	RoleFree      = "free"
+	RolePro       = "pro"
+	RoleEditor    = "editor"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+type Role struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions"`
+}
+
+var roles = []Role{
+	{Name: RoleFree, Description: "Default role for every account", Permissions: []Permission{}},
+	{Name: RolePro, Description: "Paying subscriber", Permissions: []Permission{PremiumContent}},
+	{Name: RoleEditor, Description: "Maintains the question bank", Permissions: []Permission{QuestionsWrite, ContentSync}},
+	{Name: RoleModerator, Description: "Handles user reports", Permissions: []Permission{ReportsTriage, AuditRead}},
+	{Name: RoleAdmin, Description: "Full access", Permissions: []Permission{
+		QuestionsWrite, ContentSync, UsersManage, ReportsTriage, AuditRead, PremiumContent, DebugRead, TokensAudit,
+	}},
+}
+
+// Roles returns every assignable role.
+func Roles() []Role {
+	return slices.Clone(roles)
+}
+
+// Valid reports whether name is a known role.
+func Valid(name string) bool {
+	return slices.ContainsFunc(roles, func(r Role) bool { return r.Name == name })
+}
+
+// Has reports whether the role grants p. Unknown roles grant nothing.
+func Has(role string, p Permission) bool {
+	for _, r := range roles {
+		if r.Name == role {
+			return slices.Contains(r.Permissions, p)
+		}
+	}
+	return false
+}
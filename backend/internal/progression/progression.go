@@ -0,0 +1,266 @@
+// Package progression holds the XP and level rules defined in
+// data/progression.json: how much XP a finished test earns, how much XP
+// each level takes and what reaching a level pays. Users keep their
+// lifetime XP; their level and the XP into it follow from the curve.
+package progression
+
+import (
+	"backend/internal/models"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Path is where the rules live, relative to the working directory.
+const Path = "data/progression.json"
+
+// Curve is how much XP each level takes: Base for the first and Growth
+// times the one before for every level after, up to Max.
+type Curve struct {
+	Base   int     `json:"base"`
+	Growth float64 `json:"growth"`
+	Max    int     `json:"max"` // 0 for no cap
+}
+
+// ToNext returns the XP it takes to go from level to the next.
+func (c Curve) ToNext(level int) int {
+	n := int(math.Round(float64(c.Base) * math.Pow(c.Growth, float64(max(level, 1)-1))))
+	if c.Max > 0 && n > c.Max {
+		return c.Max
+	}
+	return n
+}
+
+// Level returns the level of a user with total lifetime XP and the XP
+// they have into it.
+func (c Curve) Level(total int) (level, xp int) {
+	level, xp = 1, max(total, 0)
+	for xp >= c.ToNext(level) {
+		xp -= c.ToNext(level)
+		level++
+	}
+	return level, xp
+}
+
+// Total returns the lifetime XP of a user at level with xp into it.
+func (c Curve) Total(level, xp int) int {
+	total := xp
+	for l := 1; l < level; l++ {
+		total += c.ToNext(l)
+	}
+	return total
+}
+
+// AccuracyBonus pays XP for finishing a test with at least Min of the
+// points, e.g. 0.8 for 80%.
+type AccuracyBonus struct {
+	Min float64 `json:"min"`
+	XP  int     `json:"xp"`
+}
+
+// DailyGoal pays XP once a day, for the Tests-th test of the day.
+type DailyGoal struct {
+	Tests int `json:"tests"`
+	XP    int `json:"xp"`
+}
+
+// Sources are the ways to earn XP by finishing tests. A test earns PerTest
+// plus PerPoint for each point scored, times the test's difficulty
+// multiplier, then the best accuracy bonus it reaches on top.
+type Sources struct {
+	PerTest  int             `json:"per_test"`
+	PerPoint int             `json:"per_point"`
+	Accuracy []AccuracyBonus `json:"accuracy_bonus"`
+	// Difficulty maps the first word of a question's difficulty, in lower
+	// case, to a multiplier ("Zor Beceri" -> "zor"). Others count as 1.
+	Difficulty map[string]float64 `json:"difficulty_multipliers"`
+	DailyGoal  DailyGoal          `json:"daily_goal"`
+}
+
+// LevelReward is paid once, when the user first reaches Level.
+type LevelReward struct {
+	Level  int    `json:"level"`
+	Tokens int    `json:"tokens"`
+	Badge  string `json:"badge,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// Transaction returns the ledger entry that pays r's tokens. Its
+// idempotency key makes each level pay once, however often it's reached.
+func (r LevelReward) Transaction(userID string) *models.TokenTransaction {
+	level := strconv.Itoa(r.Level)
+	return &models.TokenTransaction{UserID: userID, Amount: r.Tokens, Reason: "level_reward", Reference: level,
+		IdempotencyKey: "level:" + level}
+}
+
+// Achievement returns the record of r's badge, or nil if it has none. Like
+// the tokens it is keyed by the level, so each badge is earned once and
+// can't clash with an achievement of the catalog.
+func (r LevelReward) Achievement(userID string) *models.UserAchievement {
+	if r.Badge == "" {
+		return nil
+	}
+	return &models.UserAchievement{UserID: userID, AchievementID: "level:" + strconv.Itoa(r.Level)}
+}
+
+// Config is the validated set of rules.
+type Config struct {
+	Version int           `json:"version"`
+	Curve   Curve         `json:"curve"`
+	XP      Sources       `json:"xp"`
+	Rewards []LevelReward `json:"level_rewards"`
+}
+
+// Flat returns the rules from before this package: a test earns its score
+// as XP and every level takes perLevel XP. Nothing else pays.
+func Flat(perLevel int) *Config {
+	return &Config{Version: 1, Curve: Curve{Base: perLevel, Growth: 1}, XP: Sources{PerPoint: 1}}
+}
+
+var badgePattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Load reads and validates the rules at path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &c, nil
+}
+
+func (c *Config) validate() error {
+	switch {
+	case c.Curve.Base < 1:
+		return fmt.Errorf("curve: base must be positive")
+	case c.Curve.Growth < 1:
+		return fmt.Errorf("curve: growth must be at least 1")
+	case c.Curve.Max < 0:
+		return fmt.Errorf("curve: max can't be negative")
+	case c.XP.PerTest < 0 || c.XP.PerPoint < 0 || c.XP.DailyGoal.Tests < 0 || c.XP.DailyGoal.XP < 0:
+		return fmt.Errorf("xp: amounts can't be negative")
+	}
+	for _, b := range c.XP.Accuracy {
+		if b.Min <= 0 || b.Min > 1 || b.XP < 0 {
+			return fmt.Errorf("xp: accuracy bonus needs a min in (0, 1] and XP of at least 0")
+		}
+	}
+	for name, m := range c.XP.Difficulty {
+		if m <= 0 || name != strings.ToLower(name) {
+			return fmt.Errorf("xp: difficulty %q needs a lowercase name and a positive multiplier", name)
+		}
+	}
+	// Best bonus first, so that TestXP can stop at the first one reached
+	sort.Slice(c.XP.Accuracy, func(i, j int) bool { return c.XP.Accuracy[i].Min > c.XP.Accuracy[j].Min })
+
+	seen := map[int]bool{}
+	for _, r := range c.Rewards {
+		switch {
+		case r.Level < 2:
+			return fmt.Errorf("level reward %d: level must be at least 2", r.Level)
+		case seen[r.Level]:
+			return fmt.Errorf("level reward %d: duplicate level", r.Level)
+		case r.Tokens < 0:
+			return fmt.Errorf("level reward %d: tokens can't be negative", r.Level)
+		case r.Badge != "" && !badgePattern.MatchString(r.Badge):
+			return fmt.Errorf("level reward %d: badge must be a lowercase slug", r.Level)
+		}
+		seen[r.Level] = true
+	}
+	sort.Slice(c.Rewards, func(i, j int) bool { return c.Rewards[i].Level < c.Rewards[j].Level })
+	return nil
+}
+
+// Multiplier returns the difficulty multiplier of a test: the mean of its
+// questions' multipliers, or 1 without questions.
+func (c *Config) Multiplier(difficulties []string) float64 {
+	if len(difficulties) == 0 {
+		return 1
+	}
+	sum := 0.0
+	for _, d := range difficulties {
+		m, ok := 1.0, false
+		if words := strings.Fields(d); len(words) > 0 {
+			m, ok = c.XP.Difficulty[strings.ToLower(words[0])]
+		}
+		if !ok {
+			m = 1
+		}
+		sum += m
+	}
+	return sum / float64(len(difficulties))
+}
+
+// ForTest returns the Result of finishing the test made of questions, with
+// MaxScore and Multiplier filled in; pointsPerQuestion is what a correct
+// answer scores.
+func (c *Config) ForTest(questions []models.Question, pointsPerQuestion int) Result {
+	difficulties := make([]string, len(questions))
+	for i, q := range questions {
+		difficulties[i] = q.Difficulty
+	}
+	return Result{MaxScore: len(questions) * pointsPerQuestion, Multiplier: c.Multiplier(difficulties)}
+}
+
+// Result is a finished test as far as XP is concerned.
+type Result struct {
+	Score      int
+	MaxScore   int     // 0 if unknown, which earns no accuracy bonus
+	Multiplier float64 // see Multiplier
+	// TestsToday counts this test among the user's tests of the day.
+	TestsToday int
+}
+
+// Breakdown is the XP a test earned, by source.
+type Breakdown struct {
+	Test      int `json:"test"`
+	Accuracy  int `json:"accuracy_bonus"`
+	DailyGoal int `json:"daily_goal"`
+	Total     int `json:"total"`
+}
+
+// TestXP returns the XP r earns.
+func (c *Config) TestXP(r Result) Breakdown {
+	m := r.Multiplier
+	if m <= 0 {
+		m = 1
+	}
+	b := Breakdown{Test: int(math.Round(float64(c.XP.PerTest+c.XP.PerPoint*max(r.Score, 0)) * m))}
+	if r.MaxScore > 0 {
+		accuracy := float64(r.Score) / float64(r.MaxScore)
+		for _, bonus := range c.XP.Accuracy {
+			if accuracy >= bonus.Min {
+				b.Accuracy = bonus.XP
+				break
+			}
+		}
+	}
+	if goal := c.XP.DailyGoal; goal.Tests > 0 && r.TestsToday == goal.Tests {
+		b.DailyGoal = goal.XP
+	}
+	b.Total = b.Test + b.Accuracy + b.DailyGoal
+	return b
+}
+
+// RewardsBetween returns the rewards of the levels after from up to and
+// including to, lowest first.
+func (c *Config) RewardsBetween(from, to int) []LevelReward {
+	var list []LevelReward
+	for _, r := range c.Rewards {
+		if r.Level > from && r.Level <= to {
+			list = append(list, r)
+		}
+	}
+	return list
+}
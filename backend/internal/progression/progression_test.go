@@ -0,0 +1,125 @@
+package progression_test
+
+import (
+	"backend/internal/models"
+	"backend/internal/progression"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The bundled rules are loaded at startup, so a broken file must fail here first.
+func TestBundledRules(t *testing.T) {
+	c, err := progression.Load("../../" + progression.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Curve.ToNext(1) <= 0 || len(c.Rewards) == 0 {
+		t.Fatalf("unexpected rules: %+v", c)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	cases := map[string]string{
+		"no base":        `{"curve": {"base": 0, "growth": 1}}`,
+		"shrinking":      `{"curve": {"base": 100, "growth": 0.9}}`,
+		"negative xp":    `{"curve": {"base": 100, "growth": 1}, "xp": {"per_test": -1}}`,
+		"bad accuracy":   `{"curve": {"base": 100, "growth": 1}, "xp": {"accuracy_bonus": [{"min": 1.5, "xp": 10}]}}`,
+		"bad difficulty": `{"curve": {"base": 100, "growth": 1}, "xp": {"difficulty_multipliers": {"Zor": 2}}}`,
+		"level one":      `{"curve": {"base": 100, "growth": 1}, "level_rewards": [{"level": 1, "tokens": 5}]}`,
+		"duplicate":      `{"curve": {"base": 100, "growth": 1}, "level_rewards": [{"level": 2}, {"level": 2}]}`,
+		"bad badge":      `{"curve": {"base": 100, "growth": 1}, "level_rewards": [{"level": 2, "badge": "Level 2"}]}`,
+	}
+	dir := t.TempDir()
+	for name, rules := range cases {
+		path := filepath.Join(dir, "progression.json")
+		if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := progression.Load(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCurve(t *testing.T) {
+	c := progression.Curve{Base: 100, Growth: 1.5, Max: 300}
+	for level, want := range map[int]int{1: 100, 2: 150, 3: 225, 4: 300, 10: 300} {
+		if got := c.ToNext(level); got != want {
+			t.Errorf("ToNext(%d) = %d, want %d", level, got, want)
+		}
+	}
+	if level, xp := c.Level(0); level != 1 || xp != 0 {
+		t.Errorf("Level(0) = %d, %d", level, xp)
+	}
+	// 100 + 150 + 225 reaches level 4 with 5 to spare
+	if level, xp := c.Level(480); level != 4 || xp != 5 {
+		t.Errorf("Level(480) = %d, %d", level, xp)
+	}
+	if total := c.Total(4, 5); total != 480 {
+		t.Errorf("Total(4, 5) = %d", total)
+	}
+
+	// The old rules: every level takes 100 XP
+	flat := progression.Flat(100).Curve
+	if level, xp := flat.Level(5950); level != 60 || xp != 50 {
+		t.Errorf("flat Level(5950) = %d, %d", level, xp)
+	}
+}
+
+func TestTestXP(t *testing.T) {
+	c := &progression.Config{Curve: progression.Curve{Base: 100, Growth: 1}, XP: progression.Sources{
+		PerTest:    10,
+		PerPoint:   1,
+		Accuracy:   []progression.AccuracyBonus{{Min: 1, XP: 25}, {Min: 0.8, XP: 10}},
+		Difficulty: map[string]float64{"zor": 1.5},
+		DailyGoal:  progression.DailyGoal{Tests: 3, XP: 30},
+	}}
+	hard := []models.Question{{Difficulty: "Zor Beceri"}, {Difficulty: "zor"}, {Difficulty: "Kolay"}, {Difficulty: ""}}
+
+	r := c.ForTest(hard, 2)
+	if r.MaxScore != 8 || r.Multiplier != 1.25 {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+	// (10 + 7) * 1.25 rounds to 21, and 7 of 8 points reaches 80%
+	r.Score, r.TestsToday = 7, 2
+	if got := c.TestXP(r); got != (progression.Breakdown{Test: 21, Accuracy: 10, Total: 31}) {
+		t.Errorf("unexpected breakdown: %+v", got)
+	}
+	// A perfect score takes the best bonus only, and the third test of the day the daily goal
+	r.Score, r.TestsToday = 8, 3
+	if got := c.TestXP(r); got != (progression.Breakdown{Test: 23, Accuracy: 25, DailyGoal: 30, Total: 78}) {
+		t.Errorf("unexpected breakdown: %+v", got)
+	}
+	// The goal pays once a day
+	r.TestsToday = 4
+	if got := c.TestXP(r); got.DailyGoal != 0 {
+		t.Errorf("daily goal paid again: %+v", got)
+	}
+
+	flat := progression.Flat(100)
+	if got := flat.TestXP(progression.Result{Score: 70, MaxScore: 70, TestsToday: 3}); got.Total != 70 {
+		t.Errorf("flat rules should pay the score: %+v", got)
+	}
+}
+
+func TestRewardsBetween(t *testing.T) {
+	c := &progression.Config{Rewards: []progression.LevelReward{{Level: 2}, {Level: 5}, {Level: 10}}}
+	got := c.RewardsBetween(2, 10)
+	if len(got) != 2 || got[0].Level != 5 || got[1].Level != 10 {
+		t.Errorf("unexpected rewards: %+v", got)
+	}
+	if got := c.RewardsBetween(3, 4); len(got) != 0 {
+		t.Errorf("unexpected rewards: %+v", got)
+	}
+	tx := progression.LevelReward{Level: 5, Tokens: 25}.Transaction("u1")
+	if tx.Amount != 25 || tx.IdempotencyKey != "level:5" {
+		t.Errorf("unexpected transaction: %+v", tx)
+	}
+	if a := (progression.LevelReward{Level: 5, Badge: "level-5"}).Achievement("u1"); a == nil || a.AchievementID != "level:5" {
+		t.Errorf("unexpected badge: %+v", a)
+	}
+	if a := (progression.LevelReward{Level: 2}).Achievement("u1"); a != nil {
+		t.Errorf("a level without a badge earned one: %+v", a)
+	}
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const sweepEvery = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // when the bucket will be full again
+}
+
+// Memory keeps buckets in process. Limits are per instance.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}}
+}
+
+func (m *Memory) Take(ctx context.Context, key string, p Policy, now time.Time) (Decision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) > sweepEvery {
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(p.Burst), last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = refill(p, b.tokens, b.last, now)
+	if now.After(b.last) {
+		b.last = now
+	}
+
+	d, left := take(p, b.tokens)
+	b.tokens = left
+	b.full = now.Add(time.Duration((float64(p.Burst) - left) * float64(p.interval())))
+	return d, nil
+}
+
+// sweep drops buckets that have refilled completely; a fresh bucket is the
+// same. Callers hold the lock.
+func (m *Memory) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
@@ -0,0 +1,219 @@
+// Package ratelimit implements token bucket rate limiting with named
+// per-route policies. Buckets live in a Backend: in memory for a single
+// instance, or in Redis when several instances must share limits.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// By selects what a policy counts requests against.
+type By string
+
+const (
+	ByIP   By = "ip"
+	ByUser By = "user" // falls back to the IP for anonymous requests
+)
+
+// Policy allows Rate requests per Per on average, with bursts of up to
+// Burst requests.
+type Policy struct {
+	Name  string
+	Rate  int
+	Per   time.Duration
+	Burst int
+	By    By
+}
+
+// interval is the time it takes to refill one token.
+func (p Policy) interval() time.Duration {
+	return p.Per / time.Duration(p.Rate)
+}
+
+// Decision is the outcome of taking a token.
+type Decision struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long until a token is available when not allowed.
+	RetryAfter time.Duration
+}
+
+// Backend stores the buckets.
+type Backend interface {
+	// Take removes a token from the bucket at key if one is available.
+	Take(ctx context.Context, key string, p Policy, now time.Time) (Decision, error)
+}
+
+// DefaultPolicies are applied by routes.RegisterRoutes. Override them with
+// RATE_LIMIT_POLICIES.
+func DefaultPolicies() map[string]Policy {
+	list := []Policy{
+		// Registration also answers whether a nickname is taken
+		{Name: "register", Rate: 10, Per: time.Hour, Burst: 5, By: ByIP},
+		{Name: "login", Rate: 10, Per: time.Minute, Burst: 10, By: ByIP},
+		{Name: "refresh", Rate: 30, Per: time.Minute, Burst: 30, By: ByIP},
+		// Each social sign-in takes one nonce, so this matches "login"
+		{Name: "nonce", Rate: 10, Per: time.Minute, Burst: 10, By: ByIP},
+		{Name: "reward", Rate: 20, Per: time.Hour, Burst: 5, By: ByUser},
+		{Name: "submit", Rate: 60, Per: time.Hour, Burst: 10, By: ByUser},
+		// Starting attempts and answering their questions
+		{Name: "answer", Rate: 1200, Per: time.Hour, Burst: 60, By: ByUser},
+		{Name: "export", Rate: 5, Per: time.Hour, Burst: 2, By: ByUser},
+		// Endpoints that send email
+		{Name: "email", Rate: 5, Per: time.Hour, Burst: 3, By: ByUser},
+	}
+	policies := map[string]Policy{}
+	for _, p := range list {
+		policies[p.Name] = p
+	}
+	return policies
+}
+
+// Limiter applies named policies on top of a Backend.
+type Limiter struct {
+	backend  Backend
+	policies map[string]Policy
+	// TrustProxy makes ClientIP use the last X-Forwarded-For entry, which
+	// is only safe behind a proxy that sets it.
+	TrustProxy bool
+	now        func() time.Time
+}
+
+func New(backend Backend, policies map[string]Policy) *Limiter {
+	return &Limiter{backend: backend, policies: policies, now: time.Now}
+}
+
+// Policy returns the named policy; ok is false when it is not configured,
+// in which case requests are not limited.
+func (l *Limiter) Policy(name string) (p Policy, ok bool) {
+	p, ok = l.policies[name]
+	return p, ok
+}
+
+// Take counts one request of subject (an IP or user ID) against the policy.
+func (l *Limiter) Take(ctx context.Context, p Policy, subject string) (Decision, error) {
+	return l.backend.Take(ctx, "rl:"+p.Name+":"+subject, p, l.now())
+}
+
+// FromEnv builds the limiter from:
+//
+//	RATE_LIMIT_BACKEND   "memory" (default) or "redis"
+//	REDIS_URL            redis://[:password@]host:port/db, for the redis backend
+//	RATE_LIMIT_POLICIES  overrides, e.g. "register=5/1h:3,reward=off"
+//	TRUST_PROXY_HEADERS  "true" when running behind a reverse proxy
+func FromEnv() (*Limiter, error) {
+	policies, err := ParsePolicies(os.Getenv("RATE_LIMIT_POLICIES"), DefaultPolicies())
+	if err != nil {
+		return nil, err
+	}
+
+	var backend Backend
+	switch kind := os.Getenv("RATE_LIMIT_BACKEND"); kind {
+	case "", "memory":
+		backend = NewMemory()
+	case "redis":
+		url := os.Getenv("REDIS_URL")
+		if url == "" {
+			return nil, errors.New("RATE_LIMIT_BACKEND=redis requires REDIS_URL")
+		}
+		if backend, err = NewRedis(url); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown RATE_LIMIT_BACKEND %q", kind)
+	}
+
+	l := New(backend, policies)
+	l.TrustProxy = os.Getenv("TRUST_PROXY_HEADERS") == "true"
+	return l, nil
+}
+
+// ParsePolicies applies a comma separated list of overrides to defaults.
+// Each entry is "name=rate/period[:burst]" or "name=off"; the burst
+// defaults to the rate. Overrides of unknown names add a policy counted by
+// user.
+func ParsePolicies(spec string, defaults map[string]Policy) (map[string]Policy, error) {
+	policies := map[string]Policy{}
+	for name, p := range defaults {
+		policies[name] = p
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("rate limit policy %q: want name=rate/period", entry)
+		}
+		if value == "off" {
+			delete(policies, name)
+			continue
+		}
+		rate, rest, _ := strings.Cut(value, "/")
+		period, burst, hasBurst := strings.Cut(rest, ":")
+
+		p, ok := policies[name]
+		if !ok {
+			p = Policy{Name: name, By: ByUser}
+		}
+		var err error
+		if p.Rate, err = strconv.Atoi(rate); err != nil || p.Rate <= 0 {
+			return nil, fmt.Errorf("rate limit policy %q: invalid rate", entry)
+		}
+		if p.Per, err = time.ParseDuration(period); err != nil || p.Per <= 0 {
+			return nil, fmt.Errorf("rate limit policy %q: invalid period", entry)
+		}
+		p.Burst = p.Rate
+		if hasBurst {
+			if p.Burst, err = strconv.Atoi(burst); err != nil || p.Burst <= 0 {
+				return nil, fmt.Errorf("rate limit policy %q: invalid burst", entry)
+			}
+		}
+		policies[name] = p
+	}
+	return policies, nil
+}
+
+// refill returns the tokens in a bucket that had tokens at last, capped at
+// the burst.
+func refill(p Policy, tokens float64, last, now time.Time) float64 {
+	if elapsed := now.Sub(last); elapsed > 0 {
+		tokens += float64(elapsed) / float64(p.interval())
+	}
+	return math.Min(tokens, float64(p.Burst))
+}
+
+// take decides on a bucket holding tokens and returns what is left.
+func take(p Policy, tokens float64) (Decision, float64) {
+	if tokens >= 1 {
+		tokens--
+		return Decision{Allowed: true, Remaining: int(tokens)}, tokens
+	}
+	wait := time.Duration(math.Ceil((1 - tokens) * float64(p.interval())))
+	return Decision{RetryAfter: wait}, tokens
+}
+
+// ClientIP returns the address requests from r are counted against.
+func (l *Limiter) ClientIP(r *http.Request) string {
+	if l.TrustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			parts := strings.Split(fwd, ",")
+			return strings.TrimSpace(parts[len(parts)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryTokenBucket(t *testing.T) {
+	m := NewMemory()
+	p := Policy{Name: "t", Rate: 6, Per: time.Minute, Burst: 3} // a token every 10s
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 2; i >= 0; i-- {
+		d, _ := m.Take(ctx, "k", p, now)
+		if !d.Allowed || d.Remaining != i {
+			t.Fatalf("burst request: %+v, want remaining %d", d, i)
+		}
+	}
+	d, _ := m.Take(ctx, "k", p, now.Add(4*time.Second))
+	if d.Allowed || d.RetryAfter != 6*time.Second {
+		t.Fatalf("over the limit: %+v", d)
+	}
+	if d, _ := m.Take(ctx, "other", p, now); !d.Allowed {
+		t.Fatal("keys should have separate buckets")
+	}
+	if d, _ := m.Take(ctx, "k", p, now.Add(10*time.Second)); !d.Allowed || d.Remaining != 0 {
+		t.Fatalf("a token should have refilled: %+v", d)
+	}
+
+	// A long pause refills up to the burst only
+	if d, _ := m.Take(ctx, "k", p, now.Add(time.Hour)); !d.Allowed || d.Remaining != 2 {
+		t.Fatalf("refill not capped at burst: %+v", d)
+	}
+}
+
+func TestMemorySweepsFullBuckets(t *testing.T) {
+	m := NewMemory()
+	p := Policy{Name: "t", Rate: 1, Per: time.Second, Burst: 1}
+	now := time.Now()
+	m.Take(context.Background(), "k", p, now)
+	m.Take(context.Background(), "fresh", p, now.Add(2*sweepEvery))
+	if _, ok := m.buckets["k"]; ok || len(m.buckets) != 1 {
+		t.Fatalf("idle bucket not swept: %v", m.buckets)
+	}
+}
+
+func TestParsePolicies(t *testing.T) {
+	policies, err := ParsePolicies("register=3/1h, reward=off, quiz=10/1m:20", DefaultPolicies())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := policies["register"]; p.Rate != 3 || p.Per != time.Hour || p.Burst != 3 || p.By != ByIP {
+		t.Fatalf("register override: %+v", p)
+	}
+	if _, ok := policies["reward"]; ok {
+		t.Fatal("reward should be disabled")
+	}
+	if p := policies["quiz"]; p.Rate != 10 || p.Burst != 20 || p.By != ByUser {
+		t.Fatalf("new policy: %+v", p)
+	}
+	if _, ok := policies["login"]; !ok {
+		t.Fatal("defaults should be kept")
+	}
+
+	for _, bad := range []string{"register", "register=0/1h", "register=5/soon", "register=5/1h:x"} {
+		if _, err := ParsePolicies(bad, DefaultPolicies()); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
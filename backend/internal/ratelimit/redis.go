@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript is the token bucket of Memory.Take run atomically in Redis.
+// KEYS[1] is the bucket; ARGV holds the burst, the refill interval in
+// milliseconds and the current time in milliseconds. It returns
+// {allowed, remaining, retry after in ms}.
+var takeScript = redis.NewScript(`
+local burst = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(state[1]) or burst
+local last = tonumber(state[2]) or now
+if now > last then
+	tokens = math.min(burst, tokens + (now - last) / interval)
+	last = now
+end
+local allowed, retry = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) * interval)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', last)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) * interval) + 1000)
+return {allowed, math.floor(tokens), retry}
+`)
+
+// Redis keeps buckets in Redis (or a compatible server such as Valkey or
+// KeyDB) so that every instance shares the same limits.
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis connects to the server at url (redis:// or rediss://).
+func NewRedis(url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return &Redis{client: redis.NewClient(opts)}, nil
+}
+
+func (r *Redis) Take(ctx context.Context, key string, p Policy, now time.Time) (Decision, error) {
+	res, err := takeScript.Run(ctx, r.client, []string{key},
+		p.Burst, p.interval().Milliseconds(), now.UnixMilli()).Int64Slice()
+	if err != nil {
+		return Decision{}, err
+	}
+	return Decision{
+		Allowed:    res[0] == 1,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,45 @@
+// Package rewards holds the rules of the daily login reward: a 7-day
+// calendar that escalates while the user claims on consecutive days and a
+// bonus for long practice streaks.
+package rewards
+
+import (
+	"backend/internal/days"
+	"slices"
+)
+
+// calendar is the reward for each day of the cycle. After day 7 the cycle
+// starts over; missing a day starts it over at day 1.
+var calendar = []int{10, 15, 20, 25, 30, 40, 60}
+
+// Calendar returns the tokens for days 1 to 7.
+func Calendar() []int {
+	return slices.Clone(calendar)
+}
+
+// Tokens returns the reward for a day of the cycle.
+func Tokens(calendarDay int) int {
+	return calendar[calendarDay-1]
+}
+
+// StreakBonus is paid on top of the calendar reward for users who keep
+// practicing: 5 tokens from a 7-day streak, 10 from a 30-day streak.
+func StreakBonus(streak int) int {
+	switch {
+	case streak >= 30:
+		return 10
+	case streak >= 7:
+		return 5
+	}
+	return 0
+}
+
+// NextDay returns the calendar day of a claim made on day, given the
+// previous claim's day and calendar day (empty and 0 if there was none).
+// Days are YYYY-MM-DD.
+func NextDay(lastDay string, lastCalendarDay int, day string) int {
+	if lastDay != "" && lastDay == days.Add(day, -1) {
+		return lastCalendarDay%len(calendar) + 1
+	}
+	return 1
+}
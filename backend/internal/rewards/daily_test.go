@@ -0,0 +1,26 @@
+package rewards_test
+
+import (
+	"backend/internal/rewards"
+	"testing"
+)
+
+func TestNextDay(t *testing.T) {
+	cases := []struct {
+		lastDay string
+		lastCal int
+		day     string
+		want    int
+	}{
+		{"", 0, "2026-03-10", 1},
+		{"2026-03-09", 1, "2026-03-10", 2},
+		{"2026-03-09", 7, "2026-03-10", 1},
+		{"2026-03-08", 4, "2026-03-10", 1},
+		{"2026-02-28", 3, "2026-03-01", 4},
+	}
+	for _, c := range cases {
+		if got := rewards.NextDay(c.lastDay, c.lastCal, c.day); got != c.want {
+			t.Errorf("NextDay(%q, %d, %q) = %d, want %d", c.lastDay, c.lastCal, c.day, got, c.want)
+		}
+	}
+}
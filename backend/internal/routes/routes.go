@@ -1,15 +1,16 @@
 package routes
 
 import (
-	"backend/internal/database"
+	"backend/internal/appenv"
 	"backend/internal/handlers"
 	"backend/internal/middleware"
+	"backend/internal/permissions"
 	"encoding/json"
 	"fmt"
 	"net/http"
 )
 
-func RegisterRoutes() *http.ServeMux {
+func RegisterRoutes(srv *handlers.Server) *http.ServeMux {
 	mux := http.NewServeMux()
 
 	// CORS and Logging Middleware
@@ -24,79 +25,135 @@ func RegisterRoutes() *http.ServeMux {
 			h(w, r)
 		}
 	}
+	// limit applies a rate limit policy; see ratelimit.DefaultPolicies
+	limit := func(policy string, h http.HandlerFunc) http.HandlerFunc {
+		return middleware.RateLimit(srv.Limiter, policy, h)
+	}
 
 	mux.HandleFunc("/", wrap(func(w http.ResponseWriter, r *http.Request) {
-		var testCount, questionCount int
-		database.DB.QueryRow("SELECT COUNT(*) FROM tests").Scan(&testCount)
-		database.DB.QueryRow("SELECT COUNT(*) FROM questions").Scan(&questionCount)
-		fmt.Fprintf(w, "OABT Backend Running (UUID v7)\nDatabase Stats:\n- Total Tests: %d\n- Total Questions: %d\n\nTo perform a fresh sync, visit /api/v1/debug/sync-public?clean=true", testCount, questionCount)
+		// "/" also matches every unregistered path, such as debug routes that
+		// aren't mounted in this environment
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		testCount, _ := srv.Store.Tests.Count(r.Context())
+		questionCount, _ := srv.Store.Questions.Count(r.Context())
+		fmt.Fprintf(w, "OABT Backend Running (UUID v7)\nDatabase Stats:\n- Total Tests: %d\n- Total Questions: %d\n", testCount, questionCount)
+		if srv.Env == appenv.Development {
+			fmt.Fprint(w, "\nTo preview a content sync, POST to /api/v1/debug/sync-public?dry_run=true")
+		}
 	}))
 
-	mux.HandleFunc("/register", wrap(handlers.RegisterHandler))
-	mux.HandleFunc("/auth/social-login", wrap(handlers.SocialLoginHandler))
-	mux.HandleFunc("/auth/refresh", wrap(handlers.RefreshTokenHandler))
-	mux.HandleFunc("/user/", wrap(handlers.GetUserHandler))
-	mux.HandleFunc("/user/update", wrap(middleware.AuthMiddleware(handlers.UpdateUserHandler)))
-	mux.HandleFunc("/user/history/", wrap(handlers.GetHistoryHandler))
-	mux.HandleFunc("/tests", wrap(handlers.GetTestsHandler))
-	mux.HandleFunc("/tests/categories", wrap(handlers.GetCategoriesHandler))
-	mux.HandleFunc("/test/", wrap(handlers.GetTestQuestionsHandler))
-	mux.HandleFunc("/submit-test", wrap(handlers.SubmitTestHandler))
-	mux.HandleFunc("/leaderboard", wrap(handlers.GetLeaderboardHandler))
-	mux.HandleFunc("/subjects", wrap(handlers.GetSubjectsHandler))
-	mux.HandleFunc("/questions", wrap(handlers.GetQuestionsHandler))
-	mux.HandleFunc("/api/v1/user/reward", wrap(middleware.AuthMiddleware(handlers.RewardHandler)))
-	mux.HandleFunc("/api/v1/user/spend-tokens", wrap(middleware.AuthMiddleware(handlers.SpendTokensHandler)))
-	mux.HandleFunc("/api/v1/user/delete", wrap(middleware.AuthMiddleware(handlers.DeleteUserHandler)))
+	mux.HandleFunc("/register", wrap(limit("register", srv.RegisterHandler)))
+	mux.HandleFunc("/auth/nonce", wrap(limit("nonce", srv.NonceHandler)))
+	mux.HandleFunc("/auth/social-login", wrap(limit("login", srv.SocialLoginHandler)))
+	mux.HandleFunc("/auth/refresh", wrap(limit("refresh", srv.RefreshTokenHandler)))
+	mux.HandleFunc("/.well-known/jwks.json", wrap(srv.JWKSHandler))
+	mux.HandleFunc("/auth/device-login", wrap(limit("login", srv.DeviceLoginHandler)))
+	mux.HandleFunc("/auth/login", wrap(limit("login", srv.LoginHandler)))
+	mux.HandleFunc("/auth/verify-email", wrap(limit("login", srv.VerifyEmailHandler)))
+	mux.HandleFunc("/user/", wrap(middleware.AuthMiddleware(srv.Tokens, srv.GetUserHandler)))
+	mux.HandleFunc("/user/update", wrap(middleware.AuthMiddleware(srv.Tokens, srv.UpdateUserHandler)))
+	mux.HandleFunc("/user/history/", wrap(middleware.AuthMiddleware(srv.Tokens, srv.GetHistoryHandler)))
+	mux.HandleFunc("/user/exam", wrap(middleware.AuthMiddleware(srv.Tokens, srv.SelectExamHandler)))
+	mux.HandleFunc("/user/timezone", wrap(middleware.AuthMiddleware(srv.Tokens, srv.SetTimezoneHandler)))
+	mux.HandleFunc("/exams", wrap(srv.GetExamsHandler))
+	mux.HandleFunc("/exams/", wrap(srv.GetExamTaxonomyHandler))
+	mux.HandleFunc("/tests", wrap(srv.GetTestsHandler))
+	mux.HandleFunc("/tests/categories", wrap(srv.GetCategoriesHandler))
+	mux.HandleFunc("/test/", wrap(srv.GetTestQuestionsHandler))
+	mux.HandleFunc("/submit-test", wrap(middleware.OptionalAuth(srv.Tokens, limit("submit", srv.SubmitTestHandler))))
+	mux.HandleFunc("/leaderboard", wrap(srv.GetLeaderboardHandler))
+	mux.HandleFunc("/api/v1/leaderboard", wrap(middleware.OptionalAuth(srv.Tokens, srv.LeaderboardHandler)))
+	mux.HandleFunc("/api/v1/leaderboard/me", wrap(middleware.AuthMiddleware(srv.Tokens, srv.MyRankHandler)))
+	mux.HandleFunc("/api/v1/user/privacy", wrap(middleware.AuthMiddleware(srv.Tokens, srv.LeaderboardPrivacyHandler)))
+	mux.HandleFunc("/subjects", wrap(srv.GetSubjectsHandler))
+	mux.HandleFunc("/questions", wrap(srv.GetQuestionsHandler))
+	mux.HandleFunc("/api/v1/tests/attempts", wrap(middleware.AuthMiddleware(srv.Tokens, limit("answer", srv.StartAttemptHandler))))
+	mux.HandleFunc("/api/v1/questions/answer", wrap(middleware.AuthMiddleware(srv.Tokens, limit("answer", srv.AnswerQuestionHandler))))
+	mux.HandleFunc("/api/v1/user/reward", wrap(middleware.AuthMiddleware(srv.Tokens, limit("reward", srv.RewardHandler))))
+	mux.HandleFunc("/api/v1/user/spend-tokens", wrap(middleware.AuthMiddleware(srv.Tokens, srv.SpendTokensHandler)))
+	mux.HandleFunc("/api/v1/user/achievements", wrap(middleware.AuthMiddleware(srv.Tokens, srv.AchievementsHandler)))
+	mux.HandleFunc("/api/v1/user/activity", wrap(middleware.AuthMiddleware(srv.Tokens, srv.ActivityHandler)))
+	mux.HandleFunc("/api/v1/user/progression", wrap(middleware.AuthMiddleware(srv.Tokens, srv.ProgressionHandler)))
+	mux.HandleFunc("/api/v1/leagues/current", wrap(middleware.AuthMiddleware(srv.Tokens, srv.CurrentLeagueHandler)))
+	mux.HandleFunc("/api/v1/leagues/history", wrap(middleware.AuthMiddleware(srv.Tokens, srv.LeagueHistoryHandler)))
+	mux.HandleFunc("/api/v1/shop/items", wrap(srv.ShopItemsHandler))
+	mux.HandleFunc("/api/v1/shop/purchase", wrap(middleware.AuthMiddleware(srv.Tokens, srv.PurchaseHandler)))
+	mux.HandleFunc("/api/v1/user/daily-reward", wrap(middleware.AuthMiddleware(srv.Tokens, srv.DailyRewardHandler)))
+	mux.HandleFunc("/api/v1/rewards/admob/ssv", wrap(srv.AdMobCallbackHandler))
+	mux.HandleFunc("/api/v1/user/subscriptions", wrap(middleware.AuthMiddleware(srv.Tokens, srv.SubscriptionsHandler)))
+	mux.HandleFunc("/api/v1/user/subscriptions/verify", wrap(middleware.AuthMiddleware(srv.Tokens, srv.VerifySubscriptionHandler)))
+	mux.HandleFunc("/api/v1/iap/apple/notifications", wrap(srv.AppleNotificationHandler))
+	mux.HandleFunc("/api/v1/iap/google/notifications", wrap(srv.GoogleNotificationHandler))
+	mux.HandleFunc("/api/v1/user/tokens/history", wrap(middleware.AuthMiddleware(srv.Tokens, srv.TokenHistoryHandler)))
+	mux.HandleFunc("/api/v1/user/delete", wrap(middleware.AuthMiddleware(srv.Tokens, srv.DeleteUserHandler)))
+	mux.HandleFunc("/api/v1/user/upgrade", wrap(middleware.AuthMiddleware(srv.Tokens, limit("email", srv.UpgradeAccountHandler))))
+	mux.HandleFunc("/api/v1/user/resend-verification", wrap(middleware.AuthMiddleware(srv.Tokens, limit("email", srv.ResendVerificationHandler))))
+	mux.HandleFunc("/api/v1/user/device-secret", wrap(middleware.AuthMiddleware(srv.Tokens, srv.RotateDeviceSecretHandler)))
+	mux.HandleFunc("/api/v1/user/sessions", wrap(middleware.AuthMiddleware(srv.Tokens, srv.GetSessionsHandler)))
+	mux.HandleFunc("/api/v1/user/logout", wrap(middleware.AuthMiddleware(srv.Tokens, srv.LogoutHandler)))
+	mux.HandleFunc("/api/v1/user/logout-all", wrap(middleware.AuthMiddleware(srv.Tokens, srv.LogoutAllHandler)))
+	mux.HandleFunc("/api/v1/user/identities", wrap(middleware.AuthMiddleware(srv.Tokens, srv.IdentitiesHandler)))
+	mux.HandleFunc("/api/v1/user/identities/", wrap(middleware.AuthMiddleware(srv.Tokens, srv.UnlinkIdentityHandler)))
+	mux.HandleFunc("/api/v1/user/merge", wrap(middleware.AuthMiddleware(srv.Tokens, srv.MergeAccountHandler)))
+	mux.HandleFunc("/api/v1/user/export", wrap(middleware.AuthMiddleware(srv.Tokens, limit("export", srv.ExportHandler))))
+	mux.HandleFunc("/api/v1/user/export/", wrap(middleware.AuthMiddleware(srv.Tokens, srv.ExportStatusHandler)))
 
 	// Admin Routes (Protected)
-	mux.HandleFunc("/api/v1/admin/questions", wrap(middleware.AuthMiddleware(middleware.RequireAdmin(handlers.CreateQuestionHandler))))
-	mux.HandleFunc("/api/v1/admin/questions/bulk", wrap(middleware.AuthMiddleware(middleware.RequireAdmin(handlers.BulkCreateQuestionsHandler))))
-	mux.HandleFunc("/api/v1/admin/questions/", wrap(middleware.AuthMiddleware(middleware.RequireAdmin(func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/v1/admin/questions", wrap(middleware.AuthMiddleware(srv.Tokens, middleware.RequirePermission(srv.Store.Users, permissions.QuestionsWrite, srv.CreateQuestionHandler))))
+	mux.HandleFunc("/api/v1/admin/questions/bulk", wrap(middleware.AuthMiddleware(srv.Tokens, middleware.RequirePermission(srv.Store.Users, permissions.QuestionsWrite, srv.BulkCreateQuestionsHandler))))
+	mux.HandleFunc("/api/v1/admin/questions/", wrap(middleware.AuthMiddleware(srv.Tokens, middleware.RequirePermission(srv.Store.Users, permissions.QuestionsWrite, func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodPut {
-			handlers.UpdateQuestionHandler(w, r)
+			srv.UpdateQuestionHandler(w, r)
 		} else if r.Method == http.MethodDelete {
-			handlers.DeleteQuestionHandler(w, r)
+			srv.DeleteQuestionHandler(w, r)
 		} else {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	}))))
-	mux.HandleFunc("/api/v1/admin/sync", wrap(middleware.AuthMiddleware(middleware.RequireAdmin(handlers.SyncQuestionsHandler))))
-	mux.HandleFunc("/api/v1/debug/db-stats", wrap(handlers.DBStatsHandler))
-	mux.HandleFunc("/api/v1/debug/categories", wrap(func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/v1/admin/sync", wrap(middleware.AuthMiddleware(srv.Tokens, middleware.RequirePermission(srv.Store.Users, permissions.ContentSync, srv.SyncQuestionsHandler))))
+	mux.HandleFunc("/api/v1/admin/roles", wrap(middleware.AuthMiddleware(srv.Tokens, middleware.RequirePermission(srv.Store.Users, permissions.UsersManage, srv.ListRolesHandler))))
+	mux.HandleFunc("/api/v1/admin/users/", wrap(middleware.AuthMiddleware(srv.Tokens, middleware.RequirePermission(srv.Store.Users, permissions.UsersManage, srv.SetUserRoleHandler))))
+	mux.HandleFunc("/api/v1/admin/audit", wrap(middleware.AuthMiddleware(srv.Tokens, middleware.RequirePermission(srv.Store.Users, permissions.AuditRead, srv.AuditLogHandler))))
+	mux.HandleFunc("/api/v1/admin/tokens/reconcile", wrap(middleware.AuthMiddleware(srv.Tokens, middleware.RequirePermission(srv.Store.Users, permissions.TokensAudit, srv.TokenReconcileHandler))))
+
+	// Debug routes are open in development only; elsewhere they need an
+	// admin. The public sync shortcut exists only in development.
+	debug := func(h http.HandlerFunc) http.HandlerFunc {
+		if srv.Env == appenv.Development {
+			return h
+		}
+		return middleware.AuthMiddleware(srv.Tokens, middleware.RequirePermission(srv.Store.Users, permissions.DebugRead, h))
+	}
+	mux.HandleFunc("/api/v1/debug/db-stats", wrap(debug(srv.DBStatsHandler)))
+	mux.HandleFunc("/api/v1/debug/categories", wrap(debug(func(w http.ResponseWriter, r *http.Request) {
 		middleware.EnableCors(&w)
 
 		// Get all categories with test counts
-		rows, err := database.DB.Query(`
-			SELECT category, COUNT(*) as test_count 
-			FROM tests 
-			WHERE category IS NOT NULL AND category != '' 
-			GROUP BY category 
-			ORDER BY category
-		`)
+		progress, err := srv.Store.Tests.CategoryProgress(r.Context(), "", "")
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
 
 		categories := []map[string]interface{}{}
-		for rows.Next() {
-			var category string
-			var count int
-			rows.Scan(&category, &count)
+		for _, c := range progress {
 			categories = append(categories, map[string]interface{}{
-				"category":   category,
-				"test_count": count,
+				"category":   c.Category,
+				"test_count": c.TotalTests,
 			})
 		}
 
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"categories": categories,
 		})
-	}))
-	mux.HandleFunc("/api/v1/debug/sync-public", wrap(handlers.SyncQuestionsHandler))
-	mux.HandleFunc("/api/v1/test/random-unsolved", wrap(handlers.GetRandomUnsolvedTestHandler))
+	})))
+	if srv.Env == appenv.Development {
+		mux.HandleFunc("/api/v1/debug/sync-public", wrap(srv.SyncQuestionsHandler))
+	}
+	mux.HandleFunc("/api/v1/test/random-unsolved", wrap(srv.GetRandomUnsolvedTestHandler))
 
 	return mux
 }
@@ -0,0 +1,92 @@
+// Package shop is the catalog of items that users buy with tokens. Prices
+// live here and nowhere else: clients name an item and the server decides
+// what it costs and what it does.
+package shop
+
+import (
+	"backend/internal/models"
+	"hash/fnv"
+	"math/rand"
+)
+
+// Item IDs.
+const (
+	FiftyFifty        = "fifty_fifty"
+	RevealExplanation = "reveal_explanation"
+	ExtraTime         = "extra_time"
+	StreakFreeze      = "streak_freeze"
+)
+
+// ExtraSeconds is how much time ExtraTime adds to the running test.
+const ExtraSeconds = 5 * 60
+
+// MaxStreakFreezes is how many streak freezes a user may hold at once.
+const MaxStreakFreezes = 2
+
+// Item is something the shop sells.
+type Item struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Price       int    `json:"price"`
+	// NeedsQuestion items act on one question and take its ID.
+	NeedsQuestion bool `json:"needs_question"`
+	// PremiumFree items cost premium users nothing.
+	PremiumFree bool `json:"premium_free"`
+}
+
+var catalog = []Item{
+	{ID: FiftyFifty, Name: "50/50", Description: "Removes two wrong options from the question.",
+		Price: 15, NeedsQuestion: true, PremiumFree: true},
+	{ID: RevealExplanation, Name: "Reveal explanation", Description: "Unlocks the question's explanation.",
+		Price: 10, NeedsQuestion: true, PremiumFree: true},
+	{ID: ExtraTime, Name: "+5 minutes", Description: "Adds five minutes to the test timer.",
+		Price: 20, PremiumFree: true},
+	{ID: StreakFreeze, Name: "Streak freeze", Description: "Keeps the streak alive through one missed day.",
+		Price: 50},
+}
+
+// Items returns the catalog.
+func Items() []Item {
+	return append([]Item(nil), catalog...)
+}
+
+// Lookup returns the item with the given ID.
+func Lookup(id string) (Item, bool) {
+	for _, it := range catalog {
+		if it.ID == id {
+			return it, true
+		}
+	}
+	return Item{}, false
+}
+
+// HiddenOptions picks two wrong options of q to hide, as indexes into
+// q.Options in ascending order. The choice depends only on the user and the
+// question, so buying again (or on another device) hides the same options.
+// Questions with fewer than three options get nil: hiding two would leave no
+// choice or give the answer away.
+func HiddenOptions(userID string, q *models.Question) []int {
+	if len(q.Options) < 3 {
+		return nil
+	}
+	var wrong []int
+	for i, o := range q.Options {
+		if !o.IsCorrect {
+			wrong = append(wrong, i)
+		}
+	}
+	if len(wrong) < 2 {
+		return nil
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(userID + "\x00" + q.ID))
+	rng := rand.New(rand.NewSource(int64(h.Sum64())))
+	rng.Shuffle(len(wrong), func(i, j int) { wrong[i], wrong[j] = wrong[j], wrong[i] })
+	a, b := wrong[0], wrong[1]
+	if a > b {
+		a, b = b, a
+	}
+	return []int{a, b}
+}
@@ -0,0 +1,43 @@
+package shop_test
+
+import (
+	"backend/internal/models"
+	"backend/internal/shop"
+	"slices"
+	"testing"
+)
+
+func TestHiddenOptions(t *testing.T) {
+	q := &models.Question{ID: "q1", Options: []models.Option{
+		{Text: "A"}, {Text: "B", IsCorrect: true}, {Text: "C"}, {Text: "D"}, {Text: "E"},
+	}}
+	first := shop.HiddenOptions("u1", q)
+	if len(first) != 2 || first[0] >= first[1] {
+		t.Fatalf("want two sorted indexes, got %v", first)
+	}
+	if slices.Contains(first, 1) {
+		t.Fatalf("the correct option must stay visible: %v", first)
+	}
+	if again := shop.HiddenOptions("u1", q); !slices.Equal(first, again) {
+		t.Fatalf("same user and question should hide the same options: %v then %v", first, again)
+	}
+
+	short := &models.Question{ID: "q2", Options: []models.Option{{Text: "A", IsCorrect: true}, {Text: "B"}}}
+	if got := shop.HiddenOptions("u1", short); got != nil {
+		t.Fatalf("two-option questions have nothing to hide, got %v", got)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, it := range shop.Items() {
+		if got, ok := shop.Lookup(it.ID); !ok || got != it {
+			t.Errorf("Lookup(%q) = %+v, %v", it.ID, got, ok)
+		}
+		if it.Price <= 0 {
+			t.Errorf("%s has no price", it.ID)
+		}
+	}
+	if _, ok := shop.Lookup("free_tokens"); ok {
+		t.Fatal("unknown items must not be found")
+	}
+}
@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"backend/internal/models"
+	"backend/internal/progression"
+	"backend/internal/store"
+	"context"
+	"sort"
+	"time"
+)
+
+type AchievementStore struct {
+	d *data
+}
+
+func (s *AchievementStore) Stats(ctx context.Context, userID string) (*models.AchievementStats, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.users[userID]; !ok {
+		return nil, store.ErrNotFound
+	}
+	// Retired questions are deleted here, so every stored question counts
+	perTest := map[string]int{}
+	for _, q := range s.d.questions {
+		perTest[q.TestID]++
+	}
+	var st models.AchievementStats
+	taken, perfect := map[string]bool{}, map[string]bool{}
+	for _, r := range s.d.results {
+		if r.UserID != userID {
+			continue
+		}
+		n := perTest[r.TestID]
+		if !taken[r.TestID] {
+			// Retakes answer the same questions again
+			st.QuestionsAnswered += n
+		}
+		taken[r.TestID] = true
+		if n > 0 && r.Score >= n*store.PointsPerQuestion {
+			perfect[r.TestID] = true
+		}
+	}
+	st.TestsCompleted, st.PerfectScores = len(taken), len(perfect)
+	return &st, nil
+}
+
+func (s *AchievementStore) List(ctx context.Context, userID string) ([]models.UserAchievement, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	list := []models.UserAchievement{}
+	for _, a := range s.d.achievements {
+		if a.UserID == userID {
+			list = append(list, a)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].EarnedAt.Before(list[j].EarnedAt) })
+	return list, nil
+}
+
+func (s *AchievementStore) Award(ctx context.Context, a *models.UserAchievement, curve progression.Curve) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[a.UserID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	for _, prev := range s.d.achievements {
+		if prev.UserID == a.UserID && prev.AchievementID == a.AchievementID {
+			return store.ErrDuplicate
+		}
+	}
+
+	if a.Tokens > 0 {
+		t := &models.TokenTransaction{UserID: a.UserID, Amount: a.Tokens, Reason: "achievement", Reference: a.AchievementID,
+			IdempotencyKey: "achievement:" + a.AchievementID}
+		if err := s.d.recordTokens(t, nil); err != nil {
+			return err
+		}
+	}
+	u.TotalXP += a.XP
+	u.Level, u.XP = curve.Level(u.TotalXP)
+	a.EarnedAt = time.Now()
+	s.d.achievements = append(s.d.achievements, *a)
+	return nil
+}
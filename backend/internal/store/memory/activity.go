@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"sort"
+)
+
+type ActivityStore struct {
+	d *data
+}
+
+// dayActivity returns the user's activity on day. Callers hold the lock.
+func (d *data) dayActivity(userID, day string) *models.DailyActivity {
+	for i, a := range d.activity {
+		if a.UserID == userID && a.Day == day {
+			return &d.activity[i]
+		}
+	}
+	return nil
+}
+
+func (s *ActivityStore) Record(ctx context.Context, a *models.DailyActivity) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.users[a.UserID]; !ok {
+		return store.ErrNotFound
+	}
+	day := s.d.dayActivity(a.UserID, a.Day)
+	if day == nil {
+		s.d.activity = append(s.d.activity, models.DailyActivity{UserID: a.UserID, Day: a.Day})
+		day = &s.d.activity[len(s.d.activity)-1]
+	}
+	day.Tests += a.Tests
+	day.Score += a.Score
+	day.XP += a.XP
+	day.Frozen = false
+	return nil
+}
+
+func (s *ActivityStore) List(ctx context.Context, userID, from, to string) ([]models.DailyActivity, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	list := []models.DailyActivity{}
+	for _, a := range s.d.activity {
+		if a.UserID == userID && a.Day >= from && a.Day <= to {
+			list = append(list, a)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Day < list[j].Day })
+	return list, nil
+}
@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"slices"
+	"time"
+)
+
+type AttemptStore struct {
+	d *data
+}
+
+// copyAttempt returns a copy of a that doesn't share its answers.
+func copyAttempt(a *models.TestAttempt) *models.TestAttempt {
+	c := *a
+	c.Answers = slices.Clone(a.Answers)
+	return &c
+}
+
+func (s *AttemptStore) Start(ctx context.Context, a *models.TestAttempt) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.users[a.UserID]; !ok {
+		return store.ErrNotFound
+	}
+	a.ID, a.StartedAt, a.SubmittedAt, a.Answers = newID(), time.Now(), nil, []models.AttemptAnswer{}
+	s.d.attempts[a.ID] = copyAttempt(a)
+	return nil
+}
+
+func (s *AttemptStore) Get(ctx context.Context, id string) (*models.TestAttempt, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	a, ok := s.d.attempts[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return copyAttempt(a), nil
+}
+
+func (s *AttemptStore) Answer(ctx context.Context, attemptID string, answer models.AttemptAnswer) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	a, ok := s.d.attempts[attemptID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	if a.SubmittedAt != nil {
+		return store.ErrConflict
+	}
+	if slices.ContainsFunc(a.Answers, func(prev models.AttemptAnswer) bool { return prev.QuestionID == answer.QuestionID }) {
+		return store.ErrDuplicate
+	}
+	a.Answers = append(a.Answers, answer)
+	return nil
+}
+
+func (s *AttemptStore) Submit(ctx context.Context, id string) (*models.TestAttempt, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	a, ok := s.d.attempts[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	if a.SubmittedAt != nil {
+		return nil, store.ErrConflict
+	}
+	now := time.Now()
+	a.SubmittedAt = &now
+	return copyAttempt(a), nil
+}
@@ -0,0 +1,47 @@
+package memory
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"slices"
+	"time"
+)
+
+type AuditStore struct {
+	d *data
+}
+
+func (s *AuditStore) Append(ctx context.Context, e *models.AuditEntry) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	e.CreatedAt = time.Now()
+	entry := *e
+	entry.Before = slices.Clone(e.Before)
+	entry.After = slices.Clone(e.After)
+	s.d.audit = append(s.d.audit, entry)
+	return nil
+}
+
+func (s *AuditStore) List(ctx context.Context, f store.AuditFilter) ([]models.AuditEntry, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	list := []models.AuditEntry{}
+	for i := len(s.d.audit) - 1; i >= 0 && len(list) < f.Limit; i-- {
+		e := s.d.audit[i]
+		if (f.ActorID != "" && e.ActorID != f.ActorID) ||
+			(f.Action != "" && e.Action != f.Action) ||
+			(f.TargetType != "" && e.TargetType != f.TargetType) ||
+			(f.TargetID != "" && e.TargetID != f.TargetID) ||
+			(!f.Before.IsZero() && !e.CreatedAt.Before(f.Before)) {
+			continue
+		}
+		list = append(list, e)
+	}
+	return list, nil
+}
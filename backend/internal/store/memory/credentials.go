@@ -0,0 +1,131 @@
+package memory
+
+import (
+	"backend/internal/store"
+	"context"
+	"strings"
+	"time"
+)
+
+// secretRow holds the credential hashes that have no place on models.User.
+type secretRow struct {
+	deviceSecretHash string
+	passwordHash     string
+}
+
+type verification struct {
+	userID    string
+	email     string
+	expiresAt time.Time
+}
+
+type CredentialStore struct {
+	d *data
+}
+
+// credentials builds the view of a stored user. Callers hold the lock.
+func (s *CredentialStore) credentials(userID string) (*store.Credentials, error) {
+	u, ok := s.d.users[userID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	row := s.d.secrets[userID]
+	return &store.Credentials{
+		UserID:           u.ID,
+		DeviceSecretHash: row.deviceSecretHash,
+		Email:            u.Email,
+		PasswordHash:     row.passwordHash,
+		EmailVerified:    u.EmailVerified,
+	}, nil
+}
+
+func (s *CredentialStore) Get(ctx context.Context, userID string) (*store.Credentials, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return s.credentials(userID)
+}
+
+func (s *CredentialStore) GetByEmail(ctx context.Context, email string) (*store.Credentials, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, u := range s.d.users {
+		if u.Email != "" && strings.EqualFold(u.Email, email) {
+			return s.credentials(u.ID)
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *CredentialStore) SetDeviceSecret(ctx context.Context, userID, secretHash string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.users[userID]; !ok {
+		return store.ErrNotFound
+	}
+	row := s.d.secrets[userID]
+	row.deviceSecretHash = secretHash
+	s.d.secrets[userID] = row
+	return nil
+}
+
+func (s *CredentialStore) SetPassword(ctx context.Context, userID, email, passwordHash string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[userID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	for _, other := range s.d.users {
+		if other.ID != userID && strings.EqualFold(other.Email, email) {
+			return store.ErrConflict
+		}
+	}
+	if !strings.EqualFold(u.Email, email) {
+		u.EmailVerified = false
+	}
+	u.Email = email
+	row := s.d.secrets[userID]
+	row.passwordHash = passwordHash
+	s.d.secrets[userID] = row
+	return nil
+}
+
+func (s *CredentialStore) AddEmailVerification(ctx context.Context, userID, email, tokenHash string, expiresAt time.Time) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.users[userID]; !ok {
+		return store.ErrNotFound
+	}
+	if _, exists := s.d.verifications[tokenHash]; exists {
+		return store.ErrConflict
+	}
+	s.d.verifications[tokenHash] = verification{userID: userID, email: email, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *CredentialStore) VerifyEmail(ctx context.Context, tokenHash string, now time.Time) (string, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	v, ok := s.d.verifications[tokenHash]
+	if !ok || !now.Before(v.expiresAt) {
+		return "", store.ErrNotFound
+	}
+	delete(s.d.verifications, tokenHash)
+
+	u, ok := s.d.users[v.userID]
+	if !ok || !strings.EqualFold(u.Email, v.email) {
+		return "", store.ErrNotFound
+	}
+	u.EmailVerified = true
+	for hash, other := range s.d.verifications {
+		if other.userID == v.userID {
+			delete(s.d.verifications, hash)
+		}
+	}
+	return v.userID, nil
+}
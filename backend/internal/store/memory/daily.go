@@ -0,0 +1,53 @@
+package memory
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"fmt"
+	"time"
+)
+
+type DailyRewardStore struct {
+	d *data
+}
+
+func (s *DailyRewardStore) Last(ctx context.Context, userID string) (*models.DailyRewardClaim, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var last *models.DailyRewardClaim
+	for i, c := range s.d.dailyClaims {
+		if c.UserID == userID && (last == nil || c.Day > last.Day) {
+			last = &s.d.dailyClaims[i]
+		}
+	}
+	if last == nil {
+		return nil, store.ErrNotFound
+	}
+	clone := *last
+	return &clone, nil
+}
+
+func (s *DailyRewardStore) Claim(ctx context.Context, c *models.DailyRewardClaim) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.users[c.UserID]; !ok {
+		return store.ErrNotFound
+	}
+	for _, prev := range s.d.dailyClaims {
+		if prev.UserID == c.UserID && prev.Day >= c.Day {
+			return store.ErrDuplicate
+		}
+	}
+
+	t := &models.TokenTransaction{UserID: c.UserID, Amount: c.Tokens + c.Bonus, Reason: "daily_login",
+		Reference: fmt.Sprintf("day %d", c.CalendarDay), IdempotencyKey: "daily:" + c.Day}
+	if err := s.d.recordTokens(t, nil); err != nil {
+		return err
+	}
+	c.TransactionID, c.ClaimedAt = t.ID, time.Now()
+	s.d.dailyClaims = append(s.d.dailyClaims, *c)
+	return nil
+}
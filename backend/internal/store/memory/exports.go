@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"slices"
+	"time"
+)
+
+type exportRow struct {
+	models.DataExport
+	archive []byte
+}
+
+type ExportStore struct {
+	d *data
+}
+
+func (s *ExportStore) Create(ctx context.Context, e *models.DataExport) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.users[e.UserID]; !ok {
+		return store.ErrNotFound
+	}
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	e.Status = "pending"
+	e.CreatedAt = time.Now()
+	s.d.exports[e.ID] = &exportRow{DataExport: *e}
+	return nil
+}
+
+func (s *ExportStore) Get(ctx context.Context, userID, id string) (*models.DataExport, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	row, ok := s.d.exports[id]
+	if !ok || row.UserID != userID {
+		return nil, store.ErrNotFound
+	}
+	e := row.DataExport
+	return &e, nil
+}
+
+func (s *ExportStore) Pending(ctx context.Context, userID string, since time.Time) (*models.DataExport, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var newest *models.DataExport
+	for _, row := range s.d.exports {
+		if row.UserID == userID && row.Status == "pending" && row.CreatedAt.After(since) &&
+			(newest == nil || row.CreatedAt.After(newest.CreatedAt)) {
+			e := row.DataExport
+			newest = &e
+		}
+	}
+	if newest == nil {
+		return nil, store.ErrNotFound
+	}
+	return newest, nil
+}
+
+func (s *ExportStore) Finish(ctx context.Context, id string, archive []byte, expiresAt time.Time) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	row, ok := s.d.exports[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	now := time.Now()
+	row.Status, row.SizeBytes, row.archive = "ready", len(archive), slices.Clone(archive)
+	row.CompletedAt, row.ExpiresAt = &now, &expiresAt
+	return nil
+}
+
+func (s *ExportStore) Fail(ctx context.Context, id, reason string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	row, ok := s.d.exports[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	now := time.Now()
+	row.Status, row.Error, row.CompletedAt = "failed", reason, &now
+	return nil
+}
+
+func (s *ExportStore) Archive(ctx context.Context, userID, id string, now time.Time) ([]byte, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	row, ok := s.d.exports[id]
+	if !ok || row.UserID != userID || row.Status != "ready" || !now.Before(*row.ExpiresAt) {
+		return nil, store.ErrNotFound
+	}
+	return slices.Clone(row.archive), nil
+}
+
+func (s *ExportStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	n := 0
+	for id, row := range s.d.exports {
+		if row.ExpiresAt != nil && !now.Before(*row.ExpiresAt) {
+			delete(s.d.exports, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"slices"
+	"time"
+)
+
+type IdentityStore struct {
+	d *data
+}
+
+func (s *IdentityStore) Get(ctx context.Context, provider, subject string) (*models.Identity, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, id := range s.d.identities {
+		if id.Provider == provider && id.Subject == subject {
+			return &id, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *IdentityStore) List(ctx context.Context, userID string) ([]models.Identity, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	list := []models.Identity{}
+	for _, id := range s.d.identities {
+		if id.UserID == userID {
+			list = append(list, id)
+		}
+	}
+	return list, nil
+}
+
+func (s *IdentityStore) Link(ctx context.Context, id *models.Identity) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.users[id.UserID]; !ok {
+		return store.ErrNotFound
+	}
+	for _, other := range s.d.identities {
+		if other.Provider == id.Provider && (other.Subject == id.Subject || other.UserID == id.UserID) {
+			return store.ErrConflict
+		}
+	}
+	id.LinkedAt = time.Now()
+	s.d.identities = append(s.d.identities, *id)
+	return nil
+}
+
+func (s *IdentityStore) Unlink(ctx context.Context, userID, provider string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	i := slices.IndexFunc(s.d.identities, func(id models.Identity) bool {
+		return id.UserID == userID && id.Provider == provider
+	})
+	if i < 0 {
+		return store.ErrNotFound
+	}
+	s.d.identities = slices.Delete(s.d.identities, i, i+1)
+	return nil
+}
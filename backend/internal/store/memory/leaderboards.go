@@ -0,0 +1,149 @@
+package memory
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"slices"
+	"sort"
+	"time"
+)
+
+type LeaderboardStore struct {
+	d *data
+}
+
+type leaderboardRow struct {
+	models.BoardPeriod
+	userID string
+	score  int
+}
+
+// addScore adds score to the user's entry for p. Callers hold the lock.
+func (d *data) addScore(userID string, score int, p models.BoardPeriod) {
+	for i, r := range d.leaderboard {
+		if r.userID == userID && r.Board == p.Board && r.Window == p.Window && r.Period == p.Period {
+			d.leaderboard[i].score += score
+			return
+		}
+	}
+	d.leaderboard = append(d.leaderboard, leaderboardRow{BoardPeriod: p, userID: userID, score: score})
+}
+
+// ranked returns the visible entries of p, best first. Callers hold the lock.
+func (d *data) ranked(p models.BoardPeriod) []models.LeaderboardEntry {
+	list := []models.LeaderboardEntry{}
+	for _, r := range d.leaderboard {
+		if r.Board != p.Board || r.Window != p.Window || r.Period != p.Period {
+			continue
+		}
+		u := d.users[r.userID]
+		if u.LeaderboardHidden || u.DeletionScheduledFor != nil {
+			continue
+		}
+		list = append(list, models.LeaderboardEntry{UserID: u.ID, Nickname: u.Nickname, Emoji: u.Emoji,
+			Score: r.score, Streak: u.Streak})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Score != list[j].Score {
+			return list[i].Score > list[j].Score
+		}
+		return list[i].UserID < list[j].UserID
+	})
+	for i := range list {
+		list[i].Rank = i + 1
+	}
+	return list
+}
+
+func (s *LeaderboardStore) Add(ctx context.Context, userID string, score int, periods []models.BoardPeriod) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.users[userID]; !ok {
+		return store.ErrNotFound
+	}
+	for _, p := range periods {
+		s.d.addScore(userID, score, p)
+	}
+	return nil
+}
+
+func (s *LeaderboardStore) Top(ctx context.Context, p models.BoardPeriod, offset, limit int) ([]models.LeaderboardEntry, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	list := s.d.ranked(p)
+	start := min(offset, len(list))
+	end := min(start+limit, len(list))
+	return slices.Clone(list[start:end]), nil
+}
+
+func (s *LeaderboardStore) Count(ctx context.Context, p models.BoardPeriod) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	return len(s.d.ranked(p)), nil
+}
+
+func (s *LeaderboardStore) Rank(ctx context.Context, p models.BoardPeriod, userID string) (*models.LeaderboardEntry, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, e := range s.d.ranked(p) {
+		if e.UserID == userID {
+			return &e, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *LeaderboardStore) Around(ctx context.Context, p models.BoardPeriod, userID string, n int) ([]models.LeaderboardEntry, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	list := s.d.ranked(p)
+	i := slices.IndexFunc(list, func(e models.LeaderboardEntry) bool { return e.UserID == userID })
+	if i < 0 {
+		return nil, store.ErrNotFound
+	}
+	around := slices.Clone(list[max(0, i-n):min(len(list), i+n+1)])
+	for j := range around {
+		around[j].Rank = 0
+	}
+	return around, nil
+}
+
+func (s *LeaderboardStore) Scores(ctx context.Context, p models.BoardPeriod) ([]models.LeaderboardEntry, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	list := s.d.ranked(p)
+	for i, e := range list {
+		list[i] = models.LeaderboardEntry{UserID: e.UserID, Score: e.Score}
+	}
+	return list, nil
+}
+
+func (s *LeaderboardStore) SetHidden(ctx context.Context, userID string, hidden bool) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[userID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	u.LeaderboardHidden = hidden
+	return nil
+}
+
+func (s *LeaderboardStore) Prune(ctx context.Context, now time.Time) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	before := len(s.d.leaderboard)
+	s.d.leaderboard = slices.DeleteFunc(s.d.leaderboard, func(r leaderboardRow) bool {
+		return r.ExpiresAt != nil && !r.ExpiresAt.After(now)
+	})
+	return before - len(s.d.leaderboard), nil
+}
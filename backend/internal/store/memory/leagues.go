@@ -0,0 +1,153 @@
+package memory
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"sort"
+	"time"
+)
+
+type LeagueStore struct {
+	d *data
+}
+
+type leagueGroupRow struct {
+	models.LeagueGroup
+	members int
+	closed  bool
+}
+
+// membership returns the user's membership for week. Callers hold the lock.
+func (d *data) membership(userID, week string) *models.LeagueMembership {
+	for i, m := range d.leagueMembers {
+		if m.UserID == userID && m.Week == week {
+			return &d.leagueMembers[i]
+		}
+	}
+	return nil
+}
+
+func (s *LeagueStore) AddXP(ctx context.Context, m *models.LeagueMembership, band, maxSize int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[m.UserID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	joined := s.d.membership(m.UserID, m.Week)
+	if joined == nil {
+		var group *leagueGroupRow
+		for _, g := range s.d.leagueGroups {
+			if g.Week == m.Week && g.Tier == u.LeagueTier && g.Band == band && !g.closed && g.members < maxSize {
+				group = g
+				break
+			}
+		}
+		if group == nil {
+			group = &leagueGroupRow{LeagueGroup: models.LeagueGroup{ID: newID(), Week: m.Week, Tier: u.LeagueTier, Band: band}}
+			s.d.leagueGroups = append(s.d.leagueGroups, group)
+		}
+		group.members++
+		s.d.leagueMembers = append(s.d.leagueMembers, models.LeagueMembership{GroupID: group.ID, UserID: m.UserID,
+			Week: m.Week, Tier: group.Tier, JoinedAt: time.Now()})
+		joined = &s.d.leagueMembers[len(s.d.leagueMembers)-1]
+	}
+	joined.XP += m.XP
+	*m = *joined
+	return nil
+}
+
+func (s *LeagueStore) Membership(ctx context.Context, userID, week string) (*models.LeagueMembership, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	m := s.d.membership(userID, week)
+	if m == nil {
+		return nil, store.ErrNotFound
+	}
+	clone := *m
+	return &clone, nil
+}
+
+func (s *LeagueStore) Standings(ctx context.Context, groupID string) ([]models.LeagueStanding, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	// leagueMembers is in join order, so a stable sort breaks ties by it
+	list := []models.LeagueStanding{}
+	for _, m := range s.d.leagueMembers {
+		if m.GroupID != groupID {
+			continue
+		}
+		u := s.d.users[m.UserID]
+		list = append(list, models.LeagueStanding{UserID: u.ID, Nickname: u.Nickname, Emoji: u.Emoji, Level: u.Level, XP: m.XP})
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].XP > list[j].XP })
+	return list, nil
+}
+
+func (s *LeagueStore) History(ctx context.Context, userID string, limit int) ([]models.LeagueMembership, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	closed := map[string]bool{}
+	for _, g := range s.d.leagueGroups {
+		closed[g.ID] = g.closed
+	}
+	list := []models.LeagueMembership{}
+	for _, m := range s.d.leagueMembers {
+		if m.UserID == userID && closed[m.GroupID] {
+			list = append(list, m)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Week > list[j].Week })
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (s *LeagueStore) Unclosed(ctx context.Context, week string, limit int) ([]models.LeagueGroup, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	list := []models.LeagueGroup{}
+	for _, g := range s.d.leagueGroups {
+		if g.Week < week && !g.closed && len(list) < limit {
+			list = append(list, g.LeagueGroup)
+		}
+	}
+	return list, nil
+}
+
+func (s *LeagueStore) Close(ctx context.Context, groupID string, results []models.LeagueResult) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var group *leagueGroupRow
+	for _, g := range s.d.leagueGroups {
+		if g.ID == groupID {
+			group = g
+		}
+	}
+	if group == nil {
+		return store.ErrNotFound
+	}
+	if group.closed {
+		return store.ErrConflict
+	}
+	for _, r := range results {
+		for i, m := range s.d.leagueMembers {
+			if m.GroupID == groupID && m.UserID == r.UserID {
+				s.d.leagueMembers[i].Rank, s.d.leagueMembers[i].Outcome = r.Rank, r.Outcome
+			}
+		}
+		if u, ok := s.d.users[r.UserID]; ok {
+			u.LeagueTier = r.Tier
+		}
+	}
+	group.closed = true
+	return nil
+}
@@ -0,0 +1,122 @@
+// Package memory implements the store interfaces with in-process maps and
+// slices. It is meant for tests: nothing is persisted and every method takes
+// a single lock.
+package memory
+
+import (
+	"backend/internal/days"
+	"backend/internal/models"
+	"backend/internal/store"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// data is shared by every repository of one Store, so cross-table operations
+// (deleting a user's results, tests joined with exams) see a consistent view.
+type data struct {
+	mu        sync.Mutex
+	users     map[string]*models.User
+	exams     []models.Exam
+	tests     []models.Test
+	questions []models.Question
+	results   []models.TestResult
+	attempts  map[string]*models.TestAttempt
+	nonces    map[nonceKey]time.Time
+	subjects  []subjectRow
+
+	secrets       map[string]secretRow // by user ID
+	verifications map[string]verification
+
+	sessions      map[string]*sessionRow
+	refreshTokens map[string]refreshToken // by token hash
+
+	identities []models.Identity
+
+	audit []models.AuditEntry // append order
+
+	exports map[string]*exportRow
+
+	tokenTx     []models.TokenTransaction // append order
+	dailyClaims []models.DailyRewardClaim // append order
+
+	subscriptions []models.Subscription
+
+	achievements []models.UserAchievement // append order
+
+	leagueGroups  []*leagueGroupRow         // creation order
+	leagueMembers []models.LeagueMembership // join order
+
+	leaderboard []leaderboardRow
+
+	activity []models.DailyActivity
+}
+
+type subjectRow struct {
+	exam    string
+	subject models.Subject
+}
+
+// New returns an empty Store. Use the Add methods on *TestStore and
+// *SubjectStore to seed rows that have no public write path.
+func New() *store.Store {
+	d := &data{
+		users:         map[string]*models.User{},
+		attempts:      map[string]*models.TestAttempt{},
+		nonces:        map[nonceKey]time.Time{},
+		secrets:       map[string]secretRow{},
+		verifications: map[string]verification{},
+		sessions:      map[string]*sessionRow{},
+		refreshTokens: map[string]refreshToken{},
+		exports:       map[string]*exportRow{},
+	}
+	return &store.Store{
+		Users:        &UserStore{d},
+		Tests:        &TestStore{d},
+		Questions:    &QuestionStore{d},
+		Results:      &ResultStore{d},
+		Attempts:     &AttemptStore{d},
+		Subjects:     &SubjectStore{d},
+		Tokens:       &TokenStore{d},
+		Credentials:  &CredentialStore{d},
+		Sessions:     &SessionStore{d},
+		Identities:   &IdentityStore{d},
+		Audit:        &AuditStore{d},
+		Exports:      &ExportStore{d},
+		Daily:        &DailyRewardStore{d},
+		Subs:         &SubscriptionStore{d},
+		Achievements: &AchievementStore{d},
+		Leagues:      &LeagueStore{d},
+		Leaderboards: &LeaderboardStore{d},
+		Activity:     &ActivityStore{d},
+		Nonces:       &NonceStore{d},
+	}
+}
+
+func newID() string {
+	id, _ := uuid.NewV7()
+	return id.String()
+}
+
+// today returns the current date in timezone, or in UTC if it's unknown.
+func today(timezone string) string {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return days.Today(time.Now(), loc)
+}
+
+// providers lists the providers linked to a user, sorted. Callers hold the lock.
+func (d *data) providers(userID string) []string {
+	list := []string{}
+	for _, id := range d.identities {
+		if id.UserID == userID {
+			list = append(list, id.Provider)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
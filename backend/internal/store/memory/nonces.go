@@ -0,0 +1,57 @@
+package memory
+
+import (
+	"backend/internal/store"
+	"context"
+	"time"
+)
+
+type NonceStore struct {
+	d *data
+}
+
+type nonceKey struct {
+	purpose, value string
+}
+
+func (s *NonceStore) Issue(ctx context.Context, purpose, value string, expiresAt time.Time) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	key := nonceKey{purpose, value}
+	if _, ok := s.d.nonces[key]; ok {
+		return store.ErrConflict
+	}
+	s.d.nonces[key] = expiresAt
+	return nil
+}
+
+func (s *NonceStore) Consume(ctx context.Context, purpose, value string, now time.Time) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	key := nonceKey{purpose, value}
+	expiresAt, ok := s.d.nonces[key]
+	if !ok {
+		return store.ErrNotFound
+	}
+	delete(s.d.nonces, key)
+	if !now.Before(expiresAt) {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *NonceStore) Prune(ctx context.Context, now time.Time) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	n := 0
+	for key, expiresAt := range s.d.nonces {
+		if !now.Before(expiresAt) {
+			delete(s.d.nonces, key)
+			n++
+		}
+	}
+	return n, nil
+}
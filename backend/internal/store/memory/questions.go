@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+)
+
+type QuestionStore struct {
+	d *data
+}
+
+func (s *QuestionStore) List(ctx context.Context, limit int) ([]models.Question, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	questions := []models.Question{}
+	for i := 0; i < len(s.d.questions) && i < limit; i++ {
+		questions = append(questions, s.d.questions[i])
+	}
+	return questions, nil
+}
+
+func (s *QuestionStore) ListByTest(ctx context.Context, testID string) ([]models.Question, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	questions := []models.Question{}
+	for _, q := range s.d.questions {
+		if q.TestID == testID {
+			questions = append(questions, q)
+		}
+	}
+	return questions, nil
+}
+
+func (s *QuestionStore) Get(ctx context.Context, id string) (*models.Question, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, q := range s.d.questions {
+		if q.ID == id {
+			return &q, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *QuestionStore) ExistsByQuestionID(ctx context.Context, questionID string) (bool, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, q := range s.d.questions {
+		if q.QuestionID == questionID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *QuestionStore) Create(ctx context.Context, q *models.Question) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if q.ID == "" {
+		q.ID = newID()
+	}
+	for _, other := range s.d.questions {
+		if other.ID == q.ID {
+			return store.ErrConflict
+		}
+	}
+	s.d.questions = append(s.d.questions, *q)
+	return nil
+}
+
+func (s *QuestionStore) Update(ctx context.Context, q *models.Question) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for i := range s.d.questions {
+		if s.d.questions[i].ID == q.ID {
+			s.d.questions[i] = *q
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *QuestionStore) Delete(ctx context.Context, id string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for i := range s.d.questions {
+		if s.d.questions[i].ID == id {
+			s.d.questions = append(s.d.questions[:i], s.d.questions[i+1:]...)
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *QuestionStore) Count(ctx context.Context) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return len(s.d.questions), nil
+}
@@ -0,0 +1,108 @@
+package memory
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"sort"
+	"time"
+)
+
+type ResultStore struct {
+	d *data
+}
+
+func (s *ResultStore) Create(ctx context.Context, r *models.TestResult) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if r.ID == "" {
+		r.ID = newID()
+	}
+	r.CompletedAt = time.Now()
+	s.d.results = append(s.d.results, *r)
+	return nil
+}
+
+func (s *ResultStore) BestScore(ctx context.Context, userID, testID string) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	best, taken := 0, false
+	for _, r := range s.d.results {
+		if r.UserID == userID && r.TestID == testID && (!taken || r.Score > best) {
+			best, taken = r.Score, true
+		}
+	}
+	if !taken {
+		return 0, store.ErrNotFound
+	}
+	return best, nil
+}
+
+func (s *ResultStore) History(ctx context.Context, userID string) ([]models.HistoryEntry, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	titles := map[string]string{}
+	for _, t := range s.d.tests {
+		titles[t.ID] = t.Title
+	}
+
+	var results []models.TestResult
+	for _, r := range s.d.results {
+		// History joins tests, so results of unknown tests are dropped
+		if _, ok := titles[r.TestID]; r.UserID == userID && ok {
+			results = append(results, r)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].CompletedAt.After(results[j].CompletedAt) })
+
+	history := []models.HistoryEntry{}
+	for _, r := range results {
+		history = append(history, models.HistoryEntry{
+			Title: titles[r.TestID],
+			Score: r.Score,
+			Date:  r.CompletedAt.Format("2006-01-02 15:04"),
+		})
+	}
+	return history, nil
+}
+
+func (s *ResultStore) Count(ctx context.Context) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return len(s.d.results), nil
+}
+
+func (s *ResultStore) CountForUser(ctx context.Context, userID string) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	n := 0
+	for _, r := range s.d.results {
+		if r.UserID == userID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *ResultStore) ListForUser(ctx context.Context, userID string) ([]models.TestResult, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	titles := map[string]string{}
+	for _, t := range s.d.tests {
+		titles[t.ID] = t.Title
+	}
+	list := []models.TestResult{}
+	for _, r := range s.d.results {
+		if r.UserID == userID {
+			r.TestTitle = titles[r.TestID]
+			list = append(list, r)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].CompletedAt.Before(list[j].CompletedAt) })
+	return list, nil
+}
@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"sort"
+	"time"
+)
+
+type sessionRow struct {
+	models.Session
+	revokedAt time.Time
+}
+
+func (s *sessionRow) active(now time.Time) bool {
+	return s.revokedAt.IsZero() && now.Before(s.ExpiresAt)
+}
+
+type refreshToken struct {
+	sessionID string
+	used      bool
+}
+
+// revokeSessions ends every active session of the user. Callers hold the lock.
+func revokeSessions(d *data, userID string, now time.Time) int {
+	n := 0
+	for _, sess := range d.sessions {
+		if sess.UserID == userID && sess.active(now) {
+			sess.revokedAt = now
+			n++
+		}
+	}
+	return n
+}
+
+type SessionStore struct {
+	d *data
+}
+
+func (s *SessionStore) Create(ctx context.Context, sess *models.Session, tokenHash string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.users[sess.UserID]; !ok {
+		return store.ErrNotFound
+	}
+	if _, exists := s.d.refreshTokens[tokenHash]; exists {
+		return store.ErrConflict
+	}
+	if sess.ID == "" {
+		sess.ID = newID()
+	}
+	now := time.Now()
+	sess.CreatedAt, sess.LastUsedAt = now, now
+	s.d.sessions[sess.ID] = &sessionRow{Session: *sess}
+	s.d.refreshTokens[tokenHash] = refreshToken{sessionID: sess.ID}
+	return nil
+}
+
+func (s *SessionStore) Rotate(ctx context.Context, tokenHash, newHash string, now, expiresAt time.Time) (*models.Session, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	t, ok := s.d.refreshTokens[tokenHash]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	sess := s.d.sessions[t.sessionID]
+	if t.used {
+		if sess != nil && sess.revokedAt.IsZero() {
+			sess.revokedAt = now
+		}
+		return nil, store.ErrTokenReused
+	}
+	if sess == nil || !sess.active(now) {
+		return nil, store.ErrNotFound
+	}
+	if _, exists := s.d.refreshTokens[newHash]; exists {
+		return nil, store.ErrConflict
+	}
+
+	t.used = true
+	s.d.refreshTokens[tokenHash] = t
+	s.d.refreshTokens[newHash] = refreshToken{sessionID: sess.ID}
+	sess.LastUsedAt, sess.ExpiresAt = now, expiresAt
+	clone := sess.Session
+	return &clone, nil
+}
+
+func (s *SessionStore) List(ctx context.Context, userID string, now time.Time) ([]models.Session, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	list := []models.Session{}
+	for _, sess := range s.d.sessions {
+		if sess.UserID == userID && sess.active(now) {
+			list = append(list, sess.Session)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastUsedAt.After(list[j].LastUsedAt) })
+	return list, nil
+}
+
+func (s *SessionStore) Revoke(ctx context.Context, userID, sessionID string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	sess, ok := s.d.sessions[sessionID]
+	if !ok || sess.UserID != userID || !sess.revokedAt.IsZero() {
+		return store.ErrNotFound
+	}
+	sess.revokedAt = time.Now()
+	return nil
+}
+
+func (s *SessionStore) RevokeAll(ctx context.Context, userID string) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return revokeSessions(s.d, userID, time.Now()), nil
+}
@@ -0,0 +1,38 @@
+package memory
+
+import (
+	"backend/internal/models"
+	"context"
+	"sort"
+)
+
+type SubjectStore struct {
+	d *data
+}
+
+// Add stores a subject under the given exam slug.
+func (s *SubjectStore) Add(exam string, subj models.Subject) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	if subj.ID == "" {
+		subj.ID = newID()
+	}
+	s.d.subjects = append(s.d.subjects, subjectRow{exam: exam, subject: subj})
+}
+
+func (s *SubjectStore) List(ctx context.Context, category, exam string) ([]models.Subject, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	subjects := []models.Subject{}
+	for _, row := range s.d.subjects {
+		if (category != "" && row.subject.Category != category) || (exam != "" && row.exam != exam) {
+			continue
+		}
+		subj := row.subject
+		subj.Related = append([]string{}, subj.Related...)
+		subjects = append(subjects, subj)
+	}
+	sort.Slice(subjects, func(i, j int) bool { return subjects[i].Title < subjects[j].Title })
+	return subjects, nil
+}
@@ -0,0 +1,129 @@
+package memory
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"sort"
+	"time"
+)
+
+type SubscriptionStore struct {
+	d *data
+}
+
+func (s *SubscriptionStore) Upsert(ctx context.Context, sub *models.Subscription) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	now := time.Now()
+	for i, prev := range s.d.subscriptions {
+		if prev.Platform != sub.Platform || prev.ExternalID != sub.ExternalID {
+			continue
+		}
+		if prev.UserID != sub.UserID {
+			return store.ErrConflict
+		}
+		sub.ID, sub.CreatedAt, sub.UpdatedAt = prev.ID, prev.CreatedAt, now
+		s.d.subscriptions[i] = *sub
+		return nil
+	}
+	if sub.ID == "" {
+		sub.ID = newID()
+	}
+	sub.CreatedAt, sub.UpdatedAt = now, now
+	s.d.subscriptions = append(s.d.subscriptions, *sub)
+	return nil
+}
+
+func (s *SubscriptionStore) GetByExternalID(ctx context.Context, platform, externalID string) (*models.Subscription, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, sub := range s.d.subscriptions {
+		if sub.Platform == platform && sub.ExternalID == externalID {
+			return &sub, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *SubscriptionStore) ListForUser(ctx context.Context, userID string) ([]models.Subscription, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	list := []models.Subscription{}
+	for _, sub := range s.d.subscriptions {
+		if sub.UserID == userID {
+			list = append(list, sub)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ExpiresAt.After(list[j].ExpiresAt) })
+	return list, nil
+}
+
+// entitled reports whether any of the user's subscriptions entitles them.
+// Callers hold the lock.
+func (d *data) entitled(userID string, now time.Time) (has, entitled bool) {
+	for _, sub := range d.subscriptions {
+		if sub.UserID == userID {
+			has = true
+			entitled = entitled || store.Entitled(sub, now)
+		}
+	}
+	return has, entitled
+}
+
+func (s *SubscriptionStore) SyncEntitlement(ctx context.Context, userID string, now time.Time) (bool, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[userID]
+	if !ok {
+		return false, store.ErrNotFound
+	}
+	_, premium := s.d.entitled(userID, now)
+	u.IsPremium = premium
+	switch {
+	case premium && u.Role == "free":
+		u.Role = "pro"
+	case !premium && u.Role == "pro":
+		u.Role = "free"
+	}
+	return premium, nil
+}
+
+func (s *SubscriptionStore) Stale(ctx context.Context, now, updatedBefore time.Time, limit int) ([]models.Subscription, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	list := []models.Subscription{}
+	for _, sub := range s.d.subscriptions {
+		if (sub.Status == models.SubscriptionActive || sub.Status == models.SubscriptionGrace) &&
+			!store.Entitled(sub, now) && sub.UpdatedAt.Before(updatedBefore) {
+			list = append(list, sub)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ExpiresAt.Before(list[j].ExpiresAt) })
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (s *SubscriptionStore) Lapsed(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	ids := []string{}
+	for _, u := range s.d.users {
+		if !u.IsPremium && u.Role != "pro" {
+			continue
+		}
+		if has, entitled := s.d.entitled(u.ID, now); has && !entitled && len(ids) < limit {
+			ids = append(ids, u.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
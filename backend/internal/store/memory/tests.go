@@ -0,0 +1,229 @@
+package memory
+
+import (
+	"backend/internal/content"
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"math/rand"
+)
+
+type TestStore struct {
+	d *data
+}
+
+// AddExam registers an exam so tests and users can refer to its slug.
+func (s *TestStore) AddExam(e models.Exam) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	s.d.exams = append(s.d.exams, e)
+}
+
+func (s *TestStore) completed(userID, testID string) bool {
+	for _, r := range s.d.results {
+		if r.UserID == userID && r.TestID == testID {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns tests in insertion order, which stands in for the category and
+// test sort order of the Postgres store.
+func (s *TestStore) List(ctx context.Context, f store.TestFilter) ([]models.Test, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	tests := []models.Test{}
+	for _, t := range s.d.tests {
+		if f.Category != "" && t.Category != f.Category && t.CategorySlug != f.Category {
+			continue
+		}
+		if f.Exam != "" && t.Exam != f.Exam {
+			continue
+		}
+		t.Completed = f.UserID != "" && s.completed(f.UserID, t.ID)
+		tests = append(tests, t)
+	}
+	return tests, nil
+}
+
+func (s *TestStore) find(fn func(t models.Test) bool) (*models.Test, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	for _, t := range s.d.tests {
+		if fn(t) {
+			return &t, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *TestStore) Get(ctx context.Context, id string) (*models.Test, error) {
+	return s.find(func(t models.Test) bool { return t.ID == id })
+}
+
+func (s *TestStore) GetByTitle(ctx context.Context, title string) (*models.Test, error) {
+	return s.find(func(t models.Test) bool { return t.Title == title })
+}
+
+func (s *TestStore) Create(ctx context.Context, t *models.Test) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if t.ID == "" {
+		t.ID = newID()
+	}
+	if t.Exam != "" && !s.examExists(t.Exam) {
+		return store.ErrNotFound
+	}
+	if t.CategorySlug == "" && t.Category != "" {
+		t.CategorySlug = content.Slugify(t.Category)
+	}
+	for _, other := range s.d.tests {
+		if other.ID == t.ID || (t.Slug != "" && other.Slug == t.Slug) {
+			return store.ErrConflict
+		}
+	}
+	stored := *t
+	stored.Completed = false
+	s.d.tests = append(s.d.tests, stored)
+	return nil
+}
+
+func (s *TestStore) examExists(slug string) bool {
+	for _, e := range s.d.exams {
+		if e.Slug == slug {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *TestStore) RandomUnsolved(ctx context.Context, userID, exam string) (*models.Test, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var all, unsolved []models.Test
+	for _, t := range s.d.tests {
+		if exam != "" && t.Exam != exam {
+			continue
+		}
+		all = append(all, t)
+		if !s.completed(userID, t.ID) {
+			unsolved = append(unsolved, t)
+		}
+	}
+	if len(unsolved) == 0 {
+		// If all tests are solved, fall back to any test
+		unsolved = all
+	}
+	if len(unsolved) == 0 {
+		return nil, store.ErrNotFound
+	}
+	t := unsolved[rand.Intn(len(unsolved))]
+	return &t, nil
+}
+
+// categories groups the tests of an exam by category slug, in order of first appearance.
+func (s *TestStore) categories(exam string) []models.CategoryProgress {
+	var categories []models.CategoryProgress
+	index := map[string]int{}
+	for _, t := range s.d.tests {
+		if t.CategorySlug == "" || (exam != "" && t.Exam != exam) {
+			continue
+		}
+		i, ok := index[t.CategorySlug]
+		if !ok {
+			i = len(categories)
+			index[t.CategorySlug] = i
+			categories = append(categories, models.CategoryProgress{
+				Category: t.Category, Slug: t.CategorySlug, Order: i + 1, Exam: t.Exam,
+			})
+		}
+		categories[i].TotalTests++
+	}
+	return categories
+}
+
+func (s *TestStore) CategoryNames(ctx context.Context, exam string) ([]string, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	names := []string{}
+	for _, c := range s.categories(exam) {
+		names = append(names, c.Category)
+	}
+	return names, nil
+}
+
+func (s *TestStore) CategoryProgress(ctx context.Context, userID, exam string) ([]models.CategoryProgress, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	categories := s.categories(exam)
+	for i := range categories {
+		for _, t := range s.d.tests {
+			if t.CategorySlug == categories[i].Slug && s.completed(userID, t.ID) {
+				categories[i].CompletedTests++
+			}
+		}
+	}
+	if categories == nil {
+		categories = []models.CategoryProgress{}
+	}
+	return categories, nil
+}
+
+func (s *TestStore) Exams(ctx context.Context) ([]models.Exam, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return append([]models.Exam{}, s.d.exams...), nil
+}
+
+// ExamTaxonomy derives the tree from the free-text category, subject and topic
+// of the exam's questions, using slugs as IDs.
+func (s *TestStore) ExamTaxonomy(ctx context.Context, examSlug string) ([]models.ExamCategory, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if !s.examExists(examSlug) {
+		return nil, store.ErrNotFound
+	}
+
+	categories := []models.ExamCategory{}
+	for i, c := range s.categories(examSlug) {
+		node := models.ExamCategory{ID: c.Slug, Slug: c.Slug, Name: c.Category, Order: i + 1, Subjects: []models.TaxonomySubject{}}
+		subjects := map[string]int{}
+		topics := map[string]bool{}
+		for _, q := range s.d.questions {
+			if content.Slugify(q.Category) != c.Slug || content.Slugify(q.Subject) == "" {
+				continue
+			}
+			subjSlug := content.Slugify(q.Subject)
+			si, ok := subjects[subjSlug]
+			if !ok {
+				si = len(node.Subjects)
+				subjects[subjSlug] = si
+				node.Subjects = append(node.Subjects, models.TaxonomySubject{ID: subjSlug, Slug: subjSlug, Name: q.Subject, Topics: []models.TaxonomyTopic{}})
+			}
+			topicSlug := content.Slugify(q.Topic)
+			if topicSlug == "" || topics[subjSlug+"/"+topicSlug] {
+				continue
+			}
+			topics[subjSlug+"/"+topicSlug] = true
+			node.Subjects[si].Topics = append(node.Subjects[si].Topics, models.TaxonomyTopic{ID: topicSlug, Slug: topicSlug, Name: q.Topic})
+		}
+		categories = append(categories, node)
+	}
+	return categories, nil
+}
+
+func (s *TestStore) Count(ctx context.Context) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return len(s.d.tests), nil
+}
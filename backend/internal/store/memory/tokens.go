@@ -0,0 +1,122 @@
+package memory
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"sort"
+	"time"
+)
+
+type TokenStore struct {
+	d *data
+}
+
+func (s *TokenStore) Balance(ctx context.Context, userID string) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[userID]
+	if !ok {
+		return 0, store.ErrNotFound
+	}
+	return u.Tokens, nil
+}
+
+func (s *TokenStore) Record(ctx context.Context, t *models.TokenTransaction) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return s.d.recordTokens(t, nil)
+}
+
+func (s *TokenStore) RecordCapped(ctx context.Context, t *models.TokenTransaction, since time.Time, max int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return s.d.recordTokens(t, func() bool {
+		n := 0
+		for _, prev := range s.d.tokenTx {
+			if prev.UserID == t.UserID && prev.Reason == t.Reason && !prev.CreatedAt.Before(since) {
+				n++
+			}
+		}
+		return n >= max
+	})
+}
+
+// recordTokens appends a ledger entry and moves the cached balance with it.
+// capped, if set, reports whether the quota is used up. Callers hold the lock.
+func (d *data) recordTokens(t *models.TokenTransaction, capped func() bool) error {
+	u, ok := d.users[t.UserID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	if t.IdempotencyKey != "" {
+		for _, prev := range d.tokenTx {
+			if prev.UserID == t.UserID && prev.IdempotencyKey == t.IdempotencyKey {
+				*t = prev
+				return store.ErrDuplicate
+			}
+		}
+	}
+	if capped != nil && capped() {
+		return store.ErrLimitReached
+	}
+	if u.Tokens+t.Amount < 0 {
+		return store.ErrInsufficientTokens
+	}
+
+	if t.ID == "" {
+		t.ID = newID()
+	}
+	u.Tokens += t.Amount
+	t.BalanceAfter = u.Tokens
+	t.CreatedAt = time.Now()
+	d.tokenTx = append(d.tokenTx, *t)
+	return nil
+}
+
+func (s *TokenStore) History(ctx context.Context, userID string, before time.Time, limit int) ([]models.TokenTransaction, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	list := []models.TokenTransaction{}
+	for i := len(s.d.tokenTx) - 1; i >= 0 && len(list) < limit; i-- {
+		t := s.d.tokenTx[i]
+		if t.UserID == userID && (before.IsZero() || t.CreatedAt.Before(before)) {
+			list = append(list, t)
+		}
+	}
+	return list, nil
+}
+
+func (s *TokenStore) Reconcile(ctx context.Context) ([]models.TokenDrift, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	ledger := map[string]int{}
+	for _, t := range s.d.tokenTx {
+		ledger[t.UserID] += t.Amount
+	}
+	list := []models.TokenDrift{}
+	for _, u := range s.d.users {
+		if u.Tokens != ledger[u.ID] {
+			list = append(list, models.TokenDrift{UserID: u.ID, Nickname: u.Nickname,
+				Cached: u.Tokens, Ledger: ledger[u.ID], Drift: u.Tokens - ledger[u.ID]})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := abs(list[i].Drift), abs(list[j].Drift)
+		if a != b {
+			return a > b
+		}
+		return list[i].UserID < list[j].UserID
+	})
+	return list, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,493 @@
+package memory
+
+import (
+	"backend/internal/models"
+	"backend/internal/progression"
+	"backend/internal/store"
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+type UserStore struct {
+	d *data
+}
+
+// find returns a copy of the first user matching fn. Callers hold the lock.
+func (s *UserStore) find(fn func(u *models.User) bool) (*models.User, error) {
+	for _, u := range s.d.users {
+		if fn(u) {
+			clone := *u
+			clone.Providers = s.d.providers(u.ID)
+			return &clone, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *UserStore) Get(ctx context.Context, id string) (*models.User, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return s.find(func(u *models.User) bool { return u.ID == id })
+}
+
+func (s *UserStore) GetByNickname(ctx context.Context, nickname string) (*models.User, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return s.find(func(u *models.User) bool { return u.Nickname == nickname })
+}
+
+func (s *UserStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return s.find(func(u *models.User) bool { return u.Email != "" && strings.EqualFold(u.Email, email) })
+}
+
+// conflicts reports whether another user already holds one of u's unique fields.
+func (s *UserStore) conflicts(u *models.User) bool {
+	for _, other := range s.d.users {
+		if other.ID == u.ID {
+			continue
+		}
+		if other.Nickname == u.Nickname || (u.Email != "" && strings.EqualFold(other.Email, u.Email)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *UserStore) Create(ctx context.Context, u *models.User) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if u.ID == "" {
+		u.ID = newID()
+	}
+	if u.Provider == "" {
+		u.Provider = "local"
+	}
+	if u.Role == "" {
+		u.Role = "free"
+	}
+	if u.Streak == 0 {
+		u.Streak = 1
+	}
+	if u.Level == 0 {
+		u.Level = 1
+	}
+	if u.Timezone == "" {
+		u.Timezone = store.DefaultTimezone
+	}
+	u.LastActiveDate = today(u.Timezone)
+
+	if _, exists := s.d.users[u.ID]; exists || s.conflicts(u) {
+		return store.ErrConflict
+	}
+	opening := u.Tokens
+	clone := *u
+	clone.Tokens = 0
+	s.d.users[u.ID] = &clone
+	if opening != 0 {
+		return s.d.recordTokens(&models.TokenTransaction{UserID: u.ID, Amount: opening, Reason: "opening_balance"}, nil)
+	}
+	return nil
+}
+
+// update applies fn to the stored user, failing with ErrNotFound if it doesn't exist.
+func (s *UserStore) update(id string, fn func(u *models.User) error) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	return fn(u)
+}
+
+func (s *UserStore) UpdateProfile(ctx context.Context, id, nickname, emoji string) error {
+	return s.update(id, func(u *models.User) error {
+		candidate := *u
+		candidate.Nickname = nickname
+		if s.conflicts(&candidate) {
+			return store.ErrConflict
+		}
+		u.Nickname, u.Emoji = nickname, emoji
+		return nil
+	})
+}
+
+func (s *UserStore) AddStreakFreeze(ctx context.Context, id string, cost *models.TokenTransaction, max int) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[id]
+	if !ok {
+		return 0, store.ErrNotFound
+	}
+	if cost != nil {
+		// Checked first so that a retry reports the duplicate rather than the cap
+		for _, prev := range s.d.tokenTx {
+			if cost.IdempotencyKey != "" && prev.UserID == id && prev.IdempotencyKey == cost.IdempotencyKey {
+				*cost = prev
+				return u.StreakFreezes, store.ErrDuplicate
+			}
+		}
+	}
+	if u.StreakFreezes >= max {
+		return u.StreakFreezes, store.ErrLimitReached
+	}
+	if cost != nil {
+		if err := s.d.recordTokens(cost, nil); err != nil {
+			return u.StreakFreezes, err
+		}
+	}
+	u.StreakFreezes++
+	return u.StreakFreezes, nil
+}
+
+func (s *UserStore) SetTimezone(ctx context.Context, id, timezone string) error {
+	return s.update(id, func(u *models.User) error {
+		u.Timezone = timezone
+		return nil
+	})
+}
+
+func (s *UserStore) SetRole(ctx context.Context, id, role string) error {
+	return s.update(id, func(u *models.User) error {
+		u.Role = role
+		revokeSessions(s.d, id, time.Now())
+		return nil
+	})
+}
+
+func (s *UserStore) SelectExam(ctx context.Context, id, examSlug string) error {
+	return s.update(id, func(u *models.User) error {
+		for _, e := range s.d.exams {
+			if e.Slug == examSlug {
+				u.SelectedExam = examSlug
+				return nil
+			}
+		}
+		return store.ErrNotFound
+	})
+}
+
+// SetStreak overwrites the user's streak and last active date, e.g. to
+// seed missed days; UpdateStreak never moves the date back.
+func (s *UserStore) SetStreak(id string, streak int, lastActiveDate string) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if u, ok := s.d.users[id]; ok {
+		u.Streak, u.LastActiveDate = streak, lastActiveDate
+	}
+}
+
+func (s *UserStore) UpdateStreak(ctx context.Context, id string, update store.StreakUpdate) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[id]
+	if !ok {
+		return 0, store.ErrNotFound
+	}
+	counted := u.LastActiveDate != "" && u.LastActiveDate >= update.Day && u.Streak != 0
+	if counted || u.StreakFreezes < len(update.Frozen) {
+		return 0, store.ErrConflict
+	}
+	u.Streak, u.LastActiveDate = update.Streak, update.Day
+	u.StreakFreezes -= len(update.Frozen)
+	if update.EarnFreeze && u.StreakFreezes < update.MaxFreezes {
+		u.StreakFreezes++
+	}
+	for _, day := range update.Frozen {
+		if s.d.dayActivity(id, day) == nil {
+			s.d.activity = append(s.d.activity, models.DailyActivity{UserID: id, Day: day, Frozen: true})
+		}
+	}
+	return u.StreakFreezes, nil
+}
+
+func (s *UserStore) AddProgress(ctx context.Context, id string, gained, scoreDelta int, curve progression.Curve) (*models.User, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	u.TotalXP += gained
+	u.Level, u.XP = curve.Level(u.TotalXP)
+	u.TotalScore += scoreDelta
+	clone := *u
+	clone.Providers = s.d.providers(id)
+	return &clone, nil
+}
+
+func (s *UserStore) SetTotalXP(ctx context.Context, id string, total int, curve progression.Curve) error {
+	return s.update(id, func(u *models.User) error {
+		u.TotalXP = max(total, 0)
+		u.Level, u.XP = curve.Level(u.TotalXP)
+		return nil
+	})
+}
+
+func (s *UserStore) ListIDs(ctx context.Context, after string, limit int) ([]string, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	ids := []string{}
+	for id := range s.d.users {
+		if id > after && id != store.TombstoneUserID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids[:min(limit, len(ids))], nil
+}
+
+func (s *UserStore) Delete(ctx context.Context, id string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.users[id]; !ok {
+		return store.ErrNotFound
+	}
+	s.d.dropUser(id)
+
+	kept := s.d.results[:0]
+	for _, r := range s.d.results {
+		if r.UserID != id {
+			kept = append(kept, r)
+		}
+	}
+	s.d.results = kept
+	return nil
+}
+
+// dropUser removes the user and the rows that cascade with it in Postgres.
+// Test results are left to the caller. Callers hold the lock.
+func (d *data) dropUser(id string) {
+	delete(d.users, id)
+	delete(d.secrets, id)
+	d.identities = slices.DeleteFunc(d.identities, func(i models.Identity) bool { return i.UserID == id })
+	for sid, sess := range d.sessions {
+		if sess.UserID == id {
+			delete(d.sessions, sid)
+		}
+	}
+	for hash, t := range d.refreshTokens {
+		if _, ok := d.sessions[t.sessionID]; !ok {
+			delete(d.refreshTokens, hash)
+		}
+	}
+	for hash, v := range d.verifications {
+		if v.userID == id {
+			delete(d.verifications, hash)
+		}
+	}
+	for eid, e := range d.exports {
+		if e.UserID == id {
+			delete(d.exports, eid)
+		}
+	}
+	d.tokenTx = slices.DeleteFunc(d.tokenTx, func(t models.TokenTransaction) bool { return t.UserID == id })
+	d.dailyClaims = slices.DeleteFunc(d.dailyClaims, func(c models.DailyRewardClaim) bool { return c.UserID == id })
+	d.subscriptions = slices.DeleteFunc(d.subscriptions, func(s models.Subscription) bool { return s.UserID == id })
+	d.achievements = slices.DeleteFunc(d.achievements, func(a models.UserAchievement) bool { return a.UserID == id })
+	d.leagueMembers = slices.DeleteFunc(d.leagueMembers, func(m models.LeagueMembership) bool { return m.UserID == id })
+	d.leaderboard = slices.DeleteFunc(d.leaderboard, func(r leaderboardRow) bool { return r.userID == id })
+	d.activity = slices.DeleteFunc(d.activity, func(a models.DailyActivity) bool { return a.UserID == id })
+}
+
+func (s *UserStore) ScheduleDeletion(ctx context.Context, id string, purgeAt time.Time) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[id]
+	if !ok || id == store.TombstoneUserID {
+		return store.ErrNotFound
+	}
+	u.DeletionScheduledFor = &purgeAt
+	revokeSessions(s.d, id, time.Now())
+	return nil
+}
+
+func (s *UserStore) CancelDeletion(ctx context.Context, id string) (bool, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[id]
+	if !ok || u.DeletionScheduledFor == nil {
+		return false, nil
+	}
+	u.DeletionScheduledFor = nil
+	return true, nil
+}
+
+func (s *UserStore) DueForDeletion(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var due []*models.User
+	for _, u := range s.d.users {
+		if u.DeletionScheduledFor != nil && !u.DeletionScheduledFor.After(now) {
+			due = append(due, u)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].DeletionScheduledFor.Before(*due[j].DeletionScheduledFor) })
+
+	ids := []string{}
+	for i := 0; i < len(due) && i < limit; i++ {
+		ids = append(ids, due[i].ID)
+	}
+	return ids, nil
+}
+
+func (s *UserStore) Purge(ctx context.Context, id string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if id == store.TombstoneUserID {
+		return store.ErrConflict
+	}
+	if _, ok := s.d.users[id]; !ok {
+		return store.ErrNotFound
+	}
+	if _, ok := s.d.users[store.TombstoneUserID]; !ok {
+		// Seeded by a migration in Postgres
+		s.d.users[store.TombstoneUserID] = &models.User{ID: store.TombstoneUserID, Nickname: "[silinmiş kullanıcı]",
+			Emoji: "👤", Provider: "local", Role: "free", Level: 1, Providers: []string{}, Timezone: store.DefaultTimezone}
+	}
+	for i := range s.d.results {
+		if s.d.results[i].UserID == id {
+			s.d.results[i].UserID = store.TombstoneUserID
+		}
+	}
+	s.d.dropUser(id)
+	return nil
+}
+
+func (s *UserStore) TopByScore(ctx context.Context, limit int) ([]models.LeaderboardEntry, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	users := make([]*models.User, 0, len(s.d.users))
+	for _, u := range s.d.users {
+		if u.ID != store.TombstoneUserID && u.DeletionScheduledFor == nil && !u.LeaderboardHidden {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].TotalScore != users[j].TotalScore {
+			return users[i].TotalScore > users[j].TotalScore
+		}
+		return users[i].ID < users[j].ID
+	})
+
+	list := []models.LeaderboardEntry{}
+	for i := 0; i < len(users) && i < limit; i++ {
+		u := users[i]
+		list = append(list, models.LeaderboardEntry{Nickname: u.Nickname, Emoji: u.Emoji, Score: u.TotalScore, Streak: u.Streak})
+	}
+	return list, nil
+}
+
+func (s *UserStore) Merge(ctx context.Context, keepID, absorbID string, curve progression.Curve) (*store.MergeReport, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	keep, ok := s.d.users[keepID]
+	absorb, ok2 := s.d.users[absorbID]
+	if !ok || !ok2 {
+		return nil, store.ErrNotFound
+	}
+	if keepID == absorbID {
+		return nil, store.ErrConflict
+	}
+	keepProviders := s.d.providers(keepID)
+	for _, p := range s.d.providers(absorbID) {
+		if slices.Contains(keepProviders, p) {
+			return nil, store.ErrConflict
+		}
+	}
+
+	report := &store.MergeReport{TokensAdded: absorb.Tokens, XPAdded: absorb.TotalXP}
+	for i := range s.d.results {
+		if s.d.results[i].UserID == absorbID {
+			s.d.results[i].UserID = keepID
+			report.ResultsMoved++
+		}
+	}
+	for i := range s.d.identities {
+		if s.d.identities[i].UserID == absorbID {
+			s.d.identities[i].UserID = keepID
+			report.IdentitiesMoved++
+		}
+	}
+	for i := range s.d.subscriptions {
+		if s.d.subscriptions[i].UserID == absorbID {
+			s.d.subscriptions[i].UserID = keepID
+		}
+	}
+	// Achievements keep has too stay with keep; their rewards are already in the totals
+	earned := map[string]bool{}
+	for _, a := range s.d.achievements {
+		if a.UserID == keepID {
+			earned[a.AchievementID] = true
+		}
+	}
+	for i, a := range s.d.achievements {
+		if a.UserID == absorbID && !earned[a.AchievementID] {
+			s.d.achievements[i].UserID = keepID
+		}
+	}
+	// Activity adds up day by day; a day either account practiced isn't frozen
+	for _, a := range s.d.activity {
+		if a.UserID != absorbID {
+			continue
+		}
+		if kept := s.d.dayActivity(keepID, a.Day); kept != nil {
+			kept.Tests, kept.Score, kept.XP = kept.Tests+a.Tests, kept.Score+a.Score, kept.XP+a.XP
+			kept.Frozen = kept.Frozen && a.Frozen
+		} else {
+			a.UserID = keepID
+			s.d.activity = append(s.d.activity, a)
+		}
+	}
+	// Leaderboard scores add up like total_score does
+	for _, r := range s.d.leaderboard {
+		if r.userID == absorbID {
+			s.d.addScore(keepID, r.score, r.BoardPeriod)
+		}
+	}
+	if keep.Email == "" && absorb.Email != "" {
+		keep.Email, keep.EmailVerified = absorb.Email, absorb.EmailVerified
+		row := s.d.secrets[keepID]
+		row.passwordHash = s.d.secrets[absorbID].passwordHash
+		s.d.secrets[keepID] = row
+		report.EmailMoved = true
+	}
+
+	merged := store.MergeUsers(*keep, *absorb, curve)
+	if merged.Role != keep.Role {
+		revokeSessions(s.d, keepID, time.Now())
+	}
+	merged.Email, merged.EmailVerified = keep.Email, keep.EmailVerified
+	// The balance moves through the ledger rather than with the merged row
+	merged.Tokens = keep.Tokens
+	*keep = merged
+	if absorb.Tokens != 0 {
+		if err := s.d.recordTokens(&models.TokenTransaction{UserID: keepID, Amount: absorb.Tokens,
+			Reason: "merge", Reference: absorbID}, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	// Sessions and pending verifications of the absorbed account go with it
+	s.d.dropUser(absorbID)
+	return report, nil
+}
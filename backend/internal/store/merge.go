@@ -0,0 +1,54 @@
+package store
+
+import (
+	"backend/internal/models"
+	"backend/internal/progression"
+)
+
+// PointsPerQuestion matches the scoring in the app's TestScreen: a test's
+// score is this many points per correct answer.
+const PointsPerQuestion = 2
+
+// roleRank orders roles so that merging never drops privileges.
+var roleRank = map[string]int{"free": 0, "pro": 1, "moderator": 2, "editor": 3, "admin": 4}
+
+// MergeUsers returns keep with absorb's progress folded in. The conflict rules:
+//   - identity fields (ID, nickname, emoji, provider, selected exam) stay
+//     with keep; the exam falls back to absorb's if keep has none
+//   - total score, tokens, streak freezes and lifetime XP are added up; level and XP are
+//     recomputed from the combined lifetime XP along curve
+//   - the longer streak wins, together with the later last active date
+//   - the higher role and league tier win; premium and the leaderboard
+//     opt-out are kept if either account had them
+//   - leaderboard scores and practice activity are added up by the stores,
+//     period by period and day by day
+//
+// Email and credentials are handled by the stores: absorb's email (with its
+// verification and password) moves over only when keep has no email.
+func MergeUsers(keep, absorb models.User, curve progression.Curve) models.User {
+	merged := keep
+	merged.TotalScore = keep.TotalScore + absorb.TotalScore
+	merged.Tokens = keep.Tokens + absorb.Tokens
+	merged.StreakFreezes = keep.StreakFreezes + absorb.StreakFreezes
+
+	merged.TotalXP = keep.TotalXP + absorb.TotalXP
+	merged.Level, merged.XP = curve.Level(merged.TotalXP)
+
+	if absorb.Streak > keep.Streak {
+		merged.Streak = absorb.Streak
+	}
+	if absorb.LastActiveDate > keep.LastActiveDate {
+		merged.LastActiveDate = absorb.LastActiveDate
+	}
+
+	if roleRank[absorb.Role] > roleRank[keep.Role] {
+		merged.Role = absorb.Role
+	}
+	merged.IsPremium = keep.IsPremium || absorb.IsPremium
+	merged.LeagueTier = max(keep.LeagueTier, absorb.LeagueTier)
+	merged.LeaderboardHidden = keep.LeaderboardHidden || absorb.LeaderboardHidden
+	if merged.SelectedExam == "" {
+		merged.SelectedExam = absorb.SelectedExam
+	}
+	return merged
+}
@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"backend/internal/models"
+	"backend/internal/progression"
+	"backend/internal/store"
+	"context"
+	"database/sql"
+)
+
+type AchievementStore struct {
+	db *sql.DB
+}
+
+func (s *AchievementStore) Stats(ctx context.Context, userID string) (*models.AchievementStats, error) {
+	var st models.AchievementStats
+	err := s.db.QueryRowContext(ctx, `WITH q AS (
+			SELECT test_id, COUNT(*) AS n FROM questions WHERE retired_at IS NULL GROUP BY test_id
+		), r AS (
+			SELECT r.test_id, r.score, COALESCE(q.n, 0) AS n
+			FROM test_results r LEFT JOIN q ON q.test_id = r.test_id
+			WHERE r.user_id = $1
+		)
+		SELECT COUNT(DISTINCT test_id),
+			COUNT(DISTINCT test_id) FILTER (WHERE n > 0 AND score >= n * $2),
+			-- Retakes answer the same questions again
+			COALESCE((SELECT SUM(n) FROM (SELECT DISTINCT test_id, n FROM r) t), 0)
+		FROM r`, uuidArg(userID), store.PointsPerQuestion).
+		Scan(&st.TestsCompleted, &st.PerfectScores, &st.QuestionsAnswered)
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (s *AchievementStore) List(ctx context.Context, userID string) ([]models.UserAchievement, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT achievement_id, xp, tokens, earned_at FROM user_achievements
+		WHERE user_id = $1 ORDER BY earned_at, achievement_id`, uuidArg(userID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.UserAchievement{}
+	for rows.Next() {
+		a := models.UserAchievement{UserID: userID}
+		if err := rows.Scan(&a.AchievementID, &a.XP, &a.Tokens, &a.EarnedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+func (s *AchievementStore) Award(ctx context.Context, a *models.UserAchievement, curve progression.Curve) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, "SELECT TRUE FROM users WHERE id = $1 FOR UPDATE", uuidArg(a.UserID)).Scan(&locked); err != nil {
+		return notFound(err)
+	}
+	err = tx.QueryRowContext(ctx, `INSERT INTO user_achievements (user_id, achievement_id, xp, tokens)
+		VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING RETURNING earned_at`,
+		a.UserID, a.AchievementID, a.XP, a.Tokens).Scan(&a.EarnedAt)
+	if err == sql.ErrNoRows {
+		return store.ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+
+	if a.Tokens > 0 {
+		t := &models.TokenTransaction{UserID: a.UserID, Amount: a.Tokens, Reason: "achievement", Reference: a.AchievementID,
+			IdempotencyKey: "achievement:" + a.AchievementID}
+		if err := recordTokensTx(ctx, tx, t, nil); err != nil {
+			return err
+		}
+	}
+	if a.XP > 0 {
+		if err := setTotalXPTx(ctx, tx, a.UserID, -1, a.XP, curve); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
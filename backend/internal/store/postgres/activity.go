@@ -0,0 +1,39 @@
+package postgres
+
+import (
+	"backend/internal/models"
+	"context"
+	"database/sql"
+)
+
+type ActivityStore struct {
+	db *sql.DB
+}
+
+func (s *ActivityStore) Record(ctx context.Context, a *models.DailyActivity) error {
+	return requireRow(s.db.ExecContext(ctx, `INSERT INTO user_activity (user_id, day, tests, score, xp)
+		SELECT id, $2::date, $3, $4, $5 FROM users WHERE id = $1
+		ON CONFLICT (user_id, day) DO UPDATE SET tests = user_activity.tests + EXCLUDED.tests,
+			score = user_activity.score + EXCLUDED.score, xp = user_activity.xp + EXCLUDED.xp, frozen = FALSE`,
+		uuidArg(a.UserID), a.Day, a.Tests, a.Score, a.XP))
+}
+
+func (s *ActivityStore) List(ctx context.Context, userID, from, to string) ([]models.DailyActivity, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT day::text, tests, score, xp, frozen FROM user_activity
+		WHERE user_id = $1 AND day BETWEEN $2::date AND $3::date
+		ORDER BY day`, uuidArg(userID), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.DailyActivity{}
+	for rows.Next() {
+		a := models.DailyActivity{UserID: userID}
+		if err := rows.Scan(&a.Day, &a.Tests, &a.Score, &a.XP, &a.Frozen); err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
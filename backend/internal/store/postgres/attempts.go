@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type AttemptStore struct {
+	db *sql.DB
+}
+
+func (s *AttemptStore) Start(ctx context.Context, a *models.TestAttempt) error {
+	a.ID, a.SubmittedAt, a.Answers = newID(), nil, []models.AttemptAnswer{}
+	err := s.db.QueryRowContext(ctx, `INSERT INTO test_attempts (id, user_id, test_id)
+		SELECT $1, u.id, t.id FROM users u, tests t WHERE u.id = $2 AND t.id = $3
+		RETURNING started_at`, a.ID, uuidArg(a.UserID), uuidArg(a.TestID)).Scan(&a.StartedAt)
+	return notFound(err)
+}
+
+// getAttempt reads an attempt and its answers through q, locking the
+// attempt's row if lock is set.
+func getAttempt(ctx context.Context, q querier, id string, lock bool) (*models.TestAttempt, error) {
+	query := `SELECT id, user_id, test_id, started_at, submitted_at FROM test_attempts WHERE id = $1`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+	var a models.TestAttempt
+	var submitted sql.NullTime
+	err := q.QueryRowContext(ctx, query, uuidArg(id)).Scan(&a.ID, &a.UserID, &a.TestID, &a.StartedAt, &submitted)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if submitted.Valid {
+		a.SubmittedAt = &submitted.Time
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT question_id, option_text, correct FROM attempt_answers
+		WHERE attempt_id = $1 ORDER BY answered_at, question_id`, a.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	a.Answers = []models.AttemptAnswer{}
+	for rows.Next() {
+		var answer models.AttemptAnswer
+		if err := rows.Scan(&answer.QuestionID, &answer.OptionText, &answer.Correct); err != nil {
+			return nil, err
+		}
+		a.Answers = append(a.Answers, answer)
+	}
+	return &a, rows.Err()
+}
+
+func (s *AttemptStore) Get(ctx context.Context, id string) (*models.TestAttempt, error) {
+	return getAttempt(ctx, s.db, id, false)
+}
+
+func (s *AttemptStore) Answer(ctx context.Context, attemptID string, a models.AttemptAnswer) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locking the attempt orders answers after a concurrent submission
+	var submitted bool
+	err = tx.QueryRowContext(ctx, "SELECT submitted_at IS NOT NULL FROM test_attempts WHERE id = $1 FOR UPDATE",
+		uuidArg(attemptID)).Scan(&submitted)
+	if err != nil {
+		return notFound(err)
+	}
+	if submitted {
+		return store.ErrConflict
+	}
+	var answered bool
+	err = tx.QueryRowContext(ctx, `INSERT INTO attempt_answers (attempt_id, question_id, option_text, correct)
+		VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING RETURNING TRUE`,
+		attemptID, uuidArg(a.QuestionID), a.OptionText, a.Correct).Scan(&answered)
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *AttemptStore) Submit(ctx context.Context, id string) (*models.TestAttempt, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	a, err := getAttempt(ctx, tx, id, true)
+	if err != nil {
+		return nil, err
+	}
+	if a.SubmittedAt != nil {
+		return nil, store.ErrConflict
+	}
+	err = tx.QueryRowContext(ctx, "UPDATE test_attempts SET submitted_at = NOW() WHERE id = $1 RETURNING submitted_at",
+		a.ID).Scan(&a.SubmittedAt)
+	if err != nil {
+		return nil, err
+	}
+	return a, tx.Commit()
+}
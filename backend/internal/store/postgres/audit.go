@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+type AuditStore struct {
+	db *sql.DB
+}
+
+func (s *AuditStore) Append(ctx context.Context, e *models.AuditEntry) error {
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	return s.db.QueryRowContext(ctx, `INSERT INTO audit_log (id, actor_id, action, target_type, target_id, before, after)
+		VALUES ($1, NULLIF($2, '')::uuid, $3, $4, $5, $6, $7) RETURNING created_at`,
+		e.ID, e.ActorID, e.Action, e.TargetType, e.TargetID, nullJSON(e.Before), nullJSON(e.After)).
+		Scan(&e.CreatedAt)
+}
+
+func (s *AuditStore) List(ctx context.Context, f store.AuditFilter) ([]models.AuditEntry, error) {
+	var where []string
+	var args []any
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if f.ActorID != "" {
+		add("actor_id = $%d", uuidArg(f.ActorID))
+	}
+	if f.Action != "" {
+		add("action = $%d", f.Action)
+	}
+	if f.TargetType != "" {
+		add("target_type = $%d", f.TargetType)
+	}
+	if f.TargetID != "" {
+		add("target_id = $%d", f.TargetID)
+	}
+	if !f.Before.IsZero() {
+		add("created_at < $%d", f.Before)
+	}
+	query := `SELECT id, COALESCE(actor_id::text, ''), action, target_type, target_id, before, after, created_at FROM audit_log`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, f.Limit)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.Action, &e.TargetType, &e.TargetID, &before, &after, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Before, e.After = before, after
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+// nullJSON stores an empty snapshot as SQL NULL rather than invalid JSON.
+func nullJSON(raw []byte) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
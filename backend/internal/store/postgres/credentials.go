@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"backend/internal/store"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type CredentialStore struct {
+	db *sql.DB
+}
+
+func (s *CredentialStore) getWhere(ctx context.Context, where string, args ...any) (*store.Credentials, error) {
+	var c store.Credentials
+	err := s.db.QueryRowContext(ctx, `SELECT id, COALESCE(device_secret_hash, ''), COALESCE(email, ''),
+		COALESCE(password_hash, ''), email_verified_at IS NOT NULL
+		FROM users WHERE `+where, args...).
+		Scan(&c.UserID, &c.DeviceSecretHash, &c.Email, &c.PasswordHash, &c.EmailVerified)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &c, nil
+}
+
+func (s *CredentialStore) Get(ctx context.Context, userID string) (*store.Credentials, error) {
+	return s.getWhere(ctx, "id = $1", uuidArg(userID))
+}
+
+func (s *CredentialStore) GetByEmail(ctx context.Context, email string) (*store.Credentials, error) {
+	return s.getWhere(ctx, "LOWER(email) = LOWER($1)", email)
+}
+
+func (s *CredentialStore) SetDeviceSecret(ctx context.Context, userID, secretHash string) error {
+	return requireRow(s.db.ExecContext(ctx, "UPDATE users SET device_secret_hash = $1 WHERE id = $2", secretHash, uuidArg(userID)))
+}
+
+func (s *CredentialStore) SetPassword(ctx context.Context, userID, email, passwordHash string) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE users SET
+		email_verified_at = CASE WHEN LOWER(COALESCE(email, '')) = LOWER($2) THEN email_verified_at END,
+		email = $2, password_hash = $3
+		WHERE id = $1`, uuidArg(userID), email, passwordHash)
+	return requireRow(result, uniqueViolation(err))
+}
+
+func (s *CredentialStore) AddEmailVerification(ctx context.Context, userID, email, tokenHash string, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO email_verifications (token_hash, user_id, email, expires_at)
+		VALUES ($1, $2, $3, $4)`, tokenHash, userID, email, expiresAt)
+	return err
+}
+
+func (s *CredentialStore) VerifyEmail(ctx context.Context, tokenHash string, now time.Time) (string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var userID, email string
+	err = tx.QueryRowContext(ctx, `DELETE FROM email_verifications WHERE token_hash = $1 AND expires_at > $2
+		RETURNING user_id, email`, tokenHash, now).Scan(&userID, &email)
+	if err != nil {
+		return "", notFound(err)
+	}
+
+	if err := requireRow(tx.ExecContext(ctx, `UPDATE users SET email_verified_at = $1
+		WHERE id = $2 AND LOWER(email) = LOWER($3)`, now, userID, email)); err != nil {
+		return "", err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM email_verifications WHERE user_id = $1", userID); err != nil {
+		return "", err
+	}
+	return userID, tx.Commit()
+}
@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type DailyRewardStore struct {
+	db *sql.DB
+}
+
+func (s *DailyRewardStore) Last(ctx context.Context, userID string) (*models.DailyRewardClaim, error) {
+	c := models.DailyRewardClaim{UserID: userID}
+	err := s.db.QueryRowContext(ctx, `SELECT day::text, calendar_day, tokens, bonus, transaction_id, claimed_at
+		FROM daily_reward_claims WHERE user_id = $1 ORDER BY day DESC LIMIT 1`, uuidArg(userID)).
+		Scan(&c.Day, &c.CalendarDay, &c.Tokens, &c.Bonus, &c.TransactionID, &c.ClaimedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &c, nil
+}
+
+func (s *DailyRewardStore) Claim(ctx context.Context, c *models.DailyRewardClaim) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locking the user serializes claims, so the day check below holds
+	var claimed bool
+	err = tx.QueryRowContext(ctx, "SELECT TRUE FROM users WHERE id = $1 FOR UPDATE", uuidArg(c.UserID)).Scan(&claimed)
+	if err != nil {
+		return notFound(err)
+	}
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM daily_reward_claims WHERE user_id = $1 AND day >= $2::date)",
+		uuidArg(c.UserID), c.Day).Scan(&claimed)
+	if err != nil {
+		return err
+	}
+	if claimed {
+		return store.ErrDuplicate
+	}
+
+	t := &models.TokenTransaction{UserID: c.UserID, Amount: c.Tokens + c.Bonus, Reason: "daily_login",
+		Reference: fmt.Sprintf("day %d", c.CalendarDay), IdempotencyKey: "daily:" + c.Day}
+	if err := recordTokensTx(ctx, tx, t, nil); err != nil {
+		return err
+	}
+	c.TransactionID = t.ID
+	err = tx.QueryRowContext(ctx, `INSERT INTO daily_reward_claims (user_id, day, calendar_day, tokens, bonus, transaction_id)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING claimed_at`,
+		c.UserID, c.Day, c.CalendarDay, c.Tokens, c.Bonus, c.TransactionID).Scan(&c.ClaimedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
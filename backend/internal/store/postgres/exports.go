@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"backend/internal/models"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type ExportStore struct {
+	db *sql.DB
+}
+
+const exportColumns = `id, user_id, status, error, size_bytes, created_at, completed_at, expires_at`
+
+func scanExport(row interface{ Scan(...any) error }) (*models.DataExport, error) {
+	var e models.DataExport
+	var completed, expires sql.NullTime
+	if err := row.Scan(&e.ID, &e.UserID, &e.Status, &e.Error, &e.SizeBytes, &e.CreatedAt, &completed, &expires); err != nil {
+		return nil, notFound(err)
+	}
+	if completed.Valid {
+		e.CompletedAt = &completed.Time
+	}
+	if expires.Valid {
+		e.ExpiresAt = &expires.Time
+	}
+	return &e, nil
+}
+
+func (s *ExportStore) Create(ctx context.Context, e *models.DataExport) error {
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	e.Status = "pending"
+	return s.db.QueryRowContext(ctx, `INSERT INTO data_exports (id, user_id) VALUES ($1, $2) RETURNING created_at`,
+		e.ID, e.UserID).Scan(&e.CreatedAt)
+}
+
+func (s *ExportStore) Get(ctx context.Context, userID, id string) (*models.DataExport, error) {
+	return scanExport(s.db.QueryRowContext(ctx, `SELECT `+exportColumns+` FROM data_exports
+		WHERE id = $1 AND user_id = $2`, uuidArg(id), uuidArg(userID)))
+}
+
+func (s *ExportStore) Pending(ctx context.Context, userID string, since time.Time) (*models.DataExport, error) {
+	return scanExport(s.db.QueryRowContext(ctx, `SELECT `+exportColumns+` FROM data_exports
+		WHERE user_id = $1 AND status = 'pending' AND created_at > $2
+		ORDER BY created_at DESC LIMIT 1`, uuidArg(userID), since))
+}
+
+func (s *ExportStore) Finish(ctx context.Context, id string, archive []byte, expiresAt time.Time) error {
+	return requireRow(s.db.ExecContext(ctx, `UPDATE data_exports SET status = 'ready', archive = $2, size_bytes = $3,
+		completed_at = NOW(), expires_at = $4 WHERE id = $1`, id, archive, len(archive), expiresAt))
+}
+
+func (s *ExportStore) Fail(ctx context.Context, id, reason string) error {
+	return requireRow(s.db.ExecContext(ctx, `UPDATE data_exports SET status = 'failed', error = $2, completed_at = NOW()
+		WHERE id = $1`, id, reason))
+}
+
+func (s *ExportStore) Archive(ctx context.Context, userID, id string, now time.Time) ([]byte, error) {
+	var archive []byte
+	err := s.db.QueryRowContext(ctx, `SELECT archive FROM data_exports
+		WHERE id = $1 AND user_id = $2 AND status = 'ready' AND expires_at > $3`, uuidArg(id), uuidArg(userID), now).Scan(&archive)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return archive, nil
+}
+
+func (s *ExportStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM data_exports WHERE expires_at <= $1", now)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
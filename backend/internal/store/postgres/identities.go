@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"backend/internal/models"
+	"context"
+	"database/sql"
+)
+
+type IdentityStore struct {
+	db *sql.DB
+}
+
+func (s *IdentityStore) Get(ctx context.Context, provider, subject string) (*models.Identity, error) {
+	var id models.Identity
+	err := s.db.QueryRowContext(ctx, `SELECT provider, subject, user_id, email, linked_at FROM user_identities
+		WHERE provider = $1 AND subject = $2`, provider, subject).
+		Scan(&id.Provider, &id.Subject, &id.UserID, &id.Email, &id.LinkedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &id, nil
+}
+
+func (s *IdentityStore) List(ctx context.Context, userID string) ([]models.Identity, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT provider, subject, user_id, email, linked_at FROM user_identities
+		WHERE user_id = $1 ORDER BY linked_at`, uuidArg(userID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Identity{}
+	for rows.Next() {
+		var id models.Identity
+		if err := rows.Scan(&id.Provider, &id.Subject, &id.UserID, &id.Email, &id.LinkedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, id)
+	}
+	return list, rows.Err()
+}
+
+func (s *IdentityStore) Link(ctx context.Context, id *models.Identity) error {
+	err := s.db.QueryRowContext(ctx, `INSERT INTO user_identities (provider, subject, user_id, email)
+		VALUES ($1, $2, $3, $4) RETURNING linked_at`, id.Provider, id.Subject, id.UserID, id.Email).Scan(&id.LinkedAt)
+	return uniqueViolation(err)
+}
+
+func (s *IdentityStore) Unlink(ctx context.Context, userID, provider string) error {
+	return requireRow(s.db.ExecContext(ctx, "DELETE FROM user_identities WHERE user_id = $1 AND provider = $2", uuidArg(userID), provider))
+}
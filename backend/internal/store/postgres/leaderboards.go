@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"backend/internal/models"
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+)
+
+type LeaderboardStore struct {
+	db *sql.DB
+}
+
+// leaderboardHiddenExpr is whether the user u is left out of rankings.
+const leaderboardHiddenExpr = `(u.leaderboard_hidden OR u.deletion_scheduled_for IS NOT NULL)`
+
+// syncLeaderboardHidden copies the user's ranking visibility onto their
+// leaderboard entries. Call it whenever leaderboardHiddenExpr may change.
+func syncLeaderboardHidden(ctx context.Context, tx *sql.Tx, userID string) error {
+	_, err := tx.ExecContext(ctx, `UPDATE leaderboard_scores s SET hidden = `+leaderboardHiddenExpr+`
+		FROM users u WHERE u.id = s.user_id AND u.id = $1`, uuidArg(userID))
+	return err
+}
+
+func (s *LeaderboardStore) Add(ctx context.Context, userID string, score int, periods []models.BoardPeriod) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, p := range periods {
+		err := requireRow(tx.ExecContext(ctx, `INSERT INTO leaderboard_scores (board, time_window, period, user_id, score, hidden, expires_at)
+			SELECT $1, $2, $3, u.id, $5, `+leaderboardHiddenExpr+`, $6 FROM users u WHERE u.id = $4
+			ON CONFLICT (board, time_window, period, user_id) DO UPDATE SET score = leaderboard_scores.score + EXCLUDED.score`,
+			p.Board, p.Window, p.Period, uuidArg(userID), score, p.ExpiresAt))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *LeaderboardStore) Top(ctx context.Context, p models.BoardPeriod, offset, limit int) ([]models.LeaderboardEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT u.id, u.nickname, u.emoji, s.score, COALESCE(u.streak, 0)
+		FROM leaderboard_scores s JOIN users u ON u.id = s.user_id
+		WHERE s.board = $1 AND s.time_window = $2 AND s.period = $3 AND NOT s.hidden
+		ORDER BY s.score DESC, s.user_id
+		OFFSET $4 LIMIT $5`, p.Board, p.Window, p.Period, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.LeaderboardEntry{}
+	for rows.Next() {
+		e := models.LeaderboardEntry{Rank: offset + len(list) + 1}
+		if err := rows.Scan(&e.UserID, &e.Nickname, &e.Emoji, &e.Score, &e.Streak); err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+func (s *LeaderboardStore) Count(ctx context.Context, p models.BoardPeriod) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM leaderboard_scores
+		WHERE board = $1 AND time_window = $2 AND period = $3 AND NOT hidden`, p.Board, p.Window, p.Period).Scan(&n)
+	return n, err
+}
+
+func (s *LeaderboardStore) Rank(ctx context.Context, p models.BoardPeriod, userID string) (*models.LeaderboardEntry, error) {
+	// Both counts are range scans of the rank index
+	e := models.LeaderboardEntry{UserID: userID}
+	err := s.db.QueryRowContext(ctx, `SELECT u.nickname, u.emoji, s.score, COALESCE(u.streak, 0),
+			1 + (SELECT COUNT(*) FROM leaderboard_scores o
+				WHERE o.board = s.board AND o.time_window = s.time_window AND o.period = s.period AND NOT o.hidden
+				AND o.score > s.score)
+			+ (SELECT COUNT(*) FROM leaderboard_scores o
+				WHERE o.board = s.board AND o.time_window = s.time_window AND o.period = s.period AND NOT o.hidden
+				AND o.score = s.score AND o.user_id < s.user_id)
+		FROM leaderboard_scores s JOIN users u ON u.id = s.user_id
+		WHERE s.board = $1 AND s.time_window = $2 AND s.period = $3 AND s.user_id = $4 AND NOT s.hidden`,
+		p.Board, p.Window, p.Period, uuidArg(userID)).Scan(&e.Nickname, &e.Emoji, &e.Score, &e.Streak, &e.Rank)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &e, nil
+}
+
+func (s *LeaderboardStore) Around(ctx context.Context, p models.BoardPeriod, userID string, n int) ([]models.LeaderboardEntry, error) {
+	var score int
+	err := s.db.QueryRowContext(ctx, `SELECT score FROM leaderboard_scores
+		WHERE board = $1 AND time_window = $2 AND period = $3 AND user_id = $4 AND NOT hidden`,
+		p.Board, p.Window, p.Period, uuidArg(userID)).Scan(&score)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	// Each side is a short walk of the rank index away from the user
+	const entry = `SELECT u.id, u.nickname, u.emoji, s.score, COALESCE(u.streak, 0)
+		FROM leaderboard_scores s JOIN users u ON u.id = s.user_id
+		WHERE s.board = $1 AND s.time_window = $2 AND s.period = $3 AND NOT s.hidden`
+	rows, err := s.db.QueryContext(ctx, `(`+entry+` AND s.score >= $4 AND (s.score > $4 OR s.user_id < $5::uuid)
+			ORDER BY s.score, s.user_id DESC LIMIT $6)
+		UNION ALL (`+entry+` AND s.user_id = $5::uuid)
+		UNION ALL (`+entry+` AND s.score <= $4 AND (s.score < $4 OR s.user_id > $5::uuid)
+			ORDER BY s.score DESC, s.user_id LIMIT $6)`,
+		p.Board, p.Window, p.Period, score, uuidArg(userID), n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.LeaderboardEntry{}
+	for rows.Next() {
+		var e models.LeaderboardEntry
+		if err := rows.Scan(&e.UserID, &e.Nickname, &e.Emoji, &e.Score, &e.Streak); err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Score != list[j].Score {
+			return list[i].Score > list[j].Score
+		}
+		return list[i].UserID < list[j].UserID
+	})
+	return list, nil
+}
+
+func (s *LeaderboardStore) Scores(ctx context.Context, p models.BoardPeriod) ([]models.LeaderboardEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT user_id, score FROM leaderboard_scores
+		WHERE board = $1 AND time_window = $2 AND period = $3 AND NOT hidden`, p.Board, p.Window, p.Period)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.LeaderboardEntry{}
+	for rows.Next() {
+		var e models.LeaderboardEntry
+		if err := rows.Scan(&e.UserID, &e.Score); err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+func (s *LeaderboardStore) SetHidden(ctx context.Context, userID string, hidden bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := requireRow(tx.ExecContext(ctx, "UPDATE users SET leaderboard_hidden = $1 WHERE id = $2", hidden, uuidArg(userID))); err != nil {
+		return err
+	}
+	if err := syncLeaderboardHidden(ctx, tx, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *LeaderboardStore) Prune(ctx context.Context, now time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM leaderboard_scores WHERE expires_at <= $1", now)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
@@ -0,0 +1,185 @@
+package postgres
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type LeagueStore struct {
+	db *sql.DB
+}
+
+const membershipColumns = `m.group_id, m.week::text, g.tier, m.xp, COALESCE(m.rank, 0), COALESCE(m.outcome, ''), m.joined_at`
+
+func scanMembership(row interface{ Scan(...any) error }, userID string) (*models.LeagueMembership, error) {
+	m := models.LeagueMembership{UserID: userID}
+	if err := row.Scan(&m.GroupID, &m.Week, &m.Tier, &m.XP, &m.Rank, &m.Outcome, &m.JoinedAt); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (s *LeagueStore) AddXP(ctx context.Context, m *models.LeagueMembership, band, maxSize int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locking the user serializes their joins, so they get one group a week
+	var tier int
+	err = tx.QueryRowContext(ctx, "SELECT league_tier FROM users WHERE id = $1 FOR UPDATE", uuidArg(m.UserID)).Scan(&tier)
+	if err != nil {
+		return notFound(err)
+	}
+	var joined bool
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM league_members WHERE user_id = $1 AND week = $2::date)",
+		uuidArg(m.UserID), m.Week).Scan(&joined)
+	if err != nil {
+		return err
+	}
+
+	if !joined {
+		// The row lock makes a concurrent join wait and then recheck members
+		var groupID string
+		err = tx.QueryRowContext(ctx, `SELECT id FROM league_groups
+			WHERE week = $1::date AND tier = $2 AND band = $3 AND closed_at IS NULL AND members < $4
+			ORDER BY created_at LIMIT 1 FOR UPDATE`, m.Week, tier, band, maxSize).Scan(&groupID)
+		if errors.Is(err, sql.ErrNoRows) {
+			groupID = newID()
+			_, err = tx.ExecContext(ctx, "INSERT INTO league_groups (id, week, tier, band) VALUES ($1, $2::date, $3, $4)",
+				groupID, m.Week, tier, band)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE league_groups SET members = members + 1 WHERE id = $1", groupID); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO league_members (group_id, user_id, week) VALUES ($1, $2, $3::date)",
+			groupID, m.UserID, m.Week)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE league_members SET xp = xp + $1 WHERE user_id = $2 AND week = $3::date",
+		m.XP, uuidArg(m.UserID), m.Week)
+	if err != nil {
+		return err
+	}
+	got, err := scanMembership(tx.QueryRowContext(ctx, `SELECT `+membershipColumns+`
+		FROM league_members m JOIN league_groups g ON g.id = m.group_id
+		WHERE m.user_id = $1 AND m.week = $2::date`, uuidArg(m.UserID), m.Week), m.UserID)
+	if err != nil {
+		return err
+	}
+	*m = *got
+	return tx.Commit()
+}
+
+func (s *LeagueStore) Membership(ctx context.Context, userID, week string) (*models.LeagueMembership, error) {
+	m, err := scanMembership(s.db.QueryRowContext(ctx, `SELECT `+membershipColumns+`
+		FROM league_members m JOIN league_groups g ON g.id = m.group_id
+		WHERE m.user_id = $1 AND m.week = $2::date`, uuidArg(userID), week), userID)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return m, nil
+}
+
+func (s *LeagueStore) Standings(ctx context.Context, groupID string) ([]models.LeagueStanding, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT u.id, u.nickname, u.emoji, COALESCE(u.level, 1), m.xp
+		FROM league_members m JOIN users u ON u.id = m.user_id
+		WHERE m.group_id = $1
+		ORDER BY m.xp DESC, m.joined_at, u.id`, uuidArg(groupID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.LeagueStanding{}
+	for rows.Next() {
+		var st models.LeagueStanding
+		if err := rows.Scan(&st.UserID, &st.Nickname, &st.Emoji, &st.Level, &st.XP); err != nil {
+			return nil, err
+		}
+		list = append(list, st)
+	}
+	return list, rows.Err()
+}
+
+func (s *LeagueStore) History(ctx context.Context, userID string, limit int) ([]models.LeagueMembership, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+membershipColumns+`
+		FROM league_members m JOIN league_groups g ON g.id = m.group_id
+		WHERE m.user_id = $1 AND g.closed_at IS NOT NULL
+		ORDER BY m.week DESC LIMIT $2`, uuidArg(userID), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.LeagueMembership{}
+	for rows.Next() {
+		m, err := scanMembership(rows, userID)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *m)
+	}
+	return list, rows.Err()
+}
+
+func (s *LeagueStore) Unclosed(ctx context.Context, week string, limit int) ([]models.LeagueGroup, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, week::text, tier, band FROM league_groups
+		WHERE week < $1::date AND closed_at IS NULL
+		ORDER BY week, created_at LIMIT $2`, week, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.LeagueGroup{}
+	for rows.Next() {
+		var g models.LeagueGroup
+		if err := rows.Scan(&g.ID, &g.Week, &g.Tier, &g.Band); err != nil {
+			return nil, err
+		}
+		list = append(list, g)
+	}
+	return list, rows.Err()
+}
+
+func (s *LeagueStore) Close(ctx context.Context, groupID string, results []models.LeagueResult) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var closed bool
+	err = tx.QueryRowContext(ctx, "SELECT closed_at IS NOT NULL FROM league_groups WHERE id = $1 FOR UPDATE", uuidArg(groupID)).Scan(&closed)
+	if err != nil {
+		return notFound(err)
+	}
+	if closed {
+		return store.ErrConflict
+	}
+	for _, r := range results {
+		_, err := tx.ExecContext(ctx, "UPDATE league_members SET rank = $1, outcome = $2 WHERE group_id = $3 AND user_id = $4",
+			r.Rank, r.Outcome, uuidArg(groupID), uuidArg(r.UserID))
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET league_tier = $1 WHERE id = $2", r.Tier, uuidArg(r.UserID)); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE league_groups SET closed_at = NOW() WHERE id = $1", uuidArg(groupID)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
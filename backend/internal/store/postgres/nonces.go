@@ -0,0 +1,41 @@
+package postgres
+
+import (
+	"backend/internal/store"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type NonceStore struct {
+	db *sql.DB
+}
+
+func (s *NonceStore) Issue(ctx context.Context, purpose, value string, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, "INSERT INTO nonces (purpose, value, expires_at) VALUES ($1, $2, $3)",
+		purpose, value, expiresAt)
+	return uniqueViolation(err)
+}
+
+func (s *NonceStore) Consume(ctx context.Context, purpose, value string, now time.Time) error {
+	// Deleting the row is what makes the value single-use, expired or not
+	var expiresAt time.Time
+	err := s.db.QueryRowContext(ctx, "DELETE FROM nonces WHERE purpose = $1 AND value = $2 RETURNING expires_at",
+		purpose, value).Scan(&expiresAt)
+	if err != nil {
+		return notFound(err)
+	}
+	if !now.Before(expiresAt) {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *NonceStore) Prune(ctx context.Context, now time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM nonces WHERE expires_at <= $1", now)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
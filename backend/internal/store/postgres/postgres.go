@@ -0,0 +1,81 @@
+// Package postgres implements the store interfaces on top of the schema
+// managed by the database package's migrations.
+package postgres
+
+import (
+	"backend/internal/store"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// New returns a Store backed by db.
+func New(db *sql.DB) *store.Store {
+	return &store.Store{
+		Users:        &UserStore{db: db},
+		Tests:        &TestStore{db: db},
+		Questions:    &QuestionStore{db: db},
+		Results:      &ResultStore{db: db},
+		Attempts:     &AttemptStore{db: db},
+		Subjects:     &SubjectStore{db: db},
+		Tokens:       &TokenStore{db: db},
+		Credentials:  &CredentialStore{db: db},
+		Sessions:     &SessionStore{db: db},
+		Identities:   &IdentityStore{db: db},
+		Audit:        &AuditStore{db: db},
+		Exports:      &ExportStore{db: db},
+		Daily:        &DailyRewardStore{db: db},
+		Subs:         &SubscriptionStore{db: db},
+		Achievements: &AchievementStore{db: db},
+		Leagues:      &LeagueStore{db: db},
+		Leaderboards: &LeaderboardStore{db: db},
+		Activity:     &ActivityStore{db: db},
+		Nonces:       &NonceStore{db: db},
+	}
+}
+
+func newID() string {
+	id, _ := uuid.NewV7()
+	return id.String()
+}
+
+// uuidArg passes id for comparison with a uuid column, which keeps the
+// column's indexes usable. A malformed ID can't name any row, so it is
+// passed as NULL and the lookup finds nothing rather than failing the cast.
+func uuidArg(id string) any {
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return nil
+	}
+	return u.String()
+}
+
+// notFound maps sql.ErrNoRows to store.ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.ErrNotFound
+	}
+	return err
+}
+
+// uniqueViolation maps Postgres unique_violation errors to store.ErrConflict.
+func uniqueViolation(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return store.ErrConflict
+	}
+	return err
+}
+
+// requireRow turns an UPDATE or DELETE that matched nothing into store.ErrNotFound.
+func requireRow(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
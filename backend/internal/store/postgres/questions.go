@@ -0,0 +1,138 @@
+package postgres
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+type QuestionStore struct {
+	db *sql.DB
+}
+
+const questionColumns = `id, COALESCE(test_id::text, ''), COALESCE(question_id, ''), COALESCE(category, ''), COALESCE(subject, ''),
+	COALESCE(topic, ''), COALESCE(sub_topic, ''), COALESCE(difficulty, ''), COALESCE(skill_level, ''), text,
+	options, solution, metadata, image_url, COALESCE(related_concept_id, ''),
+	COALESCE(category_id::text, ''), COALESCE(subject_id::text, ''), COALESCE(topic_id::text, '')`
+
+func (s *QuestionStore) query(ctx context.Context, query string, args ...any) ([]models.Question, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	questions := []models.Question{}
+	for rows.Next() {
+		var q models.Question
+		var optsStr, solStr, metaStr []byte
+		err := rows.Scan(
+			&q.ID, &q.TestID, &q.QuestionID, &q.Category, &q.Subject, &q.Topic, &q.SubTopic,
+			&q.Difficulty, &q.SkillLevel, &q.Text, &optsStr, &solStr, &metaStr, &q.ImageURL, &q.RelatedConceptID,
+			&q.CategoryID, &q.SubjectID, &q.TopicID,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		json.Unmarshal(optsStr, &q.Options)
+		json.Unmarshal(solStr, &q.Solution)
+		json.Unmarshal(metaStr, &q.Metadata)
+		questions = append(questions, q)
+	}
+	return questions, rows.Err()
+}
+
+func (s *QuestionStore) List(ctx context.Context, limit int) ([]models.Question, error) {
+	return s.query(ctx, `SELECT `+questionColumns+` FROM questions WHERE retired_at IS NULL LIMIT $1`, limit)
+}
+
+func (s *QuestionStore) ListByTest(ctx context.Context, testID string) ([]models.Question, error) {
+	return s.query(ctx, `SELECT `+questionColumns+` FROM questions WHERE test_id = $1 AND retired_at IS NULL`, uuidArg(testID))
+}
+
+func (s *QuestionStore) Get(ctx context.Context, id string) (*models.Question, error) {
+	questions, err := s.query(ctx, `SELECT `+questionColumns+` FROM questions WHERE id = $1`, uuidArg(id))
+	if err != nil {
+		return nil, err
+	}
+	if len(questions) == 0 {
+		return nil, store.ErrNotFound
+	}
+	return &questions[0], nil
+}
+
+func (s *QuestionStore) ExistsByQuestionID(ctx context.Context, questionID string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM questions WHERE question_id = $1)", questionID).Scan(&exists)
+	return exists, err
+}
+
+// taxonomy links q to the normalized taxonomy, using the exam of its test and
+// its free-text category, subject and topic.
+func (s *QuestionStore) taxonomy(ctx context.Context, q *models.Question) error {
+	var examID string
+	err := s.db.QueryRowContext(ctx, "SELECT COALESCE(exam_id::text, '') FROM tests WHERE id = $1", uuidArg(q.TestID)).Scan(&examID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	tax, err := database.ResolveTaxonomy(s.db, examID, q.Category, q.Subject, q.Topic)
+	if err != nil {
+		return err
+	}
+	q.CategoryID, q.SubjectID, q.TopicID = tax.CategoryID, tax.SubjectID, tax.TopicID
+	return nil
+}
+
+func (s *QuestionStore) Create(ctx context.Context, q *models.Question) error {
+	if q.ID == "" {
+		q.ID = newID()
+	}
+	if err := s.taxonomy(ctx, q); err != nil {
+		return err
+	}
+
+	optionsJson, _ := json.Marshal(q.Options)
+	solutionJson, _ := json.Marshal(q.Solution)
+	metadataJson, _ := json.Marshal(q.Metadata)
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO questions
+		(id, test_id, question_id, category, subject, topic, sub_topic, difficulty, skill_level, text, options, solution, metadata, image_url, related_concept_id, category_id, subject_id, topic_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)`,
+		q.ID, database.NullIfEmpty(q.TestID), q.QuestionID, q.Category, q.Subject, q.Topic, q.SubTopic, q.Difficulty, q.SkillLevel, q.Text,
+		optionsJson, solutionJson, metadataJson, q.ImageURL, q.RelatedConceptID,
+		database.NullIfEmpty(q.CategoryID), database.NullIfEmpty(q.SubjectID), database.NullIfEmpty(q.TopicID))
+	return uniqueViolation(err)
+}
+
+func (s *QuestionStore) Update(ctx context.Context, q *models.Question) error {
+	if err := s.taxonomy(ctx, q); err != nil {
+		return err
+	}
+
+	optionsJson, _ := json.Marshal(q.Options)
+	solutionJson, _ := json.Marshal(q.Solution)
+	metadataJson, _ := json.Marshal(q.Metadata)
+
+	result, err := s.db.ExecContext(ctx, `UPDATE questions SET
+		test_id=$1, question_id=$2, category=$3, subject=$4, topic=$5, sub_topic=$6, difficulty=$7, skill_level=$8, text=$9, options=$10, solution=$11, metadata=$12, image_url=$13, related_concept_id=$14,
+		category_id=$15, subject_id=$16, topic_id=$17, updated_at=NOW()
+		WHERE id = $18`,
+		database.NullIfEmpty(q.TestID), q.QuestionID, q.Category, q.Subject, q.Topic, q.SubTopic, q.Difficulty, q.SkillLevel, q.Text,
+		optionsJson, solutionJson, metadataJson, q.ImageURL, q.RelatedConceptID,
+		database.NullIfEmpty(q.CategoryID), database.NullIfEmpty(q.SubjectID), database.NullIfEmpty(q.TopicID), uuidArg(q.ID))
+	return requireRow(result, err)
+}
+
+func (s *QuestionStore) Delete(ctx context.Context, id string) error {
+	return requireRow(s.db.ExecContext(ctx, "DELETE FROM questions WHERE id = $1", uuidArg(id)))
+}
+
+func (s *QuestionStore) Count(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM questions").Scan(&n)
+	return n, err
+}
@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"database/sql"
+)
+
+type ResultStore struct {
+	db *sql.DB
+}
+
+func (s *ResultStore) Create(ctx context.Context, r *models.TestResult) error {
+	if r.ID == "" {
+		r.ID = newID()
+	}
+	return s.db.QueryRowContext(ctx, `INSERT INTO test_results (id, user_id, test_id, score, completed_at)
+		VALUES ($1, $2, $3, $4, NOW()) RETURNING completed_at`,
+		r.ID, r.UserID, r.TestID, r.Score).Scan(&r.CompletedAt)
+}
+
+func (s *ResultStore) BestScore(ctx context.Context, userID, testID string) (int, error) {
+	var best sql.NullInt64
+	err := s.db.QueryRowContext(ctx, "SELECT MAX(score) FROM test_results WHERE user_id = $1 AND test_id = $2",
+		uuidArg(userID), uuidArg(testID)).Scan(&best)
+	if err != nil {
+		return 0, err
+	}
+	if !best.Valid {
+		return 0, store.ErrNotFound
+	}
+	return int(best.Int64), nil
+}
+
+func (s *ResultStore) History(ctx context.Context, userID string) ([]models.HistoryEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.score, TO_CHAR(r.completed_at, 'YYYY-MM-DD HH24:MI'), t.title
+		FROM test_results r
+		JOIN tests t ON r.test_id = t.id
+		WHERE r.user_id = $1
+		ORDER BY r.completed_at DESC`, uuidArg(userID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []models.HistoryEntry{}
+	for rows.Next() {
+		var h models.HistoryEntry
+		if err := rows.Scan(&h.Score, &h.Date, &h.Title); err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+	return history, rows.Err()
+}
+
+func (s *ResultStore) Count(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM test_results").Scan(&n)
+	return n, err
+}
+
+func (s *ResultStore) CountForUser(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM test_results WHERE user_id = $1", uuidArg(userID)).Scan(&n)
+	return n, err
+}
+
+func (s *ResultStore) ListForUser(ctx context.Context, userID string) ([]models.TestResult, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.id, r.user_id, r.test_id, r.score, r.completed_at, COALESCE(t.title, '')
+		FROM test_results r
+		LEFT JOIN tests t ON r.test_id = t.id
+		WHERE r.user_id = $1
+		ORDER BY r.completed_at`, uuidArg(userID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.TestResult{}
+	for rows.Next() {
+		var r models.TestResult
+		if err := rows.Scan(&r.ID, &r.UserID, &r.TestID, &r.Score, &r.CompletedAt, &r.TestTitle); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type SessionStore struct {
+	db *sql.DB
+}
+
+const sessionColumns = `id, user_id, device_name, user_agent, ip, created_at, last_used_at, expires_at`
+
+func scanSession(row interface{ Scan(...any) error }) (*models.Session, error) {
+	var s models.Session
+	err := row.Scan(&s.ID, &s.UserID, &s.DeviceName, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt)
+	return &s, err
+}
+
+func (s *SessionStore) Create(ctx context.Context, sess *models.Session, tokenHash string) error {
+	if sess.ID == "" {
+		sess.ID = newID()
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `INSERT INTO sessions (id, user_id, device_name, user_agent, ip, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at, last_used_at`,
+		sess.ID, sess.UserID, sess.DeviceName, sess.UserAgent, sess.IP, sess.ExpiresAt).
+		Scan(&sess.CreatedAt, &sess.LastUsedAt)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO refresh_tokens (token_hash, session_id) VALUES ($1, $2)", tokenHash, sess.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SessionStore) Rotate(ctx context.Context, tokenHash, newHash string, now, expiresAt time.Time) (*models.Session, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var sessionID string
+	err = tx.QueryRowContext(ctx, `UPDATE refresh_tokens SET used_at = $2
+		WHERE token_hash = $1 AND used_at IS NULL RETURNING session_id`, tokenHash, now).Scan(&sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Either the token never existed or it was rotated before and is being replayed
+		err = tx.QueryRowContext(ctx, "SELECT session_id FROM refresh_tokens WHERE token_hash = $1", tokenHash).Scan(&sessionID)
+		if err != nil {
+			return nil, notFound(err)
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE sessions SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL", sessionID, now); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, store.ErrTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := scanSession(tx.QueryRowContext(ctx, `UPDATE sessions SET last_used_at = $2, expires_at = $3
+		WHERE id = $1 AND revoked_at IS NULL AND expires_at > $2
+		RETURNING `+sessionColumns, sessionID, now, expiresAt))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO refresh_tokens (token_hash, session_id) VALUES ($1, $2)", newHash, sessionID); err != nil {
+		return nil, err
+	}
+	return sess, tx.Commit()
+}
+
+func (s *SessionStore) List(ctx context.Context, userID string, now time.Time) ([]models.Session, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+sessionColumns+` FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY last_used_at DESC`, uuidArg(userID), now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Session{}
+	for rows.Next() {
+		sess, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *sess)
+	}
+	return list, rows.Err()
+}
+
+func (s *SessionStore) Revoke(ctx context.Context, userID, sessionID string) error {
+	return requireRow(s.db.ExecContext(ctx, `UPDATE sessions SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, uuidArg(sessionID), uuidArg(userID)))
+}
+
+func (s *SessionStore) RevokeAll(ctx context.Context, userID string) (int, error) {
+	result, err := s.db.ExecContext(ctx, `UPDATE sessions SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()`, uuidArg(userID))
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"backend/internal/models"
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+type SubjectStore struct {
+	db *sql.DB
+}
+
+func (s *SubjectStore) List(ctx context.Context, category, exam string) ([]models.Subject, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT s.id, s.title, s.weight, s.category, COALESCE(s.content, ''),
+			COALESCE(ARRAY(
+				SELECT r.title FROM subjects r
+				JOIN related_subjects rs ON r.id = rs.related_subject_id
+				WHERE rs.subject_id = s.id ORDER BY r.title
+			), '{}')
+		FROM subjects s
+		LEFT JOIN exams e ON e.id = s.exam_id
+		WHERE ($1 = '' OR s.category = $1) AND ($2 = '' OR e.slug = $2)
+		ORDER BY s.title`, category, exam)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subjects := []models.Subject{}
+	for rows.Next() {
+		var subj models.Subject
+		var related pq.StringArray
+		if err := rows.Scan(&subj.ID, &subj.Title, &subj.Weight, &subj.Category, &subj.Content, &related); err != nil {
+			return nil, err
+		}
+		subj.Related = []string(related)
+		if subj.Related == nil {
+			subj.Related = []string{}
+		}
+		subjects = append(subjects, subj)
+	}
+	return subjects, rows.Err()
+}
@@ -0,0 +1,129 @@
+package postgres
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type SubscriptionStore struct {
+	db *sql.DB
+}
+
+const subscriptionColumns = `id, user_id, platform, product_id, external_id, status, auto_renew, environment,
+	period_start, expires_at, grace_expires_at, created_at, updated_at`
+
+// entitledSQL mirrors store.Entitled for a subscriptions row aliased s; $1 is now.
+const entitledSQL = `((s.status = 'active' AND s.expires_at > $1)
+	OR (s.status = 'grace' AND COALESCE(s.grace_expires_at, s.expires_at) > $1))`
+
+func scanSubscription(row interface{ Scan(...any) error }) (*models.Subscription, error) {
+	var s models.Subscription
+	var start, grace sql.NullTime
+	err := row.Scan(&s.ID, &s.UserID, &s.Platform, &s.ProductID, &s.ExternalID, &s.Status, &s.AutoRenew, &s.Environment,
+		&start, &s.ExpiresAt, &grace, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if start.Valid {
+		s.PeriodStart = &start.Time
+	}
+	if grace.Valid {
+		s.GraceExpiresAt = &grace.Time
+	}
+	return &s, nil
+}
+
+func (s *SubscriptionStore) Upsert(ctx context.Context, sub *models.Subscription) error {
+	if sub.ID == "" {
+		sub.ID = newID()
+	}
+	// The WHERE clause turns an update of someone else's purchase into no row
+	row := s.db.QueryRowContext(ctx, `INSERT INTO subscriptions
+		(id, user_id, platform, product_id, external_id, status, auto_renew, environment, period_start, expires_at, grace_expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (platform, external_id) DO UPDATE SET
+			product_id = EXCLUDED.product_id, status = EXCLUDED.status, auto_renew = EXCLUDED.auto_renew,
+			environment = EXCLUDED.environment, period_start = EXCLUDED.period_start,
+			expires_at = EXCLUDED.expires_at, grace_expires_at = EXCLUDED.grace_expires_at, updated_at = NOW()
+		WHERE subscriptions.user_id = EXCLUDED.user_id
+		RETURNING id, created_at, updated_at`,
+		sub.ID, sub.UserID, sub.Platform, sub.ProductID, sub.ExternalID, sub.Status, sub.AutoRenew, sub.Environment,
+		sub.PeriodStart, sub.ExpiresAt, sub.GraceExpiresAt)
+	err := row.Scan(&sub.ID, &sub.CreatedAt, &sub.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return store.ErrConflict
+	}
+	return err
+}
+
+func (s *SubscriptionStore) GetByExternalID(ctx context.Context, platform, externalID string) (*models.Subscription, error) {
+	sub, err := scanSubscription(s.db.QueryRowContext(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions
+		WHERE platform = $1 AND external_id = $2`, platform, externalID))
+	return sub, notFound(err)
+}
+
+func (s *SubscriptionStore) list(ctx context.Context, query string, args ...any) ([]models.Subscription, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *sub)
+	}
+	return list, rows.Err()
+}
+
+func (s *SubscriptionStore) ListForUser(ctx context.Context, userID string) ([]models.Subscription, error) {
+	return s.list(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions
+		WHERE user_id = $1 ORDER BY expires_at DESC`, uuidArg(userID))
+}
+
+func (s *SubscriptionStore) SyncEntitlement(ctx context.Context, userID string, now time.Time) (bool, error) {
+	var premium bool
+	err := s.db.QueryRowContext(ctx, `UPDATE users u SET
+			is_premium = e.premium,
+			role = CASE WHEN e.premium AND u.role = 'free' THEN 'pro'
+				WHEN NOT e.premium AND u.role = 'pro' THEN 'free' ELSE u.role END
+		FROM (SELECT EXISTS (SELECT 1 FROM subscriptions s WHERE s.user_id = $2 AND `+entitledSQL+`) AS premium) e
+		WHERE u.id = $2
+		RETURNING u.is_premium`, now, uuidArg(userID)).Scan(&premium)
+	return premium, notFound(err)
+}
+
+func (s *SubscriptionStore) Stale(ctx context.Context, now, updatedBefore time.Time, limit int) ([]models.Subscription, error) {
+	return s.list(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions s
+		WHERE s.status IN ('active', 'grace') AND NOT `+entitledSQL+` AND s.updated_at < $2
+		ORDER BY s.expires_at LIMIT $3`, now, updatedBefore, limit)
+}
+
+func (s *SubscriptionStore) Lapsed(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT u.id FROM users u
+		WHERE (u.is_premium OR u.role = 'pro')
+			AND EXISTS (SELECT 1 FROM subscriptions s WHERE s.user_id = u.id)
+			AND NOT EXISTS (SELECT 1 FROM subscriptions s WHERE s.user_id = u.id AND `+entitledSQL+`)
+		LIMIT $2`, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
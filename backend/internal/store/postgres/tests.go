@@ -0,0 +1,227 @@
+package postgres
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type TestStore struct {
+	db *sql.DB
+}
+
+const testColumns = `t.id, COALESCE(t.slug, ''), t.title, COALESCE(t.description, ''), COALESCE(t.category, ''),
+	COALESCE(t.category_slug, ''), COALESCE(e.slug, ''), COALESCE(t.time_limit_minutes, 0)`
+
+func scanTest(row interface{ Scan(...any) error }, t *models.Test, extra ...any) error {
+	return row.Scan(append([]any{&t.ID, &t.Slug, &t.Title, &t.Description, &t.Category, &t.CategorySlug, &t.Exam, &t.TimeLimitMinutes}, extra...)...)
+}
+
+func (s *TestStore) List(ctx context.Context, f store.TestFilter) ([]models.Test, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+testColumns+`,
+			EXISTS(SELECT 1 FROM test_results r WHERE r.test_id = t.id AND r.user_id = $1) as completed
+		FROM tests t
+		LEFT JOIN categories c ON c.id = t.category_id
+		LEFT JOIN exams e ON e.id = t.exam_id
+		WHERE ($2 = '' OR t.category = $2 OR t.category_slug = $2)
+		AND ($3 = '' OR e.slug = $3)
+		ORDER BY c.sort_order NULLS LAST, t.sort_order NULLS LAST, t.title`, uuidArg(f.UserID), f.Category, f.Exam)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tests := []models.Test{}
+	for rows.Next() {
+		var t models.Test
+		if err := scanTest(rows, &t, &t.Completed); err != nil {
+			return nil, err
+		}
+		tests = append(tests, t)
+	}
+	return tests, rows.Err()
+}
+
+func (s *TestStore) getWhere(ctx context.Context, where string, args ...any) (*models.Test, error) {
+	var t models.Test
+	row := s.db.QueryRowContext(ctx, `SELECT `+testColumns+` FROM tests t
+		LEFT JOIN exams e ON e.id = t.exam_id WHERE `+where, args...)
+	if err := scanTest(row, &t); err != nil {
+		return nil, notFound(err)
+	}
+	return &t, nil
+}
+
+func (s *TestStore) Get(ctx context.Context, id string) (*models.Test, error) {
+	return s.getWhere(ctx, "t.id = $1", uuidArg(id))
+}
+
+func (s *TestStore) GetByTitle(ctx context.Context, title string) (*models.Test, error) {
+	return s.getWhere(ctx, "t.title = $1 LIMIT 1", title)
+}
+
+// Create inserts t under the exam named by t.Exam and links its category, if any.
+func (s *TestStore) Create(ctx context.Context, t *models.Test) error {
+	if t.ID == "" {
+		t.ID = newID()
+	}
+
+	var examID string
+	if t.Exam != "" {
+		err := s.db.QueryRowContext(ctx, "SELECT id FROM exams WHERE slug=$1", t.Exam).Scan(&examID)
+		if err != nil {
+			return notFound(err)
+		}
+	}
+	tax, err := database.ResolveTaxonomy(s.db, examID, t.Category, "", "")
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO tests
+		(id, slug, title, description, category, category_slug, time_limit_minutes, exam_id, category_id)
+		VALUES ($1, NULLIF($2, ''), $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, $8, $9)`,
+		t.ID, t.Slug, t.Title, t.Description, t.Category, t.CategorySlug, t.TimeLimitMinutes,
+		database.NullIfEmpty(examID), database.NullIfEmpty(tax.CategoryID))
+	return uniqueViolation(err)
+}
+
+func (s *TestStore) RandomUnsolved(ctx context.Context, userID, exam string) (*models.Test, error) {
+	t, err := s.getWhere(ctx, `t.id NOT IN (SELECT test_id FROM test_results WHERE user_id = $1 AND test_id IS NOT NULL)
+		AND ($2 = '' OR e.slug = $2)
+		ORDER BY RANDOM() LIMIT 1`, uuidArg(userID), exam)
+	if errors.Is(err, store.ErrNotFound) {
+		// If all tests are solved, fall back to any test
+		return s.getWhere(ctx, "$1 = '' OR e.slug = $1 ORDER BY RANDOM() LIMIT 1", exam)
+	}
+	return t, err
+}
+
+func (s *TestStore) CategoryNames(ctx context.Context, exam string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.name FROM categories c
+		LEFT JOIN exams e ON e.id = c.exam_id
+		WHERE $1 = '' OR e.slug = $1
+		ORDER BY c.sort_order, c.name`, exam)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func (s *TestStore) CategoryProgress(ctx context.Context, userID, exam string) ([]models.CategoryProgress, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			c.name, c.slug, COALESCE(c.icon, ''), c.sort_order, COALESCE(e.slug, ''),
+			COUNT(DISTINCT t.id) as total_tests,
+			COUNT(DISTINCT tr.test_id) as completed_tests
+		FROM categories c
+		LEFT JOIN exams e ON e.id = c.exam_id
+		LEFT JOIN tests t ON t.category_id = c.id
+		LEFT JOIN test_results tr ON t.id = tr.test_id AND tr.user_id = $1
+		WHERE $2 = '' OR e.slug = $2
+		GROUP BY c.id, e.slug
+		ORDER BY c.sort_order, c.name`, uuidArg(userID), exam)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []models.CategoryProgress{}
+	for rows.Next() {
+		var cp models.CategoryProgress
+		if err := rows.Scan(&cp.Category, &cp.Slug, &cp.Icon, &cp.Order, &cp.Exam, &cp.TotalTests, &cp.CompletedTests); err != nil {
+			return nil, err
+		}
+		categories = append(categories, cp)
+	}
+	return categories, rows.Err()
+}
+
+func (s *TestStore) Exams(ctx context.Context) ([]models.Exam, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, slug, name, sort_order FROM exams ORDER BY sort_order, name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exams := []models.Exam{}
+	for rows.Next() {
+		var e models.Exam
+		if err := rows.Scan(&e.ID, &e.Slug, &e.Name, &e.Order); err != nil {
+			return nil, err
+		}
+		exams = append(exams, e)
+	}
+	return exams, rows.Err()
+}
+
+func (s *TestStore) ExamTaxonomy(ctx context.Context, examSlug string) ([]models.ExamCategory, error) {
+	var examID string
+	if err := s.db.QueryRowContext(ctx, "SELECT id FROM exams WHERE slug=$1", examSlug).Scan(&examID); err != nil {
+		return nil, notFound(err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.id, c.slug, c.name, COALESCE(c.icon, ''), c.sort_order,
+			COALESCE(s.id::text, ''), COALESCE(s.slug, ''), COALESCE(s.name, ''),
+			COALESCE(t.id::text, ''), COALESCE(t.slug, ''), COALESCE(t.name, '')
+		FROM categories c
+		LEFT JOIN taxonomy_subjects s ON s.category_id = c.id
+		LEFT JOIN taxonomy_topics t ON t.subject_id = s.id
+		WHERE c.exam_id = $1
+		ORDER BY c.sort_order, c.name, s.name, t.name`, examID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []models.ExamCategory{}
+	for rows.Next() {
+		var c models.ExamCategory
+		var s models.TaxonomySubject
+		var t models.TaxonomyTopic
+		if err := rows.Scan(&c.ID, &c.Slug, &c.Name, &c.Icon, &c.Order, &s.ID, &s.Slug, &s.Name, &t.ID, &t.Slug, &t.Name); err != nil {
+			return nil, err
+		}
+
+		// Rows arrive sorted, so a new node starts whenever the ID changes.
+		if len(categories) == 0 || categories[len(categories)-1].ID != c.ID {
+			c.Subjects = []models.TaxonomySubject{}
+			categories = append(categories, c)
+		}
+		cat := &categories[len(categories)-1]
+		if s.ID == "" {
+			continue
+		}
+		if len(cat.Subjects) == 0 || cat.Subjects[len(cat.Subjects)-1].ID != s.ID {
+			s.Topics = []models.TaxonomyTopic{}
+			cat.Subjects = append(cat.Subjects, s)
+		}
+		subj := &cat.Subjects[len(cat.Subjects)-1]
+		if t.ID != "" {
+			subj.Topics = append(subj.Topics, t)
+		}
+	}
+	return categories, rows.Err()
+}
+
+func (s *TestStore) Count(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM tests").Scan(&n)
+	return n, err
+}
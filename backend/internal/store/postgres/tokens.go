@@ -0,0 +1,145 @@
+package postgres
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type TokenStore struct {
+	db *sql.DB
+}
+
+func (s *TokenStore) Balance(ctx context.Context, userID string) (int, error) {
+	var tokens int
+	err := s.db.QueryRowContext(ctx, "SELECT COALESCE(tokens, 0) FROM users WHERE id = $1", uuidArg(userID)).Scan(&tokens)
+	return tokens, notFound(err)
+}
+
+const tokenColumns = `id, user_id, amount, balance_after, reason, reference, COALESCE(idempotency_key, ''), created_at`
+
+func scanTokenTransaction(row interface{ Scan(...any) error }, t *models.TokenTransaction) error {
+	return row.Scan(&t.ID, &t.UserID, &t.Amount, &t.BalanceAfter, &t.Reason, &t.Reference, &t.IdempotencyKey, &t.CreatedAt)
+}
+
+func (s *TokenStore) Record(ctx context.Context, t *models.TokenTransaction) error {
+	return s.record(ctx, t, nil)
+}
+
+func (s *TokenStore) RecordCapped(ctx context.Context, t *models.TokenTransaction, since time.Time, max int) error {
+	return s.record(ctx, t, &tokenCap{since, max})
+}
+
+func (s *TokenStore) record(ctx context.Context, t *models.TokenTransaction, limit *tokenCap) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := recordTokensTx(ctx, tx, t, limit); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// tokenCap limits how many entries with the same reason a user gets since a time.
+type tokenCap struct {
+	since time.Time
+	max   int
+}
+
+// recordTokensTx is Record inside the caller's transaction. limit may be nil.
+func recordTokensTx(ctx context.Context, tx *sql.Tx, t *models.TokenTransaction, limit *tokenCap) error {
+	// The row lock serializes entries of one user, so a retried request
+	// sees the first one's idempotency key
+	var balance int
+	err := tx.QueryRowContext(ctx, "SELECT COALESCE(tokens, 0) FROM users WHERE id = $1 FOR UPDATE", uuidArg(t.UserID)).Scan(&balance)
+	if err != nil {
+		return notFound(err)
+	}
+	if t.IdempotencyKey != "" {
+		err := scanTokenTransaction(tx.QueryRowContext(ctx, `SELECT `+tokenColumns+` FROM token_transactions
+			WHERE user_id = $1 AND idempotency_key = $2`, uuidArg(t.UserID), t.IdempotencyKey), t)
+		if err == nil {
+			return store.ErrDuplicate
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	}
+	if limit != nil {
+		var n int
+		err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM token_transactions
+			WHERE user_id = $1 AND reason = $2 AND created_at >= $3`, uuidArg(t.UserID), t.Reason, limit.since).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n >= limit.max {
+			return store.ErrLimitReached
+		}
+	}
+	if balance+t.Amount < 0 {
+		return store.ErrInsufficientTokens
+	}
+
+	if t.ID == "" {
+		t.ID = newID()
+	}
+	t.BalanceAfter = balance + t.Amount
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET tokens = $1 WHERE id = $2", t.BalanceAfter, uuidArg(t.UserID)); err != nil {
+		return err
+	}
+	return tx.QueryRowContext(ctx, `INSERT INTO token_transactions
+		(id, user_id, amount, balance_after, reason, reference, idempotency_key)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, '')) RETURNING created_at`,
+		t.ID, t.UserID, t.Amount, t.BalanceAfter, t.Reason, t.Reference, t.IdempotencyKey).Scan(&t.CreatedAt)
+}
+
+func (s *TokenStore) History(ctx context.Context, userID string, before time.Time, limit int) ([]models.TokenTransaction, error) {
+	if before.IsZero() {
+		before = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT `+tokenColumns+` FROM token_transactions
+		WHERE user_id = $1 AND created_at < $2
+		ORDER BY created_at DESC, id DESC LIMIT $3`, uuidArg(userID), before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.TokenTransaction{}
+	for rows.Next() {
+		var t models.TokenTransaction
+		if err := scanTokenTransaction(rows, &t); err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+func (s *TokenStore) Reconcile(ctx context.Context) ([]models.TokenDrift, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT u.id, u.nickname, COALESCE(u.tokens, 0), COALESCE(SUM(t.amount), 0) AS ledger
+		FROM users u LEFT JOIN token_transactions t ON t.user_id = u.id
+		GROUP BY u.id
+		HAVING COALESCE(u.tokens, 0) <> COALESCE(SUM(t.amount), 0)
+		ORDER BY ABS(COALESCE(u.tokens, 0) - COALESCE(SUM(t.amount), 0)) DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.TokenDrift{}
+	for rows.Next() {
+		var d models.TokenDrift
+		if err := rows.Scan(&d.UserID, &d.Nickname, &d.Cached, &d.Ledger); err != nil {
+			return nil, err
+		}
+		d.Drift = d.Cached - d.Ledger
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,528 @@
+package postgres
+
+import (
+	"backend/internal/models"
+	"backend/internal/progression"
+	"backend/internal/store"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type UserStore struct {
+	db *sql.DB
+}
+
+const userColumns = `u.id, u.nickname, u.emoji, COALESCE(u.streak, 0), u.streak_freezes, COALESCE(u.last_active_date::text, ''),
+	COALESCE(u.total_score, 0), COALESCE(u.level, 1), COALESCE(u.xp, 0), u.total_xp,
+	COALESCE(u.email, ''), COALESCE(u.provider, 'local'),
+	ARRAY(SELECT i.provider FROM user_identities i WHERE i.user_id = u.id ORDER BY i.provider),
+	COALESCE(u.role, 'free'), COALESCE(u.tokens, 0), COALESCE(u.is_premium, FALSE), COALESCE(e.slug, ''),
+	u.email_verified_at IS NOT NULL, u.deletion_scheduled_for, u.timezone, u.league_tier,
+	u.leaderboard_hidden`
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func getUserWhere(ctx context.Context, q querier, where string, args ...any) (*models.User, error) {
+	var u models.User
+	var providers pq.StringArray
+	var deletion sql.NullTime
+	err := q.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users u
+		LEFT JOIN exams e ON e.id = u.selected_exam_id
+		WHERE `+where, args...).
+		Scan(&u.ID, &u.Nickname, &u.Emoji, &u.Streak, &u.StreakFreezes, &u.LastActiveDate, &u.TotalScore, &u.Level, &u.XP, &u.TotalXP,
+			&u.Email, &u.Provider, &providers, &u.Role, &u.Tokens, &u.IsPremium, &u.SelectedExam, &u.EmailVerified, &deletion, &u.Timezone,
+			&u.LeagueTier, &u.LeaderboardHidden)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	u.Providers = []string(providers)
+	if deletion.Valid {
+		u.DeletionScheduledFor = &deletion.Time
+	}
+	return &u, nil
+}
+
+func (s *UserStore) getWhere(ctx context.Context, where string, args ...any) (*models.User, error) {
+	return getUserWhere(ctx, s.db, where, args...)
+}
+
+func (s *UserStore) Get(ctx context.Context, id string) (*models.User, error) {
+	return s.getWhere(ctx, "u.id = $1", uuidArg(id))
+}
+
+func (s *UserStore) GetByNickname(ctx context.Context, nickname string) (*models.User, error) {
+	return s.getWhere(ctx, "u.nickname = $1", nickname)
+}
+
+func (s *UserStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return s.getWhere(ctx, "LOWER(u.email) = LOWER($1)", email)
+}
+
+func (s *UserStore) Create(ctx context.Context, u *models.User) error {
+	if u.ID == "" {
+		u.ID = newID()
+	}
+	if u.Provider == "" {
+		u.Provider = "local"
+	}
+	if u.Role == "" {
+		u.Role = "free"
+	}
+	if u.Streak == 0 {
+		u.Streak = 1
+	}
+	if u.Level == 0 {
+		u.Level = 1
+	}
+	if u.Timezone == "" {
+		u.Timezone = store.DefaultTimezone
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `INSERT INTO users
+		(id, nickname, emoji, streak, last_active_date, level, xp, total_xp, email, provider, role, tokens, is_premium, email_verified_at, timezone)
+		VALUES ($1, $2, $3, $4, (NOW() AT TIME ZONE $13)::date, $5, $6, $7, NULLIF($8, ''), $9, $10, 0, $11, CASE WHEN $12 THEN NOW() END, $13)
+		RETURNING last_active_date::text`,
+		u.ID, u.Nickname, u.Emoji, u.Streak, u.Level, u.XP, u.TotalXP, u.Email, u.Provider, u.Role, u.IsPremium, u.EmailVerified, u.Timezone).
+		Scan(&u.LastActiveDate)
+	if err != nil {
+		return uniqueViolation(err)
+	}
+	if u.Tokens != 0 {
+		err := recordTokensTx(ctx, tx, &models.TokenTransaction{UserID: u.ID, Amount: u.Tokens, Reason: "opening_balance"}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *UserStore) UpdateProfile(ctx context.Context, id, nickname, emoji string) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE users SET nickname=$1, emoji=$2 WHERE id=$3", nickname, emoji, id)
+	return requireRow(result, uniqueViolation(err))
+}
+
+func (s *UserStore) AddStreakFreeze(ctx context.Context, id string, cost *models.TokenTransaction, max int) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var held int
+	if err := tx.QueryRowContext(ctx, "SELECT streak_freezes FROM users WHERE id = $1 FOR UPDATE", uuidArg(id)).Scan(&held); err != nil {
+		return 0, notFound(err)
+	}
+	if cost != nil {
+		if err := recordTokensTx(ctx, tx, cost, nil); err != nil {
+			return held, err
+		}
+	}
+	if held >= max {
+		return held, store.ErrLimitReached
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET streak_freezes = streak_freezes + 1 WHERE id = $1", uuidArg(id)); err != nil {
+		return 0, err
+	}
+	return held + 1, tx.Commit()
+}
+
+func (s *UserStore) SetTimezone(ctx context.Context, id, timezone string) error {
+	return requireRow(s.db.ExecContext(ctx, "UPDATE users SET timezone = $1 WHERE id = $2", timezone, uuidArg(id)))
+}
+
+func (s *UserStore) SetRole(ctx context.Context, id, role string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := requireRow(tx.ExecContext(ctx, "UPDATE users SET role = $1 WHERE id = $2", role, uuidArg(id))); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", uuidArg(id)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *UserStore) SelectExam(ctx context.Context, id, examSlug string) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE users SET selected_exam_id = e.id
+		FROM exams e WHERE users.id = $1 AND e.slug = $2`, uuidArg(id), examSlug)
+	return requireRow(result, err)
+}
+
+func (s *UserStore) UpdateStreak(ctx context.Context, id string, u store.StreakUpdate) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var held int
+	err = tx.QueryRowContext(ctx, `UPDATE users SET streak = $1, last_active_date = $2::date,
+		streak_freezes = streak_freezes - $3 + CASE WHEN $4 AND streak_freezes - $3 < $5 THEN 1 ELSE 0 END
+		WHERE id = $6 AND streak_freezes >= $3
+		AND (last_active_date IS NULL OR last_active_date < $2::date OR COALESCE(streak, 0) = 0)
+		RETURNING streak_freezes`, u.Streak, u.Day, len(u.Frozen), u.EarnFreeze, u.MaxFreezes, uuidArg(id)).Scan(&held)
+	if errors.Is(err, sql.ErrNoRows) {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", uuidArg(id)).Scan(&exists); err != nil {
+			return 0, err
+		}
+		if !exists {
+			return 0, store.ErrNotFound
+		}
+		return 0, store.ErrConflict
+	}
+	if err != nil {
+		return 0, err
+	}
+	for _, day := range u.Frozen {
+		_, err := tx.ExecContext(ctx, `INSERT INTO user_activity (user_id, day, frozen) VALUES ($1, $2::date, TRUE)
+			ON CONFLICT (user_id, day) DO NOTHING`, id, day)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return held, tx.Commit()
+}
+
+// setTotalXPTx sets the user's lifetime XP to total plus add and their
+// level and xp to match along curve. Passing total -1 keeps the current
+// lifetime XP, so add is added to it.
+func setTotalXPTx(ctx context.Context, tx *sql.Tx, id string, total, add int, curve progression.Curve) error {
+	err := tx.QueryRowContext(ctx, `UPDATE users SET total_xp = CASE WHEN $1 < 0 THEN total_xp ELSE $1 END + $2
+		WHERE id = $3 RETURNING total_xp`, total, add, uuidArg(id)).Scan(&total)
+	if err != nil {
+		return notFound(err)
+	}
+	level, xp := curve.Level(total)
+	_, err = tx.ExecContext(ctx, "UPDATE users SET level = $1, xp = $2 WHERE id = $3", level, xp, uuidArg(id))
+	return err
+}
+
+func (s *UserStore) AddProgress(ctx context.Context, id string, gained, scoreDelta int, curve progression.Curve) (*models.User, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := setTotalXPTx(ctx, tx, id, -1, gained, curve); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET total_score = total_score + $1 WHERE id = $2", scoreDelta, uuidArg(id)); err != nil {
+		return nil, err
+	}
+	u, err := getUserWhere(ctx, tx, "u.id = $1", uuidArg(id))
+	if err != nil {
+		return nil, err
+	}
+	return u, tx.Commit()
+}
+
+func (s *UserStore) SetTotalXP(ctx context.Context, id string, total int, curve progression.Curve) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setTotalXPTx(ctx, tx, id, max(total, 0), 0, curve); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *UserStore) ListIDs(ctx context.Context, after string, limit int) ([]string, error) {
+	if after == "" {
+		after = store.TombstoneUserID // the lowest ID, and never listed
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM users WHERE id > $1 AND id <> $2
+		ORDER BY id LIMIT $3`, uuidArg(after), store.TombstoneUserID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *UserStore) Delete(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// test_results references users, so it goes first
+	if _, err := tx.ExecContext(ctx, "DELETE FROM test_results WHERE user_id = $1", uuidArg(id)); err != nil {
+		return err
+	}
+	if err := requireRow(tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", uuidArg(id))); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *UserStore) ScheduleDeletion(ctx context.Context, id string, purgeAt time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = requireRow(tx.ExecContext(ctx, `UPDATE users SET deletion_requested_at = NOW(), deletion_scheduled_for = $2
+		WHERE id = $1 AND id <> $3`, uuidArg(id), purgeAt, store.TombstoneUserID))
+	if err != nil {
+		return err
+	}
+	if err := syncLeaderboardHidden(ctx, tx, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", uuidArg(id)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *UserStore) CancelDeletion(ctx context.Context, id string) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE users SET deletion_requested_at = NULL, deletion_scheduled_for = NULL
+		WHERE id = $1 AND deletion_scheduled_for IS NOT NULL`, uuidArg(id))
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if err := syncLeaderboardHidden(ctx, tx, id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (s *UserStore) DueForDeletion(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM users WHERE deletion_scheduled_for <= $1
+		ORDER BY deletion_scheduled_for LIMIT $2`, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *UserStore) Purge(ctx context.Context, id string) error {
+	if id == store.TombstoneUserID {
+		return store.ErrConflict
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE test_results SET user_id = $2 WHERE user_id = $1", uuidArg(id), store.TombstoneUserID); err != nil {
+		return err
+	}
+	// Sessions, identities, verifications and exports cascade
+	if err := requireRow(tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", uuidArg(id))); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *UserStore) TopByScore(ctx context.Context, limit int) ([]models.LeaderboardEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT nickname, emoji, COALESCE(total_score, 0), COALESCE(streak, 0)
+		FROM users WHERE id <> $2 AND deletion_scheduled_for IS NULL AND NOT leaderboard_hidden
+		ORDER BY total_score DESC NULLS LAST LIMIT $1`, limit, store.TombstoneUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.LeaderboardEntry{}
+	for rows.Next() {
+		var e models.LeaderboardEntry
+		if err := rows.Scan(&e.Nickname, &e.Emoji, &e.Score, &e.Streak); err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+func (s *UserStore) Merge(ctx context.Context, keepID, absorbID string, curve progression.Curve) (*store.MergeReport, error) {
+	if keepID == absorbID {
+		return nil, store.ErrConflict
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock both rows in a fixed order so concurrent merges can't deadlock
+	var locked int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM (SELECT id FROM users WHERE id IN ($1, $2) ORDER BY id FOR UPDATE) l`,
+		uuidArg(keepID), uuidArg(absorbID)).Scan(&locked)
+	if err != nil {
+		return nil, err
+	}
+	if locked != 2 {
+		return nil, store.ErrNotFound
+	}
+	keep, err := getUserWhere(ctx, tx, "u.id = $1", uuidArg(keepID))
+	if err != nil {
+		return nil, err
+	}
+	absorb, err := getUserWhere(ctx, tx, "u.id = $1", uuidArg(absorbID))
+	if err != nil {
+		return nil, err
+	}
+
+	var shared int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM (SELECT provider FROM user_identities
+		WHERE user_id IN ($1, $2) GROUP BY provider HAVING COUNT(*) > 1) p`, keep.ID, absorb.ID).Scan(&shared)
+	if err != nil {
+		return nil, err
+	}
+	if shared > 0 {
+		return nil, store.ErrConflict
+	}
+
+	report := &store.MergeReport{TokensAdded: absorb.Tokens, XPAdded: absorb.TotalXP}
+	result, err := tx.ExecContext(ctx, "UPDATE test_results SET user_id = $1 WHERE user_id = $2", keep.ID, absorb.ID)
+	if err != nil {
+		return nil, err
+	}
+	moved, _ := result.RowsAffected()
+	report.ResultsMoved = int(moved)
+
+	result, err = tx.ExecContext(ctx, "UPDATE user_identities SET user_id = $1 WHERE user_id = $2", keep.ID, absorb.ID)
+	if err != nil {
+		return nil, err
+	}
+	moved, _ = result.RowsAffected()
+	report.IdentitiesMoved = int(moved)
+
+	// Subscriptions were paid for by the same person, so they follow the account
+	if _, err := tx.ExecContext(ctx, "UPDATE subscriptions SET user_id = $1 WHERE user_id = $2", keep.ID, absorb.ID); err != nil {
+		return nil, err
+	}
+	// Achievements keep has too stay with keep; their rewards are already in the totals
+	_, err = tx.ExecContext(ctx, `UPDATE user_achievements SET user_id = $1 WHERE user_id = $2
+		AND achievement_id NOT IN (SELECT achievement_id FROM user_achievements WHERE user_id = $1)`, keep.ID, absorb.ID)
+	if err != nil {
+		return nil, err
+	}
+	// Activity adds up day by day; a day either account practiced isn't frozen
+	_, err = tx.ExecContext(ctx, `INSERT INTO user_activity (user_id, day, tests, score, xp, frozen)
+		SELECT $1, day, tests, score, xp, frozen FROM user_activity WHERE user_id = $2
+		ON CONFLICT (user_id, day) DO UPDATE SET tests = user_activity.tests + EXCLUDED.tests,
+			score = user_activity.score + EXCLUDED.score, xp = user_activity.xp + EXCLUDED.xp,
+			frozen = user_activity.frozen AND EXCLUDED.frozen`, keep.ID, absorb.ID)
+	if err != nil {
+		return nil, err
+	}
+	// Leaderboard scores add up like total_score does
+	_, err = tx.ExecContext(ctx, `INSERT INTO leaderboard_scores (board, time_window, period, user_id, score, expires_at)
+		SELECT board, time_window, period, $1, score, expires_at FROM leaderboard_scores WHERE user_id = $2
+		ON CONFLICT (board, time_window, period, user_id) DO UPDATE SET score = leaderboard_scores.score + EXCLUDED.score`,
+		keep.ID, absorb.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if keep.Email == "" && absorb.Email != "" {
+		var verifiedAt sql.NullTime
+		var passwordHash sql.NullString
+		err = tx.QueryRowContext(ctx, "SELECT email_verified_at, password_hash FROM users WHERE id = $1", absorb.ID).
+			Scan(&verifiedAt, &passwordHash)
+		if err != nil {
+			return nil, err
+		}
+		// Free the unique email before assigning it to the kept account
+		_, err = tx.ExecContext(ctx, "UPDATE users SET email = NULL, email_verified_at = NULL, password_hash = NULL WHERE id = $1", absorb.ID)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE users SET email = $1, email_verified_at = $2, password_hash = $3 WHERE id = $4",
+			absorb.Email, verifiedAt, passwordHash, keep.ID)
+		if err != nil {
+			return nil, err
+		}
+		report.EmailMoved = true
+	}
+
+	merged := store.MergeUsers(*keep, *absorb, curve)
+	_, err = tx.ExecContext(ctx, `UPDATE users SET streak = $1, last_active_date = NULLIF($2, '')::date, total_score = $3,
+		level = $4, xp = $5, total_xp = $6, role = $7, is_premium = $8,
+		selected_exam_id = COALESCE(selected_exam_id, (SELECT id FROM exams WHERE slug = $9)), streak_freezes = $10,
+		league_tier = $11, leaderboard_hidden = $12
+		WHERE id = $13`,
+		merged.Streak, merged.LastActiveDate, merged.TotalScore, merged.Level, merged.XP, merged.TotalXP, merged.Role,
+		merged.IsPremium, merged.SelectedExam, merged.StreakFreezes, merged.LeagueTier, merged.LeaderboardHidden, keep.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := syncLeaderboardHidden(ctx, tx, keep.ID); err != nil {
+		return nil, err
+	}
+	// The balance moves through the ledger; the absorbed user's entries cascade away
+	if absorb.Tokens != 0 {
+		err := recordTokensTx(ctx, tx, &models.TokenTransaction{UserID: keep.ID, Amount: absorb.Tokens,
+			Reason: "merge", Reference: absorb.ID}, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if merged.Role != keep.Role {
+		if _, err := tx.ExecContext(ctx, "UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", keep.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Sessions and pending verifications of the absorbed account go with it
+	if _, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", absorb.ID); err != nil {
+		return nil, err
+	}
+	return report, tx.Commit()
+}
@@ -0,0 +1,420 @@
+// Package store defines the persistence interfaces used by the HTTP handlers.
+// The postgres subpackage implements them on top of database/sql and the
+// memory subpackage keeps everything in process for tests.
+package store
+
+import (
+	"backend/internal/models"
+	"backend/internal/progression"
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the requested row does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write would violate a uniqueness rule.
+	ErrConflict = errors.New("conflict")
+	// ErrInsufficientTokens is returned by TokenStore.Record when a debit exceeds the balance.
+	ErrInsufficientTokens = errors.New("insufficient tokens")
+	// ErrTokenReused is returned by SessionStore.Rotate when a refresh token
+	// that was already rotated is presented again. The session is revoked.
+	ErrTokenReused = errors.New("refresh token reused")
+	// ErrDuplicate means an idempotency key was used before.
+	ErrDuplicate = errors.New("duplicate request")
+	// ErrLimitReached is returned by TokenStore.RecordCapped when the cap is used up.
+	ErrLimitReached = errors.New("limit reached")
+)
+
+// Store bundles every repository the server needs.
+type Store struct {
+	Users        UserStore
+	Tests        TestStore
+	Questions    QuestionStore
+	Results      ResultStore
+	Attempts     AttemptStore
+	Subjects     SubjectStore
+	Tokens       TokenStore
+	Credentials  CredentialStore
+	Sessions     SessionStore
+	Identities   IdentityStore
+	Audit        AuditStore
+	Exports      ExportStore
+	Daily        DailyRewardStore
+	Subs         SubscriptionStore
+	Achievements AchievementStore
+	Leagues      LeagueStore
+	Leaderboards LeaderboardStore
+	Activity     ActivityStore
+	Nonces       NonceStore
+}
+
+// TombstoneUserID owns the test results of purged accounts, keeping
+// aggregate statistics intact without tying them to a person.
+const TombstoneUserID = "00000000-0000-0000-0000-000000000000"
+
+// DefaultTimezone is given to users who haven't set one.
+const DefaultTimezone = "Europe/Istanbul"
+
+type UserStore interface {
+	// Get returns the user with its selected exam slug filled in.
+	Get(ctx context.Context, id string) (*models.User, error)
+	GetByNickname(ctx context.Context, nickname string) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	// Create inserts u, filling in defaults (streak 1, level 1, today as last active date).
+	// u.EmailVerified marks an email the caller has already verified, e.g. through a provider.
+	Create(ctx context.Context, u *models.User) error
+	UpdateProfile(ctx context.Context, id, nickname, emoji string) error
+	// AddStreakFreeze gives the user a streak freeze unless they already hold
+	// max (ErrLimitReached). cost, if not nil, is recorded in the same
+	// transaction as with TokenStore.Record, including ErrDuplicate. It
+	// returns the freezes held afterwards.
+	AddStreakFreeze(ctx context.Context, id string, cost *models.TokenTransaction, max int) (int, error)
+	// SetTimezone stores the user's IANA timezone name; callers validate it.
+	SetTimezone(ctx context.Context, id, timezone string) error
+	// SetRole changes the user's role and revokes all of their sessions.
+	SetRole(ctx context.Context, id, role string) error
+	// SelectExam stores the user's exam; ErrNotFound means the exam does not exist.
+	SelectExam(ctx context.Context, id, examSlug string) error
+	// UpdateStreak applies u, logs its frozen days as activity and returns
+	// the streak freezes held afterwards. It fails with ErrConflict if u.Day
+	// is already counted or the user no longer holds enough freezes, which
+	// means a concurrent request got there first.
+	UpdateStreak(ctx context.Context, id string, u StreakUpdate) (int, error)
+	// AddProgress adds gained to the user's lifetime XP and scoreDelta to
+	// total_score, moves level and xp along curve and returns the user
+	// afterwards.
+	AddProgress(ctx context.Context, id string, gained, scoreDelta int, curve progression.Curve) (*models.User, error)
+	// SetTotalXP replaces the user's lifetime XP and sets level and xp from
+	// curve, e.g. when recomputing it from their history.
+	SetTotalXP(ctx context.Context, id string, total int, curve progression.Curve) error
+	// ListIDs returns up to limit user IDs after the given one, in order, to
+	// walk every account in batches. The tombstone is left out.
+	ListIDs(ctx context.Context, after string, limit int) ([]string, error)
+	// Delete removes the user together with their test results and sessions.
+	Delete(ctx context.Context, id string) error
+	// ScheduleDeletion marks the account for purging at purgeAt and revokes
+	// all of its sessions.
+	ScheduleDeletion(ctx context.Context, id string, purgeAt time.Time) error
+	// CancelDeletion clears a scheduled deletion and reports whether there was one.
+	CancelDeletion(ctx context.Context, id string) (bool, error)
+	// DueForDeletion lists up to limit accounts whose deletion is due at now.
+	DueForDeletion(ctx context.Context, now time.Time, limit int) ([]string, error)
+	// Purge moves the user's test results to TombstoneUserID and deletes
+	// the account with everything else that belongs to it.
+	Purge(ctx context.Context, id string) error
+	// TopByScore leaves out the tombstone, accounts scheduled for deletion and
+	// users who opted out of leaderboards.
+	TopByScore(ctx context.Context, limit int) ([]models.LeaderboardEntry, error)
+	// Merge folds the absorbed account into the kept one following
+	// MergeUsers and deletes it. ErrConflict means both accounts have an
+	// identity from the same provider (or they are the same account).
+	Merge(ctx context.Context, keepID, absorbID string, curve progression.Curve) (*MergeReport, error)
+}
+
+// StreakUpdate is the outcome of practicing on Day; see streaks.Advance.
+type StreakUpdate struct {
+	Day    string // YYYY-MM-DD in the user's timezone
+	Streak int
+	// Frozen are the missed days kept in the streak, each using up a freeze.
+	Frozen []string
+	// EarnFreeze gives the user a freeze unless they then hold MaxFreezes.
+	EarnFreeze bool
+	MaxFreezes int
+}
+
+// MergeReport describes what Merge moved into the kept account.
+type MergeReport struct {
+	ResultsMoved    int  `json:"results_moved"`
+	IdentitiesMoved int  `json:"identities_moved"`
+	TokensAdded     int  `json:"tokens_added"`
+	XPAdded         int  `json:"xp_added"`
+	EmailMoved      bool `json:"email_moved"`
+}
+
+// TestFilter narrows TestStore.List. Empty fields don't filter; Category
+// matches either the display name or the slug.
+type TestFilter struct {
+	UserID   string
+	Category string
+	Exam     string
+}
+
+type TestStore interface {
+	List(ctx context.Context, f TestFilter) ([]models.Test, error)
+	Get(ctx context.Context, id string) (*models.Test, error)
+	GetByTitle(ctx context.Context, title string) (*models.Test, error)
+	Create(ctx context.Context, t *models.Test) error
+	// RandomUnsolved picks a test the user hasn't taken, or any test once all are solved.
+	RandomUnsolved(ctx context.Context, userID, exam string) (*models.Test, error)
+	CategoryNames(ctx context.Context, exam string) ([]string, error)
+	CategoryProgress(ctx context.Context, userID, exam string) ([]models.CategoryProgress, error)
+	Exams(ctx context.Context) ([]models.Exam, error)
+	// ExamTaxonomy returns the category -> subject -> topic tree of an exam.
+	ExamTaxonomy(ctx context.Context, examSlug string) ([]models.ExamCategory, error)
+	Count(ctx context.Context) (int, error)
+}
+
+type QuestionStore interface {
+	// List returns up to limit active questions.
+	List(ctx context.Context, limit int) ([]models.Question, error)
+	ListByTest(ctx context.Context, testID string) ([]models.Question, error)
+	Get(ctx context.Context, id string) (*models.Question, error)
+	ExistsByQuestionID(ctx context.Context, questionID string) (bool, error)
+	// Create inserts q and links it to the normalized taxonomy of its test's exam.
+	Create(ctx context.Context, q *models.Question) error
+	Update(ctx context.Context, q *models.Question) error
+	Delete(ctx context.Context, id string) error
+	Count(ctx context.Context) (int, error)
+}
+
+type ResultStore interface {
+	Create(ctx context.Context, r *models.TestResult) error
+	// BestScore returns the user's best score on the test, or ErrNotFound
+	// if they haven't taken it.
+	BestScore(ctx context.Context, userID, testID string) (int, error)
+	History(ctx context.Context, userID string) ([]models.HistoryEntry, error)
+	// ListForUser returns every result of the user, oldest first, with the
+	// test title filled in where the test still exists.
+	ListForUser(ctx context.Context, userID string) ([]models.TestResult, error)
+	Count(ctx context.Context) (int, error)
+	CountForUser(ctx context.Context, userID string) (int, error)
+}
+
+type AttemptStore interface {
+	// Start opens a, filling in its ID and start time.
+	Start(ctx context.Context, a *models.TestAttempt) error
+	// Get returns the attempt with its answers in the order they were given.
+	Get(ctx context.Context, id string) (*models.TestAttempt, error)
+	// Answer records the answer to one question of an open attempt. Each
+	// question is answered once (ErrDuplicate); a submitted attempt takes
+	// no more answers (ErrConflict).
+	Answer(ctx context.Context, attemptID string, a models.AttemptAnswer) error
+	// Submit closes an open attempt and returns it with its answers. It
+	// fails with ErrConflict if the attempt was submitted before.
+	Submit(ctx context.Context, id string) (*models.TestAttempt, error)
+}
+
+type SubjectStore interface {
+	// List returns subjects with their related titles. Empty filters match everything.
+	List(ctx context.Context, category, exam string) ([]models.Subject, error)
+}
+
+type TokenStore interface {
+	Balance(ctx context.Context, userID string) (int, error)
+	// Record adds t to the ledger and updates the cached balance atomically,
+	// filling in its ID, balance and time. A debit larger than the balance
+	// fails with ErrInsufficientTokens. If the user already recorded an
+	// entry with t's idempotency key, nothing changes: t is filled with
+	// that entry and ErrDuplicate is returned.
+	Record(ctx context.Context, t *models.TokenTransaction) error
+	// RecordCapped is Record for rewards with a quota: it fails with
+	// ErrLimitReached when the user already has max entries with t's reason
+	// since since. Duplicates are reported before the cap is checked.
+	RecordCapped(ctx context.Context, t *models.TokenTransaction, since time.Time, max int) error
+	// History returns the user's entries created before before (any time if
+	// zero), newest first.
+	History(ctx context.Context, userID string, before time.Time, limit int) ([]models.TokenTransaction, error)
+	// Reconcile lists users whose cached balance differs from their ledger.
+	Reconcile(ctx context.Context) ([]models.TokenDrift, error)
+}
+
+// Credentials are the secrets a local account signs in with. Only hashes are stored.
+type Credentials struct {
+	UserID           string
+	DeviceSecretHash string
+	Email            string
+	PasswordHash     string
+	EmailVerified    bool
+}
+
+type CredentialStore interface {
+	Get(ctx context.Context, userID string) (*Credentials, error)
+	// GetByEmail matches the email case-insensitively.
+	GetByEmail(ctx context.Context, email string) (*Credentials, error)
+	SetDeviceSecret(ctx context.Context, userID, secretHash string) error
+	// SetPassword sets the account email and password. Changing the email
+	// clears its verification; ErrConflict means another account owns it.
+	SetPassword(ctx context.Context, userID, email, passwordHash string) error
+	AddEmailVerification(ctx context.Context, userID, email, tokenHash string, expiresAt time.Time) error
+	// VerifyEmail consumes a verification token and marks the email verified,
+	// returning the user ID. ErrNotFound covers unknown, expired and stale
+	// tokens (the account email changed since the token was sent).
+	VerifyEmail(ctx context.Context, tokenHash string, now time.Time) (string, error)
+}
+
+type SessionStore interface {
+	// Create stores a new session; tokenHash is the hash of its first refresh token.
+	Create(ctx context.Context, s *models.Session, tokenHash string) error
+	// Rotate consumes the refresh token hashing to tokenHash, replaces it with
+	// newHash and moves the session's expiry to expiresAt. ErrNotFound covers
+	// unknown tokens and expired or revoked sessions; ErrTokenReused means the
+	// token was already rotated, and the session has been revoked.
+	Rotate(ctx context.Context, tokenHash, newHash string, now, expiresAt time.Time) (*models.Session, error)
+	// List returns the user's active sessions, most recently used first.
+	List(ctx context.Context, userID string, now time.Time) ([]models.Session, error)
+	// Revoke ends one of the user's sessions.
+	Revoke(ctx context.Context, userID, sessionID string) error
+	// RevokeAll ends every session of the user and returns how many were active.
+	RevokeAll(ctx context.Context, userID string) (int, error)
+}
+
+type IdentityStore interface {
+	// Get returns the identity with the provider's subject.
+	Get(ctx context.Context, provider, subject string) (*models.Identity, error)
+	List(ctx context.Context, userID string) ([]models.Identity, error)
+	// Link attaches an identity to id.UserID. ErrConflict means the identity
+	// belongs to another account or the user already has one from the provider.
+	Link(ctx context.Context, id *models.Identity) error
+	Unlink(ctx context.Context, userID, provider string) error
+}
+
+// AuditFilter narrows AuditStore.List. Empty fields don't filter; Before
+// pages backwards through older entries.
+type AuditFilter struct {
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     time.Time
+	Limit      int
+}
+
+// AuditStore is append-only: entries are never updated or deleted.
+type AuditStore interface {
+	Append(ctx context.Context, e *models.AuditEntry) error
+	// List returns matching entries, newest first.
+	List(ctx context.Context, f AuditFilter) ([]models.AuditEntry, error)
+}
+
+// ExportStore tracks background personal data exports.
+type ExportStore interface {
+	Create(ctx context.Context, e *models.DataExport) error
+	Get(ctx context.Context, userID, id string) (*models.DataExport, error)
+	// Pending returns the user's newest pending export created after since,
+	// or ErrNotFound. Older pending rows are from a crashed worker.
+	Pending(ctx context.Context, userID string, since time.Time) (*models.DataExport, error)
+	Finish(ctx context.Context, id string, archive []byte, expiresAt time.Time) error
+	Fail(ctx context.Context, id, reason string) error
+	// Archive returns a ready export's archive, or ErrNotFound once it expired.
+	Archive(ctx context.Context, userID, id string, now time.Time) ([]byte, error)
+	// DeleteExpired removes exports whose archive expired before now.
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+// DailyRewardStore keeps the daily login reward claims.
+type DailyRewardStore interface {
+	// Last returns the user's latest claim, or ErrNotFound.
+	Last(ctx context.Context, userID string) (*models.DailyRewardClaim, error)
+	// Claim stores c and credits Tokens+Bonus to the ledger in one
+	// transaction, filling in its transaction ID and time. It fails with
+	// ErrDuplicate if the user already claimed on c.Day or a later day.
+	Claim(ctx context.Context, c *models.DailyRewardClaim) error
+}
+
+type AchievementStore interface {
+	// Stats counts the user's completed tests, perfect scores (see
+	// PointsPerQuestion), and answered questions.
+	// Retired questions don't count.
+	Stats(ctx context.Context, userID string) (*models.AchievementStats, error)
+	// List returns the user's achievements, oldest first.
+	List(ctx context.Context, userID string) ([]models.UserAchievement, error)
+	// Award stores a and credits its XP (moving the level along curve) and
+	// tokens in one transaction, filling in its time. It fails with
+	// ErrDuplicate if the user already earned the achievement.
+	Award(ctx context.Context, a *models.UserAchievement, curve progression.Curve) error
+}
+
+type LeagueStore interface {
+	// AddXP adds m.XP to the user's membership for m.Week. A user without
+	// one joins an open group of their tier and band for that week, or a new
+	// group if every open one has maxSize members. m is filled with the
+	// membership afterwards.
+	AddXP(ctx context.Context, m *models.LeagueMembership, band, maxSize int) error
+	// Membership returns the user's membership for week, or ErrNotFound.
+	Membership(ctx context.Context, userID, week string) (*models.LeagueMembership, error)
+	// Standings returns the members of a group, most XP first; ties go to
+	// whoever joined first.
+	Standings(ctx context.Context, groupID string) ([]models.LeagueStanding, error)
+	// History returns the user's memberships of closed weeks, newest first.
+	History(ctx context.Context, userID string, limit int) ([]models.LeagueMembership, error)
+	// Unclosed returns groups of weeks before week that haven't been closed.
+	Unclosed(ctx context.Context, week string, limit int) ([]models.LeagueGroup, error)
+	// Close records the final ranks of a group and moves its members to
+	// their new tiers in one transaction. It fails with ErrConflict if the
+	// group was already closed.
+	Close(ctx context.Context, groupID string, results []models.LeagueResult) error
+}
+
+// LeaderboardStore keeps a running score per user for every board period,
+// so rankings never have to sum test results. Users who are hidden or
+// scheduled for deletion are left out of every ranking.
+type LeaderboardStore interface {
+	// Add adds score to the user's entry in each period, creating entries
+	// as needed.
+	Add(ctx context.Context, userID string, score int, periods []models.BoardPeriod) error
+	// Top returns the entries of a period from offset on, best first, with
+	// ranks filled in. Ties are broken by user ID, so ranks are stable.
+	Top(ctx context.Context, p models.BoardPeriod, offset, limit int) ([]models.LeaderboardEntry, error)
+	// Count returns how many users are ranked in a period.
+	Count(ctx context.Context, p models.BoardPeriod) (int, error)
+	// Rank returns the user's entry in a period, or ErrNotFound if they
+	// have none or are left out.
+	Rank(ctx context.Context, p models.BoardPeriod, userID string) (*models.LeaderboardEntry, error)
+	// Around returns the user's entry in a period with up to n entries on
+	// either side, best first, or ErrNotFound like Rank. Ranks are not
+	// filled in: it walks the ranking from the user without counting the
+	// entries before them.
+	Around(ctx context.Context, p models.BoardPeriod, userID string, n int) ([]models.LeaderboardEntry, error)
+	// Scores returns every ranked user of a period with their score and
+	// nothing else, in no particular order.
+	Scores(ctx context.Context, p models.BoardPeriod) ([]models.LeaderboardEntry, error)
+	// SetHidden sets the user's leaderboard opt-out.
+	SetHidden(ctx context.Context, userID string, hidden bool) error
+	// Prune deletes the entries of periods that ended before now and
+	// returns how many it deleted.
+	Prune(ctx context.Context, now time.Time) (int, error)
+}
+
+// ActivityStore keeps a log of the days each user practiced, in their
+// timezone, for the streak calendar.
+type ActivityStore interface {
+	// Record adds a's counts to the user's activity on a.Day.
+	Record(ctx context.Context, a *models.DailyActivity) error
+	// List returns the user's activity from one day to another, both
+	// included, oldest first. Days without activity are left out.
+	List(ctx context.Context, userID, from, to string) ([]models.DailyActivity, error)
+}
+
+// SubscriptionStore keeps store subscriptions and the premium status they grant.
+type SubscriptionStore interface {
+	// Upsert stores s by platform and external ID, filling in its ID and
+	// times. It fails with ErrConflict if the purchase belongs to another user.
+	Upsert(ctx context.Context, s *models.Subscription) error
+	GetByExternalID(ctx context.Context, platform, externalID string) (*models.Subscription, error)
+	ListForUser(ctx context.Context, userID string) ([]models.Subscription, error)
+	// SyncEntitlement sets the user's premium flag from their subscriptions
+	// (see Entitled) and moves the role between free and pro to match.
+	// Other roles are left alone. It returns whether the user is premium.
+	SyncEntitlement(ctx context.Context, userID string, now time.Time) (bool, error)
+	// Stale returns active or grace subscriptions that expired before now and
+	// weren't updated since updatedBefore, so they can be checked with the store.
+	Stale(ctx context.Context, now, updatedBefore time.Time, limit int) ([]models.Subscription, error)
+	// Lapsed returns premium users who have subscriptions but none that
+	// entitles them at now.
+	Lapsed(ctx context.Context, now time.Time, limit int) ([]string, error)
+}
+
+// NonceStore keeps single-use values the server hands out, such as sign-in
+// nonces and confirmation token IDs, until they are used or expire.
+type NonceStore interface {
+	// Issue stores value for purpose until expiresAt. ErrConflict means it
+	// was issued already.
+	Issue(ctx context.Context, purpose, value string, expiresAt time.Time) error
+	// Consume uses up an issued value. ErrNotFound covers unknown, used and
+	// expired values.
+	Consume(ctx context.Context, purpose, value string, now time.Time) error
+	// Prune removes values that expired before now.
+	Prune(ctx context.Context, now time.Time) (int, error)
+}
@@ -0,0 +1,20 @@
+package store
+
+import (
+	"backend/internal/models"
+	"time"
+)
+
+// Entitled reports whether s grants premium at now.
+func Entitled(s models.Subscription, now time.Time) bool {
+	switch s.Status {
+	case models.SubscriptionActive:
+		return now.Before(s.ExpiresAt)
+	case models.SubscriptionGrace:
+		if s.GraceExpiresAt != nil {
+			return now.Before(*s.GraceExpiresAt)
+		}
+		return now.Before(s.ExpiresAt)
+	}
+	return false
+}
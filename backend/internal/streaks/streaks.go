@@ -0,0 +1,50 @@
+// Package streaks holds the rules of practice streaks. A streak counts the
+// consecutive days, in the user's timezone, on which they finished a test.
+// A missed day breaks it unless the user holds a streak freeze, which is
+// used up in the day's place when they next practice. Freezes are bought in
+// the shop or earned every EarnEvery days of streak.
+package streaks
+
+import "backend/internal/days"
+
+// EarnEvery is how many days of streak earn a streak freeze.
+const EarnEvery = 7
+
+// Advance returns the streak after practicing on today, given the last
+// practice day and the streak and freezes held before it, along with the
+// missed days that freezes cover. Missed days are only covered when there
+// are enough freezes for all of them; otherwise the streak starts over and
+// the freezes are kept. Days are YYYY-MM-DD.
+func Advance(lastDay string, streak, freezes int, today string) (int, []string) {
+	missed, ok := days.Between(lastDay, today)
+	switch {
+	case !ok || streak <= 0:
+		return 1, nil
+	case missed < 0:
+		// Already counted, or the user moved to a timezone behind the last one
+		return streak, nil
+	case missed > freezes:
+		return 1, nil
+	}
+	frozen := make([]string, 0, missed)
+	for i := 1; i <= missed; i++ {
+		frozen = append(frozen, days.Add(lastDay, i))
+	}
+	return streak + 1, frozen
+}
+
+// Current returns the streak as it stands on today: still alive if the
+// user practiced today or yesterday, or holds enough freezes for the days
+// missed since, and 0 otherwise.
+func Current(lastDay string, streak, freezes int, today string) int {
+	missed, ok := days.Between(lastDay, today)
+	if !ok || missed > freezes {
+		return 0
+	}
+	return streak
+}
+
+// EarnsFreeze reports whether reaching streak earns a streak freeze.
+func EarnsFreeze(streak int) bool {
+	return streak > 0 && streak%EarnEvery == 0
+}
@@ -0,0 +1,49 @@
+package streaks_test
+
+import (
+	"backend/internal/streaks"
+	"slices"
+	"testing"
+)
+
+func TestAdvance(t *testing.T) {
+	cases := []struct {
+		name            string
+		lastDay, today  string
+		streak, freezes int
+		want            int
+		frozen          []string
+	}{
+		{"same day", "2026-10-19", "2026-10-19", 4, 0, 4, nil},
+		{"next day", "2026-10-18", "2026-10-19", 4, 0, 5, nil},
+		{"missed a day", "2026-10-17", "2026-10-19", 4, 0, 1, nil},
+		{"frozen day", "2026-10-17", "2026-10-19", 4, 1, 5, []string{"2026-10-18"}},
+		{"frozen across a month", "2026-09-29", "2026-10-02", 4, 2, 5, []string{"2026-09-30", "2026-10-01"}},
+		{"too few freezes", "2026-10-15", "2026-10-19", 4, 2, 1, nil},
+		{"timezone moved back", "2026-10-20", "2026-10-19", 4, 0, 4, nil},
+		{"no streak yet", "2026-10-18", "2026-10-19", 0, 0, 1, nil},
+		{"never active", "", "2026-10-19", 0, 2, 1, nil},
+	}
+	for _, c := range cases {
+		got, frozen := streaks.Advance(c.lastDay, c.streak, c.freezes, c.today)
+		if got != c.want || !slices.Equal(frozen, c.frozen) {
+			t.Errorf("%s: Advance = %d, %v, want %d, %v", c.name, got, frozen, c.want, c.frozen)
+		}
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	today := "2026-10-19"
+	if got := streaks.Current("2026-10-18", 6, 0, today); got != 6 {
+		t.Errorf("a streak from yesterday is alive, got %d", got)
+	}
+	if got := streaks.Current("2026-10-16", 6, 1, today); got != 0 {
+		t.Errorf("two missed days with one freeze break the streak, got %d", got)
+	}
+	if got := streaks.Current("2026-10-16", 6, 2, today); got != 6 {
+		t.Errorf("two freezes cover two missed days, got %d", got)
+	}
+	if !streaks.EarnsFreeze(14) || streaks.EarnsFreeze(13) || streaks.EarnsFreeze(0) {
+		t.Error("freezes are earned every 7 days of streak")
+	}
+}
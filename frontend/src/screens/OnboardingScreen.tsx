@@ -3,6 +3,7 @@ import { View, Text, StyleSheet, TextInput, TouchableOpacity, Alert, Platform, S
 import { SafeAreaView } from 'react-native-safe-area-context';
 import AsyncStorage from '@react-native-async-storage/async-storage';
 import * as AppleAuthentication from 'expo-apple-authentication';
+import * as Crypto from 'expo-crypto';
 import { Ionicons } from '@expo/vector-icons';
 
 const COLORS = {
@@ -33,16 +34,24 @@ export default function OnboardingScreen({ navigation, route }: any) {
             let userData: any = null;
 
             if (provider === 'apple') {
+                // The backend issues single-use nonces; Apple embeds the SHA-256 of it in the identity token
+                const nonceRes = await fetch(`${API_URL}/auth/nonce`, { method: 'POST' });
+                if (!nonceRes.ok) {
+                    throw new Error(`nonce ${nonceRes.status}`);
+                }
+                const { nonce: rawNonce } = await nonceRes.json();
+                const hashedNonce = await Crypto.digestStringAsync(Crypto.CryptoDigestAlgorithm.SHA256, rawNonce);
                 const credential = await AppleAuthentication.signInAsync({
                     requestedScopes: [
                         AppleAuthentication.AppleAuthenticationScope.FULL_NAME,
                         AppleAuthentication.AppleAuthenticationScope.EMAIL,
                     ],
+                    nonce: hashedNonce,
                 });
                 userData = {
-                    email: credential.email,
+                    id_token: credential.identityToken,
+                    nonce: rawNonce,
                     nickname: credential.fullName?.givenName || '',
-                    oauth_id: credential.user,
                     provider: 'apple',
                     emoji: 'apple'
                 };
@@ -63,7 +63,9 @@ export default function ProfileScreen({ navigation, onLogout }: any) {
             }
 
             // Fetch History
-            const histRes = await fetch(`${baseUrl}/user/history/${userId}?t=${timestamp}`);
+            const histRes = await fetch(`${baseUrl}/user/history/${userId}?t=${timestamp}`, {
+                headers: { 'Authorization': `Bearer ${token}` }
+            });
             if (histRes.ok) {
                 const histData = await histRes.json();
                 setHistory(histData || []);
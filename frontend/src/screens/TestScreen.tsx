@@ -1,5 +1,5 @@
 import { StatusBar } from 'expo-status-bar';
-import { useEffect, useState } from 'react';
+import { useEffect, useRef, useState } from 'react';
 import { StyleSheet, Text, View, ActivityIndicator, TouchableOpacity, Dimensions, Platform, ScrollView, Alert } from 'react-native';
 import { SafeAreaView } from 'react-native-safe-area-context';
 import { Ionicons } from '@expo/vector-icons';
@@ -26,7 +26,6 @@ const EXAM_DURATION_MINUTES = 2; // Increased slightly
 
 interface QuestionOption {
     option_text: string;
-    is_correct: boolean;
 }
 
 interface Question {
@@ -35,10 +34,6 @@ interface Question {
     category: string;
     options: QuestionOption[];
     difficulty: string;
-    solution?: {
-        explanation_text: string;
-        video_solution_url?: string;
-    };
 }
 
 export default function TestScreen({ route, navigation }: any) {
@@ -48,6 +43,10 @@ export default function TestScreen({ route, navigation }: any) {
     const [loading, setLoading] = useState(true);
     const [currentIndex, setCurrentIndex] = useState(0);
     const [selectedAnswers, setSelectedAnswers] = useState<{ [key: string]: string }>({}); // Key is string UUID
+    // The server only reveals the correct options once the attempt is submitted
+    const [correctAnswers, setCorrectAnswers] = useState<{ [key: string]: string }>({});
+    // A ref, since the timer submits from the closure it was started with
+    const attemptId = useRef<string | null>(null);
     const [score, setScore] = useState(0);
     const [timeLeft, setTimeLeft] = useState<number | null>(null);
     const [isTimeUp, setIsTimeUp] = useState(false);
@@ -140,25 +139,46 @@ export default function TestScreen({ route, navigation }: any) {
             });
     }, [resetKey, testId]);
 
-    const handleAnswer = (option: QuestionOption) => {
+    // Answers are recorded against an attempt so they can be graded on submit
+    useEffect(() => {
+        attemptId.current = null;
+        if (!testId) return;
+
+        ApiClient.post('/api/v1/tests/attempts', { test_id: testId })
+            .then((res) => (res.ok ? res.json() : null))
+            .then((data) => {
+                if (data) attemptId.current = data.attempt_id;
+            })
+            .catch((error) => console.error('Error starting attempt:', error));
+    }, [resetKey, testId]);
+
+    const handleAnswer = async (option: QuestionOption) => {
         const currentQuestion = questions[currentIndex];
         if (selectedAnswers[currentQuestion.id]) return;
 
-        if (option.is_correct) {
-            setScore(score + 2);
+        setSelectedAnswers(prev => ({
+            ...prev,
+            [currentQuestion.id]: option.option_text,
+        }));
 
-            // Auto-advance to next question after a short delay
-            if (currentIndex < questions.length - 1) {
-                setTimeout(() => {
-                    setCurrentIndex(prev => prev + 1);
-                }, 250);
+        if (attemptId.current) {
+            try {
+                await ApiClient.post('/api/v1/questions/answer', {
+                    attempt_id: attemptId.current,
+                    question_id: currentQuestion.id,
+                    option_text: option.option_text,
+                });
+            } catch (error) {
+                console.error('Error recording answer:', error);
             }
         }
 
-        setSelectedAnswers({
-            ...selectedAnswers,
-            [currentQuestion.id]: option.option_text,
-        });
+        // Auto-advance to next question after a short delay
+        if (currentIndex < questions.length - 1) {
+            setTimeout(() => {
+                setCurrentIndex(prev => prev + 1);
+            }, 250);
+        }
     };
 
     const handleNext = () => {
@@ -176,16 +196,24 @@ export default function TestScreen({ route, navigation }: any) {
     const getOptionStyle = (option: QuestionOption) => {
         const currentQuestion = questions[currentIndex];
         const selectedText = selectedAnswers[currentQuestion.id];
+        const isCorrect = option.option_text === correctAnswers[currentQuestion.id];
 
         if (!selectedText) return styles.optionButton;
 
+        // Grades are only known after submitting
+        if (correctAnswers[currentQuestion.id] === undefined) {
+            return option.option_text === selectedText
+                ? [styles.optionButton, styles.optionSelected]
+                : [styles.optionButton, styles.optionDisabled];
+        }
+
         if (option.option_text === selectedText) {
-            return option.is_correct
+            return isCorrect
                 ? [styles.optionButton, styles.optionCorrect]
                 : [styles.optionButton, styles.optionWrong];
         }
 
-        if (selectedText && option.is_correct) {
+        if (selectedText && isCorrect) {
             return [styles.optionButton, styles.optionCorrect];
         }
 
@@ -212,12 +240,21 @@ export default function TestScreen({ route, navigation }: any) {
         try {
             const res = await ApiClient.post('/submit-test', {
                 test_id: testId,
+                attempt_id: attemptId.current,
                 score: score
             });
 
             if (res.ok) {
                 const data = await res.json();
                 setSubmitResult(data);
+                setScore(data.score || 0);
+                if (Array.isArray(data.answers)) {
+                    const graded: { [key: string]: string } = {};
+                    data.answers.forEach((a: any) => {
+                        graded[a.question_id] = a.correct_option;
+                    });
+                    setCorrectAnswers(graded);
+                }
                 if (data.leveled_up) {
                     Alert.alert('TEBRİKLER! 🎉', `Seviye Atladın! Yeni Seviyen: ${data.new_level}`);
                 }
@@ -245,6 +282,7 @@ export default function TestScreen({ route, navigation }: any) {
         setScore(0);
         setCurrentIndex(0);
         setSelectedAnswers({});
+        setCorrectAnswers({});
         setQuestions(shuffleArray([...questions]));
 
         const timerKey = `TIMER_END_TIME_${testId || 'default'}`;
@@ -271,10 +309,7 @@ export default function TestScreen({ route, navigation }: any) {
 
     if (isTimeUp || isExamFinished) {
         const correctCount = Object.keys(selectedAnswers).filter((key) => {
-            const question = questions.find(q => q.id === key);
-            const selectedOptionText = selectedAnswers[key];
-            const correctOption = question?.options.find(opt => opt.is_correct);
-            return correctOption && correctOption.option_text === selectedOptionText;
+            return correctAnswers[key] !== undefined && correctAnswers[key] === selectedAnswers[key];
         }).length;
 
         const wrongCount = Object.keys(selectedAnswers).length - correctCount;
@@ -407,9 +442,9 @@ export default function TestScreen({ route, navigation }: any) {
                                 activeOpacity={0.8}
                             >
                                 <Text style={styles.optionText}>{option.option_text}</Text>
-                                {selectedAnswers[currentQuestion.id] === option.option_text && (
+                                {selectedAnswers[currentQuestion.id] === option.option_text && correctAnswers[currentQuestion.id] !== undefined && (
                                     <Ionicons
-                                        name={option.is_correct ? "checkmark-circle" : "close-circle"}
+                                        name={option.option_text === correctAnswers[currentQuestion.id] ? "checkmark-circle" : "close-circle"}
                                         size={24}
                                         color="white"
                                     />
@@ -432,8 +467,8 @@ export default function TestScreen({ route, navigation }: any) {
                 </TouchableOpacity>
 
                 <View style={styles.scoreContainer}>
-                    <Text style={styles.scoreLabel}>Puan</Text>
-                    <Text style={styles.scoreValue}>{score}</Text>
+                    <Text style={styles.scoreLabel}>Cevap</Text>
+                    <Text style={styles.scoreValue}>{Object.keys(selectedAnswers).length}/{questions.length}</Text>
                 </View>
 
                 {currentIndex === questions.length - 1 ? (
@@ -574,6 +609,9 @@ const styles = StyleSheet.create({
         backgroundColor: COLORS.success,
         borderColor: COLORS.success,
     },
+    optionSelected: {
+        borderColor: COLORS.primary,
+    },
     optionWrong: {
         backgroundColor: COLORS.error,
         borderColor: COLORS.error,
@@ -23,7 +23,7 @@ class TokenManager {
     const token = await AsyncStorage.getItem('AUTH_TOKEN');
     if (!token) return null;
 
-    // Check if token is expired or about to expire (within 1 hour)
+    // Check if token is expired or about to expire (within 1 minute)
     if (this.isTokenExpiringSoon(token)) {
       return await this.refreshToken();
     }
@@ -36,9 +36,9 @@ class TokenManager {
       const payload = JSON.parse(atob(token.split('.')[1]));
       const exp = payload.exp * 1000; // Convert to milliseconds
       const now = Date.now();
-      const oneHour = 60 * 60 * 1000;
-      
-      return exp - now < oneHour; // Token expires within 1 hour
+      const oneMinute = 60 * 1000;
+
+      return exp - now < oneMinute; // Access tokens only live 15 minutes
     } catch (error) {
       console.error('Error parsing token:', error);
       return true; // If we can't parse, assume it's expired